@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -15,6 +16,10 @@ import (
 )
 
 func main() {
+	migrateOnly := flag.Bool("migrate-only", false, "apply pending schema migrations and exit")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "list pending schema migrations without applying them and exit")
+	flag.Parse()
+
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("load config: %v", err)
@@ -26,11 +31,35 @@ func main() {
 	}
 	defer database.Close()
 
-	handler := httpapi.NewRouter(cfg, database)
+	if *migrateDryRun {
+		pending, err := db.PendingMigrations(context.Background(), database)
+		if err != nil {
+			log.Fatalf("list pending migrations: %v", err)
+		}
+		log.Printf("pending schema migrations: %d", len(pending))
+		for _, migration := range pending {
+			log.Printf("-> %s", migration.Name)
+		}
+		return
+	}
+
+	applied, err := db.Migrate(context.Background(), database)
+	if err != nil {
+		log.Fatalf("migrate db: %v", err)
+	}
+	log.Printf("schema migrations applied: %d", len(applied))
+	if *migrateOnly {
+		return
+	}
+
+	router, err := httpapi.NewRouter(cfg, database)
+	if err != nil {
+		log.Fatalf("build router: %v", err)
+	}
 
 	srv := &http.Server{
 		Addr:         cfg.ListenAddress(),
-		Handler:      handler,
+		Handler:      router,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 130 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -47,6 +76,12 @@ func main() {
 	defer stop()
 	<-ctx.Done()
 
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), time.Duration(cfg.GenerationDrainSeconds)*time.Second)
+	defer cancelDrain()
+	if err := router.Shutdown(drainCtx); err != nil {
+		log.Printf("generation drain incomplete, interrupted in-flight generations: %v", err)
+	}
+
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(shutdownCtx); err != nil {
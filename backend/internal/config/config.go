@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +19,9 @@ const (
 	defaultDeepReasoningEffort = "high"
 	defaultOpenRouterBaseURL   = "https://openrouter.ai/api/v1"
 	defaultBraveBaseURL        = "https://api.search.brave.com/res/v1"
+	defaultTavilyBaseURL       = "https://api.tavily.com"
+	defaultSearchProvider      = "brave"
+	defaultBraveMinIntervalMS  = 1100
 	defaultFrontendOrigin      = "https://chat.sanetomore.com"
 	defaultUploadDir           = "/tmp/chat-uploads"
 	defaultGCSUploadPrefix     = "chat-uploads"
@@ -33,6 +37,17 @@ const (
 	defaultDeepMaxSearchQ      = 18
 	defaultChatMaxCitations    = 8
 	defaultDeepMaxCitations    = 12
+	defaultReadConcurrency     = 4
+	defaultPerHostReadConc     = 2
+	defaultHostIntervalMS      = 1000
+	defaultHostMaxConc         = 2
+	defaultRobotsTTLSecs       = 3600
+	defaultGenerationDrainSecs = 8
+	defaultResearchCache       = "memory"
+	defaultSearchCacheTTLSecs  = 3600
+	defaultPageCacheTTLSecs    = 21600
+	defaultFreshCacheTTLSecs   = 300
+	defaultResearchCacheBytes  = 64 << 20
 )
 
 type Config struct {
@@ -53,11 +68,24 @@ type Config struct {
 	OpenRouterAPIKey           string
 	OpenRouterBaseURL          string
 	OpenRouterDefaultModel     string
+	OpenRouterFallbackModels   []string
+	ConversationTitleModel     string
+	HistorySummaryModel        string
 	DefaultChatReasoningEffort string
 	DefaultDeepReasoningEffort string
 	BraveAPIKey                string
 	BraveBaseURL               string
+	BraveMinIntervalMS         int
+	SearchProviders            []string
+	SearXNGBaseURL             string
+	SearXNGAPIKey              string
+	SearXNGMinIntervalMS       int
+	TavilyAPIKey               string
+	TavilyBaseURL              string
+	TavilyMinIntervalMS        int
+	SearchFixturePath          string
 	LocalUploadDir             string
+	LocalUploadFsync           bool
 	GCSUploadBucket            string
 	GCSUploadPrefix            string
 	DeepResearchTimeoutSeconds int
@@ -74,6 +102,17 @@ type Config struct {
 	ResearchSourceMaxBytes     int
 	ResearchMaxCitationsChat   int
 	ResearchMaxCitationsDeep   int
+	ResearchReadConcurrency    int
+	ResearchReadPerHostConc    int
+	ResearchHostIntervalMS     int
+	ResearchHostMaxConc        int
+	ResearchRobotsTTLSecs      int
+	GenerationDrainSeconds     int
+	ResearchCache              string
+	ResearchSearchCacheTTLSecs int
+	ResearchPageCacheTTLSecs   int
+	ResearchFreshCacheTTLSecs  int
+	ResearchCacheMaxBytes      int
 }
 
 func (c Config) ListenAddress() string {
@@ -96,11 +135,24 @@ func Load() (Config, error) {
 		OpenRouterAPIKey:           strings.TrimSpace(os.Getenv("OPENROUTER_API_KEY")),
 		OpenRouterBaseURL:          envOrDefault("OPENROUTER_API_BASE_URL", defaultOpenRouterBaseURL),
 		OpenRouterDefaultModel:     envOrDefault("OPENROUTER_FREE_TIER_DEFAULT_MODEL", defaultDefaultModel),
+		OpenRouterFallbackModels:   parseList(os.Getenv("OPENROUTER_FALLBACK_MODELS")),
+		ConversationTitleModel:     strings.TrimSpace(os.Getenv("CONVERSATION_TITLE_MODEL")),
+		HistorySummaryModel:        strings.TrimSpace(os.Getenv("HISTORY_SUMMARY_MODEL")),
 		DefaultChatReasoningEffort: strings.ToLower(envOrDefault("DEFAULT_CHAT_REASONING_EFFORT", defaultChatReasoningEffort)),
 		DefaultDeepReasoningEffort: strings.ToLower(envOrDefault("DEFAULT_DEEP_RESEARCH_REASONING_EFFORT", defaultDeepReasoningEffort)),
 		BraveAPIKey:                strings.TrimSpace(os.Getenv("BRAVE_API_KEY")),
 		BraveBaseURL:               envOrDefault("BRAVE_API_BASE_URL", defaultBraveBaseURL),
+		BraveMinIntervalMS:         intOrDefault("BRAVE_MIN_INTERVAL_MS", defaultBraveMinIntervalMS),
+		SearchProviders:            parseProviderList(envOrDefault("SEARCH_PROVIDER", defaultSearchProvider)),
+		SearXNGBaseURL:             strings.TrimSpace(os.Getenv("SEARXNG_BASE_URL")),
+		SearXNGAPIKey:              strings.TrimSpace(os.Getenv("SEARXNG_API_KEY")),
+		SearXNGMinIntervalMS:       intOrDefault("SEARXNG_MIN_INTERVAL_MS", 0),
+		TavilyAPIKey:               strings.TrimSpace(os.Getenv("TAVILY_API_KEY")),
+		TavilyBaseURL:              envOrDefault("TAVILY_API_BASE_URL", defaultTavilyBaseURL),
+		TavilyMinIntervalMS:        intOrDefault("TAVILY_MIN_INTERVAL_MS", 0),
+		SearchFixturePath:          strings.TrimSpace(os.Getenv("SEARCH_STATIC_FIXTURE_PATH")),
 		LocalUploadDir:             envOrDefault("LOCAL_UPLOAD_DIR", defaultUploadDir),
+		LocalUploadFsync:           boolOrDefault("LOCAL_UPLOAD_FSYNC", true),
 		GCSUploadBucket:            strings.TrimSpace(os.Getenv("GCS_UPLOAD_BUCKET")),
 		GCSUploadPrefix:            envOrDefault("GCS_UPLOAD_PREFIX", defaultGCSUploadPrefix),
 		DeepResearchTimeoutSeconds: intOrDefault("DEEP_RESEARCH_TIMEOUT_SECONDS", defaultResearchTimeoutSecs),
@@ -117,6 +169,17 @@ func Load() (Config, error) {
 		ResearchSourceMaxBytes:     intOrDefault("RESEARCH_SOURCE_MAX_BYTES", defaultSourceMaxBytes),
 		ResearchMaxCitationsChat:   intOrDefault("RESEARCH_MAX_CITATIONS_CHAT", defaultChatMaxCitations),
 		ResearchMaxCitationsDeep:   intOrDefault("RESEARCH_MAX_CITATIONS_DEEP", defaultDeepMaxCitations),
+		ResearchReadConcurrency:    intOrDefault("RESEARCH_READ_CONCURRENCY", defaultReadConcurrency),
+		ResearchReadPerHostConc:    intOrDefault("RESEARCH_READ_PER_HOST_CONCURRENCY", defaultPerHostReadConc),
+		ResearchHostIntervalMS:     intOrDefault("RESEARCH_HOST_MIN_INTERVAL_MS", defaultHostIntervalMS),
+		ResearchHostMaxConc:        intOrDefault("RESEARCH_HOST_MAX_CONCURRENCY", defaultHostMaxConc),
+		ResearchRobotsTTLSecs:      intOrDefault("RESEARCH_ROBOTS_CACHE_TTL_SECONDS", defaultRobotsTTLSecs),
+		GenerationDrainSeconds:     intOrDefault("GENERATION_DRAIN_TIMEOUT_SECONDS", defaultGenerationDrainSecs),
+		ResearchCache:              strings.ToLower(envOrDefault("RESEARCH_CACHE", defaultResearchCache)),
+		ResearchSearchCacheTTLSecs: intOrDefault("RESEARCH_CACHE_SEARCH_TTL_SECONDS", defaultSearchCacheTTLSecs),
+		ResearchPageCacheTTLSecs:   intOrDefault("RESEARCH_CACHE_PAGE_TTL_SECONDS", defaultPageCacheTTLSecs),
+		ResearchFreshCacheTTLSecs:  intOrDefault("RESEARCH_CACHE_TIME_SENSITIVE_TTL_SECONDS", defaultFreshCacheTTLSecs),
+		ResearchCacheMaxBytes:      intOrDefault("RESEARCH_CACHE_MAX_BYTES", defaultResearchCacheBytes),
 	}
 
 	if cfg.Environment == "production" {
@@ -153,6 +216,17 @@ func Load() (Config, error) {
 	if err := validateReasoningEffort(cfg.DefaultDeepReasoningEffort); err != nil {
 		return Config{}, fmt.Errorf("DEFAULT_DEEP_RESEARCH_REASONING_EFFORT %w", err)
 	}
+	if len(cfg.SearchProviders) == 0 {
+		cfg.SearchProviders = []string{defaultSearchProvider}
+	}
+	if err := validateResearchCache(cfg.ResearchCache); err != nil {
+		return Config{}, fmt.Errorf("RESEARCH_CACHE %w", err)
+	}
+	for _, provider := range cfg.SearchProviders {
+		if err := validateSearchProvider(provider); err != nil {
+			return Config{}, fmt.Errorf("SEARCH_PROVIDER %w", err)
+		}
+	}
 
 	cfg.DeepResearchTimeoutSeconds = ensurePositiveInt(cfg.DeepResearchTimeoutSeconds, defaultResearchTimeoutSecs)
 	cfg.ChatResearchMaxLoops = ensurePositiveInt(cfg.ChatResearchMaxLoops, defaultChatMaxLoops)
@@ -166,6 +240,19 @@ func Load() (Config, error) {
 	cfg.ResearchSourceMaxBytes = ensurePositiveInt(cfg.ResearchSourceMaxBytes, defaultSourceMaxBytes)
 	cfg.ResearchMaxCitationsChat = ensurePositiveInt(cfg.ResearchMaxCitationsChat, defaultChatMaxCitations)
 	cfg.ResearchMaxCitationsDeep = ensurePositiveInt(cfg.ResearchMaxCitationsDeep, defaultDeepMaxCitations)
+	cfg.ResearchReadConcurrency = ensurePositiveInt(cfg.ResearchReadConcurrency, defaultReadConcurrency)
+	cfg.ResearchReadPerHostConc = ensurePositiveInt(cfg.ResearchReadPerHostConc, defaultPerHostReadConc)
+	cfg.ResearchHostMaxConc = ensurePositiveInt(cfg.ResearchHostMaxConc, defaultHostMaxConc)
+	cfg.ResearchRobotsTTLSecs = ensurePositiveInt(cfg.ResearchRobotsTTLSecs, defaultRobotsTTLSecs)
+	cfg.GenerationDrainSeconds = ensurePositiveInt(cfg.GenerationDrainSeconds, defaultGenerationDrainSecs)
+	cfg.ResearchSearchCacheTTLSecs = ensurePositiveInt(cfg.ResearchSearchCacheTTLSecs, defaultSearchCacheTTLSecs)
+	cfg.ResearchPageCacheTTLSecs = ensurePositiveInt(cfg.ResearchPageCacheTTLSecs, defaultPageCacheTTLSecs)
+	cfg.ResearchFreshCacheTTLSecs = ensurePositiveInt(cfg.ResearchFreshCacheTTLSecs, defaultFreshCacheTTLSecs)
+	cfg.ResearchCacheMaxBytes = ensurePositiveInt(cfg.ResearchCacheMaxBytes, defaultResearchCacheBytes)
+	cfg.BraveMinIntervalMS = max(cfg.BraveMinIntervalMS, 0)
+	cfg.SearXNGMinIntervalMS = max(cfg.SearXNGMinIntervalMS, 0)
+	cfg.TavilyMinIntervalMS = max(cfg.TavilyMinIntervalMS, 0)
+	cfg.ResearchHostIntervalMS = max(cfg.ResearchHostIntervalMS, 0)
 
 	return cfg, nil
 }
@@ -214,6 +301,19 @@ func parseList(raw string) []string {
 	return out
 }
 
+// parseProviderList lowercases and dedupes a comma-separated provider list,
+// keeping the configured order.
+func parseProviderList(raw string) []string {
+	items := parseList(strings.ToLower(raw))
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if !slices.Contains(out, item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func parseEmailSet(raw string) map[string]struct{} {
 	emails := parseList(raw)
 	out := make(map[string]struct{}, len(emails))
@@ -232,6 +332,24 @@ func validateReasoningEffort(effort string) error {
 	}
 }
 
+func validateSearchProvider(provider string) error {
+	switch strings.ToLower(strings.TrimSpace(provider)) {
+	case "brave", "searxng", "tavily", "static":
+		return nil
+	default:
+		return fmt.Errorf("must be one of: brave, searxng, tavily, static")
+	}
+}
+
+func validateResearchCache(kind string) error {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "memory", "db", "off":
+		return nil
+	default:
+		return fmt.Errorf("must be one of: memory, db, off")
+	}
+}
+
 func ensurePositiveInt(value, fallback int) int {
 	if value <= 0 {
 		return fallback
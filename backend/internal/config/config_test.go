@@ -44,10 +44,16 @@ func TestLoadDefaults(t *testing.T) {
 	if cfg.BraveBaseURL != "https://api.search.brave.com/res/v1" {
 		t.Fatalf("unexpected brave base url: %s", cfg.BraveBaseURL)
 	}
+	if len(cfg.SearchProviders) != 1 || cfg.SearchProviders[0] != "brave" || cfg.BraveMinIntervalMS != 1100 || cfg.TavilyBaseURL != "https://api.tavily.com" {
+		t.Fatalf("unexpected search provider defaults: providers=%v brave_interval=%d tavily=%s", cfg.SearchProviders, cfg.BraveMinIntervalMS, cfg.TavilyBaseURL)
+	}
 
 	if cfg.GCSUploadPrefix != "chat-uploads" {
 		t.Fatalf("unexpected gcs upload prefix: %s", cfg.GCSUploadPrefix)
 	}
+	if cfg.LocalUploadDir != "/tmp/chat-uploads" || !cfg.LocalUploadFsync {
+		t.Fatalf("unexpected local upload defaults: dir=%s fsync=%v", cfg.LocalUploadDir, cfg.LocalUploadFsync)
+	}
 
 	if cfg.DeepResearchTimeoutSeconds != 150 {
 		t.Fatalf("unexpected deep research timeout default: %d", cfg.DeepResearchTimeoutSeconds)
@@ -88,6 +94,16 @@ func TestLoadDefaults(t *testing.T) {
 	if cfg.ResearchMaxCitationsDeep != 12 {
 		t.Fatalf("unexpected deep max citations default: %d", cfg.ResearchMaxCitationsDeep)
 	}
+	if cfg.ResearchCache != "memory" || cfg.ResearchSearchCacheTTLSecs != 3600 || cfg.ResearchPageCacheTTLSecs != 21600 ||
+		cfg.ResearchFreshCacheTTLSecs != 300 || cfg.ResearchCacheMaxBytes != 64<<20 {
+		t.Fatalf("unexpected research cache defaults: %+v", cfg)
+	}
+	if cfg.ResearchHostIntervalMS != 1000 || cfg.ResearchHostMaxConc != 2 || cfg.ResearchRobotsTTLSecs != 3600 {
+		t.Fatalf("unexpected reader politeness defaults: %+v", cfg)
+	}
+	if cfg.GenerationDrainSeconds != 8 {
+		t.Fatalf("unexpected generation drain timeout default: %d", cfg.GenerationDrainSeconds)
+	}
 
 	if cfg.ModelSyncBearerToken != "" {
 		t.Fatalf("expected empty model sync bearer token by default")
@@ -126,6 +142,22 @@ func TestLoadAllowsMissingGoogleClientIDWhenAuthDisabled(t *testing.T) {
 	}
 }
 
+func TestLoadParsesFallbackModels(t *testing.T) {
+	t.Setenv("TURSO_DATABASE_URL", "file:local.db")
+	t.Setenv("GOOGLE_CLIENT_ID", "client-id")
+	t.Setenv("AUTH_INSECURE_SKIP_GOOGLE_VERIFY", "false")
+	t.Setenv("OPENROUTER_FALLBACK_MODELS", " openai/gpt-4o-mini, ,anthropic/claude-3.5-haiku ")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	if len(cfg.OpenRouterFallbackModels) != 2 || cfg.OpenRouterFallbackModels[0] != "openai/gpt-4o-mini" || cfg.OpenRouterFallbackModels[1] != "anthropic/claude-3.5-haiku" {
+		t.Fatalf("unexpected fallback models: %v", cfg.OpenRouterFallbackModels)
+	}
+}
+
 func TestLoadReadsModelSyncBearerToken(t *testing.T) {
 	t.Setenv("TURSO_DATABASE_URL", "file:local.db")
 	t.Setenv("GOOGLE_CLIENT_ID", "client-id")
@@ -154,6 +186,46 @@ func TestLoadRejectsInvalidReasoningEffort(t *testing.T) {
 	}
 }
 
+func TestLoadParsesSearchProviderList(t *testing.T) {
+	t.Setenv("TURSO_DATABASE_URL", "file:local.db")
+	t.Setenv("GOOGLE_CLIENT_ID", "client-id")
+	t.Setenv("AUTH_INSECURE_SKIP_GOOGLE_VERIFY", "false")
+	t.Setenv("SEARCH_PROVIDER", " Brave, searxng ,brave,,tavily")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	if len(cfg.SearchProviders) != 3 || cfg.SearchProviders[0] != "brave" || cfg.SearchProviders[1] != "searxng" || cfg.SearchProviders[2] != "tavily" {
+		t.Fatalf("unexpected search providers: %v", cfg.SearchProviders)
+	}
+}
+
+func TestLoadRejectsUnknownSearchProvider(t *testing.T) {
+	t.Setenv("TURSO_DATABASE_URL", "file:local.db")
+	t.Setenv("GOOGLE_CLIENT_ID", "client-id")
+	t.Setenv("AUTH_INSECURE_SKIP_GOOGLE_VERIFY", "false")
+	t.Setenv("SEARCH_PROVIDER", "brave,bing")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("expected error for unknown SEARCH_PROVIDER")
+	}
+}
+
+func TestLoadRejectsUnknownResearchCache(t *testing.T) {
+	t.Setenv("TURSO_DATABASE_URL", "file:local.db")
+	t.Setenv("GOOGLE_CLIENT_ID", "client-id")
+	t.Setenv("AUTH_INSECURE_SKIP_GOOGLE_VERIFY", "false")
+	t.Setenv("RESEARCH_CACHE", "redis")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("expected error for unknown RESEARCH_CACHE")
+	}
+}
+
 func TestLoadClampsInvalidResearchBudgetsToDefaults(t *testing.T) {
 	t.Setenv("TURSO_DATABASE_URL", "file:local.db")
 	t.Setenv("GOOGLE_CLIENT_ID", "client-id")
@@ -169,6 +241,11 @@ func TestLoadClampsInvalidResearchBudgetsToDefaults(t *testing.T) {
 	t.Setenv("RESEARCH_SOURCE_MAX_BYTES", "0")
 	t.Setenv("RESEARCH_MAX_CITATIONS_CHAT", "0")
 	t.Setenv("RESEARCH_MAX_CITATIONS_DEEP", "-4")
+	t.Setenv("RESEARCH_READ_CONCURRENCY", "0")
+	t.Setenv("RESEARCH_READ_PER_HOST_CONCURRENCY", "-1")
+	t.Setenv("RESEARCH_HOST_MIN_INTERVAL_MS", "-5")
+	t.Setenv("RESEARCH_HOST_MAX_CONCURRENCY", "0")
+	t.Setenv("RESEARCH_ROBOTS_CACHE_TTL_SECONDS", "-1")
 
 	cfg, err := Load()
 	if err != nil {
@@ -185,7 +262,12 @@ func TestLoadClampsInvalidResearchBudgetsToDefaults(t *testing.T) {
 		cfg.ResearchSourceTimeoutSecs != 12 ||
 		cfg.ResearchSourceMaxBytes != 1_500_000 ||
 		cfg.ResearchMaxCitationsChat != 8 ||
-		cfg.ResearchMaxCitationsDeep != 12 {
+		cfg.ResearchMaxCitationsDeep != 12 ||
+		cfg.ResearchReadConcurrency != 4 ||
+		cfg.ResearchReadPerHostConc != 2 ||
+		cfg.ResearchHostIntervalMS != 0 ||
+		cfg.ResearchHostMaxConc != 2 ||
+		cfg.ResearchRobotsTTLSecs != 3600 {
 		t.Fatalf("expected invalid budgets to clamp to defaults, got %+v", cfg)
 	}
 }
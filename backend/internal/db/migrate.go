@@ -0,0 +1,329 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	migrationLockTimeout      = 2 * time.Minute
+	migrationLockPollInterval = 500 * time.Millisecond
+	migrationLockStaleSeconds = 600
+	// Migrations up to this version were applied by hand with the Turso shell
+	// before schema_migrations existed.
+	legacyBaselineVersion = 9
+)
+
+var errMigrationLockTimeout = errors.New("timed out waiting for schema migration lock")
+
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read embedded migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	seen := make(map[int]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		version, err := parseMigrationVersion(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := seen[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, existing, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    strings.TrimSuffix(entry.Name(), ".sql"),
+			SQL:     string(body),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func parseMigrationVersion(filename string) (int, error) {
+	prefix, _, ok := strings.Cut(filename, "_")
+	if !ok {
+		return 0, fmt.Errorf("migration %s must be named <version>_<name>.sql", filename)
+	}
+	version, err := strconv.Atoi(prefix)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("migration %s has invalid version prefix %q", filename, prefix)
+	}
+	return version, nil
+}
+
+// PendingMigrations reports the migrations Migrate would apply without
+// changing the database.
+func PendingMigrations(ctx context.Context, database *sql.DB) ([]Migration, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked, err := tableExists(ctx, database, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]struct{}{}
+	if tracked {
+		applied, err = appliedMigrationVersions(ctx, database)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(applied) == 0 {
+		legacy, err := tableExists(ctx, database, "users")
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			for _, migration := range migrations {
+				if migration.Version <= legacyBaselineVersion {
+					applied[migration.Version] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return filterPendingMigrations(migrations, applied), nil
+}
+
+// Migrate applies every embedded migration that has not been recorded in
+// schema_migrations, in version order, each inside its own transaction.
+// Concurrent instances serialize on the schema_migrations_lock row.
+func Migrate(ctx context.Context, database *sql.DB) ([]Migration, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureMigrationTables(ctx, database); err != nil {
+		return nil, err
+	}
+
+	owner := uuid.NewString()
+	if err := acquireMigrationLock(ctx, database, owner); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := releaseMigrationLock(context.WithoutCancel(ctx), database, owner); err != nil {
+			log.Printf("release schema migration lock failed: %v", err)
+		}
+	}()
+
+	if err := baselineLegacySchema(ctx, database, migrations); err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrationVersions(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := filterPendingMigrations(migrations, applied)
+	for _, migration := range pending {
+		if err := applyMigration(ctx, database, migration); err != nil {
+			return nil, err
+		}
+		log.Printf("applied schema migration version=%d name=%s", migration.Version, migration.Name)
+	}
+
+	return pending, nil
+}
+
+func ensureMigrationTables(ctx context.Context, database *sql.DB) error {
+	_, err := database.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	_, err = database.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+  id INTEGER PRIMARY KEY CHECK (id = 1),
+  owner TEXT NOT NULL,
+  acquired_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations_lock: %w", err)
+	}
+	return nil
+}
+
+func acquireMigrationLock(ctx context.Context, database *sql.DB, owner string) error {
+	deadline := time.Now().Add(migrationLockTimeout)
+	for {
+		if _, err := database.ExecContext(ctx, `
+DELETE FROM schema_migrations_lock
+WHERE acquired_at < datetime('now', ?);
+`, fmt.Sprintf("-%d seconds", migrationLockStaleSeconds)); err != nil {
+			return fmt.Errorf("expire stale schema migration lock: %w", err)
+		}
+
+		result, err := database.ExecContext(ctx, `
+INSERT INTO schema_migrations_lock (id, owner)
+VALUES (1, ?)
+ON CONFLICT(id) DO NOTHING;
+`, owner)
+		if err != nil {
+			return fmt.Errorf("acquire schema migration lock: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 1 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return errMigrationLockTimeout
+		}
+		timer := time.NewTimer(migrationLockPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func releaseMigrationLock(ctx context.Context, database *sql.DB, owner string) error {
+	if _, err := database.ExecContext(ctx, `DELETE FROM schema_migrations_lock WHERE id = 1 AND owner = ?;`, owner); err != nil {
+		return fmt.Errorf("delete schema migration lock: %w", err)
+	}
+	return nil
+}
+
+func baselineLegacySchema(ctx context.Context, database *sql.DB, migrations []Migration) error {
+	applied, err := appliedMigrationVersions(ctx, database)
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		return nil
+	}
+
+	legacy, err := tableExists(ctx, database, "users")
+	if err != nil {
+		return err
+	}
+	if !legacy {
+		return nil
+	}
+
+	for _, migration := range migrations {
+		if migration.Version > legacyBaselineVersion {
+			break
+		}
+		if _, err := database.ExecContext(ctx, `
+INSERT INTO schema_migrations (version, name)
+VALUES (?, ?)
+ON CONFLICT(version) DO NOTHING;
+`, migration.Version, migration.Name); err != nil {
+			return fmt.Errorf("baseline schema migration %d: %w", migration.Version, err)
+		}
+	}
+	log.Printf("baselined existing schema at migration version=%d", legacyBaselineVersion)
+	return nil
+}
+
+func applyMigration(ctx context.Context, database *sql.DB, migration Migration) error {
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin migration %s: %w", migration.Name, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+		return fmt.Errorf("apply migration %s: %w", migration.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?);`, migration.Version, migration.Name); err != nil {
+		return fmt.Errorf("record migration %s: %w", migration.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration %s: %w", migration.Name, err)
+	}
+	return nil
+}
+
+func appliedMigrationVersions(ctx context.Context, database *sql.DB) (map[int]struct{}, error) {
+	rows, err := database.QueryContext(ctx, `SELECT version FROM schema_migrations;`)
+	if err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]struct{}{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("scan applied migration: %w", err)
+		}
+		applied[version] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+func filterPendingMigrations(migrations []Migration, applied map[int]struct{}) []Migration {
+	pending := make([]Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		pending = append(pending, migration)
+	}
+	return pending
+}
+
+func tableExists(ctx context.Context, database *sql.DB, name string) (bool, error) {
+	var count int
+	if err := database.QueryRowContext(ctx, `SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = ?;`, name).Scan(&count); err != nil {
+		return false, fmt.Errorf("check table %s: %w", name, err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,233 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func openMemoryDB(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	database.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = database.Close() })
+	return database
+}
+
+func TestLoadMigrationsOrderedByVersion(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if len(migrations) < legacyBaselineVersion {
+		t.Fatalf("expected at least %d migrations, got %d", legacyBaselineVersion, len(migrations))
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Fatalf("expected contiguous versions, got %d at index %d", migration.Version, i)
+		}
+	}
+	if migrations[0].Name != "0001_init" {
+		t.Fatalf("unexpected first migration name: %s", migrations[0].Name)
+	}
+}
+
+func TestParseMigrationVersionRejectsBadNames(t *testing.T) {
+	for _, name := range []string{"init.sql", "abc_init.sql", "0000_init.sql"} {
+		if _, err := parseMigrationVersion(name); err == nil {
+			t.Fatalf("expected error for %q", name)
+		}
+	}
+}
+
+func TestMigrateAppliesAllMigrationsOnce(t *testing.T) {
+	database := openMemoryDB(t)
+	ctx := context.Background()
+
+	pending, err := PendingMigrations(ctx, database)
+	if err != nil {
+		t.Fatalf("pending migrations: %v", err)
+	}
+	all, _ := LoadMigrations()
+	if len(pending) != len(all) {
+		t.Fatalf("expected %d pending migrations on empty db, got %d", len(all), len(pending))
+	}
+	if exists, _ := tableExists(ctx, database, "schema_migrations"); exists {
+		t.Fatalf("expected dry run to leave database untouched")
+	}
+
+	applied, err := Migrate(ctx, database)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(applied) != len(all) {
+		t.Fatalf("expected %d applied migrations, got %d", len(all), len(applied))
+	}
+
+	applied, err = Migrate(ctx, database)
+	if err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("expected second migrate to be a no-op, applied %d", len(applied))
+	}
+
+	var seeded int
+	if err := database.QueryRow(`SELECT COUNT(1) FROM models WHERE id = 'openrouter/free';`).Scan(&seeded); err != nil {
+		t.Fatalf("query seeded model: %v", err)
+	}
+	if seeded != 1 {
+		t.Fatalf("expected default model to be seeded")
+	}
+
+	var locks int
+	if err := database.QueryRow(`SELECT COUNT(1) FROM schema_migrations_lock;`).Scan(&locks); err != nil {
+		t.Fatalf("query lock: %v", err)
+	}
+	if locks != 0 {
+		t.Fatalf("expected migration lock to be released")
+	}
+}
+
+func TestMigrateBaselinesLegacySchema(t *testing.T) {
+	database := openMemoryDB(t)
+	ctx := context.Background()
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	for _, migration := range migrations[:legacyBaselineVersion] {
+		if _, err := database.Exec(migration.SQL); err != nil {
+			t.Fatalf("apply legacy migration %s: %v", migration.Name, err)
+		}
+	}
+
+	pending, err := PendingMigrations(ctx, database)
+	if err != nil {
+		t.Fatalf("pending migrations: %v", err)
+	}
+	for _, migration := range pending {
+		if migration.Version <= legacyBaselineVersion {
+			t.Fatalf("expected legacy migration %s to be treated as applied", migration.Name)
+		}
+	}
+
+	if _, err := Migrate(ctx, database); err != nil {
+		t.Fatalf("migrate legacy db: %v", err)
+	}
+
+	var baselined int
+	if err := database.QueryRow(`SELECT COUNT(1) FROM schema_migrations WHERE version <= ?;`, legacyBaselineVersion).Scan(&baselined); err != nil {
+		t.Fatalf("count baselined migrations: %v", err)
+	}
+	if baselined != legacyBaselineVersion {
+		t.Fatalf("expected %d baselined migrations, got %d", legacyBaselineVersion, baselined)
+	}
+}
+
+func TestMigrationsMatchCanonicalSchema(t *testing.T) {
+	migrated := openMemoryDB(t)
+	if _, err := Migrate(context.Background(), migrated); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	canonical := openMemoryDB(t)
+	schema, err := os.ReadFile(filepath.Join("..", "..", "..", "db", "schema.sql"))
+	if err != nil {
+		t.Fatalf("read schema.sql: %v", err)
+	}
+	if _, err := canonical.Exec(string(schema)); err != nil {
+		t.Fatalf("apply schema.sql: %v", err)
+	}
+
+	want := tableColumns(t, canonical)
+	got := tableColumns(t, migrated)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("migrated schema drifted from db/schema.sql:\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestMigrateWaitsForHeldLock(t *testing.T) {
+	database := openMemoryDB(t)
+	if err := ensureMigrationTables(context.Background(), database); err != nil {
+		t.Fatalf("ensure tables: %v", err)
+	}
+	if _, err := database.Exec(`INSERT INTO schema_migrations_lock (id, owner) VALUES (1, 'other-instance');`); err != nil {
+		t.Fatalf("seed lock: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Migrate(ctx, database); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected migrate to block on held lock, got %v", err)
+	}
+
+	var owner string
+	if err := database.QueryRow(`SELECT owner FROM schema_migrations_lock WHERE id = 1;`).Scan(&owner); err != nil {
+		t.Fatalf("query lock owner: %v", err)
+	}
+	if owner != "other-instance" {
+		t.Fatalf("expected foreign lock to be left in place, got owner %q", owner)
+	}
+}
+
+func TestMigrateTakesOverStaleLock(t *testing.T) {
+	database := openMemoryDB(t)
+	if err := ensureMigrationTables(context.Background(), database); err != nil {
+		t.Fatalf("ensure tables: %v", err)
+	}
+	if _, err := database.Exec(`INSERT INTO schema_migrations_lock (id, owner, acquired_at) VALUES (1, 'crashed-instance', datetime('now', '-1 hour'));`); err != nil {
+		t.Fatalf("seed stale lock: %v", err)
+	}
+
+	if _, err := Migrate(context.Background(), database); err != nil {
+		t.Fatalf("migrate with stale lock: %v", err)
+	}
+}
+
+func tableColumns(t *testing.T, database *sql.DB) map[string][]string {
+	t.Helper()
+	rows, err := database.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE 'schema_migrations%';`)
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("scan table: %v", err)
+		}
+		tables = append(tables, name)
+	}
+	_ = rows.Close()
+
+	out := make(map[string][]string, len(tables))
+	for _, table := range tables {
+		columnRows, err := database.Query(`SELECT name FROM pragma_table_info(?);`, table)
+		if err != nil {
+			t.Fatalf("table info %s: %v", table, err)
+		}
+		var columns []string
+		for columnRows.Next() {
+			var name string
+			if err := columnRows.Scan(&name); err != nil {
+				t.Fatalf("scan column: %v", err)
+			}
+			columns = append(columns, name)
+		}
+		_ = columnRows.Close()
+		sort.Strings(columns)
+		out[table] = columns
+	}
+	return out
+}
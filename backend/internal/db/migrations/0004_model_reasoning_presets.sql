@@ -1,8 +1,7 @@
 -- 0004_model_reasoning_presets.sql
--- Add model capability metadata and user reasoning-effort presets.
-
-ALTER TABLE models ADD COLUMN supported_parameters_json TEXT;
-ALTER TABLE models ADD COLUMN supports_reasoning INTEGER NOT NULL DEFAULT 0;
+-- Add user reasoning-effort presets.
+-- models.supported_parameters_json and models.supports_reasoning are created by
+-- 0001_init.sql, which 0002_seed_default_model.sql already depends on.
 
 CREATE TABLE IF NOT EXISTS user_model_reasoning_presets (
   user_id TEXT NOT NULL,
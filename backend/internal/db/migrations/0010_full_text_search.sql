@@ -0,0 +1,68 @@
+-- 0010_full_text_search.sql
+-- FTS5 indexes over message content, conversation titles and attachment text.
+-- The indexes are external-content tables kept in sync by triggers, so inserts,
+-- edit truncation and cascading deletes never need application-side bookkeeping.
+
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+  content,
+  content = 'messages',
+  content_rowid = 'rowid',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_insert AFTER INSERT ON messages BEGIN
+  INSERT INTO messages_fts (rowid, content) VALUES (new.rowid, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_delete AFTER DELETE ON messages BEGIN
+  INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_update AFTER UPDATE OF content ON messages BEGIN
+  INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+  INSERT INTO messages_fts (rowid, content) VALUES (new.rowid, new.content);
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS conversations_fts USING fts5(
+  title,
+  content = 'conversations',
+  content_rowid = 'rowid',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS conversations_fts_after_insert AFTER INSERT ON conversations BEGIN
+  INSERT INTO conversations_fts (rowid, title) VALUES (new.rowid, new.title);
+END;
+
+CREATE TRIGGER IF NOT EXISTS conversations_fts_after_delete AFTER DELETE ON conversations BEGIN
+  INSERT INTO conversations_fts (conversations_fts, rowid, title) VALUES ('delete', old.rowid, old.title);
+END;
+
+CREATE TRIGGER IF NOT EXISTS conversations_fts_after_update AFTER UPDATE OF title ON conversations BEGIN
+  INSERT INTO conversations_fts (conversations_fts, rowid, title) VALUES ('delete', old.rowid, old.title);
+  INSERT INTO conversations_fts (rowid, title) VALUES (new.rowid, new.title);
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(
+  extracted_text,
+  content = 'files',
+  content_rowid = 'rowid',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS files_fts_after_insert AFTER INSERT ON files BEGIN
+  INSERT INTO files_fts (rowid, extracted_text) VALUES (new.rowid, COALESCE(new.extracted_text, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS files_fts_after_delete AFTER DELETE ON files BEGIN
+  INSERT INTO files_fts (files_fts, rowid, extracted_text) VALUES ('delete', old.rowid, COALESCE(old.extracted_text, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS files_fts_after_update AFTER UPDATE OF extracted_text ON files BEGIN
+  INSERT INTO files_fts (files_fts, rowid, extracted_text) VALUES ('delete', old.rowid, COALESCE(old.extracted_text, ''));
+  INSERT INTO files_fts (rowid, extracted_text) VALUES (new.rowid, COALESCE(new.extracted_text, ''));
+END;
+
+INSERT INTO messages_fts (messages_fts) VALUES ('rebuild');
+INSERT INTO conversations_fts (conversations_fts) VALUES ('rebuild');
+INSERT INTO files_fts (files_fts) VALUES ('rebuild');
@@ -0,0 +1,28 @@
+-- 0011_message_branches.sql
+-- Messages form a tree per conversation: edits and regenerations add siblings
+-- instead of deleting later turns. The conversation tracks the leaf of the
+-- branch currently shown; the active path is that leaf's chain of parents.
+
+ALTER TABLE messages ADD COLUMN parent_message_id TEXT REFERENCES messages(id) ON DELETE CASCADE;
+ALTER TABLE conversations ADD COLUMN active_leaf_message_id TEXT REFERENCES messages(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_messages_parent ON messages(conversation_id, parent_message_id);
+
+UPDATE messages
+SET parent_message_id = (
+  SELECT p.id
+  FROM messages p
+  WHERE p.conversation_id = messages.conversation_id
+    AND (p.created_at < messages.created_at OR (p.created_at = messages.created_at AND p.rowid < messages.rowid))
+  ORDER BY p.created_at DESC, p.rowid DESC
+  LIMIT 1
+);
+
+UPDATE conversations
+SET active_leaf_message_id = (
+  SELECT m.id
+  FROM messages m
+  WHERE m.conversation_id = conversations.id
+  ORDER BY m.created_at DESC, m.rowid DESC
+  LIMIT 1
+);
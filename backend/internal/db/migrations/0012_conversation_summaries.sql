@@ -0,0 +1,13 @@
+-- 0012_conversation_summaries.sql
+-- Rolling summary of the turns that no longer fit a model's history budget.
+-- It covers the active path up to and including through_message_id and is
+-- extended with newer turns as they fall out of the budget.
+
+CREATE TABLE IF NOT EXISTS conversation_summaries (
+  conversation_id TEXT PRIMARY KEY,
+  through_message_id TEXT NOT NULL,
+  content TEXT NOT NULL,
+  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+  FOREIGN KEY (through_message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
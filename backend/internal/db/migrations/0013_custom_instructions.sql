@@ -0,0 +1,6 @@
+-- 0013_custom_instructions.sql
+-- Standing instructions a user wants applied to every reply, and an optional
+-- system prompt scoped to a single conversation.
+
+ALTER TABLE users ADD COLUMN custom_instructions TEXT NOT NULL DEFAULT '';
+ALTER TABLE conversations ADD COLUMN system_prompt TEXT NOT NULL DEFAULT '';
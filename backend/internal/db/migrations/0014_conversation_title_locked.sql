@@ -0,0 +1,5 @@
+-- 0014_conversation_title_locked.sql
+-- Marks conversations whose title the user chose, so generated titles never
+-- overwrite it.
+
+ALTER TABLE conversations ADD COLUMN title_locked INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- 0015_message_tool_calls.sql
+-- Tool results are stored as role 'tool' messages under the user turn that
+-- triggered them, together with the call the model made.
+
+ALTER TABLE messages ADD COLUMN tool_call_id TEXT;
+ALTER TABLE messages ADD COLUMN tool_name TEXT;
+ALTER TABLE messages ADD COLUMN tool_arguments_json TEXT;
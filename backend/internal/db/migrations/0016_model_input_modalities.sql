@@ -0,0 +1,5 @@
+-- 0016_model_input_modalities.sql
+-- Input modalities from the provider catalog (e.g. ["text","image"]), used to
+-- reject image attachments for text-only models.
+
+ALTER TABLE models ADD COLUMN input_modalities_json TEXT;
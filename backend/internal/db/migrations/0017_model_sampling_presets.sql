@@ -0,0 +1,20 @@
+-- 0017_model_sampling_presets.sql
+-- Per-user sampling defaults for a model and mode, alongside the reasoning
+-- presets. NULL columns fall back to the provider's defaults.
+
+CREATE TABLE IF NOT EXISTS user_model_sampling_presets (
+  user_id TEXT NOT NULL,
+  model_id TEXT NOT NULL,
+  mode TEXT NOT NULL CHECK (mode IN ('chat', 'deep_research')),
+  temperature REAL,
+  top_p REAL,
+  max_tokens INTEGER,
+  stop_json TEXT,
+  seed INTEGER,
+  presence_penalty REAL,
+  frequency_penalty REAL,
+  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, model_id, mode),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (model_id) REFERENCES models(id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+-- 0018_message_structured_output.sql
+-- Validated JSON for replies requested with a response format, kept next to
+-- the raw reply text.
+
+ALTER TABLE messages ADD COLUMN structured_output_json TEXT;
@@ -0,0 +1,15 @@
+-- 0019_message_comparisons.sql
+-- A user message sent to several models at once. Each answer is an assistant
+-- child of user_message_id; winner_message_id is the one the user picked to
+-- continue from.
+
+CREATE TABLE IF NOT EXISTS message_comparisons (
+  user_message_id TEXT PRIMARY KEY,
+  conversation_id TEXT NOT NULL,
+  model_ids_json TEXT NOT NULL,
+  winner_message_id TEXT,
+  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_message_id) REFERENCES messages(id) ON DELETE CASCADE,
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+  FOREIGN KEY (winner_message_id) REFERENCES messages(id) ON DELETE SET NULL
+);
@@ -0,0 +1,15 @@
+-- 0021_research_cache.sql
+-- Shared cache for research search results and fetched pages. value holds
+-- JSON; size_bytes is its length so the cache can stay within a size bound by
+-- evicting the oldest writes first.
+
+CREATE TABLE IF NOT EXISTS research_cache (
+  cache_key TEXT PRIMARY KEY,
+  value TEXT NOT NULL,
+  size_bytes INTEGER NOT NULL,
+  created_at TEXT NOT NULL,
+  expires_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_research_cache_expires_at ON research_cache(expires_at);
+CREATE INDEX IF NOT EXISTS idx_research_cache_created_at ON research_cache(created_at);
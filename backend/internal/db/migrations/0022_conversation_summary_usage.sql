@@ -0,0 +1,7 @@
+-- 0022_conversation_summary_usage.sql
+-- Running totals of the tokens and cost spent folding turns into a
+-- conversation's rolling summary.
+
+ALTER TABLE conversation_summaries ADD COLUMN prompt_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE conversation_summaries ADD COLUMN completion_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE conversation_summaries ADD COLUMN cost_microusd INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,28 @@
+-- 0023_branch_conversation_summaries.sql
+-- Keeps one rolling summary per branch instead of one per conversation, so
+-- switching branches extends the summary already on that path instead of
+-- rebuilding it. A row is identified by the message it covers through and
+-- moves forward along its branch as newer turns are folded in.
+
+CREATE TABLE IF NOT EXISTS conversation_summaries_by_branch (
+  conversation_id TEXT NOT NULL,
+  through_message_id TEXT NOT NULL,
+  content TEXT NOT NULL,
+  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  prompt_tokens INTEGER NOT NULL DEFAULT 0,
+  completion_tokens INTEGER NOT NULL DEFAULT 0,
+  cost_microusd INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (conversation_id, through_message_id),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+  FOREIGN KEY (through_message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+INSERT INTO conversation_summaries_by_branch (
+  conversation_id, through_message_id, content, updated_at, prompt_tokens, completion_tokens, cost_microusd
+)
+SELECT conversation_id, through_message_id, content, updated_at, prompt_tokens, completion_tokens, cost_microusd
+FROM conversation_summaries;
+
+DROP TABLE conversation_summaries;
+
+ALTER TABLE conversation_summaries_by_branch RENAME TO conversation_summaries;
@@ -0,0 +1,109 @@
+-- 0024_stable_search_rowids.sql
+-- The FTS5 indexes were keyed on the implicit rowid of messages, conversations
+-- and files. Those tables have TEXT primary keys, so VACUUM may renumber their
+-- rowids and leave the indexes pointing at the wrong rows. Each table gets a
+-- search_rowid that is assigned once on insert and never changes, and the
+-- indexes are rebuilt on it.
+
+ALTER TABLE messages ADD COLUMN search_rowid INTEGER;
+UPDATE messages SET search_rowid = rowid;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_search_rowid ON messages(search_rowid);
+
+ALTER TABLE conversations ADD COLUMN search_rowid INTEGER;
+UPDATE conversations SET search_rowid = rowid;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_search_rowid ON conversations(search_rowid);
+
+ALTER TABLE files ADD COLUMN search_rowid INTEGER;
+UPDATE files SET search_rowid = rowid;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_files_search_rowid ON files(search_rowid);
+
+DROP TRIGGER IF EXISTS messages_fts_after_insert;
+DROP TRIGGER IF EXISTS messages_fts_after_delete;
+DROP TRIGGER IF EXISTS messages_fts_after_update;
+DROP TABLE IF EXISTS messages_fts;
+
+DROP TRIGGER IF EXISTS conversations_fts_after_insert;
+DROP TRIGGER IF EXISTS conversations_fts_after_delete;
+DROP TRIGGER IF EXISTS conversations_fts_after_update;
+DROP TABLE IF EXISTS conversations_fts;
+
+DROP TRIGGER IF EXISTS files_fts_after_insert;
+DROP TRIGGER IF EXISTS files_fts_after_delete;
+DROP TRIGGER IF EXISTS files_fts_after_update;
+DROP TABLE IF EXISTS files_fts;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+  content,
+  content = 'messages',
+  content_rowid = 'search_rowid',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_insert AFTER INSERT ON messages BEGIN
+  UPDATE messages
+  SET search_rowid = (SELECT COALESCE(MAX(search_rowid), 0) + 1 FROM messages)
+  WHERE rowid = new.rowid AND search_rowid IS NULL;
+  INSERT INTO messages_fts (rowid, content)
+  SELECT search_rowid, new.content FROM messages WHERE rowid = new.rowid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_delete AFTER DELETE ON messages BEGIN
+  INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.search_rowid, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_update AFTER UPDATE OF content ON messages BEGIN
+  INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.search_rowid, old.content);
+  INSERT INTO messages_fts (rowid, content) VALUES (new.search_rowid, new.content);
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS conversations_fts USING fts5(
+  title,
+  content = 'conversations',
+  content_rowid = 'search_rowid',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS conversations_fts_after_insert AFTER INSERT ON conversations BEGIN
+  UPDATE conversations
+  SET search_rowid = (SELECT COALESCE(MAX(search_rowid), 0) + 1 FROM conversations)
+  WHERE rowid = new.rowid AND search_rowid IS NULL;
+  INSERT INTO conversations_fts (rowid, title)
+  SELECT search_rowid, new.title FROM conversations WHERE rowid = new.rowid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS conversations_fts_after_delete AFTER DELETE ON conversations BEGIN
+  INSERT INTO conversations_fts (conversations_fts, rowid, title) VALUES ('delete', old.search_rowid, old.title);
+END;
+
+CREATE TRIGGER IF NOT EXISTS conversations_fts_after_update AFTER UPDATE OF title ON conversations BEGIN
+  INSERT INTO conversations_fts (conversations_fts, rowid, title) VALUES ('delete', old.search_rowid, old.title);
+  INSERT INTO conversations_fts (rowid, title) VALUES (new.search_rowid, new.title);
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(
+  extracted_text,
+  content = 'files',
+  content_rowid = 'search_rowid',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS files_fts_after_insert AFTER INSERT ON files BEGIN
+  UPDATE files
+  SET search_rowid = (SELECT COALESCE(MAX(search_rowid), 0) + 1 FROM files)
+  WHERE rowid = new.rowid AND search_rowid IS NULL;
+  INSERT INTO files_fts (rowid, extracted_text)
+  SELECT search_rowid, COALESCE(new.extracted_text, '') FROM files WHERE rowid = new.rowid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS files_fts_after_delete AFTER DELETE ON files BEGIN
+  INSERT INTO files_fts (files_fts, rowid, extracted_text) VALUES ('delete', old.search_rowid, COALESCE(old.extracted_text, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS files_fts_after_update AFTER UPDATE OF extracted_text ON files BEGIN
+  INSERT INTO files_fts (files_fts, rowid, extracted_text) VALUES ('delete', old.search_rowid, COALESCE(old.extracted_text, ''));
+  INSERT INTO files_fts (rowid, extracted_text) VALUES (new.search_rowid, COALESCE(new.extracted_text, ''));
+END;
+
+INSERT INTO messages_fts (messages_fts) VALUES ('rebuild');
+INSERT INTO conversations_fts (conversations_fts) VALUES ('rebuild');
+INSERT INTO files_fts (files_fts) VALUES ('rebuild');
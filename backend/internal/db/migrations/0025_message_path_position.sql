@@ -0,0 +1,27 @@
+-- 0025_message_path_position.sql
+-- Adds messages.path_position, a message's 1-based position on its branch
+-- (its parent's plus one). It is set once on insert, so message pages can use
+-- it as a cursor instead of the implicit rowid, which is not guaranteed to
+-- follow path order and may be renumbered by VACUUM.
+
+ALTER TABLE messages ADD COLUMN path_position INTEGER;
+
+WITH RECURSIVE positions(id, position) AS (
+  SELECT id, 1 FROM messages WHERE parent_message_id IS NULL
+  UNION ALL
+  SELECT m.id, positions.position + 1
+  FROM messages m
+  JOIN positions ON m.parent_message_id = positions.id
+)
+UPDATE messages
+SET path_position = positions.position
+FROM positions
+WHERE positions.id = messages.id;
+
+CREATE TRIGGER IF NOT EXISTS messages_path_position_after_insert AFTER INSERT ON messages
+WHEN new.path_position IS NULL
+BEGIN
+  UPDATE messages
+  SET path_position = COALESCE((SELECT parent.path_position FROM messages parent WHERE parent.id = new.parent_message_id), 0) + 1
+  WHERE rowid = new.rowid;
+END;
@@ -0,0 +1,6 @@
+-- 0026_citation_source_providers.sql
+-- Every search provider that returned a citation's URL when results from
+-- several providers were fused, as a JSON array. source_provider stays the one
+-- that ranked it highest.
+
+ALTER TABLE citations ADD COLUMN source_providers_json TEXT;
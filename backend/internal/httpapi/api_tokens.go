@@ -0,0 +1,150 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"chat/backend/internal/session"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxAPITokenNameLength = 100
+	maxAPITokensPerUser   = 20
+)
+
+const apiTokenContextKey contextKey = "api_token"
+
+type createAPITokenRequest struct {
+	Name string `json:"name"`
+}
+
+type createAPITokenResponse struct {
+	Token  session.APIToken `json:"token"`
+	Secret string           `json:"secret"`
+}
+
+func (h Handler) ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	tokens, err := h.sessions.ListAPITokens(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to read api tokens")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tokens": tokens})
+}
+
+// CreateAPIToken issues a bearer token for the OpenAI-compatible endpoints.
+// The secret is only returned here.
+func (h Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	var req createAPITokenRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "name is required")
+		return
+	}
+	if len([]rune(name)) > maxAPITokenNameLength {
+		writeError(w, http.StatusBadRequest, "invalid_request", "name must be at most 100 characters")
+		return
+	}
+
+	token, secret, err := h.sessions.CreateAPIToken(r.Context(), user.ID, name, maxAPITokensPerUser)
+	if errors.Is(err, session.ErrAPITokenLimit) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "a maximum of 20 api tokens is supported")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to create api token")
+		return
+	}
+	writeJSON(w, http.StatusCreated, createAPITokenResponse{Token: token, Secret: secret})
+}
+
+func (h Handler) DeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	tokenID := strings.TrimSpace(chi.URLParam(r, "id"))
+	if tokenID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "token id is required")
+		return
+	}
+
+	err = h.sessions.DeleteAPIToken(r.Context(), user.ID, tokenID)
+	if errors.Is(err, session.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "api_token_not_found", "api token not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to delete api token")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true})
+}
+
+// RequireAPIToken authenticates a bearer API token and puts its owner in the
+// context the same way RequireSession does.
+func (h Handler) RequireAPIToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawToken, err := readBearerToken(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid bearer token")
+			return
+		}
+
+		user, tokenID, err := h.sessions.ResolveAPIToken(r.Context(), rawToken)
+		if errors.Is(err, session.ErrNotFound) {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid bearer token")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve api token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), sessionUserContextKey, user)
+		ctx = context.WithValue(ctx, apiTokenContextKey, tokenID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func apiTokenIDFromContext(ctx context.Context) (string, bool) {
+	tokenID, ok := ctx.Value(apiTokenContextKey).(string)
+	return tokenID, ok && tokenID != ""
+}
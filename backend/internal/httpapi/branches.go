@@ -0,0 +1,191 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type switchBranchRequest struct {
+	MessageID string `json:"messageId"`
+}
+
+// SwitchConversationBranch makes the branch containing messageId active. When
+// messageId has descendants, the newest child is followed at every level, so
+// picking a sibling lands on the latest reply in that branch.
+func (h Handler) SwitchConversationBranch(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	conversationID := strings.TrimSpace(chi.URLParam(r, "id"))
+	if conversationID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "conversation id is required")
+		return
+	}
+
+	var req switchBranchRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	messageID := strings.TrimSpace(req.MessageID)
+	if messageID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "messageId is required")
+		return
+	}
+
+	exists, err := h.conversationExists(r.Context(), user.ID, conversationID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to read conversation")
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "conversation_not_found", "conversation not found")
+		return
+	}
+
+	leafMessageID, err := h.latestBranchLeafMessageID(r.Context(), user.ID, conversationID, messageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "message_not_found", "message not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve branch")
+		return
+	}
+
+	if _, err := h.db.ExecContext(r.Context(), `
+UPDATE conversations
+SET active_leaf_message_id = ?
+WHERE id = ? AND user_id = ?;
+`, leafMessageID, conversationID, user.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to switch branch")
+		return
+	}
+
+	messages, info, err := h.listActivePathMessages(r.Context(), user.ID, conversationID, pageRequest{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to read messages")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"messages": messages, "page": info})
+}
+
+func (h Handler) activeLeafMessageID(ctx context.Context, userID, conversationID string) (string, error) {
+	return readActiveLeafMessageID(ctx, h.db, userID, conversationID)
+}
+
+func readActiveLeafMessageID(ctx context.Context, q rowQuerier, userID, conversationID string) (string, error) {
+	var leafMessageID sql.NullString
+	err := q.QueryRowContext(ctx, `
+SELECT COALESCE(
+  c.active_leaf_message_id,
+  (SELECT m.id FROM messages m WHERE m.conversation_id = c.id ORDER BY m.created_at DESC, m.rowid DESC LIMIT 1)
+)
+FROM conversations c
+WHERE c.id = ? AND c.user_id = ?
+LIMIT 1;
+`, conversationID, userID).Scan(&leafMessageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return leafMessageID.String, nil
+}
+
+func (h Handler) latestBranchLeafMessageID(ctx context.Context, userID, conversationID, messageID string) (string, error) {
+	var leafMessageID string
+	err := h.db.QueryRowContext(ctx, `
+WITH RECURSIVE descent(id, depth) AS (
+  SELECT m.id, 0
+  FROM messages m
+  JOIN conversations c ON c.id = m.conversation_id
+  WHERE m.id = ? AND m.conversation_id = ? AND c.user_id = ?
+  UNION ALL
+  SELECT (
+    SELECT child.id
+    FROM messages child
+    WHERE child.parent_message_id = descent.id AND child.role <> 'tool'
+    ORDER BY child.created_at DESC, child.rowid DESC
+    LIMIT 1
+  ), descent.depth + 1
+  FROM descent
+  WHERE descent.id IS NOT NULL
+)
+SELECT id
+FROM descent
+WHERE id IS NOT NULL
+ORDER BY depth DESC
+LIMIT 1;
+`, messageID, conversationID, userID).Scan(&leafMessageID)
+	if err != nil {
+		return "", err
+	}
+	return leafMessageID, nil
+}
+
+// listConversationMessageSiblings groups message IDs by parent, oldest first,
+// for the given parent keys. Root messages use the empty parent key.
+func (h Handler) listConversationMessageSiblings(ctx context.Context, userID, conversationID string, parentKeys []string) (map[string][]string, error) {
+	parentKeys = slices.Compact(slices.Sorted(slices.Values(parentKeys)))
+	if len(parentKeys) == 0 {
+		return map[string][]string{}, nil
+	}
+
+	args := make([]any, 0, len(parentKeys)+2)
+	args = append(args, conversationID, userID)
+	for _, parentKey := range parentKeys {
+		args = append(args, parentKey)
+	}
+
+	placeholders := strings.TrimRight(strings.Repeat("?,", len(parentKeys)), ",")
+	rows, err := h.db.QueryContext(ctx, fmt.Sprintf(`
+SELECT m.id, COALESCE(m.parent_message_id, '')
+FROM messages m
+JOIN conversations c ON c.id = m.conversation_id
+WHERE m.conversation_id = ? AND c.user_id = ? AND COALESCE(m.parent_message_id, '') IN (%s) AND m.role <> 'tool'
+ORDER BY m.created_at ASC, m.rowid ASC;
+`, placeholders), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string][]string)
+	for rows.Next() {
+		var messageID string
+		var parentMessageID string
+		if err := rows.Scan(&messageID, &parentMessageID); err != nil {
+			return nil, err
+		}
+		out[parentMessageID] = append(out[parentMessageID], messageID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func messageParentKey(message messageResponse) string {
+	if message.ParentMessageID == nil {
+		return ""
+	}
+	return *message.ParentMessageID
+}
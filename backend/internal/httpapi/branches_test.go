@@ -0,0 +1,136 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+func TestSwitchConversationBranchRestoresOriginalPathAndHistory(t *testing.T) {
+	capturedRequests := make([]openrouter.StreamRequest, 0, 4)
+	streamer := stubStreamer{
+		tokens: []string{"Ack"},
+		onRequest: func(req openrouter.StreamRequest) {
+			capturedRequests = append(capturedRequests, req)
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	postChatMessage(t, handler, user, `{"message":"Turn one","modelId":"openrouter/free"}`)
+	var conversationID string
+	if err := db.QueryRow(`SELECT id FROM conversations WHERE user_id = ? LIMIT 1;`, user.ID).Scan(&conversationID); err != nil {
+		t.Fatalf("query conversation: %v", err)
+	}
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversationID+`","message":"Turn two","modelId":"openrouter/free"}`)
+
+	var originalMessageID string
+	if err := db.QueryRow(`SELECT id FROM messages WHERE conversation_id = ? AND content = 'Turn two';`, conversationID).Scan(&originalMessageID); err != nil {
+		t.Fatalf("query original message: %v", err)
+	}
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversationID+`","editMessageId":"`+originalMessageID+`","message":"Turn two edited","modelId":"openrouter/free"}`)
+
+	req := httptest.NewRequest(
+		http.MethodPut,
+		"/v1/conversations/"+conversationID+"/active-branch",
+		strings.NewReader(`{"messageId":"`+originalMessageID+`"}`),
+	)
+	req = requestWithConversationID(requestWithSessionUser(req, user), conversationID)
+	resp := httptest.NewRecorder()
+	handler.SwitchConversationBranch(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	var payload struct {
+		Messages []messageResponse `json:"messages"`
+	}
+	decodeJSONBody(t, resp, &payload)
+	if len(payload.Messages) != 4 {
+		t.Fatalf("expected 4 messages on the original branch, got %+v", payload.Messages)
+	}
+	switched := payload.Messages[2]
+	if switched.ID != originalMessageID || switched.SiblingCount != 2 || switched.SiblingIndex != 0 {
+		t.Fatalf("expected original message as first of two siblings, got %+v", switched)
+	}
+	if payload.Messages[3].Role != "assistant" {
+		t.Fatalf("expected branch to extend to its latest reply, got %+v", payload.Messages[3])
+	}
+
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversationID+`","message":"Turn three","modelId":"openrouter/free"}`)
+
+	generationRequests := filterGenerationRequests(capturedRequests)
+	lastPrompt := generationRequests[len(generationRequests)-1].Messages
+	var sawOriginal bool
+	for _, message := range lastPrompt {
+		if message.Content == "Turn two edited" {
+			t.Fatalf("expected inactive branch to be excluded from prompt history, got %+v", lastPrompt)
+		}
+		if message.Content == "Turn two" {
+			sawOriginal = true
+		}
+	}
+	if !sawOriginal {
+		t.Fatalf("expected active branch in prompt history, got %+v", lastPrompt)
+	}
+}
+
+func TestSwitchConversationBranchRejectsUnknownMessage(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	owner := session.User{ID: "user-1"}
+	other := session.User{ID: "user-2"}
+	seedUser(t, db, owner.ID, "user1@example.com")
+	seedUser(t, db, other.ID, "user2@example.com")
+
+	conversation, err := handler.insertConversation(context.Background(), owner.ID, "Branches")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	otherConversation, err := handler.insertConversation(context.Background(), other.ID, "Other")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	if err := handler.insertMessage(context.Background(), other.ID, otherConversation.ID, "user", "hello", "", true, false); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	var foreignMessageID string
+	if err := db.QueryRow(`SELECT id FROM messages WHERE conversation_id = ?;`, otherConversation.ID).Scan(&foreignMessageID); err != nil {
+		t.Fatalf("query message: %v", err)
+	}
+
+	for _, messageID := range []string{"missing", foreignMessageID} {
+		req := httptest.NewRequest(
+			http.MethodPut,
+			"/v1/conversations/"+conversation.ID+"/active-branch",
+			strings.NewReader(`{"messageId":"`+messageID+`"}`),
+		)
+		req = requestWithConversationID(requestWithSessionUser(req, owner), conversation.ID)
+		resp := httptest.NewRecorder()
+		handler.SwitchConversationBranch(resp, req)
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("expected status %d for %q, got %d (%s)", http.StatusNotFound, messageID, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func postChatMessage(t *testing.T, handler Handler, user session.User, body string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(body))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, resp.Code, resp.Body.String())
+	}
+}
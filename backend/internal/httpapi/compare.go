@@ -0,0 +1,448 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/research"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	minCompareModels = 2
+	maxCompareModels = 4
+)
+
+var (
+	errInvalidCompareModels = errors.New("compareModelIds must list 2 to 4 distinct models")
+	errNotComparisonAnswer  = errors.New("message is not a comparison answer")
+)
+
+// compareTarget is one model of a comparison with the settings resolved for
+// it.
+type compareTarget struct {
+	ModelID         string
+	ReasoningEffort string
+	Sampling        openrouter.SamplingParams
+}
+
+type compareStreamInput struct {
+	UserID         string
+	UserMessageID  string
+	ConversationID string
+	Targets        []compareTarget
+	Message        string
+	Prompt         string
+	Images         []openrouter.ContentPart
+	Grounding      bool
+	Instructions   string
+	History        []historyMessage
+}
+
+type comparisonResponse struct {
+	ModelIDs        []string `json:"modelIds"`
+	WinnerMessageID *string  `json:"winnerMessageId,omitempty"`
+}
+
+// normalizeCompareModelIDs trims and checks compareModelIds. An empty list
+// means the turn is not a comparison.
+func normalizeCompareModelIDs(raw []string) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	modelIDs := make([]string, 0, len(raw))
+	for _, modelID := range raw {
+		modelID = strings.TrimSpace(modelID)
+		if modelID == "" || slices.Contains(modelIDs, modelID) {
+			return nil, errInvalidCompareModels
+		}
+		modelIDs = append(modelIDs, modelID)
+	}
+	if len(modelIDs) < minCompareModels || len(modelIDs) > maxCompareModels {
+		return nil, errInvalidCompareModels
+	}
+	return modelIDs, nil
+}
+
+// resolveCompareTargets resolves reasoning effort, sampling and image support
+// for each model the way a single-model turn does. Errors name the model.
+func (h Handler) resolveCompareTargets(ctx context.Context, userID string, modelIDs []string, reasoningEffort string, sampling samplingParams, files []storedFile) ([]compareTarget, error) {
+	targets := make([]compareTarget, 0, len(modelIDs))
+	for _, modelID := range modelIDs {
+		effort, err := h.resolveReasoningEffort(ctx, userID, modelID, "chat", reasoningEffort)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", modelID, err)
+		}
+		params, err := h.resolveSamplingParams(ctx, userID, modelID, "chat", sampling)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", modelID, err)
+		}
+		if err := h.checkImageAttachments(ctx, modelID, false, files); err != nil {
+			return nil, fmt.Errorf("%s: %w", modelID, err)
+		}
+		targets = append(targets, compareTarget{ModelID: modelID, ReasoningEffort: effort, Sampling: params})
+	}
+	return targets, nil
+}
+
+func (h Handler) insertMessageComparison(ctx context.Context, conversationID, userMessageID string, modelIDs []string) error {
+	encoded, err := json.Marshal(modelIDs)
+	if err != nil {
+		return err
+	}
+	_, err = h.db.ExecContext(ctx, `
+INSERT INTO message_comparisons (user_message_id, conversation_id, model_ids_json)
+VALUES (?, ?, ?);
+`, userMessageID, conversationID, string(encoded))
+	return err
+}
+
+// streamCompareResponse answers one user message with every target model at
+// once. Grounding runs once and is shared; each answer streams with its
+// modelId on every event and is persisted as its own assistant reply. The
+// first model's answer is left active until the user picks a winner.
+func (h Handler) streamCompareResponse(ctx context.Context, stream *generationStream, input compareStreamInput) {
+	timeSensitive := isTimeSensitivePrompt(input.Message)
+	modelIDs := make([]string, 0, len(input.Targets))
+	for _, target := range input.Targets {
+		modelIDs = append(modelIDs, target.ModelID)
+	}
+
+	_ = stream.send(map[string]any{
+		"type":            "metadata",
+		"grounding":       input.Grounding,
+		"deepResearch":    false,
+		"modelId":         modelIDs[0],
+		"compareModelIds": modelIDs,
+		"conversationId":  input.ConversationID,
+		"userMessageId":   input.UserMessageID,
+		"generationId":    stream.id,
+	})
+
+	traceCollector := newThinkingTraceCollector()
+	groundingCitations, groundingWarning := h.resolveGroundingContext(
+		ctx,
+		input.Message,
+		input.Grounding,
+		timeSensitive,
+		modelIDs[0],
+		plannerReasoningEffort(input.Targets[0].ReasoningEffort),
+		func(progress research.Progress) {
+			traceCollector.AppendProgress(progress)
+			_ = stream.send(progressEventData(progress))
+		},
+	)
+	if groundingWarning != "" {
+		_ = stream.send(map[string]any{
+			"type":    "warning",
+			"scope":   "grounding",
+			"message": groundingWarning,
+		})
+	}
+	if input.Grounding {
+		synthesizingProgress := summarizedProgress(research.Progress{
+			Phase:   research.PhaseSynthesizing,
+			Message: "Preparing grounded responses",
+		}, research.ProgressSummaryInput{
+			Phase: research.PhaseSynthesizing,
+		})
+		traceCollector.AppendProgress(synthesizingProgress)
+		_ = stream.send(progressEventData(synthesizingProgress))
+	}
+
+	systemMessages := []openrouter.Message{
+		{Role: "system", Content: buildSystemPrompt(input.Grounding, false, len(groundingCitations) > 0, timeSensitive)},
+	}
+	if input.Instructions != "" {
+		systemMessages = append(systemMessages, openrouter.Message{Role: "system", Content: input.Instructions})
+	}
+	if len(groundingCitations) > 0 {
+		systemMessages = append(systemMessages, openrouter.Message{
+			Role:    "system",
+			Content: buildGroundingPrompt(groundingCitations, timeSensitive),
+		})
+	}
+
+	// History is trimmed per model, and may be summarized, before the answers
+	// start so the summary is not refreshed concurrently.
+	requests := make([]openrouter.StreamRequest, len(input.Targets))
+	for i, target := range input.Targets {
+		messages := slices.Clone(systemMessages)
+		messages = append(messages, h.promptHistory(ctx, input.UserID, input.ConversationID, target.ModelID, input.Prompt, input.History)...)
+		messages = append(messages, openrouter.Message{
+			Role:    "user",
+			Content: input.Prompt,
+			Parts:   userMessageParts(input.Prompt, input.Images),
+		})
+		requests[i] = openrouter.StreamRequest{
+			Model:          target.ModelID,
+			Messages:       messages,
+			Reasoning:      openRouterReasoningConfig(target.ReasoningEffort),
+			SamplingParams: target.Sampling,
+		}
+	}
+
+	answerIDs := make([]string, len(requests))
+	answers := make([]string, len(requests))
+	answerErrs := make([]error, len(requests))
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		trace := traceCollector.fork()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			answerIDs[i], answers[i], answerErrs[i] = h.streamCompareAnswer(ctx, stream, input, req, trace, groundingCitations)
+		}()
+	}
+	wg.Wait()
+
+	titleReply, titleReplies := "", 0
+	first := slices.IndexFunc(answerIDs, func(id string) bool { return id != "" })
+	if first >= 0 {
+		if len(groundingCitations) > 0 {
+			_ = stream.send(map[string]any{
+				"type":      "citations",
+				"citations": groundingCitations,
+			})
+		}
+		if _, err := h.db.ExecContext(context.WithoutCancel(ctx), `
+UPDATE conversations
+SET active_leaf_message_id = ?
+WHERE id = ? AND user_id = ?;
+`, answerIDs[first], input.ConversationID, input.UserID); err != nil {
+			log.Printf("compare active branch update failed: conversation_id=%s err=%v", input.ConversationID, err)
+		}
+		if answerErrs[first] == nil {
+			saved := 0
+			for _, id := range answerIDs {
+				if id != "" {
+					saved++
+				}
+			}
+			titleReply, titleReplies = answers[first], saved
+		}
+	} else if !generationCancelled(ctx) {
+		_ = stream.send(map[string]any{
+			"type":    "error",
+			"message": "stream interrupted",
+		})
+	}
+
+	endGeneration(ctx, stream)
+	if titleReplies > 0 {
+		h.generateConversationTitle(ctx, stream, input.UserID, input.ConversationID, input.Message, titleReply, titleReplies)
+	}
+}
+
+// streamCompareAnswer streams and persists one model's answer, then sends a
+// compare_result event for it. It returns the persisted message id, empty when
+// nothing was saved.
+func (h Handler) streamCompareAnswer(
+	ctx context.Context,
+	stream *generationStream,
+	input compareStreamInput,
+	req openrouter.StreamRequest,
+	traceCollector *thinkingTraceCollector,
+	citations []citationResponse,
+) (string, string, error) {
+	var assistantContent strings.Builder
+	var reasoningContent strings.Builder
+	var assistantUsage *openrouter.Usage
+	var streamStartedAt time.Time
+	var firstTokenAt time.Time
+
+	markFirstTokenAt := func() {
+		if firstTokenAt.IsZero() {
+			firstTokenAt = time.Now()
+		}
+	}
+
+	streamErr := h.openrouter.StreamChatCompletion(
+		ctx,
+		req,
+		func() error {
+			if streamStartedAt.IsZero() {
+				streamStartedAt = time.Now()
+			}
+			return nil
+		},
+		func(delta string) error {
+			assistantContent.WriteString(delta)
+			markFirstTokenAt()
+			return stream.send(map[string]any{"type": "token", "modelId": req.Model, "delta": delta})
+		},
+		func(reasoning string) error {
+			reasoningContent.WriteString(reasoning)
+			markFirstTokenAt()
+			return stream.send(map[string]any{"type": "reasoning", "modelId": req.Model, "delta": reasoning})
+		},
+		func(usage openrouter.Usage) error {
+			copied := usageWithLocalUsageFallbacks(usage, req.Model, streamStartedAt, firstTokenAt)
+			assistantUsage = &copied
+			return stream.send(map[string]any{
+				"type":    "usage",
+				"modelId": req.Model,
+				"usage":   usageResponseFromOpenRouter(copied),
+			})
+		},
+	)
+	if streamErr != nil {
+		log.Printf("compare answer stream failed: conversation_id=%s model_id=%s err=%v", input.ConversationID, req.Model, streamErr)
+		markGenerationStopped(ctx, traceCollector)
+	} else {
+		traceCollector.MarkDone()
+	}
+
+	result := map[string]any{
+		"type":    "compare_result",
+		"modelId": req.Model,
+		"status":  "failed",
+	}
+	var messageID string
+	if assistantContent.Len() > 0 {
+		// Persist even when ctx was interrupted so the partial answer survives.
+		persistedID, err := h.insertMessageWithCitations(
+			context.WithoutCancel(ctx),
+			input.UserID,
+			input.ConversationID,
+			input.UserMessageID,
+			"assistant",
+			assistantContent.String(),
+			reasoningContent.String(),
+			req.Model,
+			input.Grounding,
+			false,
+			citations,
+			traceCollector.Snapshot(),
+			messageUsageFromOpenRouter(assistantUsage),
+		)
+		if err != nil {
+			log.Printf("compare answer persist failed: conversation_id=%s model_id=%s err=%v", input.ConversationID, req.Model, err)
+			streamErr = err
+		} else {
+			messageID = persistedID
+			result["messageId"] = messageID
+			result["status"] = "interrupted"
+			if streamErr == nil {
+				result["status"] = "completed"
+			}
+			if assistantUsage != nil {
+				h.enrichAndPersistMessageUsageAsync(input.UserID, messageID, req.Model, *assistantUsage, streamStartedAt, firstTokenAt)
+			}
+		}
+	}
+	_ = stream.send(result)
+	return messageID, assistantContent.String(), streamErr
+}
+
+// PickComparisonWinner records messageId as the chosen answer of its
+// comparison and makes its branch the one the conversation continues from.
+func (h Handler) PickComparisonWinner(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	conversationID := strings.TrimSpace(chi.URLParam(r, "id"))
+	messageID := strings.TrimSpace(chi.URLParam(r, "messageId"))
+	if conversationID == "" || messageID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "conversation id and message id are required")
+		return
+	}
+
+	userMessageID, err := h.comparisonForAnswer(r.Context(), user.ID, conversationID, messageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "message_not_found", "message not found")
+		case errors.Is(err, errNotComparisonAnswer):
+			writeError(w, http.StatusBadRequest, "invalid_request", "messageId must reference an answer from a comparison")
+		default:
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve comparison")
+		}
+		return
+	}
+
+	if _, err := h.db.ExecContext(r.Context(), `
+UPDATE message_comparisons
+SET winner_message_id = ?
+WHERE user_message_id = ?;
+`, messageID, userMessageID); err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to record winner")
+		return
+	}
+	leafMessageID, err := h.latestBranchLeafMessageID(r.Context(), user.ID, conversationID, messageID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve branch")
+		return
+	}
+	if _, err := h.db.ExecContext(r.Context(), `
+UPDATE conversations
+SET active_leaf_message_id = ?
+WHERE id = ? AND user_id = ?;
+`, leafMessageID, conversationID, user.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to switch branch")
+		return
+	}
+
+	messages, info, err := h.listActivePathMessages(r.Context(), user.ID, conversationID, pageRequest{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to read messages")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"messages": messages, "page": info})
+}
+
+// comparisonForAnswer returns the user message of the comparison that
+// messageID answered.
+func (h Handler) comparisonForAnswer(ctx context.Context, userID, conversationID, messageID string) (string, error) {
+	var role string
+	var userMessageID sql.NullString
+	err := h.db.QueryRowContext(ctx, `
+SELECT m.role, mc.user_message_id
+FROM messages m
+JOIN conversations c ON c.id = m.conversation_id
+LEFT JOIN message_comparisons mc ON mc.user_message_id = m.parent_message_id
+WHERE m.id = ? AND m.conversation_id = ? AND c.user_id = ?
+LIMIT 1;
+`, messageID, conversationID, userID).Scan(&role, &userMessageID)
+	if err != nil {
+		return "", err
+	}
+	if role != "assistant" || !userMessageID.Valid {
+		return "", errNotComparisonAnswer
+	}
+	return userMessageID.String, nil
+}
+
+func decodeComparison(modelIDsJSON, winnerMessageID sql.NullString) *comparisonResponse {
+	if !modelIDsJSON.Valid {
+		return nil
+	}
+	var modelIDs []string
+	if err := json.Unmarshal([]byte(modelIDsJSON.String), &modelIDs); err != nil {
+		return nil
+	}
+	return &comparisonResponse{
+		ModelIDs:        modelIDs,
+		WinnerMessageID: nullableStringPointer(winnerMessageID),
+	}
+}
@@ -0,0 +1,166 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+func TestChatMessagesComparesModelsAndPicksWinner(t *testing.T) {
+	var mu sync.Mutex
+	var models []string
+	streamer := stubStreamer{
+		tokens: []string{"Hello", " there"},
+		usage:  &openrouter.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+		onRequest: func(req openrouter.StreamRequest) {
+			if isTitleRequest(req) {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			models = append(models, req.Model)
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	seedModel(t, db, "openrouter/other")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Hi","compareModelIds":["openrouter/free","openrouter/other"],"grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	slices.Sort(models)
+	if strings.Join(models, ",") != "openrouter/free,openrouter/other" {
+		t.Fatalf("expected one request per compared model, got %v", models)
+	}
+
+	tokensByModel := map[string]string{}
+	results := map[string]string{}
+	var titleEvent *sseEvent
+	for _, event := range decodeSSEEvents(t, resp.Body.String()) {
+		switch event.Type {
+		case "token":
+			modelID, _ := event.Data["modelId"].(string)
+			if modelID == "" {
+				t.Fatalf("expected every token event to carry a modelId, got %+v", event)
+			}
+			delta, _ := event.Data["delta"].(string)
+			tokensByModel[modelID] += delta
+		case "compare_result":
+			modelID, _ := event.Data["modelId"].(string)
+			results[modelID], _ = event.Data["status"].(string)
+		case "title":
+			titleEvent = &event
+		case "error":
+			t.Fatalf("expected no error event, got %+v", event)
+		}
+	}
+	if tokensByModel["openrouter/free"] != "Hello there" || tokensByModel["openrouter/other"] != "Hello there" {
+		t.Fatalf("expected each answer to stream under its model, got %+v", tokensByModel)
+	}
+	if results["openrouter/free"] != "completed" || results["openrouter/other"] != "completed" {
+		t.Fatalf("expected a completed result per model, got %+v", results)
+	}
+
+	var conversationID, userMessageID string
+	if err := db.QueryRow(`SELECT conversation_id, id FROM messages WHERE role = 'user';`).Scan(&conversationID, &userMessageID); err != nil {
+		t.Fatalf("query user message: %v", err)
+	}
+	answers := map[string]string{}
+	rows, err := db.Query(`SELECT id, model_id FROM messages WHERE role = 'assistant' AND parent_message_id = ? AND total_tokens = 12;`, userMessageID)
+	if err != nil {
+		t.Fatalf("query answers: %v", err)
+	}
+	for rows.Next() {
+		var id, modelID string
+		if err := rows.Scan(&id, &modelID); err != nil {
+			t.Fatalf("scan answer: %v", err)
+		}
+		answers[modelID] = id
+	}
+	_ = rows.Close()
+	if len(answers) != 2 {
+		t.Fatalf("expected two sibling answers with their own usage, got %+v", answers)
+	}
+
+	if titleEvent == nil || titleEvent.Data["conversationId"] != conversationID || titleEvent.Data["title"] != "Hello there" {
+		t.Fatalf("expected a conversation started in compare mode to get a title, got %+v", titleEvent)
+	}
+
+	listed := listMessagesAs(t, handler, user, conversationID, "").Messages
+	if len(listed) != 2 || listed[1].ID != answers["openrouter/free"] || listed[1].SiblingCount != 2 {
+		t.Fatalf("expected the first model's answer to be active among two siblings, got %+v", listed)
+	}
+	comparison := listed[0].Comparison
+	if comparison == nil || strings.Join(comparison.ModelIDs, ",") != "openrouter/free,openrouter/other" || comparison.WinnerMessageID != nil {
+		t.Fatalf("expected the user message to describe the comparison, got %+v", comparison)
+	}
+
+	winnerReq := httptest.NewRequest(http.MethodPut, "/v1/conversations/"+conversationID+"/messages/"+answers["openrouter/other"]+"/winner", nil)
+	winnerReq = requestWithMessageID(requestWithConversationID(requestWithSessionUser(winnerReq, user), conversationID), answers["openrouter/other"])
+	winnerResp := httptest.NewRecorder()
+	handler.PickComparisonWinner(winnerResp, winnerReq)
+	if winnerResp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", winnerResp.Code, winnerResp.Body.String())
+	}
+
+	var picked pagedMessages
+	decodeJSONBody(t, winnerResp, &picked)
+	if len(picked.Messages) != 2 || picked.Messages[1].ID != answers["openrouter/other"] {
+		t.Fatalf("expected the winner to become the active branch, got %+v", picked.Messages)
+	}
+	if winner := picked.Messages[0].Comparison.WinnerMessageID; winner == nil || *winner != answers["openrouter/other"] {
+		t.Fatalf("expected the winner to be recorded, got %+v", picked.Messages[0].Comparison)
+	}
+
+	userReq := httptest.NewRequest(http.MethodPut, "/v1/conversations/"+conversationID+"/messages/"+userMessageID+"/winner", nil)
+	userReq = requestWithMessageID(requestWithConversationID(requestWithSessionUser(userReq, user), conversationID), userMessageID)
+	userResp := httptest.NewRecorder()
+	handler.PickComparisonWinner(userResp, userReq)
+	if userResp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non-answer, got %d body=%s", userResp.Code, userResp.Body.String())
+	}
+}
+
+func TestChatMessagesRejectsInvalidCompareModels(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{tokens: []string{"unused"}})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	tests := map[string]struct {
+		body string
+		want string
+	}{
+		"one model":       {`{"message":"Hi","compareModelIds":["a/one"]}`, "2 to 4 distinct models"},
+		"five models":     {`{"message":"Hi","compareModelIds":["a/1","a/2","a/3","a/4","a/5"]}`, "2 to 4 distinct models"},
+		"duplicate":       {`{"message":"Hi","compareModelIds":["a/1"," a/1"]}`, "2 to 4 distinct models"},
+		"deep research":   {`{"message":"Hi","deepResearch":true,"compareModelIds":["a/1","a/2"]}`, "not supported with deep research"},
+		"response format": {`{"message":"Hi","compareModelIds":["a/1","a/2"],"responseFormat":{"type":"json_object"}}`, "not supported in compare mode"},
+	}
+	for name, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(tc.body))
+		req = requestWithSessionUser(req, user)
+		resp := httptest.NewRecorder()
+		handler.ChatMessages(resp, req)
+		if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), tc.want) {
+			t.Fatalf("%s: expected 400 mentioning %q, got %d body=%s", name, tc.want, resp.Code, resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat/backend/internal/openrouter"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	conversationTitleTimeout  = 5 * time.Second
+	maxGeneratedTitleRunes    = 80
+	maxTitleExchangeTurnRunes = 1500
+)
+
+type updateConversationRequest struct {
+	Title string `json:"title"`
+}
+
+// UpdateConversation renames a conversation. A user-chosen title is locked so
+// generated titles never replace it.
+func (h Handler) UpdateConversation(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	conversationID := strings.TrimSpace(chi.URLParam(r, "id"))
+	if conversationID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "conversation id is required")
+		return
+	}
+
+	var req updateConversationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "title is required")
+		return
+	}
+
+	var conversation conversationResponse
+	err = h.db.QueryRowContext(r.Context(), `
+UPDATE conversations
+SET title = ?, title_locked = 1
+WHERE id = ? AND user_id = ?
+RETURNING id, title, system_prompt, created_at, updated_at;
+`, normalizeConversationTitle(req.Title), conversationID, user.ID).Scan(
+		&conversation.ID,
+		&conversation.Title,
+		&conversation.SystemPrompt,
+		&conversation.CreatedAt,
+		&conversation.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "conversation_not_found", "conversation not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to update conversation")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"conversation": conversation})
+}
+
+// generateConversationTitle replaces the placeholder title taken from the
+// first message once the conversation's first turn is persisted, and pushes
+// a title event. It runs after the turn's final event so the reply is never
+// held up by it, and before the stream closes. turnReplies is how many
+// replies that turn saved: one, or one per model in compare mode. Failures
+// keep the existing title.
+func (h Handler) generateConversationTitle(ctx context.Context, stream *generationStream, userID, conversationID, prompt, reply string, turnReplies int) {
+	eligible, err := h.conversationNeedsTitle(ctx, userID, conversationID, turnReplies)
+	if err != nil {
+		log.Printf("conversation title lookup failed: conversation_id=%s err=%v", conversationID, err)
+		return
+	}
+	if !eligible {
+		return
+	}
+
+	titleCtx, cancel := context.WithTimeout(ctx, conversationTitleTimeout)
+	defer cancel()
+	modelID := fallback(h.cfg.ConversationTitleModel, h.cfg.OpenRouterDefaultModel)
+	title, err := h.requestConversationTitle(titleCtx, modelID, prompt, reply)
+	if err != nil {
+		log.Printf("conversation title generation failed: conversation_id=%s model_id=%s err=%v", conversationID, modelID, err)
+		return
+	}
+
+	result, err := h.db.ExecContext(context.WithoutCancel(ctx), `
+UPDATE conversations
+SET title = ?
+WHERE id = ? AND user_id = ? AND title_locked = 0;
+`, title, conversationID, userID)
+	if err != nil {
+		log.Printf("conversation title persist failed: conversation_id=%s err=%v", conversationID, err)
+		return
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return
+	}
+
+	_ = stream.send(map[string]any{
+		"type":           "title",
+		"conversationId": conversationID,
+		"title":          title,
+	})
+}
+
+// conversationNeedsTitle reports whether the turn's turnReplies are the
+// conversation's only assistant replies and the user has not set a title.
+func (h Handler) conversationNeedsTitle(ctx context.Context, userID, conversationID string, turnReplies int) (bool, error) {
+	var titleLocked bool
+	var assistantReplies int
+	err := h.db.QueryRowContext(ctx, `
+SELECT c.title_locked, (
+  SELECT COUNT(*)
+  FROM messages m
+  WHERE m.conversation_id = c.id AND m.role = 'assistant'
+)
+FROM conversations c
+WHERE c.id = ? AND c.user_id = ?;
+`, conversationID, userID).Scan(&titleLocked, &assistantReplies)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !titleLocked && assistantReplies == turnReplies, nil
+}
+
+func (h Handler) requestConversationTitle(ctx context.Context, modelID, prompt, reply string) (string, error) {
+	var out strings.Builder
+	err := h.openrouter.StreamChatCompletion(
+		ctx,
+		openrouter.StreamRequest{
+			Model: modelID,
+			Messages: []openrouter.Message{
+				{
+					Role:    "system",
+					Content: "You name conversations for a chat sidebar. Reply with a short, specific title of at most six words for the exchange below, in the user's language. Reply with the title only: no quotes, no trailing punctuation.",
+				},
+				{
+					Role:    "user",
+					Content: "User: " + trimToRunes(strings.TrimSpace(prompt), maxTitleExchangeTurnRunes) + "\n\nAssistant: " + trimToRunes(strings.TrimSpace(reply), maxTitleExchangeTurnRunes),
+				},
+			},
+		},
+		nil,
+		func(delta string) error {
+			out.WriteString(delta)
+			return nil
+		},
+		nil,
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+	title := cleanGeneratedTitle(out.String())
+	if title == "" {
+		return "", errors.New("title response was empty")
+	}
+	return title, nil
+}
+
+// cleanGeneratedTitle keeps the first line of a model reply and strips the
+// labels, quotes and markdown models tend to wrap titles in.
+func cleanGeneratedTitle(raw string) string {
+	line := ""
+	for _, candidate := range strings.Split(raw, "\n") {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			line = candidate
+			break
+		}
+	}
+	if len(line) >= len("title:") && strings.EqualFold(line[:len("title:")], "title:") {
+		line = line[len("title:"):]
+	}
+	const wrappers = " \t\"'`*#“”‘’"
+	line = strings.TrimRight(line, wrappers+".!;:,")
+	line = strings.TrimLeft(line, wrappers)
+	line = strings.Join(strings.Fields(line), " ")
+	return strings.TrimSpace(trimToRunes(line, maxGeneratedTitleRunes))
+}
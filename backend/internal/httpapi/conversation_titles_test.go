@@ -0,0 +1,146 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+func TestChatMessagesGeneratesTitleAfterFirstReply(t *testing.T) {
+	var titleRequests []openrouter.StreamRequest
+	streamer := stubStreamer{
+		tokens: []string{"\"Weekend trip ", "to Lisbon.\"\nExtra line"},
+		onRequest: func(req openrouter.StreamRequest) {
+			if isTitleRequest(req) {
+				titleRequests = append(titleRequests, req)
+			}
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+	handler.cfg.ConversationTitleModel = "cheap/title-model"
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Plan a weekend in Lisbon for me please","modelId":"openrouter/free","grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	if len(titleRequests) != 1 || titleRequests[0].Model != "cheap/title-model" {
+		t.Fatalf("expected one title request on the configured model, got %+v", titleRequests)
+	}
+	if !strings.Contains(titleRequests[0].Messages[1].Content, "Plan a weekend in Lisbon") {
+		t.Fatalf("expected the first exchange in the title prompt, got %q", titleRequests[0].Messages[1].Content)
+	}
+
+	var titleEvent *sseEvent
+	events := decodeSSEEvents(t, resp.Body.String())
+	for i := range events {
+		if events[i].Type == "title" {
+			titleEvent = &events[i]
+		}
+	}
+	if titleEvent == nil || titleEvent.Data["title"] != "Weekend trip to Lisbon" {
+		t.Fatalf("expected a title event, got %+v", events)
+	}
+	if last := events[len(events)-1]; last.Type != "title" || events[len(events)-2].Type != "done" {
+		t.Fatalf("expected the title right after done, got %q", last.Type)
+	}
+
+	conversationID, _ := titleEvent.Data["conversationId"].(string)
+	var title string
+	if err := db.QueryRow(`SELECT title FROM conversations WHERE id = ?;`, conversationID).Scan(&title); err != nil {
+		t.Fatalf("query title: %v", err)
+	}
+	if title != "Weekend trip to Lisbon" {
+		t.Fatalf("expected generated title to be persisted, got %q", title)
+	}
+
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversationID+`","message":"And a day trip?","modelId":"openrouter/free","grounding":false}`)
+	if len(titleRequests) != 1 {
+		t.Fatalf("expected no title request after the first reply, got %d", len(titleRequests))
+	}
+}
+
+func TestUpdateConversationRenamesAndLocksTitle(t *testing.T) {
+	titleRequests := 0
+	streamer := stubStreamer{
+		tokens: []string{"Generated"},
+		onRequest: func(req openrouter.StreamRequest) {
+			if isTitleRequest(req) {
+				titleRequests++
+			}
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	conversation, err := handler.insertConversation(t.Context(), user.ID, "")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+
+	renameReq := httptest.NewRequest(http.MethodPatch, "/v1/conversations/"+conversation.ID, strings.NewReader(`{"title":"  My   notes "}`))
+	renameReq = requestWithConversationID(requestWithSessionUser(renameReq, user), conversation.ID)
+	renameResp := httptest.NewRecorder()
+	handler.UpdateConversation(renameResp, renameReq)
+	if renameResp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", renameResp.Code, renameResp.Body.String())
+	}
+	var body struct {
+		Conversation conversationResponse `json:"conversation"`
+	}
+	decodeJSONBody(t, renameResp, &body)
+	if body.Conversation.Title != "My notes" {
+		t.Fatalf("expected normalized title, got %q", body.Conversation.Title)
+	}
+
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversation.ID+`","message":"Hello","modelId":"openrouter/free","grounding":false}`)
+	if titleRequests != 0 {
+		t.Fatalf("expected renamed conversation to skip title generation, got %d requests", titleRequests)
+	}
+
+	emptyReq := httptest.NewRequest(http.MethodPatch, "/v1/conversations/"+conversation.ID, strings.NewReader(`{"title":"   "}`))
+	emptyReq = requestWithConversationID(requestWithSessionUser(emptyReq, user), conversation.ID)
+	emptyResp := httptest.NewRecorder()
+	handler.UpdateConversation(emptyResp, emptyReq)
+	if emptyResp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for empty title, got %d", emptyResp.Code)
+	}
+
+	missingReq := httptest.NewRequest(http.MethodPatch, "/v1/conversations/missing", strings.NewReader(`{"title":"Other"}`))
+	missingReq = requestWithConversationID(requestWithSessionUser(missingReq, user), "missing")
+	missingResp := httptest.NewRecorder()
+	handler.UpdateConversation(missingResp, missingReq)
+	if missingResp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown conversation, got %d", missingResp.Code)
+	}
+}
+
+func TestCleanGeneratedTitle(t *testing.T) {
+	tests := map[string]string{
+		"\"Lisbon Weekend Plan\"":            "Lisbon Weekend Plan",
+		"Title: **Go error handling**.":      "Go error handling",
+		"\n\n  Tax   questions  \nmore text": "Tax questions",
+		"   ":                                "",
+	}
+	for raw, want := range tests {
+		if got := cleanGeneratedTitle(raw); got != want {
+			t.Fatalf("cleanGeneratedTitle(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"regexp"
 	"sort"
 	"strconv"
@@ -14,12 +13,12 @@ import (
 
 	"chat/backend/internal/openrouter"
 	"chat/backend/internal/research"
+	"chat/backend/internal/search"
 )
 
 const (
 	maxDeepResearchCitations = 10
 	maxNormalCitations       = 10
-	braveFreeTierSpacing     = 1100 * time.Millisecond
 )
 
 var citationIndexPattern = regexp.MustCompile(`\[(\d{1,2})\]`)
@@ -30,14 +29,16 @@ type deepResearchStreamInput struct {
 	ConversationID  string
 	ModelID         string
 	ReasoningEffort string
+	Sampling        openrouter.SamplingParams
 	Message         string
 	Prompt          string
 	Grounding       bool
 	IsAnonymous     bool
-	History         []openrouter.Message
+	Instructions    string
+	History         []historyMessage
 }
 
-func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, input deepResearchStreamInput) {
+func (h Handler) streamDeepResearchResponse(ctx context.Context, stream *generationStream, input deepResearchStreamInput) {
 	timeoutSeconds := h.cfg.DeepResearchTimeoutSeconds
 	if timeoutSeconds <= 0 {
 		timeoutSeconds = 150
@@ -60,22 +61,18 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 		len(input.History),
 	)
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
 	metadataEvent := map[string]any{
 		"type":           "metadata",
 		"grounding":      input.Grounding,
 		"deepResearch":   true,
 		"modelId":        input.ModelID,
 		"conversationId": input.ConversationID,
+		"generationId":   stream.id,
 	}
 	if input.ReasoningEffort != "" {
 		metadataEvent["reasoningEffort"] = input.ReasoningEffort
 	}
-	_ = writeSSEEvent(w, metadataEvent)
-	flusher.Flush()
+	_ = stream.send(metadataEvent)
 
 	traceCollector := newThinkingTraceCollector()
 
@@ -97,7 +94,7 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 			Phase: research.PhasePlanning,
 		})
 		traceCollector.AppendProgress(planningProgress)
-		_ = writeSSEEvent(w, progressEventData(planningProgress))
+		_ = stream.send(progressEventData(planningProgress))
 		searchingProgress := summarizedProgress(research.Progress{
 			Phase:   research.PhaseSearching,
 			Message: "Grounding disabled; skipping web search",
@@ -106,8 +103,7 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 			QueryCount: 1,
 		})
 		traceCollector.AppendProgress(searchingProgress)
-		_ = writeSSEEvent(w, progressEventData(searchingProgress))
-		flusher.Flush()
+		_ = stream.send(progressEventData(searchingProgress))
 	} else {
 		searchStartedAt := time.Now()
 		if h.cfg.AgenticResearchDeepEnabled {
@@ -120,8 +116,7 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 				plannerReasoningEffort(input.ReasoningEffort),
 				func(progress research.Progress) {
 					traceCollector.AppendProgress(progress)
-					_ = writeSSEEvent(w, progressEventData(progress))
-					flusher.Flush()
+					_ = stream.send(progressEventData(progress))
 				},
 			)
 			if err != nil {
@@ -140,9 +135,10 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 					err,
 					time.Since(searchStartedAt).Milliseconds(),
 				)
-				_ = writeSSEEvent(w, map[string]any{"type": "error", "message": message})
-				_ = writeSSEEvent(w, map[string]any{"type": "done"})
-				flusher.Flush()
+				if !generationCancelled(researchCtx) {
+					_ = stream.send(map[string]any{"type": "error", "message": message})
+				}
+				endGeneration(researchCtx, stream)
 				return
 			}
 
@@ -167,12 +163,11 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 				MaxPasses:         6,
 				ResultsPerPass:    maxGroundingResults,
 				MaxCitations:      maxDeepResearchCitations,
-				MinSearchInterval: braveFreeTierSpacing,
+				MinSearchInterval: search.MinInterval(h.cfg),
 			})
 			researchResult, err := runner.Run(researchCtx, input.Message, timeSensitive, func(progress research.Progress) {
 				traceCollector.AppendProgress(progress)
-				_ = writeSSEEvent(w, progressEventData(progress))
-				flusher.Flush()
+				_ = stream.send(progressEventData(progress))
 			})
 			if err != nil {
 				message := "deep research interrupted"
@@ -190,9 +185,10 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 					err,
 					time.Since(searchStartedAt).Milliseconds(),
 				)
-				_ = writeSSEEvent(w, map[string]any{"type": "error", "message": message})
-				_ = writeSSEEvent(w, map[string]any{"type": "done"})
-				flusher.Flush()
+				if !generationCancelled(researchCtx) {
+					_ = stream.send(map[string]any{"type": "error", "message": message})
+				}
+				endGeneration(researchCtx, stream)
 				return
 			}
 			searchWarning = strings.TrimSpace(researchResult.Warning)
@@ -208,10 +204,11 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 			)
 			for _, item := range researchResult.Citations {
 				citations = append(citations, citationResponse{
-					URL:            item.URL,
-					Title:          trimToRunes(item.Title, 240),
-					Snippet:        trimToRunes(item.Snippet, 800),
-					SourceProvider: "brave",
+					URL:             item.URL,
+					Title:           trimToRunes(item.Title, 240),
+					Snippet:         trimToRunes(item.Snippet, 800),
+					SourceProvider:  item.SourceProvider,
+					SourceProviders: item.Providers,
 				})
 			}
 		}
@@ -225,12 +222,11 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 			input.UserMessageID,
 			searchWarning,
 		)
-		_ = writeSSEEvent(w, map[string]any{
+		_ = stream.send(map[string]any{
 			"type":    "warning",
 			"scope":   "research",
 			"message": searchWarning,
 		})
-		flusher.Flush()
 	}
 
 	synthesizingProgress := summarizedProgress(research.Progress{
@@ -240,19 +236,21 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 		Phase: research.PhaseSynthesizing,
 	})
 	traceCollector.AppendProgress(synthesizingProgress)
-	_ = writeSSEEvent(w, progressEventData(synthesizingProgress))
-	flusher.Flush()
+	_ = stream.send(progressEventData(synthesizingProgress))
 
 	promptMessages := []openrouter.Message{
 		{Role: "system", Content: buildDeepResearchSystemPrompt(timeSensitive)},
 	}
+	if input.Instructions != "" {
+		promptMessages = append(promptMessages, openrouter.Message{Role: "system", Content: input.Instructions})
+	}
 	if len(citations) > 0 {
 		promptMessages = append(promptMessages, openrouter.Message{
 			Role:    "system",
 			Content: buildDeepResearchEvidencePrompt(citations, timeSensitive),
 		})
 	}
-	promptMessages = append(promptMessages, input.History...)
+	promptMessages = append(promptMessages, h.promptHistory(researchCtx, input.UserID, input.ConversationID, input.ModelID, input.Prompt, input.History)...)
 	promptMessages = append(promptMessages, openrouter.Message{Role: "user", Content: input.Prompt})
 
 	var assistantContent strings.Builder
@@ -260,52 +258,61 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 	var assistantUsage *openrouter.Usage
 	var streamStartedAt time.Time
 	var firstTokenAt time.Time
+	titleReplies := 0
 
 	markFirstTokenAt := func() {
 		if firstTokenAt.IsZero() {
 			firstTokenAt = time.Now()
 		}
 	}
-	streamErr := h.openrouter.StreamChatCompletion(
+	answeredModelID := input.ModelID
+	_, streamErr := h.streamWithModelFallback(
 		researchCtx,
 		openrouter.StreamRequest{
-			Model:     input.ModelID,
-			Messages:  promptMessages,
-			Reasoning: openRouterReasoningConfig(input.ReasoningEffort),
-		},
-		func() error {
-			streamStartedAt = time.Now()
-			return nil
+			Model:          input.ModelID,
+			Messages:       promptMessages,
+			Reasoning:      openRouterReasoningConfig(input.ReasoningEffort),
+			SamplingParams: input.Sampling,
 		},
 		func(delta string) error {
 			assistantContent.WriteString(delta)
 			markFirstTokenAt()
-			if err := writeSSEEvent(w, map[string]any{"type": "token", "delta": delta}); err != nil {
+			if err := stream.send(map[string]any{"type": "token", "delta": delta}); err != nil {
 				return err
 			}
-			flusher.Flush()
 			return nil
 		},
 		func(reasoning string) error {
 			reasoningContent.WriteString(reasoning)
 			markFirstTokenAt()
-			if err := writeSSEEvent(w, map[string]any{"type": "reasoning", "delta": reasoning}); err != nil {
+			if err := stream.send(map[string]any{"type": "reasoning", "delta": reasoning}); err != nil {
 				return err
 			}
-			flusher.Flush()
 			return nil
 		},
-		func(usage openrouter.Usage) error {
-			copied := usageWithLocalUsageFallbacks(usage, input.ModelID, streamStartedAt, firstTokenAt)
-			assistantUsage = &copied
-			if err := writeSSEEvent(w, map[string]any{
-				"type":  "usage",
-				"usage": usageResponseFromOpenRouter(copied),
-			}); err != nil {
-				return err
-			}
-			flusher.Flush()
-			return nil
+		modelFallbackWarning(stream, &answeredModelID),
+		func(req openrouter.StreamRequest, onDelta, onReasoning func(string) error) error {
+			return h.openrouter.StreamChatCompletion(
+				researchCtx,
+				req,
+				func() error {
+					streamStartedAt = time.Now()
+					return nil
+				},
+				onDelta,
+				onReasoning,
+				func(usage openrouter.Usage) error {
+					copied := usageWithLocalUsageFallbacks(usage, answeredModelID, streamStartedAt, firstTokenAt)
+					assistantUsage = &copied
+					if err := stream.send(map[string]any{
+						"type":  "usage",
+						"usage": usageResponseFromOpenRouter(copied),
+					}); err != nil {
+						return err
+					}
+					return nil
+				},
+			)
 		},
 	)
 
@@ -316,11 +323,10 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 		Phase: research.PhaseFinalizing,
 	})
 	traceCollector.AppendProgress(finalizingProgress)
-	_ = writeSSEEvent(w, progressEventData(finalizingProgress))
-	flusher.Flush()
+	_ = stream.send(progressEventData(finalizingProgress))
 
 	if streamErr != nil {
-		traceCollector.MarkStopped("Stopped due to an error")
+		markGenerationStopped(researchCtx, traceCollector)
 	} else {
 		traceCollector.MarkDone()
 	}
@@ -331,10 +337,12 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 	}
 
 	if assistantContent.Len() > 0 {
+		// Persist even when researchCtx ended so the partial reply survives.
 		assistantMessageID, err := h.insertMessageWithCitations(
-			researchCtx,
+			context.WithoutCancel(researchCtx),
 			input.UserID,
 			input.ConversationID,
+			input.UserMessageID,
 			"assistant",
 			assistantContent.String(),
 			reasoningContent.String(),
@@ -356,21 +364,26 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 				assistantContent.Len(),
 				len(orderedCitations),
 			)
-			_ = writeSSEEvent(w, map[string]any{
+			_ = stream.send(map[string]any{
 				"type":    "error",
 				"message": "failed to persist assistant response",
 			})
-			flusher.Flush()
-		} else if len(orderedCitations) > 0 {
-			_ = writeSSEEvent(w, map[string]any{
-				"type":      "citations",
-				"citations": orderedCitations,
-			})
-			flusher.Flush()
+		} else {
+			if len(orderedCitations) > 0 {
+				_ = stream.send(map[string]any{
+					"type":      "citations",
+					"citations": orderedCitations,
+				})
+			}
+			if streamErr == nil {
+				titleReplies = 1
+			}
 		}
 
 		if assistantUsage != nil {
-			h.enrichAndPersistMessageUsageAsync(input.UserID, assistantMessageID, input.ModelID, *assistantUsage, streamStartedAt, firstTokenAt)
+			h.enrichAndPersistMessageUsageAsync(input.UserID, assistantMessageID, answeredModelID, *assistantUsage, streamStartedAt, firstTokenAt)
+		} else if err == nil && answeredModelID != input.ModelID {
+			h.recordAnsweringModel(context.WithoutCancel(researchCtx), assistantMessageID, answeredModelID)
 		}
 	}
 
@@ -393,8 +406,9 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 			len(orderedCitations),
 			time.Since(startedAt).Milliseconds(),
 		)
-		_ = writeSSEEvent(w, map[string]any{"type": "error", "message": message})
-		flusher.Flush()
+		if !generationCancelled(researchCtx) {
+			_ = stream.send(map[string]any{"type": "error", "message": message})
+		}
 	}
 
 	log.Printf(
@@ -408,8 +422,10 @@ func (h Handler) streamDeepResearchResponse(ctx context.Context, w http.Response
 		time.Since(startedAt).Milliseconds(),
 	)
 
-	_ = writeSSEEvent(w, map[string]any{"type": "done"})
-	flusher.Flush()
+	endGeneration(researchCtx, stream)
+	if titleReplies > 0 {
+		h.generateConversationTitle(ctx, stream, input.UserID, input.ConversationID, input.Message, assistantContent.String(), titleReplies)
+	}
 }
 
 func orderCitationsByClaims(citations []citationResponse, answer string) []citationResponse {
@@ -14,6 +14,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"unicode/utf8"
 
@@ -29,6 +30,7 @@ const (
 	maxPerFilePromptTextRunes  = 10_000
 	maxTotalPromptTextRunes    = 30_000
 	defaultObjectStoragePrefix = "chat-uploads"
+	unsupportedFileTypeMessage = "supported file types: .txt, .md, .pdf, .csv, .json, .png, .jpg, .jpeg, .webp, .gif"
 )
 
 var (
@@ -44,12 +46,23 @@ var (
 		".json": {},
 	}
 
+	// supportedImageExtensions maps image uploads to the media type their
+	// content must sniff as.
+	supportedImageExtensions = map[string]string{
+		".png":  "image/png",
+		".jpg":  "image/jpeg",
+		".jpeg": "image/jpeg",
+		".webp": "image/webp",
+		".gif":  "image/gif",
+	}
+
 	filenameSanitizer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
 )
 
 type fileObjectStore interface {
 	Backend() string
 	PutObject(ctx context.Context, objectPath, contentType string, data []byte) error
+	GetObject(ctx context.Context, objectPath string) ([]byte, error)
 	DeleteObject(ctx context.Context, objectPath string) error
 }
 
@@ -67,6 +80,11 @@ type storedFile struct {
 	MediaType     string
 	SizeBytes     int64
 	ExtractedText string
+	StoragePath   string
+}
+
+func (f storedFile) isImage() bool {
+	return strings.HasPrefix(f.MediaType, "image/")
 }
 
 type storedBlobRef struct {
@@ -117,8 +135,9 @@ func (h Handler) UploadFile(w http.ResponseWriter, r *http.Request) {
 
 	filename := sanitizeFilename(header.Filename)
 	extension := strings.ToLower(filepath.Ext(filename))
-	if _, supported := supportedUploadExtensions[extension]; !supported {
-		writeError(w, http.StatusBadRequest, "unsupported_file_type", "supported file types: .txt, .md, .pdf, .csv, .json")
+	imageMediaType, isImage := supportedImageExtensions[extension]
+	if _, supported := supportedUploadExtensions[extension]; !supported && !isImage {
+		writeError(w, http.StatusBadRequest, "unsupported_file_type", unsupportedFileTypeMessage)
 		return
 	}
 
@@ -136,22 +155,33 @@ func (h Handler) UploadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	extractedText, err := extractUploadedText(extension, data)
-	if err != nil {
-		if errors.Is(err, errUnsupportedFileType) {
-			writeError(w, http.StatusBadRequest, "unsupported_file_type", "supported file types: .txt, .md, .pdf, .csv, .json")
+	var extractedText string
+	var mediaType string
+	if isImage {
+		// Images are sent to the model as is, so their bytes must really be
+		// the format the extension claims.
+		if sniffUploadMediaType(data) != imageMediaType {
+			writeError(w, http.StatusBadRequest, "unsupported_file_type", "file content does not match its image extension")
 			return
 		}
-		writeError(w, http.StatusBadRequest, "file_extraction_failed", "failed to extract text from attachment")
-		return
-	}
-	extractedText = trimToRunes(extractedText, maxExtractedTextRunes)
-	if strings.TrimSpace(extractedText) == "" {
-		writeError(w, http.StatusBadRequest, "file_extraction_failed", "attachment did not contain extractable text")
-		return
+		mediaType = imageMediaType
+	} else {
+		extractedText, err = extractUploadedText(extension, data)
+		if err != nil {
+			if errors.Is(err, errUnsupportedFileType) {
+				writeError(w, http.StatusBadRequest, "unsupported_file_type", unsupportedFileTypeMessage)
+				return
+			}
+			writeError(w, http.StatusBadRequest, "file_extraction_failed", "failed to extract text from attachment")
+			return
+		}
+		extractedText = trimToRunes(extractedText, maxExtractedTextRunes)
+		if strings.TrimSpace(extractedText) == "" {
+			writeError(w, http.StatusBadRequest, "file_extraction_failed", "attachment did not contain extractable text")
+			return
+		}
+		mediaType = detectUploadMediaType(header.Header.Get("Content-Type"), extension, data)
 	}
-
-	mediaType := detectUploadMediaType(header.Header.Get("Content-Type"), extension, data)
 	fileID := uuid.NewString()
 	objectPath := h.buildObjectPath(user.ID, fileID, filename)
 
@@ -211,7 +241,7 @@ func (h Handler) resolveUserFiles(ctx context.Context, userID string, requestedF
 	filesByID := make(map[string]storedFile, len(fileIDs))
 	for rows.Next() {
 		var file storedFile
-		if err := rows.Scan(&file.ID, &file.Filename, &file.MediaType, &file.SizeBytes, &file.ExtractedText); err != nil {
+		if err := rows.Scan(&file.ID, &file.Filename, &file.MediaType, &file.SizeBytes, &file.ExtractedText, &file.StoragePath); err != nil {
 			return nil, nil, err
 		}
 		filesByID[file.ID] = file
@@ -241,7 +271,7 @@ func userFilesQuery(userID string, fileIDs []string) (string, []any) {
 
 	placeholders := strings.TrimRight(strings.Repeat("?,", len(fileIDs)), ",")
 	query := fmt.Sprintf(`
-SELECT id, filename, media_type, size_bytes, extracted_text
+SELECT id, filename, media_type, size_bytes, COALESCE(extracted_text, ''), storage_path
 FROM files
 WHERE user_id = ? AND id IN (%s);
 `, placeholders)
@@ -249,13 +279,51 @@ WHERE user_id = ? AND id IN (%s);
 	return query, args
 }
 
-func (h Handler) insertUserMessageWithFiles(ctx context.Context, userID, conversationID, content, modelID string, groundingEnabled, deepResearchEnabled bool, fileIDs []string) (string, error) {
+func (h Handler) listMessageFiles(ctx context.Context, userID, messageID string) ([]storedFile, error) {
+	rows, err := h.db.QueryContext(ctx, `
+SELECT f.id, f.filename, f.media_type, f.size_bytes, COALESCE(f.extracted_text, ''), f.storage_path
+FROM message_files mf
+JOIN files f ON f.id = mf.file_id
+WHERE mf.message_id = ? AND f.user_id = ?
+ORDER BY mf.created_at ASC, mf.rowid ASC;
+`, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make([]storedFile, 0, maxFilesPerMessage)
+	for rows.Next() {
+		var file storedFile
+		if err := rows.Scan(&file.ID, &file.Filename, &file.MediaType, &file.SizeBytes, &file.ExtractedText, &file.StoragePath); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (h Handler) insertUserMessageWithFiles(ctx context.Context, userID, conversationID, parentMessageID, content, modelID string, groundingEnabled, deepResearchEnabled bool, fileIDs []string) (string, error) {
 	tx, err := h.db.BeginTx(ctx, nil)
 	if err != nil {
 		return "", err
 	}
 	defer tx.Rollback()
 
+	messageID, err := insertUserMessageWithFilesTx(ctx, tx, userID, conversationID, parentMessageID, content, modelID, groundingEnabled, deepResearchEnabled, fileIDs)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
+
+func insertUserMessageWithFilesTx(ctx context.Context, tx *sql.Tx, userID, conversationID, parentMessageID, content, modelID string, groundingEnabled, deepResearchEnabled bool, fileIDs []string) (string, error) {
 	nullableModelID, err := resolveNullableModelID(ctx, tx, modelID)
 	if err != nil {
 		return "", err
@@ -266,6 +334,7 @@ func (h Handler) insertUserMessageWithFiles(ctx context.Context, userID, convers
 INSERT INTO messages (
   id,
   conversation_id,
+  parent_message_id,
   user_id,
   role,
   content,
@@ -273,8 +342,8 @@ INSERT INTO messages (
   grounding_enabled,
   deep_research_enabled
 )
-VALUES (?, ?, ?, ?, ?, ?, ?, ?);
-`, messageID, conversationID, userID, "user", content, nullableModelID, boolToInt(groundingEnabled), boolToInt(deepResearchEnabled)); err != nil {
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+`, messageID, conversationID, nullableString(parentMessageID), userID, "user", content, nullableModelID, boolToInt(groundingEnabled), boolToInt(deepResearchEnabled)); err != nil {
 		return "", err
 	}
 
@@ -296,13 +365,9 @@ ON CONFLICT(message_id, file_id) DO NOTHING;
 
 	if _, err := tx.ExecContext(ctx, `
 UPDATE conversations
-SET updated_at = CURRENT_TIMESTAMP
+SET updated_at = CURRENT_TIMESTAMP, active_leaf_message_id = ?
 WHERE id = ? AND user_id = ?;
-`, conversationID, userID); err != nil {
-		return "", err
-	}
-
-	if err := tx.Commit(); err != nil {
+`, messageID, conversationID, userID); err != nil {
 		return "", err
 	}
 	return messageID, nil
@@ -354,6 +419,7 @@ WHERE user_id = ? AND id IN (%s);
 
 func (h Handler) appendFileContextToPrompt(message string, files []storedFile) string {
 	baseMessage := strings.TrimSpace(message)
+	files = slices.DeleteFunc(slices.Clone(files), storedFile.isImage)
 	if len(files) == 0 {
 		return baseMessage
 	}
@@ -427,34 +493,6 @@ WHERE c.user_id = ? AND c.id = ? AND f.user_id = ?;
 	return refs, nil
 }
 
-func (h Handler) listConversationBlobRefsFromMessageRow(ctx context.Context, userID, conversationID string, fromMessageRowID int64) ([]storedBlobRef, error) {
-	rows, err := h.db.QueryContext(ctx, `
-SELECT DISTINCT f.id, f.storage_path
-FROM files f
-JOIN message_files mf ON mf.file_id = f.id
-JOIN messages m ON m.id = mf.message_id
-JOIN conversations c ON c.id = m.conversation_id
-WHERE c.user_id = ? AND c.id = ? AND f.user_id = ? AND m.rowid >= ?;
-`, userID, conversationID, userID, fromMessageRowID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	refs := make([]storedBlobRef, 0, 8)
-	for rows.Next() {
-		var ref storedBlobRef
-		if err := rows.Scan(&ref.FileID, &ref.StoragePath); err != nil {
-			return nil, err
-		}
-		refs = append(refs, ref)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return refs, nil
-}
-
 func (h Handler) listAllUserConversationBlobRefs(ctx context.Context, userID string) ([]storedBlobRef, error) {
 	rows, err := h.db.QueryContext(ctx, `
 SELECT DISTINCT f.id, f.storage_path
@@ -535,7 +573,7 @@ WHERE id = ? AND user_id = ?;
 			continue
 		}
 
-		if h.files != nil && storageBackend == "gcs" && strings.TrimSpace(storagePath) != "" {
+		if h.files != nil && storageBackend == h.files.Backend() && strings.TrimSpace(storagePath) != "" {
 			if err := h.files.DeleteObject(ctx, storagePath); err != nil {
 				log.Printf("cleanup attachment blob delete failed: user_id=%s file_id=%s path=%s err=%v", userID, candidate.FileID, storagePath, err)
 			}
@@ -619,16 +657,20 @@ func detectUploadMediaType(headerContentType, extension string, data []byte) str
 	}
 
 	if len(data) > 0 {
-		sniffLen := len(data)
-		if sniffLen > 512 {
-			sniffLen = 512
-		}
-		return http.DetectContentType(data[:sniffLen])
+		return sniffUploadMediaType(data)
 	}
 
 	return "application/octet-stream"
 }
 
+func sniffUploadMediaType(data []byte) string {
+	sniffLen := len(data)
+	if sniffLen > 512 {
+		sniffLen = 512
+	}
+	return http.DetectContentType(data[:sniffLen])
+}
+
 func sanitizeFilename(raw string) string {
 	base := strings.TrimSpace(filepath.Base(raw))
 	if base == "" || base == "." || base == string(filepath.Separator) {
@@ -0,0 +1,508 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"chat/backend/internal/research"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// generationRetention is how long a finished generation's events stay
+// replayable after its last event.
+const generationRetention = 5 * time.Minute
+
+// maxBufferedGenerationEvents caps a generation's replay buffer. Past it the
+// oldest quarter is dropped at a time, and subscribers resuming from before
+// the buffer are told their replay is truncated.
+const maxBufferedGenerationEvents = 10000
+
+const (
+	generationStatusRunning     = "running"
+	generationStatusCompleted   = "completed"
+	generationStatusCancelled   = "cancelled"
+	generationStatusInterrupted = "interrupted"
+	generationStatusFailed      = "failed"
+)
+
+var (
+	errGenerationsDraining   = errors.New("server is shutting down")
+	errGenerationCancelled   = errors.New("generation cancelled by user")
+	errGenerationInterrupted = errors.New("generation interrupted by server shutdown")
+)
+
+type generationEvent struct {
+	ID   int
+	Data []byte
+}
+
+// generationStream buffers every SSE event of one chat or deep-research turn so
+// any number of clients can subscribe, drop and reattach from Last-Event-ID.
+type generationStream struct {
+	id             string
+	userID         string
+	conversationID string
+	userMessageID  string
+	startedAt      time.Time
+	now            func() time.Time
+
+	mu         sync.Mutex
+	cancel     context.CancelCauseFunc
+	events     []generationEvent
+	dropped    int
+	done       bool
+	status     string
+	finishedAt time.Time
+	changed    chan struct{}
+}
+
+// generationManager runs generations on a server-owned context, so they keep
+// going and persist their reply after the requesting client disconnects.
+type generationManager struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	running sync.WaitGroup
+
+	mu       sync.Mutex
+	streams  map[string]*generationStream
+	draining bool
+	now      func() time.Time
+}
+
+func newGenerationManager() *generationManager {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &generationManager{
+		ctx:     ctx,
+		cancel:  cancel,
+		streams: make(map[string]*generationStream),
+		now:     time.Now,
+	}
+}
+
+// start registers a generation and runs it in the background. It fails once
+// Shutdown has begun.
+func (g *generationManager) start(
+	userID string,
+	conversationID string,
+	userMessageID string,
+	run func(ctx context.Context, stream *generationStream),
+) (*generationStream, error) {
+	g.mu.Lock()
+	if g.draining {
+		g.mu.Unlock()
+		return nil, errGenerationsDraining
+	}
+	stream := g.registerLocked(userID, conversationID, userMessageID)
+	ctx, cancel := context.WithCancelCause(g.ctx)
+	stream.cancel = cancel
+	g.running.Add(1)
+	g.mu.Unlock()
+
+	go func() {
+		defer g.running.Done()
+		defer cancel(nil)
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("generation panicked: generation_id=%s user_id=%s conversation_id=%s err=%v", stream.id, userID, conversationID, recovered)
+				stream.finish(generationStatusFailed)
+			}
+		}()
+
+		run(ctx, stream)
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, errGenerationCancelled):
+			stream.finish(generationStatusCancelled)
+		case errors.Is(cause, errGenerationInterrupted):
+			stream.finish(generationStatusInterrupted)
+		default:
+			stream.finish(generationStatusCompleted)
+		}
+	}()
+	return stream, nil
+}
+
+func (g *generationManager) registerLocked(userID, conversationID, userMessageID string) *generationStream {
+	stream := &generationStream{
+		id:             uuid.NewString(),
+		userID:         userID,
+		conversationID: conversationID,
+		userMessageID:  userMessageID,
+		startedAt:      g.now(),
+		now:            g.now,
+		status:         generationStatusRunning,
+		changed:        make(chan struct{}),
+	}
+	g.pruneLocked()
+	g.streams[stream.id] = stream
+	return stream
+}
+
+func (g *generationManager) lookup(userID, generationID string) (*generationStream, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pruneLocked()
+	stream, ok := g.streams[generationID]
+	if !ok || stream.userID != userID {
+		return nil, false
+	}
+	return stream, true
+}
+
+func (g *generationManager) isDraining() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.draining
+}
+
+func (g *generationManager) pruneLocked() {
+	cutoff := g.now().Add(-generationRetention)
+	for id, stream := range g.streams {
+		stream.mu.Lock()
+		expired := stream.done && stream.finishedAt.Before(cutoff)
+		stream.mu.Unlock()
+		if expired {
+			delete(g.streams, id)
+		}
+	}
+}
+
+// Shutdown stops accepting generations and waits for running ones to finish.
+// If ctx ends first, the rest are interrupted so they persist their partial
+// reply, and ctx's error is returned once they have.
+func (g *generationManager) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.draining = true
+	g.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		g.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	g.cancel(errGenerationInterrupted)
+	<-drained
+	return ctx.Err()
+}
+
+// send assigns the next event ID, buffers the payload and wakes subscribers.
+func (s *generationStream) send(payload any) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal sse payload: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return nil
+	}
+	s.events = append(s.events, generationEvent{ID: s.dropped + len(s.events) + 1, Data: encoded})
+	if len(s.events) > maxBufferedGenerationEvents {
+		drop := maxBufferedGenerationEvents / 4
+		s.events = append([]generationEvent(nil), s.events[drop:]...)
+		s.dropped += drop
+	}
+	s.broadcastLocked()
+	return nil
+}
+
+// requestCancel stops a running generation. It reports false once the
+// generation has finished.
+func (s *generationStream) requestCancel() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done || s.cancel == nil {
+		return false
+	}
+	s.cancel(errGenerationCancelled)
+	return true
+}
+
+// wait blocks until the generation finishes or ctx ends.
+func (s *generationStream) wait(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		done, changed := s.done, s.changed
+		s.mu.Unlock()
+		if done {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// finish marks the generation complete with status; later sends are dropped.
+func (s *generationStream) finish(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return
+	}
+	s.done = true
+	s.status = status
+	s.finishedAt = s.now()
+	s.broadcastLocked()
+}
+
+// eventsAfter returns buffered events with IDs above lastEventID, whether the
+// generation has finished, and a channel closed on the next change. When
+// events after lastEventID were already dropped from the buffer, a
+// replay_truncated event carrying the last dropped ID comes first.
+func (s *generationStream) eventsAfter(lastEventID int) ([]generationEvent, bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lastEventID = max(lastEventID, 0)
+	if lastEventID < s.dropped {
+		notice, _ := json.Marshal(map[string]any{
+			"type":          "replay_truncated",
+			"message":       "Earlier events of this generation are no longer available; reload the conversation once it finishes.",
+			"skippedEvents": s.dropped - lastEventID,
+		})
+		events := append([]generationEvent{{ID: s.dropped, Data: notice}}, s.events...)
+		return events, s.done, s.changed
+	}
+	start := min(lastEventID-s.dropped, len(s.events))
+	return s.events[start:], s.done, s.changed
+}
+
+func (s *generationStream) snapshot() generationStatusResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	response := generationStatusResponse{
+		ID:             s.id,
+		Status:         s.status,
+		ConversationID: s.conversationID,
+		UserMessageID:  s.userMessageID,
+		LastEventID:    s.dropped + len(s.events),
+		StartedAt:      s.startedAt.UTC().Format(time.RFC3339),
+	}
+	if s.done {
+		finishedAt := s.finishedAt.UTC().Format(time.RFC3339)
+		response.FinishedAt = &finishedAt
+	}
+	return response
+}
+
+func (s *generationStream) broadcastLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func generationCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errGenerationCancelled)
+}
+
+// markGenerationStopped marks a cut-short reply's trace stopped. A deliberate
+// stop always leaves an entry, so the stopped trace is persisted even when no
+// research ran.
+func markGenerationStopped(ctx context.Context, trace *thinkingTraceCollector) {
+	var summary string
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errGenerationCancelled):
+		summary = "Stopped by user"
+	case errors.Is(cause, errGenerationInterrupted):
+		summary = "Stopped by server shutdown"
+	default:
+		trace.MarkStopped("Stopped due to an error")
+		return
+	}
+	trace.AppendProgress(research.Progress{Phase: research.PhaseFinalizing, Message: summary})
+	trace.MarkStopped(summary)
+}
+
+// endGeneration sends the final event: `cancelled` when the user stopped the
+// generation, `done` otherwise.
+func endGeneration(ctx context.Context, stream *generationStream) {
+	if generationCancelled(ctx) {
+		_ = stream.send(map[string]any{"type": "cancelled"})
+		return
+	}
+	_ = stream.send(map[string]any{"type": "done"})
+}
+
+type generationStatusResponse struct {
+	ID             string  `json:"id"`
+	Status         string  `json:"status"`
+	ConversationID string  `json:"conversationId"`
+	UserMessageID  string  `json:"userMessageId"`
+	LastEventID    int     `json:"lastEventId"`
+	StartedAt      string  `json:"startedAt"`
+	FinishedAt     *string `json:"finishedAt,omitempty"`
+}
+
+// GenerationStatus reports whether a generation is still running, for clients
+// that poll instead of holding an event stream open.
+func (h Handler) GenerationStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	stream, ok := h.generations.lookup(user.ID, strings.TrimSpace(chi.URLParam(r, "id")))
+	if !ok {
+		writeError(w, http.StatusNotFound, "generation_not_found", "generation not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"generation": stream.snapshot()})
+}
+
+// CancelGeneration stops a running generation. The partial reply is persisted
+// and subscribers receive a final `cancelled` event.
+func (h Handler) CancelGeneration(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	stream, ok := h.generations.lookup(user.ID, strings.TrimSpace(chi.URLParam(r, "id")))
+	if !ok {
+		writeError(w, http.StatusNotFound, "generation_not_found", "generation not found")
+		return
+	}
+	if !stream.requestCancel() {
+		writeError(w, http.StatusConflict, "generation_finished", "generation already finished")
+		return
+	}
+	if err := stream.wait(r.Context()); err != nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"generation": stream.snapshot()})
+}
+
+// GenerationEvents replays a generation's events after Last-Event-ID and then
+// tails live events until the generation finishes.
+func (h Handler) GenerationEvents(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming_unsupported", "server does not support streaming")
+		return
+	}
+
+	lastEventID := 0
+	rawLastEventID := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if rawLastEventID == "" {
+		rawLastEventID = strings.TrimSpace(r.URL.Query().Get("lastEventId"))
+	}
+	if rawLastEventID != "" {
+		parsed, err := strconv.Atoi(rawLastEventID)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Last-Event-ID must be a non-negative integer")
+			return
+		}
+		lastEventID = parsed
+	}
+
+	stream, ok := h.generations.lookup(user.ID, strings.TrimSpace(chi.URLParam(r, "id")))
+	if !ok {
+		writeError(w, http.StatusNotFound, "generation_not_found", "generation not found")
+		return
+	}
+
+	setSSEHeaders(w)
+	streamGenerationEvents(w, r, flusher, stream, lastEventID)
+}
+
+// streamGenerationEvents writes a generation's events after lastEventID and
+// tails new ones until it finishes or the client goes away. A disconnect only
+// ends the subscription, never the generation.
+func streamGenerationEvents(w http.ResponseWriter, r *http.Request, flusher http.Flusher, stream *generationStream, lastEventID int) {
+	for {
+		events, done, changed := stream.eventsAfter(lastEventID)
+		for _, event := range events {
+			if err := writeSSEFrame(w, event); err != nil {
+				return
+			}
+			lastEventID = event.ID
+		}
+		flusher.Flush()
+		if done {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// runGeneration starts a chat or deep-research turn in the background and
+// streams it to w from the first event.
+func (h Handler) runGeneration(
+	w http.ResponseWriter,
+	r *http.Request,
+	flusher http.Flusher,
+	userID string,
+	conversationID string,
+	userMessageID string,
+	run func(ctx context.Context, stream *generationStream),
+) {
+	stream, err := h.generations.start(userID, conversationID, userMessageID, run)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "shutting_down", err.Error())
+		return
+	}
+
+	setSSEHeaders(w)
+	streamGenerationEvents(w, r, flusher, stream, 0)
+}
+
+func setSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+}
+
+func writeSSEFrame(w io.Writer, event generationEvent) error {
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: message\ndata: %s\n\n", event.ID, event.Data); err != nil {
+		return fmt.Errorf("write sse payload: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestGenerationEventsReplaysAfterLastEventID(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{tokens: []string{"Hello", " world"}})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Hi","modelId":"openrouter/free","grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	original := decodeSSEEvents(t, resp.Body.String())
+	if len(original) < 4 || original[0].Type != "metadata" {
+		t.Fatalf("expected metadata-led stream, got %+v", original)
+	}
+	for i, event := range original {
+		if event.ID != strconv.Itoa(i+1) {
+			t.Fatalf("expected sequential event ids, got %q at %d", event.ID, i)
+		}
+	}
+	generationID, _ := original[0].Data["generationId"].(string)
+	if generationID == "" {
+		t.Fatalf("expected generationId in metadata, got %+v", original[0].Data)
+	}
+
+	replayReq := httptest.NewRequest(http.MethodGet, "/v1/generations/"+generationID+"/events", nil)
+	replayReq.Header.Set("Last-Event-ID", "2")
+	replayReq = requestWithGenerationID(requestWithSessionUser(replayReq, user), generationID)
+	replayResp := httptest.NewRecorder()
+	handler.GenerationEvents(replayResp, replayReq)
+	if replayResp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, replayResp.Code, replayResp.Body.String())
+	}
+
+	replayed := decodeSSEEvents(t, replayResp.Body.String())
+	if len(replayed) != len(original)-2 {
+		t.Fatalf("expected %d replayed events, got %d (%+v)", len(original)-2, len(replayed), replayed)
+	}
+	for i, event := range replayed {
+		want := original[i+2]
+		if event.ID != want.ID || event.Type != want.Type {
+			t.Fatalf("replayed event %d mismatch: got %+v, want %+v", i, event, want)
+		}
+	}
+	if findSSEEvent(replayed, "done") == nil {
+		t.Fatalf("expected replay to include done, got %+v", replayed)
+	}
+}
+
+func TestGenerationEventsTailsLiveEventsUntilFinished(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	stream := startIdleGeneration(t, handler.generations, user.ID, "", "")
+	_ = stream.send(map[string]any{"type": "token", "delta": "first"})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/generations/"+stream.id+"/events", nil)
+	req = requestWithGenerationID(requestWithSessionUser(req, user), stream.id)
+	resp := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		handler.GenerationEvents(resp, req)
+		close(finished)
+	}()
+
+	_ = stream.send(map[string]any{"type": "token", "delta": "second"})
+	_ = stream.send(map[string]any{"type": "done"})
+	stream.finish(generationStatusCompleted)
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected subscriber to return once the generation finished")
+	}
+
+	events := decodeSSEEvents(t, resp.Body.String())
+	if len(events) != 3 || events[0].Data["delta"] != "first" || events[1].Data["delta"] != "second" || events[2].Type != "done" {
+		t.Fatalf("expected buffered and live events in order, got %+v", events)
+	}
+}
+
+func TestGenerationEventsCapsBufferAndReportsTruncatedReplay(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	stream := startIdleGeneration(t, handler.generations, user.ID, "", "")
+	total := maxBufferedGenerationEvents + 10
+	for i := 0; i < total; i++ {
+		_ = stream.send(map[string]any{"type": "token", "delta": "x"})
+	}
+	stream.finish(generationStatusCompleted)
+	if len(stream.events) > maxBufferedGenerationEvents {
+		t.Fatalf("expected at most %d buffered events, got %d", maxBufferedGenerationEvents, len(stream.events))
+	}
+	if status := generationStatusAs(t, handler, user, stream.id); status.LastEventID != total {
+		t.Fatalf("expected last event id %d, got %d", total, status.LastEventID)
+	}
+
+	replay := func(lastEventID int) []sseEvent {
+		req := httptest.NewRequest(http.MethodGet, "/v1/generations/"+stream.id+"/events", nil)
+		req.Header.Set("Last-Event-ID", strconv.Itoa(lastEventID))
+		req = requestWithGenerationID(requestWithSessionUser(req, user), stream.id)
+		resp := httptest.NewRecorder()
+		handler.GenerationEvents(resp, req)
+		return decodeSSEEvents(t, resp.Body.String())
+	}
+
+	truncated := replay(0)
+	if truncated[0].Type != "replay_truncated" || truncated[0].Data["skippedEvents"] != float64(stream.dropped) {
+		t.Fatalf("expected a replay_truncated event first, got %+v", truncated[0])
+	}
+	if truncated[1].ID != strconv.Itoa(stream.dropped+1) || truncated[len(truncated)-1].ID != strconv.Itoa(total) {
+		t.Fatalf("expected the buffered events after the notice, got %s..%s", truncated[1].ID, truncated[len(truncated)-1].ID)
+	}
+
+	resumed := replay(total - 2)
+	if len(resumed) != 2 || resumed[0].ID != strconv.Itoa(total-1) {
+		t.Fatalf("expected a plain replay from inside the buffer, got %+v", resumed)
+	}
+}
+
+func TestGenerationEventsRejectsOtherUsersAndBadLastEventID(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	owner := session.User{ID: "user-1"}
+	other := session.User{ID: "user-2"}
+	seedUser(t, db, owner.ID, "user1@example.com")
+	seedUser(t, db, other.ID, "user2@example.com")
+
+	stream := startIdleGeneration(t, handler.generations, owner.ID, "", "")
+	stream.finish(generationStatusCompleted)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/generations/"+stream.id+"/events", nil)
+	req = requestWithGenerationID(requestWithSessionUser(req, other), stream.id)
+	resp := httptest.NewRecorder()
+	handler.GenerationEvents(resp, req)
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for another user, got %d", http.StatusNotFound, resp.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/generations/"+stream.id+"/events", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	req = requestWithGenerationID(requestWithSessionUser(req, owner), stream.id)
+	resp = httptest.NewRecorder()
+	handler.GenerationEvents(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for invalid Last-Event-ID, got %d", http.StatusBadRequest, resp.Code)
+	}
+}
+
+func TestGenerationManagerPrunesFinishedStreams(t *testing.T) {
+	manager := newGenerationManager()
+	now := time.Now()
+	manager.now = func() time.Time { return now }
+
+	finished := startIdleGeneration(t, manager, "user-1", "", "")
+	finished.finish(generationStatusCompleted)
+	running := startIdleGeneration(t, manager, "user-1", "", "")
+
+	now = now.Add(generationRetention + time.Minute)
+	if _, ok := manager.lookup("user-1", finished.id); ok {
+		t.Fatal("expected finished stream to expire after retention")
+	}
+	if _, ok := manager.lookup("user-1", running.id); !ok {
+		t.Fatal("expected running stream to be kept")
+	}
+}
+
+func TestChatMessagesKeepsGeneratingAfterClientDisconnects(t *testing.T) {
+	clientCtx, disconnect := context.WithCancel(context.Background())
+	handler, db := newTestHandler(t, stubStreamer{
+		tokens: []string{"Still", " here"},
+		onRequest: func(openrouter.StreamRequest) {
+			disconnect()
+		},
+	})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	req := httptest.NewRequestWithContext(clientCtx, http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Hi","modelId":"openrouter/free","grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	handler.ChatMessages(httptest.NewRecorder(), req)
+
+	if err := handler.generations.Shutdown(context.Background()); err != nil {
+		t.Fatalf("drain generations: %v", err)
+	}
+
+	var content string
+	if err := db.QueryRow(`SELECT content FROM messages WHERE role = 'assistant';`).Scan(&content); err != nil {
+		t.Fatalf("query assistant message: %v", err)
+	}
+	if content != "Still here" {
+		t.Fatalf("expected full reply to persist after disconnect, got %q", content)
+	}
+}
+
+func TestGenerationStatusReportsProgress(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	stream := startIdleGeneration(t, handler.generations, user.ID, "conv-1", "msg-1")
+	_ = stream.send(map[string]any{"type": "token", "delta": "first"})
+
+	running := generationStatusAs(t, handler, user, stream.id)
+	if running.Status != generationStatusRunning || running.LastEventID != 1 || running.FinishedAt != nil {
+		t.Fatalf("expected running generation with one event, got %+v", running)
+	}
+	if running.ConversationID != "conv-1" || running.UserMessageID != "msg-1" {
+		t.Fatalf("expected generation to report its conversation, got %+v", running)
+	}
+
+	stream.finish(generationStatusCompleted)
+	completed := generationStatusAs(t, handler, user, stream.id)
+	if completed.Status != generationStatusCompleted || completed.FinishedAt == nil {
+		t.Fatalf("expected completed generation, got %+v", completed)
+	}
+}
+
+func TestGenerationManagerShutdownInterruptsAndPersistsPartialReply(t *testing.T) {
+	streamer := stallingStreamer{started: make(chan struct{})}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Hi","modelId":"openrouter/free","grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		handler.ChatMessages(resp, req)
+		close(finished)
+	}()
+	<-streamer.started
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := handler.generations.Shutdown(shutdownCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected drain deadline to be reported, got %v", err)
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected subscriber to return once the generation was interrupted")
+	}
+
+	var content string
+	if err := db.QueryRow(`SELECT content FROM messages WHERE role = 'assistant';`).Scan(&content); err != nil {
+		t.Fatalf("query assistant message: %v", err)
+	}
+	if content != "Partial" {
+		t.Fatalf("expected partial reply to persist, got %q", content)
+	}
+
+	events := decodeSSEEvents(t, resp.Body.String())
+	generationID, _ := events[0].Data["generationId"].(string)
+	stream, ok := handler.generations.lookup(user.ID, generationID)
+	if !ok || stream.snapshot().Status != generationStatusInterrupted {
+		t.Fatalf("expected interrupted generation %q", generationID)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Again","modelId":"openrouter/free","grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	resp = httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d while draining, got %d", http.StatusServiceUnavailable, resp.Code)
+	}
+}
+
+func TestCancelGenerationPersistsPartialReplyAndEndsStream(t *testing.T) {
+	streamer := stallingStreamer{started: make(chan struct{})}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Hi","modelId":"openrouter/free","grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		handler.ChatMessages(resp, req)
+		close(finished)
+	}()
+	<-streamer.started
+
+	var generationID string
+	handler.generations.mu.Lock()
+	for id := range handler.generations.streams {
+		generationID = id
+	}
+	handler.generations.mu.Unlock()
+
+	cancelResp := cancelGenerationAs(handler, user, generationID)
+	if cancelResp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, cancelResp.Code, cancelResp.Body.String())
+	}
+	var payload struct {
+		Generation generationStatusResponse `json:"generation"`
+	}
+	decodeJSONBody(t, cancelResp, &payload)
+	if payload.Generation.Status != generationStatusCancelled {
+		t.Fatalf("expected cancelled generation, got %+v", payload.Generation)
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected subscriber to return once the generation was cancelled")
+	}
+
+	events := decodeSSEEvents(t, resp.Body.String())
+	for _, event := range events {
+		if event.Type == "error" || event.Type == "done" {
+			t.Fatalf("expected no %s event after cancel, got %+v", event.Type, events)
+		}
+	}
+	if events[len(events)-1].Type != "cancelled" {
+		t.Fatalf("expected stream to end with cancelled, got %+v", events)
+	}
+
+	var content string
+	var rawTrace string
+	if err := db.QueryRow(`SELECT content, thinking_trace_json FROM messages WHERE role = 'assistant';`).Scan(&content, &rawTrace); err != nil {
+		t.Fatalf("query assistant message: %v", err)
+	}
+	if content != "Partial" {
+		t.Fatalf("expected partial reply to persist, got %q", content)
+	}
+	trace, ok := decodeThinkingTraceJSON(rawTrace)
+	if !ok || trace.Status != thinkingTraceStatusStopped || trace.Summary != "Stopped by user" {
+		t.Fatalf("expected stopped thinking trace, got %q", rawTrace)
+	}
+
+	if again := cancelGenerationAs(handler, user, generationID); again.Code != http.StatusConflict {
+		t.Fatalf("expected status %d for a finished generation, got %d", http.StatusConflict, again.Code)
+	}
+	if other := cancelGenerationAs(handler, session.User{ID: "user-2"}, generationID); other.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for another user, got %d", http.StatusNotFound, other.Code)
+	}
+}
+
+// stallingStreamer emits one token and then holds the stream open until its
+// context ends.
+type stallingStreamer struct {
+	stubStreamer
+	started chan struct{}
+}
+
+func (s stallingStreamer) StreamChatCompletion(ctx context.Context, _ openrouter.StreamRequest, _ func() error, onDelta func(string) error, _ func(string) error, _ func(openrouter.Usage) error) error {
+	if err := onDelta("Partial"); err != nil {
+		return err
+	}
+	close(s.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func generationStatusAs(t *testing.T, handler Handler, user session.User, generationID string) generationStatusResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/generations/"+generationID, nil)
+	req = requestWithGenerationID(requestWithSessionUser(req, user), generationID)
+	resp := httptest.NewRecorder()
+
+	handler.GenerationStatus(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, resp.Code, resp.Body.String())
+	}
+	var payload struct {
+		Generation generationStatusResponse `json:"generation"`
+	}
+	decodeJSONBody(t, resp, &payload)
+	return payload.Generation
+}
+
+func cancelGenerationAs(handler Handler, user session.User, generationID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/generations/"+generationID+"/cancel", nil)
+	req = requestWithGenerationID(requestWithSessionUser(req, user), generationID)
+	resp := httptest.NewRecorder()
+	handler.CancelGeneration(resp, req)
+	return resp
+}
+
+func requestWithGenerationID(req *http.Request, generationID string) *http.Request {
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("id", generationID)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+}
+
+// startIdleGeneration starts a generation whose run blocks until the test
+// ends, so the test can drive its stream directly.
+func startIdleGeneration(t *testing.T, manager *generationManager, userID, conversationID, userMessageID string) *generationStream {
+	t.Helper()
+	release := make(chan struct{})
+	stream, err := manager.start(userID, conversationID, userMessageID, func(ctx context.Context, _ *generationStream) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		t.Fatalf("start generation: %v", err)
+	}
+	t.Cleanup(func() { close(release) })
+	return stream
+}
@@ -9,14 +9,15 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"chat/backend/internal/auth"
-	"chat/backend/internal/brave"
 	"chat/backend/internal/config"
 	"chat/backend/internal/openrouter"
 	"chat/backend/internal/research"
+	"chat/backend/internal/search"
 	"chat/backend/internal/session"
 
 	"github.com/go-chi/chi/v5"
@@ -26,7 +27,7 @@ import (
 var (
 	errInvalidReasoningEffort    = errors.New("invalid reasoning effort")
 	errReasoningUnsupportedModel = errors.New("model does not support reasoning")
-	errEditTargetNotUserMessage  = errors.New("edit target is not a user message")
+	errTargetNotUserMessage      = errors.New("target message is not a user message")
 )
 
 type Handler struct {
@@ -35,10 +36,14 @@ type Handler struct {
 	sessions                 session.Store
 	verifier                 auth.Verifier
 	openrouter               chatStreamer
+	toolStreamer             toolCallingStreamer
+	tools                    chatToolRegistry
 	grounding                groundingSearcher
 	researchReader           research.Reader
+	researchCache            research.Cache
 	models                   modelCataloger
 	files                    fileObjectStore
+	generations              *generationManager
 }
 
 type chatStreamer interface {
@@ -58,7 +63,7 @@ type modelCataloger interface {
 }
 
 type groundingSearcher interface {
-	Search(ctx context.Context, query string, count int) ([]brave.SearchResult, error)
+	Search(ctx context.Context, query string, count int) ([]search.Result, error)
 }
 
 func NewHandler(cfg config.Config, db *sql.DB, sessions session.Store, verifier auth.Verifier, streamer chatStreamer) Handler {
@@ -77,14 +82,21 @@ func NewHandlerWithFileStore(
 	if source, ok := streamer.(modelCataloger); ok {
 		catalog = source
 	}
+	var toolStreamer toolCallingStreamer
+	if source, ok := streamer.(toolCallingStreamer); ok {
+		toolStreamer = source
+	}
 	return Handler{
-		cfg:        cfg,
-		db:         db,
-		sessions:   sessions,
-		verifier:   verifier,
-		openrouter: streamer,
-		models:     catalog,
-		files:      fileStore,
+		cfg:          cfg,
+		db:           db,
+		sessions:     sessions,
+		verifier:     verifier,
+		openrouter:   streamer,
+		toolStreamer: toolStreamer,
+		tools:        defaultChatTools(),
+		models:       catalog,
+		files:        fileStore,
+		generations:  newGenerationManager(),
 	}
 }
 
@@ -100,6 +112,7 @@ type modelResponse struct {
 	PromptPriceMUSD   float64 `json:"promptPriceMicrosUsd"`
 	OutputPriceMUSD   float64 `json:"outputPriceMicrosUsd"`
 	SupportsReasoning bool    `json:"supportsReasoning"`
+	SupportsImages    bool    `json:"supportsImages"`
 	Curated           bool    `json:"curated"`
 }
 
@@ -120,6 +133,7 @@ type listModelsResponse struct {
 	Favorites        []string                  `json:"favorites"`
 	Preferences      modelPreferencesResponse  `json:"preferences"`
 	ReasoningPresets []reasoningPresetResponse `json:"reasoningPresets"`
+	SamplingPresets  []samplingPresetResponse  `json:"samplingPresets"`
 }
 
 type syncModelsResponse struct {
@@ -192,6 +206,11 @@ func (h Handler) AuthMe(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
 		return
 	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
 	writeJSON(w, http.StatusOK, map[string]any{"user": user})
 }
 
@@ -250,6 +269,11 @@ func (h Handler) ListModels(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "db_error", "failed to read reasoning presets")
 		return
 	}
+	samplingPresets, err := h.listUserSamplingPresets(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to read sampling presets")
+		return
+	}
 
 	allowed := make(map[string]struct{}, len(models))
 	reasoningSupported := make(map[string]bool, len(models))
@@ -272,6 +296,7 @@ func (h Handler) ListModels(w http.ResponseWriter, r *http.Request) {
 		Favorites:        filteredFavorites,
 		Preferences:      preferences,
 		ReasoningPresets: filteredReasoningPresets,
+		SamplingPresets:  samplingPresets,
 	})
 }
 
@@ -288,7 +313,7 @@ func (h Handler) SyncModels(w http.ResponseWriter, r *http.Request) {
 func (h Handler) listActiveModels(ctx context.Context) ([]modelResponse, error) {
 	rows, err := h.db.QueryContext(ctx, `
 SELECT id, display_name, provider, context_window, prompt_price_microusd, completion_price_microusd, curated
-     , supports_reasoning
+     , supports_reasoning, input_modalities_json
 FROM models
 WHERE is_active = 1
 ORDER BY curated DESC, updated_at DESC
@@ -303,10 +328,12 @@ LIMIT 500;
 	for rows.Next() {
 		var m modelResponse
 		var supportsReasoning int
-		if err := rows.Scan(&m.ID, &m.Name, &m.Provider, &m.ContextWindow, &m.PromptPriceMUSD, &m.OutputPriceMUSD, &m.Curated, &supportsReasoning); err != nil {
+		var inputModalities sql.NullString
+		if err := rows.Scan(&m.ID, &m.Name, &m.Provider, &m.ContextWindow, &m.PromptPriceMUSD, &m.OutputPriceMUSD, &m.Curated, &supportsReasoning, &inputModalities); err != nil {
 			return nil, err
 		}
 		m.SupportsReasoning = supportsReasoning == 1
+		m.SupportsImages = modalitiesIncludeImage(inputModalities)
 		models = append(models, m)
 	}
 	if err := rows.Err(); err != nil {
@@ -353,6 +380,10 @@ WHERE provider = 'openrouter'
 		if err != nil {
 			return 0, err
 		}
+		inputModalities, err := json.Marshal(model.InputModalities)
+		if err != nil {
+			return 0, err
+		}
 		if _, err := tx.ExecContext(ctx, `
 INSERT INTO models (
   id,
@@ -363,10 +394,11 @@ INSERT INTO models (
   completion_price_microusd,
   supported_parameters_json,
   supports_reasoning,
+  input_modalities_json,
   curated,
   is_active
 )
-VALUES (?, 'openrouter', ?, ?, ?, ?, ?, ?, 0, 1)
+VALUES (?, 'openrouter', ?, ?, ?, ?, ?, ?, ?, 0, 1)
 ON CONFLICT(id) DO UPDATE SET
   provider = excluded.provider,
   display_name = excluded.display_name,
@@ -375,9 +407,10 @@ ON CONFLICT(id) DO UPDATE SET
   completion_price_microusd = excluded.completion_price_microusd,
   supported_parameters_json = excluded.supported_parameters_json,
   supports_reasoning = excluded.supports_reasoning,
+  input_modalities_json = excluded.input_modalities_json,
   is_active = 1,
   updated_at = CURRENT_TIMESTAMP;
-`, model.ID, model.Name, model.ContextWindow, model.PromptPriceMicrosUSD, model.CompletionPriceMicrosUSD, string(supportedParameters), boolToInt(model.SupportsReasoning)); err != nil {
+`, model.ID, model.Name, model.ContextWindow, model.PromptPriceMicrosUSD, model.CompletionPriceMicrosUSD, string(supportedParameters), boolToInt(model.SupportsReasoning), string(inputModalities)); err != nil {
 			return 0, err
 		}
 		synced++
@@ -537,17 +570,19 @@ type createConversationRequest struct {
 }
 
 type conversationResponse struct {
-	ID        string `json:"id"`
-	Title     string `json:"title"`
-	CreatedAt string `json:"createdAt"`
-	UpdatedAt string `json:"updatedAt"`
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	SystemPrompt string `json:"systemPrompt"`
+	CreatedAt    string `json:"createdAt"`
+	UpdatedAt    string `json:"updatedAt"`
 }
 
 type citationResponse struct {
-	URL            string `json:"url"`
-	Title          string `json:"title,omitempty"`
-	Snippet        string `json:"snippet,omitempty"`
-	SourceProvider string `json:"sourceProvider,omitempty"`
+	URL             string   `json:"url"`
+	Title           string   `json:"title,omitempty"`
+	Snippet         string   `json:"snippet,omitempty"`
+	SourceProvider  string   `json:"sourceProvider,omitempty"`
+	SourceProviders []string `json:"sourceProviders,omitempty"`
 }
 
 type usageResponse struct {
@@ -563,18 +598,24 @@ type usageResponse struct {
 }
 
 type messageResponse struct {
-	ID                  string             `json:"id"`
-	ConversationID      string             `json:"conversationId"`
-	Role                string             `json:"role"`
-	Content             string             `json:"content"`
-	ReasoningContent    *string            `json:"reasoningContent,omitempty"`
-	ThinkingTrace       *thinkingTrace     `json:"thinkingTrace,omitempty"`
-	ModelID             *string            `json:"modelId,omitempty"`
-	Usage               *usageResponse     `json:"usage,omitempty"`
-	GroundingEnabled    bool               `json:"groundingEnabled"`
-	DeepResearchEnabled bool               `json:"deepResearchEnabled"`
-	Citations           []citationResponse `json:"citations"`
-	CreatedAt           string             `json:"createdAt"`
+	ID                  string              `json:"id"`
+	ConversationID      string              `json:"conversationId"`
+	ParentMessageID     *string             `json:"parentMessageId,omitempty"`
+	Role                string              `json:"role"`
+	Content             string              `json:"content"`
+	ReasoningContent    *string             `json:"reasoningContent,omitempty"`
+	ThinkingTrace       *thinkingTrace      `json:"thinkingTrace,omitempty"`
+	ModelID             *string             `json:"modelId,omitempty"`
+	Usage               *usageResponse      `json:"usage,omitempty"`
+	GroundingEnabled    bool                `json:"groundingEnabled"`
+	DeepResearchEnabled bool                `json:"deepResearchEnabled"`
+	Citations           []citationResponse  `json:"citations"`
+	StructuredOutput    json.RawMessage     `json:"structuredOutput,omitempty"`
+	Comparison          *comparisonResponse `json:"comparison,omitempty"`
+	SiblingIDs          []string            `json:"siblingIds"`
+	SiblingCount        int                 `json:"siblingCount"`
+	SiblingIndex        int                 `json:"siblingIndex"`
+	CreatedAt           string              `json:"createdAt"`
 }
 
 func (h Handler) CreateConversation(w http.ResponseWriter, r *http.Request) {
@@ -616,13 +657,33 @@ func (h Handler) ListConversations(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := h.db.QueryContext(r.Context(), `
-SELECT id, title, created_at, updated_at
+	page, err := parsePageRequest(r, pageCursorConversations, defaultConversationPageLimit, maxConversationPageLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	condition := ""
+	order := "DESC"
+	args := []any{user.ID}
+	switch {
+	case page.Before != nil:
+		condition = "AND (updated_at < ? OR (updated_at = ? AND id < ?))"
+		args = append(args, page.Before.UpdatedAt, page.Before.UpdatedAt, page.Before.ID)
+	case page.After != nil:
+		condition = "AND (updated_at > ? OR (updated_at = ? AND id > ?))"
+		order = "ASC"
+		args = append(args, page.After.UpdatedAt, page.After.UpdatedAt, page.After.ID)
+	}
+	args = append(args, page.Limit+1)
+
+	rows, err := h.db.QueryContext(r.Context(), fmt.Sprintf(`
+SELECT id, title, system_prompt, created_at, updated_at
 FROM conversations
-WHERE user_id = ?
-ORDER BY updated_at DESC, created_at DESC
-LIMIT 200;
-`, user.ID)
+WHERE user_id = ? %s
+ORDER BY updated_at %s, id %s
+LIMIT ?;
+`, condition, order, order), args...)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "db_error", "failed to read conversations")
 		return
@@ -632,7 +693,7 @@ LIMIT 200;
 	conversations := make([]conversationResponse, 0, 16)
 	for rows.Next() {
 		var conversation conversationResponse
-		if err := rows.Scan(&conversation.ID, &conversation.Title, &conversation.CreatedAt, &conversation.UpdatedAt); err != nil {
+		if err := rows.Scan(&conversation.ID, &conversation.Title, &conversation.SystemPrompt, &conversation.CreatedAt, &conversation.UpdatedAt); err != nil {
 			writeError(w, http.StatusInternalServerError, "db_error", "failed to parse conversations")
 			return
 		}
@@ -644,7 +705,22 @@ LIMIT 200;
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{"conversations": conversations})
+	// Conversations are listed newest first, so rows read oldest first for
+	// `after` are flipped back.
+	conversations, hasMore := trimPage(conversations, page.Limit, page.After != nil)
+	var info pageInfo
+	if len(conversations) > 0 {
+		newest := conversations[0]
+		oldest := conversations[len(conversations)-1]
+		info = buildPageInfo(
+			page,
+			hasMore,
+			pageCursor{Kind: pageCursorConversations, UpdatedAt: oldest.UpdatedAt, ID: oldest.ID},
+			pageCursor{Kind: pageCursorConversations, UpdatedAt: newest.UpdatedAt, ID: newest.ID},
+		)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"conversations": conversations, "page": info})
 }
 
 func (h Handler) ListConversationMessages(w http.ResponseWriter, r *http.Request) {
@@ -675,22 +751,76 @@ func (h Handler) ListConversationMessages(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	rows, err := h.db.QueryContext(r.Context(), `
-SELECT m.id, m.conversation_id, m.role, m.content, m.reasoning_content, m.thinking_trace_json, m.model_id, m.prompt_tokens, m.completion_tokens, m.total_tokens, m.reasoning_tokens, m.cost_microusd, m.byok_inference_cost_microusd, m.tokens_per_second, m.usage_model_id, m.usage_provider_name, m.grounding_enabled, m.deep_research_enabled, m.created_at
-FROM messages m
-JOIN conversations c ON c.id = m.conversation_id
-WHERE m.conversation_id = ? AND c.user_id = ?
-ORDER BY m.created_at ASC, m.rowid ASC;
-`, conversationID, user.ID)
+	page, err := parsePageRequest(r, pageCursorMessages, defaultMessagePageLimit, maxMessagePageLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	messages, info, err := h.listActivePathMessages(r.Context(), user.ID, conversationID, page)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "db_error", "failed to read messages")
 		return
 	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"messages": messages, "page": info})
+}
+
+// listActivePathMessages returns a page of the messages on the conversation's
+// active branch, root first, annotated with their sibling branches. Pages are
+// keyed on path_position, which is unique along a branch.
+func (h Handler) listActivePathMessages(ctx context.Context, userID, conversationID string, page pageRequest) ([]messageResponse, pageInfo, error) {
+	limit := page.limitOrDefault(defaultMessagePageLimit)
+	condition := ""
+	order := "DESC"
+	args := []any{conversationID, userID}
+	switch {
+	case page.Before != nil:
+		condition = "WHERE m.path_position < ?"
+		args = append(args, page.Before.PathPosition)
+	case page.After != nil:
+		condition = "WHERE m.path_position > ?"
+		order = "ASC"
+		args = append(args, page.After.PathPosition)
+	}
+	args = append(args, limit+1)
+
+	rows, err := h.db.QueryContext(ctx, fmt.Sprintf(`
+WITH RECURSIVE active_path(id, depth) AS (
+  SELECT COALESCE(
+    c.active_leaf_message_id,
+    (SELECT latest.id FROM messages latest WHERE latest.conversation_id = c.id ORDER BY latest.created_at DESC, latest.rowid DESC LIMIT 1)
+  ), 0
+  FROM conversations c
+  WHERE c.id = ? AND c.user_id = ?
+  UNION ALL
+  SELECT m.parent_message_id, active_path.depth + 1
+  FROM messages m
+  JOIN active_path ON m.id = active_path.id
+  WHERE m.parent_message_id IS NOT NULL
+)
+SELECT m.path_position, m.id, m.conversation_id, m.parent_message_id, m.role, m.content, m.reasoning_content, m.thinking_trace_json, m.model_id, m.prompt_tokens, m.completion_tokens, m.total_tokens, m.reasoning_tokens, m.cost_microusd, m.byok_inference_cost_microusd, m.tokens_per_second, m.usage_model_id, m.usage_provider_name, m.grounding_enabled, m.deep_research_enabled, m.structured_output_json, mc.model_ids_json, mc.winner_message_id, m.created_at
+FROM active_path
+JOIN messages m ON m.id = active_path.id
+LEFT JOIN message_comparisons mc ON mc.user_message_id = m.id
+%s
+ORDER BY m.path_position %s
+LIMIT ?;
+`, condition, order), args...)
+	if err != nil {
+		return nil, pageInfo{}, err
+	}
 	defer rows.Close()
 
-	messages := make([]messageResponse, 0, 32)
+	type pagedMessage struct {
+		pathPosition int64
+		message      messageResponse
+	}
+	paged := make([]pagedMessage, 0, 32)
 	for rows.Next() {
+		var pathPosition int64
 		var message messageResponse
+		var parentMessageID sql.NullString
 		var reasoningContent sql.NullString
 		var thinkingTraceJSON sql.NullString
 		var modelID sql.NullString
@@ -705,10 +835,15 @@ ORDER BY m.created_at ASC, m.rowid ASC;
 		var usageProviderName sql.NullString
 		var groundingEnabled int
 		var deepResearchEnabled int
+		var structuredOutputJSON sql.NullString
+		var compareModelIDsJSON sql.NullString
+		var compareWinnerMessageID sql.NullString
 
 		if err := rows.Scan(
+			&pathPosition,
 			&message.ID,
 			&message.ConversationID,
+			&parentMessageID,
 			&message.Role,
 			&message.Content,
 			&reasoningContent,
@@ -725,12 +860,15 @@ ORDER BY m.created_at ASC, m.rowid ASC;
 			&usageProviderName,
 			&groundingEnabled,
 			&deepResearchEnabled,
+			&structuredOutputJSON,
+			&compareModelIDsJSON,
+			&compareWinnerMessageID,
 			&message.CreatedAt,
 		); err != nil {
-			writeError(w, http.StatusInternalServerError, "db_error", "failed to parse messages")
-			return
+			return nil, pageInfo{}, err
 		}
 
+		message.ParentMessageID = nullableStringPointer(parentMessageID)
 		message.ReasoningContent = nullableStringPointer(reasoningContent)
 		if thinkingTraceJSON.Valid {
 			if trace, ok := decodeThinkingTraceJSON(thinkingTraceJSON.String); ok {
@@ -753,39 +891,75 @@ ORDER BY m.created_at ASC, m.rowid ASC;
 		}
 		message.GroundingEnabled = groundingEnabled == 1
 		message.DeepResearchEnabled = deepResearchEnabled == 1
+		if structuredOutputJSON.Valid && json.Valid([]byte(structuredOutputJSON.String)) {
+			message.StructuredOutput = json.RawMessage(structuredOutputJSON.String)
+		}
+		message.Comparison = decodeComparison(compareModelIDsJSON, compareWinnerMessageID)
 		message.Citations = make([]citationResponse, 0)
-		messages = append(messages, message)
+		paged = append(paged, pagedMessage{pathPosition: pathPosition, message: message})
 	}
 
 	if err := rows.Err(); err != nil {
-		writeError(w, http.StatusInternalServerError, "db_error", "failed to iterate messages")
-		return
+		return nil, pageInfo{}, err
 	}
 
-	citationsByMessageID, err := h.listConversationCitations(r.Context(), user.ID, conversationID)
+	paged, hasMore := trimPage(paged, limit, page.After == nil)
+	messages := make([]messageResponse, 0, len(paged))
+	if len(paged) == 0 {
+		return messages, pageInfo{}, nil
+	}
+
+	messageIDs := make([]string, 0, len(paged))
+	parentKeys := make([]string, 0, len(paged))
+	for _, item := range paged {
+		messages = append(messages, item.message)
+		messageIDs = append(messageIDs, item.message.ID)
+		parentKeys = append(parentKeys, messageParentKey(item.message))
+	}
+
+	citationsByMessageID, err := h.listMessageCitations(ctx, userID, messageIDs)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "db_error", "failed to read citations")
-		return
+		return nil, pageInfo{}, err
+	}
+
+	siblingsByParentID, err := h.listConversationMessageSiblings(ctx, userID, conversationID, parentKeys)
+	if err != nil {
+		return nil, pageInfo{}, err
 	}
 
 	for i := range messages {
 		if citations, ok := citationsByMessageID[messages[i].ID]; ok {
 			messages[i].Citations = citations
 		}
+		siblings := siblingsByParentID[messageParentKey(messages[i])]
+		if len(siblings) == 0 {
+			siblings = []string{messages[i].ID}
+		}
+		messages[i].SiblingIDs = siblings
+		messages[i].SiblingCount = len(siblings)
+		messages[i].SiblingIndex = max(slices.Index(siblings, messages[i].ID), 0)
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{"messages": messages})
+	info := buildPageInfo(page, hasMore, pageCursor{Kind: pageCursorMessages, PathPosition: paged[0].pathPosition}, pageCursor{Kind: pageCursorMessages, PathPosition: paged[len(paged)-1].pathPosition})
+	return messages, info, nil
 }
 
-func (h Handler) listConversationCitations(ctx context.Context, userID, conversationID string) (map[string][]citationResponse, error) {
-	rows, err := h.db.QueryContext(ctx, `
-SELECT c.message_id, c.url, c.title, c.snippet, c.source_provider
+func (h Handler) listMessageCitations(ctx context.Context, userID string, messageIDs []string) (map[string][]citationResponse, error) {
+	args := make([]any, 0, len(messageIDs)+1)
+	args = append(args, userID)
+	for _, messageID := range messageIDs {
+		args = append(args, messageID)
+	}
+
+	placeholders := strings.TrimRight(strings.Repeat("?,", len(messageIDs)), ",")
+	rows, err := h.db.QueryContext(ctx, fmt.Sprintf(`
+SELECT c.message_id, c.url, c.title, c.snippet, c.source_provider, c.source_providers_json
 FROM citations c
 JOIN messages m ON m.id = c.message_id
 JOIN conversations v ON v.id = m.conversation_id
-WHERE v.user_id = ? AND v.id = ?
+WHERE v.user_id = ? AND c.message_id IN (%s)
 ORDER BY c.created_at ASC, c.rowid ASC;
-`, userID, conversationID)
+`, placeholders), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -798,8 +972,9 @@ ORDER BY c.created_at ASC, c.rowid ASC;
 		var title sql.NullString
 		var snippet sql.NullString
 		var sourceProvider sql.NullString
+		var sourceProvidersJSON sql.NullString
 
-		if err := rows.Scan(&messageID, &citation.URL, &title, &snippet, &sourceProvider); err != nil {
+		if err := rows.Scan(&messageID, &citation.URL, &title, &snippet, &sourceProvider, &sourceProvidersJSON); err != nil {
 			return nil, err
 		}
 
@@ -812,6 +987,9 @@ ORDER BY c.created_at ASC, c.rowid ASC;
 		if sourceProvider.Valid {
 			citation.SourceProvider = strings.TrimSpace(sourceProvider.String)
 		}
+		if sourceProvidersJSON.Valid {
+			_ = json.Unmarshal([]byte(sourceProvidersJSON.String), &citation.SourceProviders)
+		}
 
 		out[messageID] = append(out[messageID], citation)
 	}
@@ -903,14 +1081,17 @@ WHERE user_id = ?;
 }
 
 type chatMessageRequest struct {
-	ConversationID  string   `json:"conversationId"`
-	EditMessageID   string   `json:"editMessageId"`
-	Message         string   `json:"message"`
-	ModelID         string   `json:"modelId"`
-	ReasoningEffort string   `json:"reasoningEffort"`
-	Grounding       *bool    `json:"grounding"`
-	DeepResearch    *bool    `json:"deepResearch"`
-	FileIDs         []string `json:"fileIds"`
+	ConversationID  string                 `json:"conversationId"`
+	EditMessageID   string                 `json:"editMessageId"`
+	Message         string                 `json:"message"`
+	ModelID         string                 `json:"modelId"`
+	ReasoningEffort string                 `json:"reasoningEffort"`
+	Sampling        samplingParams         `json:"sampling"`
+	Grounding       *bool                  `json:"grounding"`
+	DeepResearch    *bool                  `json:"deepResearch"`
+	FileIDs         []string               `json:"fileIds"`
+	ResponseFormat  *responseFormatRequest `json:"responseFormat"`
+	CompareModelIDs []string               `json:"compareModelIds"`
 }
 
 func (h Handler) ChatMessages(w http.ResponseWriter, r *http.Request) {
@@ -934,6 +1115,10 @@ func (h Handler) ChatMessages(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "streaming_unsupported", "server does not support streaming")
 		return
 	}
+	if h.generations.isDraining() {
+		writeError(w, http.StatusServiceUnavailable, "shutting_down", errGenerationsDraining.Error())
+		return
+	}
 
 	user, ok := sessionUserFromContext(r.Context())
 	if !ok {
@@ -970,7 +1155,24 @@ func (h Handler) ChatMessages(w http.ResponseWriter, r *http.Request) {
 		deepResearch = *req.DeepResearch
 	}
 
+	compareModelIDs, err := normalizeCompareModelIDs(req.CompareModelIDs)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if compareModelIDs != nil && deepResearch {
+		writeError(w, http.StatusBadRequest, "invalid_request", "compare mode is not supported with deep research")
+		return
+	}
+	if compareModelIDs != nil && req.ResponseFormat != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "responseFormat is not supported in compare mode")
+		return
+	}
+
 	modelID := fallback(req.ModelID, h.cfg.OpenRouterDefaultModel)
+	if compareModelIDs != nil {
+		modelID = compareModelIDs[0]
+	}
 	mode := "chat"
 	if deepResearch {
 		mode = "deep_research"
@@ -993,6 +1195,64 @@ func (h Handler) ChatMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sampling, err := h.resolveSamplingParams(r.Context(), user.ID, modelID, mode, req.Sampling)
+	if err != nil {
+		if errors.Is(err, errInvalidSamplingParams) || errors.Is(err, errSamplingUnsupportedModel) {
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve sampling parameters")
+		return
+	}
+
+	if req.ResponseFormat != nil && deepResearch {
+		writeError(w, http.StatusBadRequest, "invalid_request", "responseFormat is not supported with deep research")
+		return
+	}
+	structuredOutput, err := h.resolveResponseFormat(r.Context(), modelID, req.ResponseFormat)
+	if err != nil {
+		if errors.Is(err, errInvalidResponseFormat) {
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve model capabilities")
+		return
+	}
+
+	if err := h.checkImageAttachments(r.Context(), modelID, deepResearch, files); err != nil {
+		switch {
+		case errors.Is(err, errImagesInDeepResearch), errors.Is(err, errImageInputUnsupported):
+			writeError(w, http.StatusBadRequest, "unsupported_attachment", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve model capabilities")
+		}
+		return
+	}
+	images, err := h.loadImageParts(r.Context(), files)
+	if err != nil {
+		log.Printf("load image attachments failed: user_id=%s err=%v", user.ID, err)
+		writeError(w, http.StatusBadGateway, "storage_error", "failed to load image attachments")
+		return
+	}
+
+	var compareTargets []compareTarget
+	if compareModelIDs != nil {
+		compareTargets, err = h.resolveCompareTargets(r.Context(), user.ID, compareModelIDs[1:], req.ReasoningEffort, req.Sampling, files)
+		if err != nil {
+			switch {
+			case errors.Is(err, errInvalidReasoningEffort), errors.Is(err, errReasoningUnsupportedModel),
+				errors.Is(err, errInvalidSamplingParams), errors.Is(err, errSamplingUnsupportedModel):
+				writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			case errors.Is(err, errImageInputUnsupported):
+				writeError(w, http.StatusBadRequest, "unsupported_attachment", err.Error())
+			default:
+				writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve compare models")
+			}
+			return
+		}
+		compareTargets = append([]compareTarget{{ModelID: modelID, ReasoningEffort: reasoningEffort, Sampling: sampling}}, compareTargets...)
+	}
+
 	conversationID, err := h.resolveConversationID(r.Context(), user.ID, req.ConversationID, req.Message)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -1003,45 +1263,44 @@ func (h Handler) ChatMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	parentMessageID, err := h.activeLeafMessageID(r.Context(), user.ID, conversationID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve conversation branch")
+		return
+	}
+
 	editMessageID := strings.TrimSpace(req.EditMessageID)
 	if editMessageID != "" {
-		editTargetRowID, err := h.resolveConversationMessageRowID(r.Context(), user.ID, conversationID, editMessageID)
+		parentMessageID, err = h.resolveEditTargetParentID(r.Context(), user.ID, conversationID, editMessageID)
 		if err != nil {
 			switch {
 			case errors.Is(err, sql.ErrNoRows):
 				writeError(w, http.StatusNotFound, "message_not_found", "message not found")
-			case errors.Is(err, errEditTargetNotUserMessage):
+			case errors.Is(err, errTargetNotUserMessage):
 				writeError(w, http.StatusBadRequest, "invalid_request", "editMessageId must reference a user message")
 			default:
 				writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve edit target")
 			}
 			return
 		}
-
-		candidates, err := h.listConversationBlobRefsFromMessageRow(r.Context(), user.ID, conversationID, editTargetRowID)
-		if err != nil {
-			writeError(w, http.StatusInternalServerError, "db_error", "failed to load attachment references")
-			return
-		}
-
-		if err := h.deleteConversationMessagesFromRow(r.Context(), user.ID, conversationID, editTargetRowID); err != nil {
-			writeError(w, http.StatusInternalServerError, "db_error", "failed to truncate conversation history")
-			return
-		}
-
-		h.cleanupOrphanedFileBlobs(r.Context(), user.ID, candidates)
 	}
 
-	historyMessages, err := h.listConversationPromptMessages(r.Context(), user.ID, conversationID, maxConversationHistoryMessages)
+	historyMessages, err := h.listConversationPromptPath(r.Context(), user.ID, conversationID, parentMessageID)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "db_error", "failed to load conversation history")
 		return
 	}
+	instructions, err := h.promptInstructions(r.Context(), user.ID, conversationID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to load instructions")
+		return
+	}
 
 	userMessageID, err := h.insertUserMessageWithFiles(
 		r.Context(),
 		user.ID,
 		conversationID,
+		parentMessageID,
 		req.Message,
 		modelID,
 		grounding,
@@ -1056,71 +1315,123 @@ func (h Handler) ChatMessages(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "db_error", "failed to persist message")
 		return
 	}
+	if compareTargets != nil {
+		if err := h.insertMessageComparison(r.Context(), conversationID, userMessageID, compareModelIDs); err != nil {
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to persist comparison")
+			return
+		}
+	}
 
 	userPrompt := h.appendFileContextToPrompt(req.Message, files)
-	timeSensitive := isTimeSensitivePrompt(req.Message)
-	if deepResearch {
-		h.streamDeepResearchResponse(r.Context(), w, flusher, deepResearchStreamInput{
-			UserID:          user.ID,
-			UserMessageID:   userMessageID,
-			ConversationID:  conversationID,
-			ModelID:         modelID,
-			ReasoningEffort: reasoningEffort,
-			Message:         req.Message,
-			Prompt:          userPrompt,
-			Grounding:       grounding,
-			IsAnonymous:     user.GoogleSub == "anonymous",
-			History:         historyMessages,
+	h.runGeneration(w, r, flusher, user.ID, conversationID, userMessageID, func(ctx context.Context, stream *generationStream) {
+		if compareTargets != nil {
+			h.streamCompareResponse(ctx, stream, compareStreamInput{
+				UserID:         user.ID,
+				UserMessageID:  userMessageID,
+				ConversationID: conversationID,
+				Targets:        compareTargets,
+				Message:        req.Message,
+				Prompt:         userPrompt,
+				Images:         images,
+				Grounding:      grounding,
+				Instructions:   instructions,
+				History:        historyMessages,
+			})
+			return
+		}
+
+		if deepResearch {
+			h.streamDeepResearchResponse(ctx, stream, deepResearchStreamInput{
+				UserID:          user.ID,
+				UserMessageID:   userMessageID,
+				ConversationID:  conversationID,
+				ModelID:         modelID,
+				ReasoningEffort: reasoningEffort,
+				Sampling:        sampling,
+				Message:         req.Message,
+				Prompt:          userPrompt,
+				Grounding:       grounding,
+				IsAnonymous:     user.GoogleSub == "anonymous",
+				Instructions:    instructions,
+				History:         historyMessages,
+			})
+			return
+		}
+
+		h.streamChatResponse(ctx, stream, chatStreamInput{
+			UserID:           user.ID,
+			UserMessageID:    userMessageID,
+			ConversationID:   conversationID,
+			ModelID:          modelID,
+			ReasoningEffort:  reasoningEffort,
+			Sampling:         sampling,
+			Message:          req.Message,
+			Prompt:           userPrompt,
+			Images:           images,
+			StructuredOutput: structuredOutput,
+			Grounding:        grounding,
+			Instructions:     instructions,
+			History:          historyMessages,
 		})
-		return
-	}
+	})
+}
+
+type chatStreamInput struct {
+	UserID           string
+	UserMessageID    string
+	ConversationID   string
+	ModelID          string
+	ReasoningEffort  string
+	Sampling         openrouter.SamplingParams
+	Message          string
+	Prompt           string
+	Images           []openrouter.ContentPart
+	StructuredOutput *structuredOutputSpec
+	Grounding        bool
+	Instructions     string
+	History          []historyMessage
+}
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+func (h Handler) streamChatResponse(ctx context.Context, stream *generationStream, input chatStreamInput) {
+	timeSensitive := isTimeSensitivePrompt(input.Message)
 
 	metadataEvent := map[string]any{
 		"type":           "metadata",
-		"grounding":      grounding,
-		"deepResearch":   deepResearch,
-		"modelId":        modelID,
-		"conversationId": conversationID,
-		"userMessageId":  userMessageID,
+		"grounding":      input.Grounding,
+		"deepResearch":   false,
+		"modelId":        input.ModelID,
+		"conversationId": input.ConversationID,
+		"userMessageId":  input.UserMessageID,
+		"generationId":   stream.id,
 	}
-	if reasoningEffort != "" {
-		metadataEvent["reasoningEffort"] = reasoningEffort
+	if input.ReasoningEffort != "" {
+		metadataEvent["reasoningEffort"] = input.ReasoningEffort
 	}
-	if err := writeSSEEvent(w, metadataEvent); err != nil {
-		writeError(w, http.StatusInternalServerError, "stream_error", "failed to start stream")
-		return
-	}
-	flusher.Flush()
+	_ = stream.send(metadataEvent)
 
 	traceCollector := newThinkingTraceCollector()
 
 	groundingCitations, groundingWarning := h.resolveGroundingContext(
-		r.Context(),
-		req.Message,
-		grounding,
+		ctx,
+		input.Message,
+		input.Grounding,
 		timeSensitive,
-		modelID,
-		plannerReasoningEffort(reasoningEffort),
+		input.ModelID,
+		plannerReasoningEffort(input.ReasoningEffort),
 		func(progress research.Progress) {
 			traceCollector.AppendProgress(progress)
-			_ = writeSSEEvent(w, progressEventData(progress))
-			flusher.Flush()
+			_ = stream.send(progressEventData(progress))
 		},
 	)
 	if groundingWarning != "" {
-		_ = writeSSEEvent(w, map[string]any{
+		_ = stream.send(map[string]any{
 			"type":    "warning",
 			"scope":   "grounding",
 			"message": groundingWarning,
 		})
-		flusher.Flush()
 	}
 
-	if grounding {
+	if input.Grounding {
 		synthesizingProgress := summarizedProgress(research.Progress{
 			Phase:   research.PhaseSynthesizing,
 			Message: "Preparing grounded response",
@@ -1128,12 +1439,14 @@ func (h Handler) ChatMessages(w http.ResponseWriter, r *http.Request) {
 			Phase: research.PhaseSynthesizing,
 		})
 		traceCollector.AppendProgress(synthesizingProgress)
-		_ = writeSSEEvent(w, progressEventData(synthesizingProgress))
-		flusher.Flush()
+		_ = stream.send(progressEventData(synthesizingProgress))
 	}
 
 	promptMessages := []openrouter.Message{
-		{Role: "system", Content: buildSystemPrompt(grounding, false, len(groundingCitations) > 0, timeSensitive)},
+		{Role: "system", Content: buildSystemPrompt(input.Grounding, false, len(groundingCitations) > 0, timeSensitive)},
+	}
+	if input.Instructions != "" {
+		promptMessages = append(promptMessages, openrouter.Message{Role: "system", Content: input.Instructions})
 	}
 	if len(groundingCitations) > 0 {
 		promptMessages = append(promptMessages, openrouter.Message{
@@ -1141,75 +1454,96 @@ func (h Handler) ChatMessages(w http.ResponseWriter, r *http.Request) {
 			Content: buildGroundingPrompt(groundingCitations, timeSensitive),
 		})
 	}
-	promptMessages = append(promptMessages, historyMessages...)
-	promptMessages = append(promptMessages, openrouter.Message{Role: "user", Content: userPrompt})
+	var responseFormat *openrouter.ResponseFormat
+	if input.StructuredOutput != nil {
+		responseFormat = input.StructuredOutput.native
+		if responseFormat == nil {
+			promptMessages = append(promptMessages, openrouter.Message{Role: "system", Content: input.StructuredOutput.prompt()})
+		}
+	}
+	promptMessages = append(promptMessages, h.promptHistory(ctx, input.UserID, input.ConversationID, input.ModelID, input.Prompt, input.History)...)
+	promptMessages = append(promptMessages, openrouter.Message{
+		Role:    "user",
+		Content: input.Prompt,
+		Parts:   userMessageParts(input.Prompt, input.Images),
+	})
 
-	started := true
 	var assistantContent strings.Builder
 	var reasoningContent strings.Builder
 	var assistantUsage *openrouter.Usage
 	var streamStartedAt time.Time
 	var firstTokenAt time.Time
+	titleReplies := 0
 
 	markFirstTokenAt := func() {
 		if firstTokenAt.IsZero() {
 			firstTokenAt = time.Now()
 		}
 	}
+	answeredModelID := input.ModelID
 
-	streamErr := h.openrouter.StreamChatCompletion(
-		r.Context(),
+	replyCitations, streamErr := h.streamWithTools(
+		ctx,
+		stream,
+		input,
 		openrouter.StreamRequest{
-			Model:     modelID,
-			Messages:  promptMessages,
-			Reasoning: openRouterReasoningConfig(reasoningEffort),
+			Model:          input.ModelID,
+			Messages:       promptMessages,
+			Reasoning:      openRouterReasoningConfig(input.ReasoningEffort),
+			ResponseFormat: responseFormat,
+			SamplingParams: input.Sampling,
+		},
+		groundingCitations,
+		func(progress research.Progress) {
+			traceCollector.AppendProgress(progress)
+			_ = stream.send(progressEventData(progress))
 		},
 		func() error {
-			streamStartedAt = time.Now()
+			if streamStartedAt.IsZero() {
+				streamStartedAt = time.Now()
+			}
 			return nil
 		},
 		func(delta string) error {
 			assistantContent.WriteString(delta)
 			markFirstTokenAt()
 
-			if err := writeSSEEvent(w, map[string]any{
+			if err := stream.send(map[string]any{
 				"type":  "token",
 				"delta": delta,
 			}); err != nil {
 				return err
 			}
-			flusher.Flush()
 			return nil
 		},
 		func(reasoning string) error {
 			reasoningContent.WriteString(reasoning)
 			markFirstTokenAt()
 
-			if err := writeSSEEvent(w, map[string]any{
+			if err := stream.send(map[string]any{
 				"type":  "reasoning",
 				"delta": reasoning,
 			}); err != nil {
 				return err
 			}
-			flusher.Flush()
 			return nil
 		},
 		func(usage openrouter.Usage) error {
-			copied := usageWithLocalUsageFallbacks(usage, modelID, streamStartedAt, firstTokenAt)
+			copied := usageWithLocalUsageFallbacks(usage, answeredModelID, streamStartedAt, firstTokenAt)
 			assistantUsage = &copied
 
-			if err := writeSSEEvent(w, map[string]any{
+			if err := stream.send(map[string]any{
 				"type":  "usage",
 				"usage": usageResponseFromOpenRouter(copied),
 			}); err != nil {
 				return err
 			}
-			flusher.Flush()
 			return nil
 		},
+		modelFallbackWarning(stream, &answeredModelID),
 	)
 
-	if grounding {
+	if input.Grounding {
 		finalizingProgress := summarizedProgress(research.Progress{
 			Phase:   research.PhaseFinalizing,
 			Message: "Finalizing citations and response",
@@ -1217,86 +1551,77 @@ func (h Handler) ChatMessages(w http.ResponseWriter, r *http.Request) {
 			Phase: research.PhaseFinalizing,
 		})
 		traceCollector.AppendProgress(finalizingProgress)
-		_ = writeSSEEvent(w, progressEventData(finalizingProgress))
-		flusher.Flush()
+		_ = stream.send(progressEventData(finalizingProgress))
 	}
 
 	if streamErr != nil {
-		traceCollector.MarkStopped("Stopped due to an error")
+		markGenerationStopped(ctx, traceCollector)
 	} else {
 		traceCollector.MarkDone()
 	}
 
 	var persistedCitations []citationResponse
 	if assistantContent.Len() > 0 {
-		persistedCitations = groundingCitations
-		if len(persistedCitations) > maxNormalCitations {
-			persistedCitations = persistedCitations[:maxNormalCitations]
+		persistedCitations = replyCitations
+		if len(persistedCitations) > maxNormalCitations+maxToolCitations {
+			persistedCitations = persistedCitations[:maxNormalCitations+maxToolCitations]
 		}
+		// Persist even when ctx was interrupted so the partial reply survives.
 		assistantMessageID, err := h.insertMessageWithCitations(
-			r.Context(),
-			user.ID,
-			conversationID,
+			context.WithoutCancel(ctx),
+			input.UserID,
+			input.ConversationID,
+			input.UserMessageID,
 			"assistant",
 			assistantContent.String(),
 			reasoningContent.String(),
-			modelID,
-			grounding,
-			deepResearch,
+			input.ModelID,
+			input.Grounding,
+			false,
 			persistedCitations,
 			traceCollector.Snapshot(),
 			messageUsageFromOpenRouter(assistantUsage),
 		)
 		if err != nil {
-			if !started {
-				writeError(w, http.StatusInternalServerError, "db_error", "failed to persist assistant response")
-				return
-			}
-			_ = writeSSEEvent(w, map[string]any{
+			_ = stream.send(map[string]any{
 				"type":    "error",
 				"message": "failed to persist assistant response",
 			})
-			flusher.Flush()
 		} else {
-			if started && len(persistedCitations) > 0 {
-				_ = writeSSEEvent(w, map[string]any{
+			if len(persistedCitations) > 0 {
+				_ = stream.send(map[string]any{
 					"type":      "citations",
 					"citations": persistedCitations,
 				})
-				flusher.Flush()
 			}
 			if assistantUsage != nil {
-				h.enrichAndPersistMessageUsageAsync(user.ID, assistantMessageID, modelID, *assistantUsage, streamStartedAt, firstTokenAt)
+				h.enrichAndPersistMessageUsageAsync(input.UserID, assistantMessageID, answeredModelID, *assistantUsage, streamStartedAt, firstTokenAt)
+			} else if answeredModelID != input.ModelID {
+				h.recordAnsweringModel(context.WithoutCancel(ctx), assistantMessageID, answeredModelID)
+			}
+			if streamErr == nil && input.StructuredOutput != nil {
+				h.finishStructuredOutput(ctx, stream, input.StructuredOutput, answeredModelID, assistantMessageID, assistantContent.String())
+			}
+			if streamErr == nil {
+				titleReplies = 1
 			}
 		}
 	}
 
-	if streamErr != nil {
-		if !started {
-			status := http.StatusBadGateway
-			code := "openrouter_error"
-			message := fmt.Sprintf("failed to stream from OpenRouter: %v", streamErr)
-			if errors.Is(streamErr, openrouter.ErrMissingAPIKey) {
-				status = http.StatusInternalServerError
-				code = "openrouter_unconfigured"
-				message = "OPENROUTER_API_KEY is required"
-			}
-			writeError(w, status, code, message)
-			return
-		}
-		_ = writeSSEEvent(w, map[string]any{
+	if streamErr != nil && !generationCancelled(ctx) {
+		_ = stream.send(map[string]any{
 			"type":    "error",
 			"message": "stream interrupted",
 		})
-		flusher.Flush()
 	}
 
-	_ = writeSSEEvent(w, map[string]any{"type": "done"})
-	flusher.Flush()
+	endGeneration(ctx, stream)
+	if titleReplies > 0 {
+		h.generateConversationTitle(ctx, stream, input.UserID, input.ConversationID, input.Message, assistantContent.String(), titleReplies)
+	}
 }
 
 const maxGroundingResults = 10
-const maxConversationHistoryMessages = 24
 
 func (h Handler) resolveGroundingContext(
 	ctx context.Context,
@@ -1374,7 +1699,7 @@ func (h Handler) resolveGroundingContextLegacy(
 			continue
 		}
 		if idx > 0 {
-			if err := waitWithContext(ctx, braveFreeTierSpacing); err != nil {
+			if err := search.Wait(ctx, search.MinInterval(h.cfg)); err != nil {
 				return citations, ""
 			}
 		}
@@ -1392,14 +1717,14 @@ func (h Handler) resolveGroundingContextLegacy(
 		}
 
 		results, err := h.grounding.Search(ctx, query, maxGroundingResults)
-		if isBraveRateLimitError(err) {
-			if waitErr := waitWithContext(ctx, braveFreeTierSpacing); waitErr == nil {
+		if isSearchRateLimitError(err) {
+			if waitErr := search.Wait(ctx, search.MinInterval(h.cfg)); waitErr == nil {
 				results, err = h.grounding.Search(ctx, query, maxGroundingResults)
 			}
 		}
 		if err != nil {
-			if errors.Is(err, brave.ErrMissingAPIKey) {
-				return nil, "Grounding is unavailable because BRAVE_API_KEY is not configured."
+			if errors.Is(err, search.ErrNotConfigured) {
+				return nil, "Grounding is unavailable because the web search provider is not configured."
 			}
 			logGroundingSearchFailure("chat_legacy", idx+1, len(queries), query, err)
 			if idx == 0 {
@@ -1422,7 +1747,7 @@ func (h Handler) resolveGroundingContextLegacy(
 				URL:            rawURL,
 				Title:          trimToRunes(strings.TrimSpace(result.Title), 240),
 				Snippet:        trimToRunes(strings.TrimSpace(result.Snippet), 800),
-				SourceProvider: "brave",
+				SourceProvider: result.Provider,
 			})
 
 			if len(citations) >= maxGroundingResults {
@@ -1434,13 +1759,13 @@ func (h Handler) resolveGroundingContextLegacy(
 	return citations, ""
 }
 
-func isBraveRateLimitError(err error) bool {
-	var apiErr brave.APIError
+func isSearchRateLimitError(err error) bool {
+	var apiErr search.APIError
 	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
 }
 
-func braveStatusCode(err error) int {
-	var apiErr brave.APIError
+func searchStatusCode(err error) int {
+	var apiErr search.APIError
 	if errors.As(err, &apiErr) {
 		return apiErr.StatusCode
 	}
@@ -1454,7 +1779,7 @@ func logGroundingSearchFailure(scope string, pass, total int, query string, err
 		pass,
 		total,
 		len([]rune(strings.TrimSpace(query))),
-		braveStatusCode(err),
+		searchStatusCode(err),
 		err,
 	)
 }
@@ -1559,10 +1884,11 @@ func (h Handler) insertConversation(ctx context.Context, userID, requestedTitle
 	err := h.db.QueryRowContext(ctx, `
 INSERT INTO conversations (id, user_id, title)
 VALUES (?, ?, ?)
-RETURNING id, title, created_at, updated_at;
+RETURNING id, title, system_prompt, created_at, updated_at;
 `, uuid.NewString(), userID, normalizeConversationTitle(requestedTitle)).Scan(
 		&conversation.ID,
 		&conversation.Title,
+		&conversation.SystemPrompt,
 		&conversation.CreatedAt,
 		&conversation.UpdatedAt,
 	)
@@ -1610,84 +1936,35 @@ func (h Handler) resolveConversationID(ctx context.Context, userID, requestedCon
 	return conversationID, nil
 }
 
-func (h Handler) resolveConversationMessageRowID(ctx context.Context, userID, conversationID, messageID string) (int64, error) {
-	var rowID int64
+func (h Handler) resolveEditTargetParentID(ctx context.Context, userID, conversationID, messageID string) (string, error) {
 	var role string
+	var parentMessageID sql.NullString
 	err := h.db.QueryRowContext(ctx, `
-SELECT m.rowid, m.role
+SELECT m.role, m.parent_message_id
 FROM messages m
 JOIN conversations c ON c.id = m.conversation_id
 WHERE m.id = ? AND m.conversation_id = ? AND c.user_id = ?
 LIMIT 1;
-`, messageID, conversationID, userID).Scan(&rowID, &role)
+`, messageID, conversationID, userID).Scan(&role, &parentMessageID)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 	if role != "user" {
-		return 0, errEditTargetNotUserMessage
+		return "", errTargetNotUserMessage
 	}
-	return rowID, nil
-}
-
-func (h Handler) deleteConversationMessagesFromRow(ctx context.Context, userID, conversationID string, fromRowID int64) error {
-	_, err := h.db.ExecContext(ctx, `
-DELETE FROM messages
-WHERE conversation_id = ? AND user_id = ? AND rowid >= ?;
-`, conversationID, userID, fromRowID)
-	return err
+	return parentMessageID.String, nil
 }
 
-func (h Handler) listConversationPromptMessages(ctx context.Context, userID, conversationID string, limit int) ([]openrouter.Message, error) {
-	if limit <= 0 {
-		return nil, nil
-	}
-
-	rows, err := h.db.QueryContext(ctx, `
-SELECT m.role, m.content
-FROM messages m
-JOIN conversations c ON c.id = m.conversation_id
-WHERE m.conversation_id = ?
-  AND c.user_id = ?
-  AND m.role IN ('user', 'assistant')
-ORDER BY m.created_at DESC, m.rowid DESC
-LIMIT ?;
-`, conversationID, userID, limit)
+func (h Handler) insertMessage(ctx context.Context, userID, conversationID, role, content, modelID string, groundingEnabled, deepResearchEnabled bool) error {
+	parentMessageID, err := h.activeLeafMessageID(ctx, userID, conversationID)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	messages := make([]openrouter.Message, 0, limit)
-	for rows.Next() {
-		var role string
-		var content string
-		if err := rows.Scan(&role, &content); err != nil {
-			return nil, err
-		}
-		if strings.TrimSpace(content) == "" {
-			continue
-		}
-		messages = append(messages, openrouter.Message{
-			Role:    role,
-			Content: content,
-		})
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+		return err
 	}
-
-	return messages, nil
-}
-
-func (h Handler) insertMessage(ctx context.Context, userID, conversationID, role, content, modelID string, groundingEnabled, deepResearchEnabled bool) error {
-	_, err := h.insertMessageWithCitations(
+	_, err = h.insertMessageWithCitations(
 		ctx,
 		userID,
 		conversationID,
+		parentMessageID,
 		role,
 		content,
 		"", // no reasoning content for user messages
@@ -1715,7 +1992,7 @@ type messageUsage struct {
 
 func (h Handler) insertMessageWithCitations(
 	ctx context.Context,
-	userID, conversationID, role, content, reasoningContent, modelID string,
+	userID, conversationID, parentMessageID, role, content, reasoningContent, modelID string,
 	groundingEnabled, deepResearchEnabled bool,
 	citations []citationResponse,
 	thinkingTrace *thinkingTrace,
@@ -1727,6 +2004,25 @@ func (h Handler) insertMessageWithCitations(
 	}
 	defer tx.Rollback()
 
+	messageID, err := insertMessageWithCitationsTx(ctx, tx, userID, conversationID, parentMessageID, role, content, reasoningContent, modelID, groundingEnabled, deepResearchEnabled, citations, thinkingTrace, usage)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
+
+func insertMessageWithCitationsTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	userID, conversationID, parentMessageID, role, content, reasoningContent, modelID string,
+	groundingEnabled, deepResearchEnabled bool,
+	citations []citationResponse,
+	thinkingTrace *thinkingTrace,
+	usage *messageUsage,
+) (string, error) {
 	nullableModelID, err := resolveNullableModelID(ctx, tx, modelID)
 	if err != nil {
 		return "", err
@@ -1761,6 +2057,7 @@ func (h Handler) insertMessageWithCitations(
 INSERT INTO messages (
   id,
   conversation_id,
+  parent_message_id,
   user_id,
   role,
   content,
@@ -1779,8 +2076,8 @@ INSERT INTO messages (
   grounding_enabled,
   deep_research_enabled
 )
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
-`, messageID, conversationID, userID, role, content, nullableString(reasoningContent), thinkingTraceJSON, nullableModelID, promptTokensValue, completionTokensValue, totalTokensValue, reasoningTokensValue, costMicrosUSDValue, byokInferenceCostMicrosUSDValue, tokensPerSecondValue, usageModelIDValue, usageProviderNameValue, boolToInt(groundingEnabled), boolToInt(deepResearchEnabled)); err != nil {
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+`, messageID, conversationID, nullableString(parentMessageID), userID, role, content, nullableString(reasoningContent), thinkingTraceJSON, nullableModelID, promptTokensValue, completionTokensValue, totalTokensValue, reasoningTokensValue, costMicrosUSDValue, byokInferenceCostMicrosUSDValue, tokensPerSecondValue, usageModelIDValue, usageProviderNameValue, boolToInt(groundingEnabled), boolToInt(deepResearchEnabled)); err != nil {
 		return "", err
 	}
 
@@ -1789,6 +2086,14 @@ VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 		if rawURL == "" {
 			continue
 		}
+		var sourceProvidersJSON any
+		if len(citation.SourceProviders) > 0 {
+			encoded, err := json.Marshal(citation.SourceProviders)
+			if err != nil {
+				return "", err
+			}
+			sourceProvidersJSON = string(encoded)
+		}
 		if _, err := tx.ExecContext(ctx, `
 INSERT INTO citations (
   id,
@@ -1796,23 +2101,20 @@ INSERT INTO citations (
   url,
   title,
   snippet,
-  source_provider
+  source_provider,
+  source_providers_json
 )
-VALUES (?, ?, ?, ?, ?, ?);
-`, uuid.NewString(), messageID, rawURL, nullableString(citation.Title), nullableString(citation.Snippet), nullableString(citation.SourceProvider)); err != nil {
+VALUES (?, ?, ?, ?, ?, ?, ?);
+`, uuid.NewString(), messageID, rawURL, nullableString(citation.Title), nullableString(citation.Snippet), nullableString(citation.SourceProvider), sourceProvidersJSON); err != nil {
 			return "", err
 		}
 	}
 
 	if _, err := tx.ExecContext(ctx, `
 UPDATE conversations
-SET updated_at = CURRENT_TIMESTAMP
+SET updated_at = CURRENT_TIMESTAMP, active_leaf_message_id = ?
 WHERE id = ? AND user_id = ?;
-`, conversationID, userID); err != nil {
-		return "", err
-	}
-
-	if err := tx.Commit(); err != nil {
+`, messageID, conversationID, userID); err != nil {
 		return "", err
 	}
 	return messageID, nil
@@ -2111,9 +2413,9 @@ ON CONFLICT(user_id, model_id, mode) DO UPDATE SET
 	return err
 }
 
-func modelSupportsReasoning(ctx context.Context, tx *sql.Tx, modelID string) (bool, error) {
+func modelSupportsReasoning(ctx context.Context, q rowQuerier, modelID string) (bool, error) {
 	var supportsReasoning int
-	err := tx.QueryRowContext(ctx, `
+	err := q.QueryRowContext(ctx, `
 SELECT supports_reasoning
 FROM models
 WHERE id = ?
@@ -2359,7 +2661,9 @@ func (h Handler) usageWithOpenRouterMetrics(
 			if providerName := strings.TrimSpace(generation.ProviderName); providerName != "" {
 				enriched.ProviderName = normalizeProviderName(providerName)
 			}
-			if generation.UpstreamInferenceCostMicros != nil {
+			// usage may total several tool rounds, so only fill in what the
+			// stream did not report rather than replace it with this generation's.
+			if enriched.ByokInferenceCostMicros == nil && generation.UpstreamInferenceCostMicros != nil {
 				enriched.ByokInferenceCostMicros = generation.UpstreamInferenceCostMicros
 			}
 			if tokensPerSecond := tokensPerSecondFromGeneration(generation, usage); tokensPerSecond != nil {
@@ -2556,6 +2860,42 @@ func messageUsageFromOpenRouter(usage *openrouter.Usage) *messageUsage {
 	}
 }
 
+// addOpenRouterUsage sums token counts and costs across several completions.
+// Per-call details (model, provider, speed, generation) come from next when
+// it reports them.
+func addOpenRouterUsage(total, next openrouter.Usage) openrouter.Usage {
+	total.PromptTokens += next.PromptTokens
+	total.CompletionTokens += next.CompletionTokens
+	total.TotalTokens += next.TotalTokens
+	total.ReasoningTokens = addOptionalInts(total.ReasoningTokens, next.ReasoningTokens)
+	total.CostMicrosUSD = addOptionalInts(total.CostMicrosUSD, next.CostMicrosUSD)
+	total.ByokInferenceCostMicros = addOptionalInts(total.ByokInferenceCostMicros, next.ByokInferenceCostMicros)
+	if next.TokensPerSecond != nil {
+		total.TokensPerSecond = next.TokensPerSecond
+	}
+	if strings.TrimSpace(next.ModelID) != "" {
+		total.ModelID = next.ModelID
+	}
+	if strings.TrimSpace(next.ProviderName) != "" {
+		total.ProviderName = next.ProviderName
+	}
+	if strings.TrimSpace(next.GenerationID) != "" {
+		total.GenerationID = next.GenerationID
+	}
+	return total
+}
+
+func addOptionalInts(a, b *int) *int {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	sum := *a + *b
+	return &sum
+}
+
 func normalizeProviderName(raw string) string {
 	name := strings.TrimSpace(raw)
 	if name == "Google" {
@@ -2669,17 +3009,6 @@ func anonymousUser() session.User {
 	}
 }
 
-func writeSSEEvent(w io.Writer, payload any) error {
-	encoded, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("marshal sse payload: %w", err)
-	}
-	if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", encoded); err != nil {
-		return fmt.Errorf("write sse payload: %w", err)
-	}
-	return nil
-}
-
 func buildSystemPrompt(grounding, deepResearch, hasGroundingContext, timeSensitive bool) string {
 	mode := "normal chat"
 	if deepResearch {
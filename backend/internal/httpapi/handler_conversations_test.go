@@ -14,10 +14,11 @@ import (
 	"time"
 
 	"chat/backend/internal/auth"
-	"chat/backend/internal/brave"
 	"chat/backend/internal/config"
+	appdb "chat/backend/internal/db"
 	"chat/backend/internal/openrouter"
 	"chat/backend/internal/research"
+	"chat/backend/internal/search"
 	"chat/backend/internal/session"
 
 	"github.com/go-chi/chi/v5"
@@ -1104,7 +1105,7 @@ func TestChatMessagesCitationsDoNotWaitForGenerationLookup(t *testing.T) {
 	t.Cleanup(func() { _ = db.Close() })
 
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://example.com/one", Title: "Example One", Snippet: "First snippet"},
 			{URL: "https://example.com/two", Title: "Example Two", Snippet: "Second snippet"},
 		},
@@ -1261,7 +1262,9 @@ func TestChatMessagesAppliesReasoningEffortOverrideAndPersistsPreset(t *testing.
 	handler, db := newTestHandler(t, stubStreamer{
 		tokens: []string{"Hi"},
 		onRequest: func(req openrouter.StreamRequest) {
-			capturedRequest = req
+			if !isTitleRequest(req) {
+				capturedRequest = req
+			}
 		},
 	})
 	t.Cleanup(func() { _ = db.Close() })
@@ -1311,7 +1314,7 @@ func TestChatMessagesGroundingUsesSelectedModelForPlannerAndFinalGeneration(t *t
 	handler.cfg.ChatResearchMaxLoops = 1
 	handler.cfg.ChatResearchMaxSearchQ = 1
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://example.com/one", Title: "Example One", Snippet: "Grounding snippet."},
 		},
 	}
@@ -1340,7 +1343,7 @@ func TestChatMessagesGroundingUsesSelectedModelForPlannerAndFinalGeneration(t *t
 		t.Fatalf("expected 1 final generation request, got %d", len(generationRequests))
 	}
 
-	for _, streamed := range capturedRequests {
+	for _, streamed := range append(plannerRequests, generationRequests...) {
 		if streamed.Model != selectedModelID {
 			t.Fatalf("expected streamed model %q, got %q", selectedModelID, streamed.Model)
 		}
@@ -1366,7 +1369,7 @@ func TestChatMessagesDeepResearchUsesSelectedModelForPlannerAndFinalGeneration(t
 	handler.cfg.DeepResearchMaxLoops = 1
 	handler.cfg.DeepResearchMaxSearchQ = 1
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://example.com/one", Title: "Example One", Snippet: "Grounding snippet."},
 		},
 	}
@@ -1395,7 +1398,7 @@ func TestChatMessagesDeepResearchUsesSelectedModelForPlannerAndFinalGeneration(t
 		t.Fatalf("expected 1 final generation request, got %d", len(generationRequests))
 	}
 
-	for _, streamed := range capturedRequests {
+	for _, streamed := range append(plannerRequests, generationRequests...) {
 		if streamed.Model != selectedModelID {
 			t.Fatalf("expected streamed model %q, got %q", selectedModelID, streamed.Model)
 		}
@@ -1484,7 +1487,7 @@ func TestChatMessagesIncludesConversationHistoryInPrompt(t *testing.T) {
 	}
 }
 
-func TestChatMessagesEditMessageTruncatesFutureAndRegenerates(t *testing.T) {
+func TestChatMessagesEditMessageCreatesSiblingBranchAndRegenerates(t *testing.T) {
 	capturedRequests := make([]openrouter.StreamRequest, 0, 4)
 	streamer := stubStreamer{
 		tokens: []string{"Ack"},
@@ -1579,47 +1582,41 @@ LIMIT 1 OFFSET 1;
 		}
 	}
 
-	rows, err := db.Query(`
-SELECT role, content
-FROM messages
-WHERE conversation_id = ?
-ORDER BY rowid ASC;
-`, conversationID)
-	if err != nil {
-		t.Fatalf("query persisted messages: %v", err)
+	var persistedCount int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM messages WHERE conversation_id = ?;`, conversationID).Scan(&persistedCount); err != nil {
+		t.Fatalf("count persisted messages: %v", err)
+	}
+	if persistedCount != 6 {
+		t.Fatalf("expected edit to keep the original branch, got %d persisted messages", persistedCount)
 	}
-	defer rows.Close()
 
-	type storedMessage struct {
+	activePath, _, err := handler.listActivePathMessages(context.Background(), user.ID, conversationID, pageRequest{})
+	if err != nil {
+		t.Fatalf("list active path: %v", err)
+	}
+	wantPath := []struct {
 		Role    string
 		Content string
-	}
-	persisted := make([]storedMessage, 0, 4)
-	for rows.Next() {
-		var message storedMessage
-		if err := rows.Scan(&message.Role, &message.Content); err != nil {
-			t.Fatalf("scan persisted message: %v", err)
+	}{
+		{Role: "user", Content: "Turn one"},
+		{Role: "assistant", Content: "Ack"},
+		{Role: "user", Content: "Turn two edited"},
+		{Role: "assistant", Content: "Ack"},
+	}
+	if len(activePath) != len(wantPath) {
+		t.Fatalf("expected %d active messages after edit, got %d (%+v)", len(wantPath), len(activePath), activePath)
+	}
+	for i, want := range wantPath {
+		if activePath[i].Role != want.Role || activePath[i].Content != want.Content {
+			t.Fatalf("unexpected active message %d: %+v", i, activePath[i])
 		}
-		persisted = append(persisted, message)
-	}
-	if err := rows.Err(); err != nil {
-		t.Fatalf("iterate persisted messages: %v", err)
-	}
-
-	if len(persisted) != 4 {
-		t.Fatalf("expected 4 persisted messages after edit, got %d (%+v)", len(persisted), persisted)
-	}
-	if persisted[0].Role != "user" || persisted[0].Content != "Turn one" {
-		t.Fatalf("unexpected first persisted message: %+v", persisted[0])
 	}
-	if persisted[1].Role != "assistant" || persisted[1].Content != "Ack" {
-		t.Fatalf("unexpected second persisted message: %+v", persisted[1])
+	edited := activePath[2]
+	if edited.SiblingCount != 2 || edited.SiblingIndex != 1 || edited.SiblingIDs[0] != turnTwoMessageID {
+		t.Fatalf("expected edited message to be the second sibling of the original, got %+v", edited)
 	}
-	if persisted[2].Role != "user" || persisted[2].Content != "Turn two edited" {
-		t.Fatalf("unexpected third persisted message: %+v", persisted[2])
-	}
-	if persisted[3].Role != "assistant" || persisted[3].Content != "Ack" {
-		t.Fatalf("unexpected fourth persisted message: %+v", persisted[3])
+	if edited.ParentMessageID == nil || *edited.ParentMessageID != activePath[1].ID {
+		t.Fatalf("expected edited message to share the original parent, got %+v", edited.ParentMessageID)
 	}
 }
 
@@ -1746,7 +1743,7 @@ func TestChatMessagesPersistsGroundingCitationsAndStreamsCitationEvent(t *testin
 	t.Cleanup(func() { _ = db.Close() })
 
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{
 				URL:     "https://example.com/one",
 				Title:   "Example One",
@@ -1856,7 +1853,7 @@ func TestChatMessagesGroundingPartialReadFailureSuppressesWarning(t *testing.T)
 	handler.cfg.ChatResearchMaxLoops = 1
 	handler.cfg.ChatResearchMaxSearchQ = 1
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://example.com/a", Title: "Example A", Snippet: "First snippet"},
 			{URL: "https://example.com/b", Title: "Example B", Snippet: "Second snippet"},
 		},
@@ -1900,7 +1897,7 @@ func TestChatMessagesGroundingAllReadFailuresEmitWarning(t *testing.T) {
 	handler.cfg.ChatResearchMaxLoops = 1
 	handler.cfg.ChatResearchMaxSearchQ = 1
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://example.com/a", Title: "Example A", Snippet: "First snippet"},
 			{URL: "https://example.com/b", Title: "Example B", Snippet: "Second snippet"},
 		},
@@ -1943,7 +1940,7 @@ func TestChatMessagesDeepResearchStreamsProgressInOrder(t *testing.T) {
 	t.Cleanup(func() { _ = db.Close() })
 
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://gov.example.gov/report", Title: "Official report", Snippet: "Detailed 2026 update."},
 			{URL: "https://docs.example.com/changelog", Title: "Changelog", Snippet: "Release notes and changes."},
 		},
@@ -2007,7 +2004,7 @@ func TestChatMessagesStreamsProgressBeforeTokensForGroundedChat(t *testing.T) {
 	handler.cfg.ChatResearchMaxSearchQ = 1
 	handler.cfg.ChatResearchMaxLoops = 1
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://example.com/one", Title: "Example One", Snippet: "First snippet"},
 		},
 	}
@@ -2074,7 +2071,7 @@ func TestChatMessagesPersistsThinkingTraceDone(t *testing.T) {
 	t.Cleanup(func() { _ = db.Close() })
 
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://example.com/one", Title: "Example One", Snippet: "First snippet"},
 			{URL: "https://example.com/two", Title: "Example Two", Snippet: "Second snippet"},
 		},
@@ -2165,7 +2162,7 @@ func TestChatMessagesPersistsThinkingTraceStoppedOnStreamError(t *testing.T) {
 	t.Cleanup(func() { _ = db.Close() })
 
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://example.com/one", Title: "Example One", Snippet: "First snippet"},
 		},
 	}
@@ -2220,7 +2217,7 @@ func TestChatMessagesDeepResearchFeatureFlagOffUsesLegacyPhases(t *testing.T) {
 
 	handler.cfg.AgenticResearchDeepEnabled = false
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://gov.example.gov/report", Title: "Official report", Snippet: "Detailed 2026 update."},
 			{URL: "https://docs.example.com/changelog", Title: "Changelog", Snippet: "Release notes and changes."},
 		},
@@ -2338,7 +2335,7 @@ func TestChatMessagesDeepResearchAllReadFailuresEmitWarning(t *testing.T) {
 	handler.cfg.DeepResearchMaxLoops = 1
 	handler.cfg.DeepResearchMaxSearchQ = 1
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://example.com/a", Title: "Example A", Snippet: "First snippet"},
 			{URL: "https://example.com/b", Title: "Example B", Snippet: "Second snippet"},
 		},
@@ -2387,7 +2384,7 @@ func TestChatMessagesDeepResearchPartialReadFailureSuppressesWarning(t *testing.
 	handler.cfg.DeepResearchMaxLoops = 1
 	handler.cfg.DeepResearchMaxSearchQ = 1
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://example.com/a", Title: "Example A", Snippet: "First snippet"},
 			{URL: "https://example.com/b", Title: "Example B", Snippet: "Second snippet"},
 		},
@@ -2433,7 +2430,7 @@ func TestChatMessagesDeepResearchCitationPersistenceOrderedByClaims(t *testing.T
 	t.Cleanup(func() { _ = db.Close() })
 
 	handler.grounding = stubGrounder{
-		results: []brave.SearchResult{
+		results: []search.Result{
 			{URL: "https://gov.example.gov/report", Title: "Official report", Snippet: "Comprehensive official update with 2026 findings."},
 			{URL: "https://research.example.edu/changelog", Title: "Academic changelog analysis", Snippet: "Detailed release timeline, methodology, and deployment notes with cited publication dates from 2026 and 2025."},
 		},
@@ -2581,7 +2578,9 @@ func TestChatMessagesPersistsMessageFilesAndUsesAttachmentPrompt(t *testing.T) {
 	streamer := stubStreamer{
 		tokens: []string{"ok"},
 		onRequest: func(req openrouter.StreamRequest) {
-			capturedRequest = req
+			if !isTitleRequest(req) {
+				capturedRequest = req
+			}
 		},
 	}
 	handler, db := newTestHandler(t, streamer)
@@ -2642,7 +2641,7 @@ WHERE mf.file_id = ? AND m.role = 'user';
 	}
 }
 
-func TestChatMessagesEditMessageCleansOrphanedAttachmentBlobAndMetadata(t *testing.T) {
+func TestChatMessagesEditMessageKeepsAttachmentsOnOriginalBranch(t *testing.T) {
 	store := &stubFileStore{objects: make(map[string][]byte)}
 	handler, db := newTestHandlerWithFileStore(t, stubStreamer{tokens: []string{"ok"}}, store)
 	t.Cleanup(func() { _ = db.Close() })
@@ -2725,12 +2724,20 @@ LIMIT 1;
 	if err := db.QueryRow(`SELECT COUNT(*) FROM files WHERE id = ?;`, "file-1").Scan(&fileCount); err != nil {
 		t.Fatalf("count files: %v", err)
 	}
-	if fileCount != 0 {
-		t.Fatalf("expected orphaned file metadata deletion, got %d rows", fileCount)
+	if fileCount != 1 {
+		t.Fatalf("expected file metadata to survive edit, got %d rows", fileCount)
 	}
 
-	if len(store.deletedPaths) != 1 || store.deletedPaths[0] != storagePath {
-		t.Fatalf("expected blob delete path %q, got %+v", storagePath, store.deletedPaths)
+	var linkedMessageID string
+	if err := db.QueryRow(`SELECT message_id FROM message_files WHERE file_id = ?;`, "file-1").Scan(&linkedMessageID); err != nil {
+		t.Fatalf("query message_files: %v", err)
+	}
+	if linkedMessageID != originalUserMessageID {
+		t.Fatalf("expected attachment to stay on original message, got %q", linkedMessageID)
+	}
+
+	if len(store.deletedPaths) != 0 {
+		t.Fatalf("expected no blob deletes on edit, got %+v", store.deletedPaths)
 	}
 }
 
@@ -2892,8 +2899,11 @@ func newTestHandlerWithFileStore(t *testing.T, streamer chatStreamer, fileStore
 		t.Fatalf("open sqlite: %v", err)
 	}
 	db.SetMaxOpenConns(1)
-	if _, err := db.Exec(testSchema); err != nil {
-		t.Fatalf("apply schema: %v", err)
+	if _, err := db.Exec(`PRAGMA foreign_keys = ON;`); err != nil {
+		t.Fatalf("enable foreign keys: %v", err)
+	}
+	if _, err := appdb.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("apply migrations: %v", err)
 	}
 
 	cfg := config.Config{
@@ -2948,7 +2958,8 @@ INSERT INTO models (
   curated,
   is_active
 )
-VALUES (?, 'openrouter', 'OpenRouter Free', 0, 0, 0, '["reasoning"]', 1, 1, 1);
+VALUES (?, 'openrouter', 'OpenRouter Free', 0, 0, 0, '["reasoning"]', 1, 1, 1)
+ON CONFLICT(id) DO NOTHING;
 `, id); err != nil {
 		t.Fatalf("seed model: %v", err)
 	}
@@ -2972,6 +2983,7 @@ func decodeJSONBody(t *testing.T, resp *httptest.ResponseRecorder, target any) {
 }
 
 type sseEvent struct {
+	ID   string
 	Type string
 	Data map[string]any
 }
@@ -2987,8 +2999,13 @@ func decodeSSEEvents(t *testing.T, raw string) []sseEvent {
 			continue
 		}
 		lines := strings.Split(chunk, "\n")
+		eventID := ""
 		for _, line := range lines {
 			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "id:") {
+				eventID = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+				continue
+			}
 			if !strings.HasPrefix(line, "data:") {
 				continue
 			}
@@ -3002,6 +3019,7 @@ func decodeSSEEvents(t *testing.T, raw string) []sseEvent {
 			}
 			typeValue, _ := data["type"].(string)
 			events = append(events, sseEvent{
+				ID:   eventID,
 				Type: typeValue,
 				Data: data,
 			})
@@ -3038,7 +3056,7 @@ func filterPlannerRequests(requests []openrouter.StreamRequest) []openrouter.Str
 func filterGenerationRequests(requests []openrouter.StreamRequest) []openrouter.StreamRequest {
 	filtered := make([]openrouter.StreamRequest, 0, len(requests))
 	for _, request := range requests {
-		if isPlannerRequest(request) {
+		if isPlannerRequest(request) || isTitleRequest(request) {
 			continue
 		}
 		filtered = append(filtered, request)
@@ -3046,6 +3064,14 @@ func filterGenerationRequests(requests []openrouter.StreamRequest) []openrouter.
 	return filtered
 }
 
+func isTitleRequest(request openrouter.StreamRequest) bool {
+	if len(request.Messages) == 0 {
+		return false
+	}
+	first := request.Messages[0]
+	return first.Role == "system" && strings.Contains(first.Content, "You name conversations for a chat sidebar.")
+}
+
 func isPlannerRequest(request openrouter.StreamRequest) bool {
 	if len(request.Messages) == 0 {
 		return false
@@ -3075,12 +3101,12 @@ type stubStreamer struct {
 }
 
 type stubGrounder struct {
-	results        []brave.SearchResult
+	results        []search.Result
 	err            error
 	waitForContext bool
 }
 
-func (s stubGrounder) Search(ctx context.Context, _ string, _ int) ([]brave.SearchResult, error) {
+func (s stubGrounder) Search(ctx context.Context, _ string, _ int) ([]search.Result, error) {
 	if s.waitForContext {
 		<-ctx.Done()
 		return nil, ctx.Err()
@@ -3170,135 +3196,16 @@ func (s *stubFileStore) PutObject(_ context.Context, objectPath, _ string, data
 	return nil
 }
 
+func (s *stubFileStore) GetObject(_ context.Context, objectPath string) ([]byte, error) {
+	data, ok := s.objects[objectPath]
+	if !ok {
+		return nil, errors.New("object not found")
+	}
+	return append([]byte(nil), data...), nil
+}
+
 func (s *stubFileStore) DeleteObject(_ context.Context, objectPath string) error {
 	s.deletedPaths = append(s.deletedPaths, objectPath)
 	delete(s.objects, objectPath)
 	return nil
 }
-
-const testSchema = `
-PRAGMA foreign_keys = ON;
-
-CREATE TABLE users (
-  id TEXT PRIMARY KEY,
-  google_sub TEXT NOT NULL UNIQUE,
-  email TEXT NOT NULL UNIQUE,
-  display_name TEXT,
-  avatar_url TEXT,
-  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE models (
-  id TEXT PRIMARY KEY,
-  provider TEXT NOT NULL,
-  display_name TEXT NOT NULL,
-  context_window INTEGER NOT NULL DEFAULT 0,
-  prompt_price_microusd INTEGER NOT NULL DEFAULT 0,
-  completion_price_microusd INTEGER NOT NULL DEFAULT 0,
-  supported_parameters_json TEXT,
-  supports_reasoning INTEGER NOT NULL DEFAULT 0,
-  curated INTEGER NOT NULL DEFAULT 0,
-  is_active INTEGER NOT NULL DEFAULT 1,
-  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE user_model_preferences (
-  user_id TEXT PRIMARY KEY,
-  last_used_model_id TEXT,
-  last_used_deep_research_model_id TEXT,
-  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-  FOREIGN KEY (last_used_model_id) REFERENCES models(id) ON DELETE SET NULL,
-  FOREIGN KEY (last_used_deep_research_model_id) REFERENCES models(id) ON DELETE SET NULL
-);
-
-CREATE TABLE user_model_favorites (
-  user_id TEXT NOT NULL,
-  model_id TEXT NOT NULL,
-  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  PRIMARY KEY (user_id, model_id),
-  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-  FOREIGN KEY (model_id) REFERENCES models(id) ON DELETE CASCADE
-);
-
-CREATE TABLE user_model_reasoning_presets (
-  user_id TEXT NOT NULL,
-  model_id TEXT NOT NULL,
-  mode TEXT NOT NULL CHECK (mode IN ('chat', 'deep_research')),
-  effort TEXT NOT NULL CHECK (effort IN ('low', 'medium', 'high')),
-  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  PRIMARY KEY (user_id, model_id, mode),
-  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-  FOREIGN KEY (model_id) REFERENCES models(id) ON DELETE CASCADE
-);
-
-CREATE TABLE conversations (
-  id TEXT PRIMARY KEY,
-  user_id TEXT NOT NULL,
-  title TEXT NOT NULL DEFAULT 'New Chat',
-  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-
-CREATE TABLE messages (
-  id TEXT PRIMARY KEY,
-  conversation_id TEXT NOT NULL,
-  user_id TEXT NOT NULL,
-  role TEXT NOT NULL CHECK (role IN ('system', 'user', 'assistant', 'tool')),
-  content TEXT NOT NULL,
-  reasoning_content TEXT,
-  thinking_trace_json TEXT,
-  model_id TEXT,
-  prompt_tokens INTEGER,
-  completion_tokens INTEGER,
-  total_tokens INTEGER,
-  reasoning_tokens INTEGER,
-  cost_microusd INTEGER,
-  byok_inference_cost_microusd INTEGER,
-  tokens_per_second REAL,
-  usage_model_id TEXT,
-  usage_provider_name TEXT,
-  grounding_enabled INTEGER NOT NULL DEFAULT 1,
-  deep_research_enabled INTEGER NOT NULL DEFAULT 0,
-  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
-  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-  FOREIGN KEY (model_id) REFERENCES models(id) ON DELETE SET NULL
-);
-
-CREATE TABLE citations (
-  id TEXT PRIMARY KEY,
-  message_id TEXT NOT NULL,
-  url TEXT NOT NULL,
-  title TEXT,
-  snippet TEXT,
-  source_provider TEXT,
-  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
-);
-
-CREATE TABLE files (
-  id TEXT PRIMARY KEY,
-  user_id TEXT NOT NULL,
-  filename TEXT NOT NULL,
-  media_type TEXT NOT NULL,
-  size_bytes INTEGER NOT NULL,
-  storage_backend TEXT NOT NULL CHECK (storage_backend IN ('local', 'gcs')),
-  storage_path TEXT NOT NULL,
-  extracted_text TEXT,
-  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-
-CREATE TABLE message_files (
-  message_id TEXT NOT NULL,
-  file_id TEXT NOT NULL,
-  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  PRIMARY KEY (message_id, file_id),
-  FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
-  FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
-);
-`
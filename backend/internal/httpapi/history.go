@@ -0,0 +1,404 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chat/backend/internal/openrouter"
+)
+
+const (
+	// defaultHistoryContextWindow is assumed for models whose context window
+	// is unknown (0 in the catalog).
+	defaultHistoryContextWindow = 8192
+	maxHistoryPathMessages      = 400
+	historyMessageOverhead      = 4
+	historySummaryReserveTokens = 600
+	maxHistorySummaryRunes      = 4000
+	maxHistorySummaryTurnRunes  = 2000
+	// Summarizer prompts are cut into chunks of at least this many tokens,
+	// and at most maxHistorySummaryChunks run before one reply. Turns left
+	// over are summarized on later replies.
+	minHistorySummaryChunkTokens = 1000
+	maxHistorySummaryChunks      = 4
+	// historySummaryTimeout bounds every summarizer call made before one
+	// reply; chunks it cuts off are summarized on later replies.
+	historySummaryTimeout = 20 * time.Second
+	// maxConversationSummaries caps the branch summaries kept per
+	// conversation; the least recently written are dropped first.
+	maxConversationSummaries = 8
+)
+
+type historyMessage struct {
+	ID      string
+	Role    string
+	Content string
+}
+
+// conversationSummary is the summary of one branch up to and including the
+// message it is stored under, with the summarizer usage spent building it.
+type conversationSummary struct {
+	Content          string
+	PromptTokens     int
+	CompletionTokens int
+	CostMicrosUSD    int
+}
+
+// estimateTokens approximates a tokenizer at four runes per token, which errs
+// high for English and close enough elsewhere for budgeting.
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+func estimateMessageTokens(content string) int {
+	return estimateTokens(content) + historyMessageOverhead
+}
+
+// historyTokenBudget leaves half the context window for the system prompt,
+// grounding evidence and the reply, and takes the current prompt out of the
+// other half.
+func historyTokenBudget(contextWindow int, prompt string) int {
+	if contextWindow <= 0 {
+		contextWindow = defaultHistoryContextWindow
+	}
+	return max(contextWindow/2-estimateMessageTokens(prompt), 0)
+}
+
+// splitHistoryByBudget keeps the newest messages that fit budget and returns
+// the older remainder separately, both oldest first.
+func splitHistoryByBudget(messages []historyMessage, budget int) ([]historyMessage, []historyMessage) {
+	used := 0
+	start := len(messages)
+	for start > 0 {
+		cost := estimateMessageTokens(messages[start-1].Content)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+	return messages[:start], messages[start:]
+}
+
+// promptHistory turns the active path before the current prompt into history
+// that fits the model's context window. Turns that do not fit are folded into
+// the conversation's rolling summary, which is sent as a system message.
+func (h Handler) promptHistory(ctx context.Context, userID, conversationID, modelID, prompt string, path []historyMessage) []openrouter.Message {
+	contextWindow, err := h.modelContextWindow(ctx, modelID)
+	if err != nil {
+		log.Printf("history context window lookup failed: model_id=%s err=%v", modelID, err)
+	}
+	budget := historyTokenBudget(contextWindow, prompt)
+
+	total := 0
+	for _, message := range path {
+		total += estimateMessageTokens(message.Content)
+	}
+	older, recent := []historyMessage(nil), path
+	if total > budget {
+		older, recent = splitHistoryByBudget(path, max(budget-historySummaryReserveTokens, 0))
+	}
+
+	messages := make([]openrouter.Message, 0, len(recent)+1)
+	if len(older) > 0 {
+		if summary := h.refreshConversationSummary(ctx, userID, conversationID, older); summary != "" {
+			messages = append(messages, openrouter.Message{
+				Role:    "system",
+				Content: "Summary of the earlier conversation:\n" + summary,
+			})
+		}
+	}
+	for _, message := range recent {
+		messages = append(messages, openrouter.Message{Role: message.Role, Content: message.Content})
+	}
+	return messages
+}
+
+// refreshConversationSummary returns a summary covering older. Each branch
+// keeps its own summaries: the one stored furthest along this path is
+// extended with just the turns after it into a new one, so branches that
+// forked after it can still extend it too, and a path without one starts
+// from scratch.
+// Turns are folded in oldest first, one context-sized chunk per call to
+// HISTORY_SUMMARY_MODEL, and the summary is saved through the last chunk that
+// succeeded within historySummaryTimeout.
+func (h Handler) refreshConversationSummary(ctx context.Context, userID, conversationID string, older []historyMessage) string {
+	stored, err := h.readConversationSummaries(ctx, userID, conversationID)
+	if err != nil {
+		log.Printf("history summary read failed: conversation_id=%s err=%v", conversationID, err)
+	}
+
+	var base conversationSummary
+	pending := older
+	for i := len(older) - 1; i >= 0; i-- {
+		if summary, ok := stored[older[i].ID]; ok {
+			base = summary
+			pending = older[i+1:]
+			break
+		}
+	}
+	if len(pending) == 0 {
+		return base.Content
+	}
+
+	modelID := fallback(h.cfg.HistorySummaryModel, h.cfg.OpenRouterDefaultModel)
+	contextWindow, err := h.modelContextWindow(ctx, modelID)
+	if err != nil {
+		log.Printf("history summary context window lookup failed: model_id=%s err=%v", modelID, err)
+	}
+	summaryCtx, cancel := context.WithTimeout(ctx, historySummaryTimeout)
+	defer cancel()
+
+	summary := base.Content
+	var usage openrouter.Usage
+	throughMessageID := ""
+	chunks := chunkHistoryForSummary(pending, historySummaryChunkBudget(contextWindow))
+	for _, chunk := range chunks[:min(len(chunks), maxHistorySummaryChunks)] {
+		updated, chunkUsage, err := h.summarizeHistory(summaryCtx, modelID, summary, chunk)
+		if err != nil {
+			log.Printf("history summary refresh failed: conversation_id=%s model_id=%s turns=%d err=%v", conversationID, modelID, len(chunk), err)
+			break
+		}
+		summary = updated
+		usage = addOpenRouterUsage(usage, chunkUsage)
+		throughMessageID = chunk[len(chunk)-1].ID
+	}
+	if throughMessageID == "" {
+		return base.Content
+	}
+
+	log.Printf(
+		"history summary refreshed: conversation_id=%s model_id=%s chunks=%d of %d prompt_tokens=%d completion_tokens=%d",
+		conversationID, modelID, min(len(chunks), maxHistorySummaryChunks), len(chunks), usage.PromptTokens, usage.CompletionTokens,
+	)
+	cost := 0
+	if usage.CostMicrosUSD != nil {
+		cost = *usage.CostMicrosUSD
+	}
+	if err := h.saveConversationSummary(ctx, conversationID, throughMessageID, conversationSummary{
+		Content:          summary,
+		PromptTokens:     base.PromptTokens + usage.PromptTokens,
+		CompletionTokens: base.CompletionTokens + usage.CompletionTokens,
+		CostMicrosUSD:    base.CostMicrosUSD + cost,
+	}); err != nil {
+		log.Printf("history summary persist failed: conversation_id=%s err=%v", conversationID, err)
+	}
+	return summary
+}
+
+// historySummaryChunkBudget leaves room in half the context window for the
+// instructions, the running summary and the reply.
+func historySummaryChunkBudget(contextWindow int) int {
+	if contextWindow <= 0 {
+		contextWindow = defaultHistoryContextWindow
+	}
+	budget := contextWindow/2 - estimateTokens(strings.Repeat(" ", maxHistorySummaryRunes)) - historySummaryReserveTokens
+	return max(budget, minHistorySummaryChunkTokens)
+}
+
+// chunkHistoryForSummary splits turns, oldest first, into chunks whose
+// trimmed transcript fits budget. Every chunk holds at least one turn.
+func chunkHistoryForSummary(turns []historyMessage, budget int) [][]historyMessage {
+	var chunks [][]historyMessage
+	start, used := 0, 0
+	for i, turn := range turns {
+		cost := estimateMessageTokens(trimToRunes(turn.Content, maxHistorySummaryTurnRunes))
+		if i > start && used+cost > budget {
+			chunks = append(chunks, turns[start:i])
+			start, used = i, 0
+		}
+		used += cost
+	}
+	if start < len(turns) {
+		chunks = append(chunks, turns[start:])
+	}
+	return chunks
+}
+
+func (h Handler) summarizeHistory(ctx context.Context, modelID, summary string, turns []historyMessage) (string, openrouter.Usage, error) {
+	if strings.TrimSpace(summary) == "" {
+		summary = "(none yet)"
+	}
+	var transcript strings.Builder
+	for _, turn := range turns {
+		speaker := "User"
+		if turn.Role == "assistant" {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", speaker, trimToRunes(turn.Content, maxHistorySummaryTurnRunes))
+	}
+
+	var out strings.Builder
+	var usage openrouter.Usage
+	err := h.openrouter.StreamChatCompletion(
+		ctx,
+		openrouter.StreamRequest{
+			Model: modelID,
+			Messages: []openrouter.Message{
+				{
+					Role:    "system",
+					Content: "You maintain a running summary of a conversation between a user and an assistant. Merge the new turns into the current summary. Keep facts, decisions, names, numbers, user preferences and open questions; drop pleasantries. Reply with the updated summary only, under 300 words.",
+				},
+				{
+					Role:    "user",
+					Content: "Current summary:\n" + summary + "\n\nNew turns:\n" + strings.TrimSpace(transcript.String()),
+				},
+			},
+		},
+		nil,
+		func(delta string) error {
+			out.WriteString(delta)
+			return nil
+		},
+		nil,
+		func(reported openrouter.Usage) error {
+			usage = reported
+			return nil
+		},
+	)
+	if err != nil {
+		return "", openrouter.Usage{}, err
+	}
+	updated := strings.TrimSpace(out.String())
+	if updated == "" {
+		return "", openrouter.Usage{}, errors.New("summary response was empty")
+	}
+	return trimToRunes(updated, maxHistorySummaryRunes), usage, nil
+}
+
+func (h Handler) modelContextWindow(ctx context.Context, modelID string) (int, error) {
+	var contextWindow int
+	err := h.db.QueryRowContext(ctx, `
+SELECT context_window
+FROM models
+WHERE id = ?;
+`, modelID).Scan(&contextWindow)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return contextWindow, err
+}
+
+// readConversationSummaries returns the conversation's branch summaries
+// keyed by the message each covers through.
+func (h Handler) readConversationSummaries(ctx context.Context, userID, conversationID string) (map[string]conversationSummary, error) {
+	rows, err := h.db.QueryContext(ctx, `
+SELECT s.through_message_id, s.content, s.prompt_tokens, s.completion_tokens, s.cost_microusd
+FROM conversation_summaries s
+JOIN conversations c ON c.id = s.conversation_id
+WHERE s.conversation_id = ? AND c.user_id = ?;
+`, conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make(map[string]conversationSummary)
+	for rows.Next() {
+		var throughMessageID string
+		var summary conversationSummary
+		if err := rows.Scan(&throughMessageID, &summary.Content, &summary.PromptTokens, &summary.CompletionTokens, &summary.CostMicrosUSD); err != nil {
+			return nil, err
+		}
+		summaries[throughMessageID] = summary
+	}
+	return summaries, rows.Err()
+}
+
+// saveConversationSummary stores summary under throughMessageID and drops the
+// conversation's least recently written summaries past
+// maxConversationSummaries. Usage totals are carried from the summary it
+// extended, so each row holds everything spent on its branch.
+func (h Handler) saveConversationSummary(ctx context.Context, conversationID, throughMessageID string, summary conversationSummary) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO conversation_summaries (
+  conversation_id, through_message_id, content, prompt_tokens, completion_tokens, cost_microusd, updated_at
+)
+VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(conversation_id, through_message_id) DO UPDATE SET
+  content = excluded.content,
+  prompt_tokens = excluded.prompt_tokens,
+  completion_tokens = excluded.completion_tokens,
+  cost_microusd = excluded.cost_microusd,
+  updated_at = CURRENT_TIMESTAMP;
+`, conversationID, throughMessageID, summary.Content, summary.PromptTokens, summary.CompletionTokens, summary.CostMicrosUSD); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+DELETE FROM conversation_summaries
+WHERE conversation_id = ? AND rowid NOT IN (
+  SELECT rowid
+  FROM conversation_summaries
+  WHERE conversation_id = ?
+  ORDER BY updated_at DESC, rowid DESC
+  LIMIT ?
+);
+`, conversationID, conversationID, maxConversationSummaries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// listConversationPromptPath returns the user and assistant messages on the
+// path ending at leafMessageID, oldest first.
+func (h Handler) listConversationPromptPath(ctx context.Context, userID, conversationID, leafMessageID string) ([]historyMessage, error) {
+	if strings.TrimSpace(leafMessageID) == "" {
+		return nil, nil
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+WITH RECURSIVE branch(id, depth) AS (
+  SELECT m.id, 0
+  FROM messages m
+  JOIN conversations c ON c.id = m.conversation_id
+  WHERE m.id = ? AND m.conversation_id = ? AND c.user_id = ?
+  UNION ALL
+  SELECT m.parent_message_id, branch.depth + 1
+  FROM messages m
+  JOIN branch ON m.id = branch.id
+  WHERE m.parent_message_id IS NOT NULL
+)
+SELECT m.id, m.role, m.content
+FROM branch
+JOIN messages m ON m.id = branch.id
+WHERE m.role IN ('user', 'assistant')
+ORDER BY branch.depth ASC
+LIMIT ?;
+`, leafMessageID, conversationID, userID, maxHistoryPathMessages)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]historyMessage, 0, 16)
+	for rows.Next() {
+		var message historyMessage
+		if err := rows.Scan(&message.ID, &message.Role, &message.Content); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(message.Content) == "" {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
@@ -0,0 +1,287 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+func TestSplitHistoryByBudgetKeepsNewestMessages(t *testing.T) {
+	messages := []historyMessage{
+		{ID: "m1", Content: strings.Repeat("a", 40)},
+		{ID: "m2", Content: strings.Repeat("b", 40)},
+		{ID: "m3", Content: strings.Repeat("c", 40)},
+	}
+	perMessage := estimateMessageTokens(messages[0].Content)
+
+	older, recent := splitHistoryByBudget(messages, 2*perMessage)
+	if len(older) != 1 || older[0].ID != "m1" || len(recent) != 2 || recent[0].ID != "m2" {
+		t.Fatalf("expected newest two messages to fit, got older=%+v recent=%+v", older, recent)
+	}
+
+	older, recent = splitHistoryByBudget(messages, 3*perMessage)
+	if len(older) != 0 || len(recent) != 3 {
+		t.Fatalf("expected all messages to fit, got older=%+v recent=%+v", older, recent)
+	}
+
+	if got := historyTokenBudget(0, ""); got != defaultHistoryContextWindow/2-historyMessageOverhead {
+		t.Fatalf("expected unknown context window to use the default, got %d", got)
+	}
+}
+
+func TestChatMessagesFoldsOverflowingHistoryIntoRollingSummary(t *testing.T) {
+	capturedRequests := make([]openrouter.StreamRequest, 0, 4)
+	streamer := stubStreamer{
+		tokens: []string{"Ack"},
+		onRequest: func(req openrouter.StreamRequest) {
+			capturedRequests = append(capturedRequests, req)
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET context_window = 2000 WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("set context window: %v", err)
+	}
+
+	ctx := context.Background()
+	conversation, err := handler.insertConversation(ctx, user.ID, "Long thread")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	for i := 1; i <= 10; i++ {
+		role := "user"
+		if i%2 == 0 {
+			role = "assistant"
+		}
+		if err := handler.insertMessage(ctx, user.ID, conversation.ID, role, strings.Repeat(fmt.Sprintf("turn %02d ", i), 50), "", true, false); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+	}
+	var seventhID string
+	if err := db.QueryRow(`SELECT id FROM messages WHERE content LIKE 'turn 07 %';`).Scan(&seventhID); err != nil {
+		t.Fatalf("query seventh message: %v", err)
+	}
+
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversation.ID+`","message":"Next?","modelId":"openrouter/free","grounding":false}`)
+
+	summaryRequests, generationRequests := splitSummaryRequests(capturedRequests)
+	if len(summaryRequests) != 1 || len(generationRequests) != 1 {
+		t.Fatalf("expected one summary and one generation request, got %d and %d", len(summaryRequests), len(generationRequests))
+	}
+	firstSummaryInput := summaryRequests[0].Messages[1].Content
+	if !strings.Contains(firstSummaryInput, "turn 01 ") || !strings.Contains(firstSummaryInput, "turn 07 ") || strings.Contains(firstSummaryInput, "turn 08 ") {
+		t.Fatalf("expected turns 1-7 to be summarized, got %q", firstSummaryInput)
+	}
+
+	prompt := generationRequests[0].Messages
+	summaryIndex := -1
+	for i, message := range prompt {
+		if message.Role == "system" && message.Content == "Summary of the earlier conversation:\nAck" {
+			summaryIndex = i
+		}
+	}
+	if summaryIndex == -1 || summaryIndex+3 >= len(prompt) {
+		t.Fatalf("expected summary followed by recent turns, got %+v", prompt)
+	}
+	if !strings.HasPrefix(prompt[summaryIndex+1].Content, "turn 08 ") || prompt[len(prompt)-1].Content != "Next?" {
+		t.Fatalf("expected turns 8-10 and the new prompt after the summary, got %+v", prompt[summaryIndex:])
+	}
+
+	var throughMessageID string
+	if err := db.QueryRow(`SELECT through_message_id FROM conversation_summaries WHERE conversation_id = ?;`, conversation.ID).Scan(&throughMessageID); err != nil {
+		t.Fatalf("query summary: %v", err)
+	}
+	if throughMessageID != seventhID {
+		t.Fatalf("expected summary through the seventh message, got %q", throughMessageID)
+	}
+
+	capturedRequests = capturedRequests[:0]
+	longPrompt := strings.Repeat("more ", 80)
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversation.ID+`","message":"`+longPrompt+`","modelId":"openrouter/free","grounding":false}`)
+
+	summaryRequests, _ = splitSummaryRequests(capturedRequests)
+	if len(summaryRequests) != 1 {
+		t.Fatalf("expected one incremental summary request, got %d", len(summaryRequests))
+	}
+	incrementalInput := summaryRequests[0].Messages[1].Content
+	if !strings.HasPrefix(incrementalInput, "Current summary:\nAck") || !strings.Contains(incrementalInput, "turn 08 ") || strings.Contains(incrementalInput, "turn 07 ") {
+		t.Fatalf("expected only turn 8 folded into the stored summary, got %q", incrementalInput)
+	}
+}
+
+func TestChatMessagesKeepsHistorySummaryPerBranchWithSummaryModel(t *testing.T) {
+	capturedRequests := make([]openrouter.StreamRequest, 0, 4)
+	streamer := stubStreamer{
+		tokens: []string{"Ack"},
+		onRequest: func(req openrouter.StreamRequest) {
+			capturedRequests = append(capturedRequests, req)
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+	handler.cfg.HistorySummaryModel = "openrouter/summary"
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	seedModel(t, db, "openrouter/summary")
+	if _, err := db.Exec(`UPDATE models SET context_window = 2000 WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("set context window: %v", err)
+	}
+
+	ctx := context.Background()
+	conversation, err := handler.insertConversation(ctx, user.ID, "Long thread")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	for i := 1; i <= 10; i++ {
+		role := "user"
+		if i%2 == 0 {
+			role = "assistant"
+		}
+		if err := handler.insertMessage(ctx, user.ID, conversation.ID, role, strings.Repeat(fmt.Sprintf("turn %02d ", i), 50), "", true, false); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+	}
+
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversation.ID+`","message":"Next?","modelId":"openrouter/free","grounding":false}`)
+	summaryRequests, _ := splitSummaryRequests(capturedRequests)
+	if len(summaryRequests) != 1 || summaryRequests[0].Model != "openrouter/summary" {
+		t.Fatalf("expected one summary request on the summary model, got %+v", summaryRequests)
+	}
+
+	longPrompt := strings.Repeat("more ", 80)
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversation.ID+`","message":"`+longPrompt+`","modelId":"openrouter/free","grounding":false}`)
+	var branchMessageID, nextMessageID string
+	if err := db.QueryRow(`SELECT id FROM messages WHERE conversation_id = ? AND content = ?;`, conversation.ID, longPrompt).Scan(&branchMessageID); err != nil {
+		t.Fatalf("query branch message: %v", err)
+	}
+	if err := db.QueryRow(`SELECT id FROM messages WHERE conversation_id = ? AND content = 'Next?';`, conversation.ID).Scan(&nextMessageID); err != nil {
+		t.Fatalf("query edited message: %v", err)
+	}
+
+	capturedRequests = capturedRequests[:0]
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversation.ID+`","editMessageId":"`+nextMessageID+`","message":"Next!","modelId":"openrouter/free","grounding":false}`)
+	if summaryRequests, _ := splitSummaryRequests(capturedRequests); len(summaryRequests) != 0 {
+		t.Fatalf("expected the new branch to reuse the summary it shares, got %d summary requests", len(summaryRequests))
+	}
+
+	req := httptest.NewRequest(
+		http.MethodPut,
+		"/v1/conversations/"+conversation.ID+"/active-branch",
+		strings.NewReader(`{"messageId":"`+branchMessageID+`"}`),
+	)
+	req = requestWithConversationID(requestWithSessionUser(req, user), conversation.ID)
+	resp := httptest.NewRecorder()
+	handler.SwitchConversationBranch(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	capturedRequests = capturedRequests[:0]
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversation.ID+`","message":"Again?","modelId":"openrouter/free","grounding":false}`)
+	summaryRequests, _ = splitSummaryRequests(capturedRequests)
+	for _, request := range summaryRequests {
+		if strings.Contains(request.Messages[1].Content, "turn 01 ") {
+			t.Fatalf("expected switching back to extend the branch summary, got a rebuild %q", request.Messages[1].Content)
+		}
+	}
+}
+
+func TestChatMessagesSummarizesLongHistoryInChunksAndRecordsUsage(t *testing.T) {
+	capturedRequests := make([]openrouter.StreamRequest, 0, 8)
+	cost := 5
+	streamer := stubStreamer{
+		tokens: []string{"Ack"},
+		usage:  &openrouter.Usage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110, CostMicrosUSD: &cost},
+		onRequest: func(req openrouter.StreamRequest) {
+			capturedRequests = append(capturedRequests, req)
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET context_window = 2000 WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("set context window: %v", err)
+	}
+
+	ctx := context.Background()
+	conversation, err := handler.insertConversation(ctx, user.ID, "Very long thread")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	for i := 1; i <= 12; i++ {
+		role := "user"
+		if i%2 == 0 {
+			role = "assistant"
+		}
+		if err := handler.insertMessage(ctx, user.ID, conversation.ID, role, strings.Repeat(fmt.Sprintf("turn %02d ", i), 200), "", true, false); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+	}
+	var eighthID string
+	if err := db.QueryRow(`SELECT id FROM messages WHERE content LIKE 'turn 08 %';`).Scan(&eighthID); err != nil {
+		t.Fatalf("query eighth message: %v", err)
+	}
+
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversation.ID+`","message":"Next?","modelId":"openrouter/free","grounding":false}`)
+
+	summaryRequests, _ := splitSummaryRequests(capturedRequests)
+	if len(summaryRequests) != maxHistorySummaryChunks {
+		t.Fatalf("expected %d chunked summary requests, got %d", maxHistorySummaryChunks, len(summaryRequests))
+	}
+	for i, request := range summaryRequests {
+		input := request.Messages[1].Content
+		if estimateTokens(input) > historySummaryChunkBudget(2000)+estimateTokens(strings.Repeat(" ", maxHistorySummaryRunes)) {
+			t.Fatalf("summary request %d exceeds the chunk budget: %d tokens", i, estimateTokens(input))
+		}
+		if i > 0 && !strings.HasPrefix(input, "Current summary:\nAck") {
+			t.Fatalf("expected chunk %d to carry the running summary, got %q", i, input[:40])
+		}
+	}
+	if !strings.Contains(summaryRequests[0].Messages[1].Content, "turn 01 ") || strings.Contains(summaryRequests[0].Messages[1].Content, "turn 03 ") {
+		t.Fatalf("expected the first chunk to hold the oldest turns")
+	}
+
+	var throughMessageID string
+	var promptTokens, completionTokens, costMicros int
+	if err := db.QueryRow(`
+SELECT through_message_id, prompt_tokens, completion_tokens, cost_microusd
+FROM conversation_summaries
+WHERE conversation_id = ?;
+`, conversation.ID).Scan(&throughMessageID, &promptTokens, &completionTokens, &costMicros); err != nil {
+		t.Fatalf("query summary: %v", err)
+	}
+	if throughMessageID != eighthID {
+		t.Fatalf("expected summary through the last summarized chunk, got %q", throughMessageID)
+	}
+	if promptTokens != 400 || completionTokens != 40 || costMicros != 20 {
+		t.Fatalf("expected summed summarizer usage, got prompt=%d completion=%d cost=%d", promptTokens, completionTokens, costMicros)
+	}
+}
+
+func splitSummaryRequests(requests []openrouter.StreamRequest) ([]openrouter.StreamRequest, []openrouter.StreamRequest) {
+	var summaries []openrouter.StreamRequest
+	var generations []openrouter.StreamRequest
+	for _, request := range filterGenerationRequests(requests) {
+		if strings.Contains(request.Messages[0].Content, "running summary of a conversation") {
+			summaries = append(summaries, request)
+			continue
+		}
+		generations = append(generations, request)
+	}
+	return summaries, generations
+}
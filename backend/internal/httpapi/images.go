@@ -0,0 +1,104 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"chat/backend/internal/openrouter"
+)
+
+var (
+	errImageInputUnsupported = errors.New("selected model does not accept image input")
+	errImagesInDeepResearch  = errors.New("image attachments are not supported in deep research")
+)
+
+func hasImageFiles(files []storedFile) bool {
+	return slices.ContainsFunc(files, storedFile.isImage)
+}
+
+// checkImageAttachments rejects image attachments the generation could not
+// use: deep research only reads text, and text-only models would drop them.
+func (h Handler) checkImageAttachments(ctx context.Context, modelID string, deepResearch bool, files []storedFile) error {
+	if !hasImageFiles(files) {
+		return nil
+	}
+	if deepResearch {
+		return errImagesInDeepResearch
+	}
+	accepts, err := h.modelAcceptsImages(ctx, modelID)
+	if err != nil {
+		return err
+	}
+	if !accepts {
+		return errImageInputUnsupported
+	}
+	return nil
+}
+
+// modelAcceptsImages reads the catalog's input modalities. Models the catalog
+// has not described are treated as text-only.
+func (h Handler) modelAcceptsImages(ctx context.Context, modelID string) (bool, error) {
+	var raw sql.NullString
+	err := h.db.QueryRowContext(ctx, `
+SELECT input_modalities_json
+FROM models
+WHERE id = ?;
+`, modelID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return modalitiesIncludeImage(raw), nil
+}
+
+func modalitiesIncludeImage(raw sql.NullString) bool {
+	if !raw.Valid || strings.TrimSpace(raw.String) == "" {
+		return false
+	}
+	var modalities []string
+	if err := json.Unmarshal([]byte(raw.String), &modalities); err != nil {
+		return false
+	}
+	return slices.Contains(modalities, "image")
+}
+
+// loadImageParts reads image attachments back from object storage and
+// inlines them as base64 data URLs.
+func (h Handler) loadImageParts(ctx context.Context, files []storedFile) ([]openrouter.ContentPart, error) {
+	if !hasImageFiles(files) {
+		return nil, nil
+	}
+	if h.files == nil {
+		return nil, errors.New("attachments storage is not configured")
+	}
+
+	parts := make([]openrouter.ContentPart, 0, len(files))
+	for _, file := range files {
+		if !file.isImage() {
+			continue
+		}
+		data, err := h.files.GetObject(ctx, file.StoragePath)
+		if err != nil {
+			return nil, fmt.Errorf("load image %s: %w", file.ID, err)
+		}
+		parts = append(parts, openrouter.ImagePart("data:"+file.MediaType+";base64,"+base64.StdEncoding.EncodeToString(data)))
+	}
+	return parts, nil
+}
+
+// userMessageParts puts the prompt text ahead of the images, or returns nil
+// for a plain text message.
+func userMessageParts(prompt string, images []openrouter.ContentPart) []openrouter.ContentPart {
+	if len(images) == 0 {
+		return nil
+	}
+	return append([]openrouter.ContentPart{openrouter.TextPart(prompt)}, images...)
+}
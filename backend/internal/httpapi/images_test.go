@@ -0,0 +1,161 @@
+package httpapi
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func uploadTestFile(t *testing.T, handler Handler, user session.User, filename string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("create multipart form file: %v", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatalf("write multipart payload: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", &body)
+	req = requestWithSessionUser(req, user)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp := httptest.NewRecorder()
+	handler.UploadFile(resp, req)
+	return resp
+}
+
+func TestUploadFileAcceptsImagesMatchingTheirExtension(t *testing.T) {
+	store := &stubFileStore{objects: make(map[string][]byte)}
+	handler, db := newTestHandlerWithFileStore(t, stubStreamer{}, store)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	resp := uploadTestFile(t, handler, user, "screenshot.png", testPNG(t))
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusCreated, resp.Code, resp.Body.String())
+	}
+	var payload struct {
+		File fileResponse `json:"file"`
+	}
+	decodeJSONBody(t, resp, &payload)
+	if payload.File.MediaType != "image/png" {
+		t.Fatalf("unexpected media type: %s", payload.File.MediaType)
+	}
+	if len(store.objects) != 1 {
+		t.Fatalf("expected image blob to be stored, got %d objects", len(store.objects))
+	}
+
+	fake := uploadTestFile(t, handler, user, "notes.jpg", []byte("not really a jpeg"))
+	if fake.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for mismatched image content, got %d (%s)", fake.Code, fake.Body.String())
+	}
+}
+
+func TestChatMessagesSendsImagesToVisionModels(t *testing.T) {
+	var generationRequests []openrouter.StreamRequest
+	streamer := stubStreamer{
+		tokens: []string{"A blank square."},
+		onRequest: func(req openrouter.StreamRequest) {
+			generationRequests = append(generationRequests, req)
+		},
+	}
+	store := &stubFileStore{objects: make(map[string][]byte)}
+	handler, db := newTestHandlerWithFileStore(t, streamer, store)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET input_modalities_json = '["text","image"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("enable image input: %v", err)
+	}
+
+	var uploaded struct {
+		File fileResponse `json:"file"`
+	}
+	decodeJSONBody(t, uploadTestFile(t, handler, user, "square.png", testPNG(t)), &uploaded)
+
+	postChatMessage(t, handler, user, `{"message":"What is in this picture?","modelId":"openrouter/free","grounding":false,"fileIds":["`+uploaded.File.ID+`"]}`)
+
+	generationRequests = filterGenerationRequests(generationRequests)
+	if len(generationRequests) != 1 {
+		t.Fatalf("expected one generation request, got %d", len(generationRequests))
+	}
+	messages := generationRequests[0].Messages
+	last := messages[len(messages)-1]
+	if len(last.Parts) != 2 {
+		t.Fatalf("expected text and image parts, got %+v", last.Parts)
+	}
+	if last.Parts[0].Type != "text" || last.Parts[0].Text != "What is in this picture?" {
+		t.Fatalf("expected the prompt without an attachment excerpt header, got %+v", last.Parts[0])
+	}
+	if last.Parts[1].ImageURL == nil || !strings.HasPrefix(last.Parts[1].ImageURL.URL, "data:image/png;base64,") {
+		t.Fatalf("expected inlined png, got %+v", last.Parts[1])
+	}
+}
+
+func TestChatMessagesRejectsImagesTheModelCannotUse(t *testing.T) {
+	store := &stubFileStore{objects: make(map[string][]byte)}
+	handler, db := newTestHandlerWithFileStore(t, stubStreamer{tokens: []string{"unused"}}, store)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET input_modalities_json = '["text"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("set text-only input: %v", err)
+	}
+
+	var uploaded struct {
+		File fileResponse `json:"file"`
+	}
+	decodeJSONBody(t, uploadTestFile(t, handler, user, "square.png", testPNG(t)), &uploaded)
+
+	for name, body := range map[string]string{
+		"text-only model": `{"message":"Describe it","modelId":"openrouter/free","fileIds":["` + uploaded.File.ID + `"]}`,
+		"deep research":   `{"message":"Describe it","modelId":"openrouter/free","deepResearch":true,"fileIds":["` + uploaded.File.ID + `"]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(body))
+		req = requestWithSessionUser(req, user)
+		resp := httptest.NewRecorder()
+		handler.ChatMessages(resp, req)
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d (%s)", name, resp.Code, resp.Body.String())
+		}
+		if !strings.Contains(resp.Body.String(), "unsupported_attachment") {
+			t.Fatalf("%s: expected unsupported_attachment error, got %s", name, resp.Body.String())
+		}
+	}
+
+	var messages int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM messages;`).Scan(&messages); err != nil {
+		t.Fatalf("count messages: %v", err)
+	}
+	if messages != 0 {
+		t.Fatalf("expected rejected requests to persist nothing, got %d messages", messages)
+	}
+}
@@ -0,0 +1,164 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"chat/backend/internal/session"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxCustomInstructionsRunes = 4000
+	maxSystemPromptRunes       = 4000
+)
+
+type updateCustomInstructionsRequest struct {
+	CustomInstructions string `json:"customInstructions"`
+}
+
+type updateSystemPromptRequest struct {
+	SystemPrompt string `json:"systemPrompt"`
+}
+
+// UpdateCustomInstructions replaces the standing instructions applied to
+// every reply for the current user. An empty value clears them.
+func (h Handler) UpdateCustomInstructions(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	var req updateCustomInstructionsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	instructions := strings.TrimSpace(req.CustomInstructions)
+	if utf8.RuneCountInString(instructions) > maxCustomInstructionsRunes {
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("customInstructions must be at most %d characters", maxCustomInstructionsRunes))
+		return
+	}
+
+	updated, err := h.sessions.UpdateCustomInstructions(r.Context(), user.ID, instructions)
+	if err != nil {
+		if errors.Is(err, session.ErrNotFound) {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to update custom instructions")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"user": updated})
+}
+
+// UpdateConversationSystemPrompt replaces the system prompt scoped to one
+// conversation. An empty value clears it.
+func (h Handler) UpdateConversationSystemPrompt(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	conversationID := strings.TrimSpace(chi.URLParam(r, "id"))
+	if conversationID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "conversation id is required")
+		return
+	}
+
+	var req updateSystemPromptRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	systemPrompt := strings.TrimSpace(req.SystemPrompt)
+	if utf8.RuneCountInString(systemPrompt) > maxSystemPromptRunes {
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("systemPrompt must be at most %d characters", maxSystemPromptRunes))
+		return
+	}
+
+	var conversation conversationResponse
+	err = h.db.QueryRowContext(r.Context(), `
+UPDATE conversations
+SET system_prompt = ?
+WHERE id = ? AND user_id = ?
+RETURNING id, title, system_prompt, created_at, updated_at;
+`, systemPrompt, conversationID, user.ID).Scan(
+		&conversation.ID,
+		&conversation.Title,
+		&conversation.SystemPrompt,
+		&conversation.CreatedAt,
+		&conversation.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "conversation_not_found", "conversation not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to update system prompt")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"conversation": conversation})
+}
+
+// promptInstructions loads the user's custom instructions and the
+// conversation's system prompt and renders them for the model.
+func (h Handler) promptInstructions(ctx context.Context, userID, conversationID string) (string, error) {
+	var customInstructions string
+	var systemPrompt string
+	err := h.db.QueryRowContext(ctx, `
+SELECT u.custom_instructions, c.system_prompt
+FROM conversations c
+JOIN users u ON u.id = c.user_id
+WHERE c.id = ? AND c.user_id = ?;
+`, conversationID, userID).Scan(&customInstructions, &systemPrompt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return buildInstructionsPrompt(customInstructions, systemPrompt), nil
+}
+
+// buildInstructionsPrompt renders the user's custom instructions and the
+// conversation's system prompt as one system message, or "" when both are
+// empty. The conversation prompt comes last so it wins on conflicts.
+func buildInstructionsPrompt(customInstructions, systemPrompt string) string {
+	customInstructions = strings.TrimSpace(customInstructions)
+	systemPrompt = strings.TrimSpace(systemPrompt)
+
+	var builder strings.Builder
+	if customInstructions != "" {
+		builder.WriteString("The user's custom instructions. Follow them unless they conflict with the rules above:\n")
+		builder.WriteString(customInstructions)
+	}
+	if systemPrompt != "" {
+		if builder.Len() > 0 {
+			builder.WriteString("\n\n")
+		}
+		builder.WriteString("Instructions for this conversation. Follow them unless they conflict with the rules above:\n")
+		builder.WriteString(systemPrompt)
+	}
+	return builder.String()
+}
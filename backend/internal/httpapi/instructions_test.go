@@ -0,0 +1,120 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+func TestCustomInstructionsAndSystemPromptAreInjectedIntoChatPrompt(t *testing.T) {
+	capturedRequests := make([]openrouter.StreamRequest, 0, 2)
+	streamer := stubStreamer{
+		tokens: []string{"Ack"},
+		onRequest: func(req openrouter.StreamRequest) {
+			capturedRequests = append(capturedRequests, req)
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	conversation, err := handler.insertConversation(context.Background(), user.ID, "Instructions")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+
+	updateInstructionsReq := httptest.NewRequest(http.MethodPut, "/v1/auth/me/instructions", strings.NewReader(`{"customInstructions":"  Answer in British English.  "}`))
+	updateInstructionsReq = requestWithSessionUser(updateInstructionsReq, user)
+	updateInstructionsResp := httptest.NewRecorder()
+	handler.UpdateCustomInstructions(updateInstructionsResp, updateInstructionsReq)
+	if updateInstructionsResp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", updateInstructionsResp.Code, updateInstructionsResp.Body.String())
+	}
+	var userBody struct {
+		User session.User `json:"user"`
+	}
+	decodeJSONBody(t, updateInstructionsResp, &userBody)
+	if userBody.User.CustomInstructions != "Answer in British English." {
+		t.Fatalf("expected trimmed custom instructions, got %q", userBody.User.CustomInstructions)
+	}
+
+	updatePromptReq := httptest.NewRequest(http.MethodPut, "/v1/conversations/"+conversation.ID+"/system-prompt", strings.NewReader(`{"systemPrompt":"You are a terse code reviewer."}`))
+	updatePromptReq = requestWithConversationID(requestWithSessionUser(updatePromptReq, user), conversation.ID)
+	updatePromptResp := httptest.NewRecorder()
+	handler.UpdateConversationSystemPrompt(updatePromptResp, updatePromptReq)
+	if updatePromptResp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", updatePromptResp.Code, updatePromptResp.Body.String())
+	}
+	var conversationBody struct {
+		Conversation conversationResponse `json:"conversation"`
+	}
+	decodeJSONBody(t, updatePromptResp, &conversationBody)
+	if conversationBody.Conversation.SystemPrompt != "You are a terse code reviewer." {
+		t.Fatalf("expected system prompt in response, got %+v", conversationBody.Conversation)
+	}
+
+	postChatMessage(t, handler, user, `{"conversationId":"`+conversation.ID+`","message":"Review this","modelId":"openrouter/free","grounding":false}`)
+
+	generationRequests := filterGenerationRequests(capturedRequests)
+	if len(generationRequests) != 1 {
+		t.Fatalf("expected one generation request, got %d", len(generationRequests))
+	}
+	messages := generationRequests[0].Messages
+	if len(messages) < 3 || messages[1].Role != "system" {
+		t.Fatalf("expected instructions right after the base system prompt, got %+v", messages)
+	}
+	instructions := messages[1].Content
+	customIndex := strings.Index(instructions, "Answer in British English.")
+	promptIndex := strings.Index(instructions, "You are a terse code reviewer.")
+	if customIndex == -1 || promptIndex == -1 || customIndex > promptIndex {
+		t.Fatalf("expected custom instructions followed by the conversation prompt, got %q", instructions)
+	}
+
+	listReq := httptest.NewRequest(http.MethodGet, "/v1/conversations", nil)
+	listReq = requestWithSessionUser(listReq, user)
+	listResp := httptest.NewRecorder()
+	handler.ListConversations(listResp, listReq)
+	if listResp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", listResp.Code, listResp.Body.String())
+	}
+	var listBody struct {
+		Conversations []conversationResponse `json:"conversations"`
+	}
+	decodeJSONBody(t, listResp, &listBody)
+	if len(listBody.Conversations) != 1 || listBody.Conversations[0].SystemPrompt != "You are a terse code reviewer." {
+		t.Fatalf("expected system prompt in conversation list, got %+v", listBody.Conversations)
+	}
+}
+
+func TestInstructionsEndpointsValidateInput(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	tooLong := strings.Repeat("é", maxCustomInstructionsRunes+1)
+	instructionsReq := httptest.NewRequest(http.MethodPut, "/v1/auth/me/instructions", strings.NewReader(`{"customInstructions":"`+tooLong+`"}`))
+	instructionsReq = requestWithSessionUser(instructionsReq, user)
+	instructionsResp := httptest.NewRecorder()
+	handler.UpdateCustomInstructions(instructionsResp, instructionsReq)
+	if instructionsResp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for oversized instructions, got %d body=%s", instructionsResp.Code, instructionsResp.Body.String())
+	}
+
+	promptReq := httptest.NewRequest(http.MethodPut, "/v1/conversations/missing/system-prompt", strings.NewReader(`{"systemPrompt":"Be brief."}`))
+	promptReq = requestWithConversationID(requestWithSessionUser(promptReq, user), "missing")
+	promptResp := httptest.NewRecorder()
+	handler.UpdateConversationSystemPrompt(promptResp, promptReq)
+	if promptResp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown conversation, got %d body=%s", promptResp.Code, promptResp.Body.String())
+	}
+}
@@ -0,0 +1,190 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"chat/backend/internal/openrouter"
+)
+
+// modelFallbackChain is modelID followed by OPENROUTER_FALLBACK_MODELS, in
+// order and without repeats.
+func (h Handler) modelFallbackChain(modelID string) []string {
+	chain := []string{modelID}
+	for _, candidate := range h.cfg.OpenRouterFallbackModels {
+		candidate = strings.TrimSpace(candidate)
+		if candidate != "" && !slices.Contains(chain, candidate) {
+			chain = append(chain, candidate)
+		}
+	}
+	return chain
+}
+
+// streamWithModelFallback calls send with req and, while an attempt fails
+// before any token or reasoning arrived, again with the next model in the
+// chain. req is built for the first model; every later one gets it adapted by
+// fallbackRequest and is skipped when it cannot take it at all. Failures after
+// output started are returned as they are so a reply is never stitched
+// together from two models. It returns the model that answered, or the last
+// one tried.
+func (h Handler) streamWithModelFallback(
+	ctx context.Context,
+	req openrouter.StreamRequest,
+	onDelta func(string) error,
+	onReasoning func(string) error,
+	onFallback func(failedModelID, nextModelID string),
+	send func(req openrouter.StreamRequest, onDelta, onReasoning func(string) error) error,
+) (string, error) {
+	chain := h.modelFallbackChain(req.Model)
+	failedModelID := req.Model
+	var failErr error
+	for i, modelID := range chain {
+		attempt := req
+		if i > 0 {
+			var ok bool
+			attempt, ok = h.fallbackRequest(ctx, req, modelID)
+			if !ok {
+				continue
+			}
+			log.Printf("model failed before first token, falling back: model_id=%s next_model_id=%s err=%v", failedModelID, modelID, failErr)
+			if onFallback != nil {
+				onFallback(failedModelID, modelID)
+			}
+		}
+
+		produced := false
+		attemptDelta := func(delta string) error {
+			produced = true
+			return onDelta(delta)
+		}
+		attemptReasoning := onReasoning
+		if onReasoning != nil {
+			attemptReasoning = func(reasoning string) error {
+				produced = true
+				return onReasoning(reasoning)
+			}
+		}
+
+		err := send(attempt, attemptDelta, attemptReasoning)
+		if err == nil || produced || ctx.Err() != nil {
+			return modelID, err
+		}
+		failedModelID, failErr = modelID, err
+	}
+	return failedModelID, failErr
+}
+
+// fallbackRequest adapts req, built for another model, to what modelID
+// accepts: tools, reasoning, a native response format and sampling keys it
+// does not list are dropped, the format falling back to its prompt. It
+// reports false when the model cannot take the request at all, because the
+// request carries images it cannot read or tool results it cannot follow.
+func (h Handler) fallbackRequest(ctx context.Context, req openrouter.StreamRequest, modelID string) (openrouter.StreamRequest, bool) {
+	req.Model = modelID
+	supported, err := h.modelSupportedParameters(ctx, modelID)
+	if err != nil {
+		log.Printf("fallback model lookup failed, skipping: model_id=%s err=%v", modelID, err)
+		return req, false
+	}
+
+	if requestHasImages(req.Messages) {
+		acceptsImages, err := h.modelAcceptsImages(ctx, modelID)
+		if err != nil {
+			log.Printf("fallback model lookup failed, skipping: model_id=%s err=%v", modelID, err)
+			return req, false
+		}
+		if !acceptsImages {
+			log.Printf("fallback model cannot read images, skipping: model_id=%s", modelID)
+			return req, false
+		}
+	}
+	if len(req.Tools) > 0 && !slices.Contains(supported, "tools") {
+		if requestHasToolTurns(req.Messages) {
+			log.Printf("fallback model cannot use tools, skipping: model_id=%s", modelID)
+			return req, false
+		}
+		req.Tools = nil
+		req.ToolChoice = ""
+	}
+	if req.Reasoning != nil {
+		supportsReasoning, err := modelSupportsReasoning(ctx, h.db, modelID)
+		if err != nil {
+			log.Printf("fallback model lookup failed, skipping: model_id=%s err=%v", modelID, err)
+			return req, false
+		}
+		if !supportsReasoning {
+			req.Reasoning = nil
+		}
+	}
+	if format := req.ResponseFormat; format != nil {
+		if !slices.Contains(supported, responseFormatParameter(format)) {
+			spec := &structuredOutputSpec{}
+			if format.JSONSchema != nil {
+				spec.rawSchema = format.JSONSchema.Schema
+			}
+			req.ResponseFormat = nil
+			req.Messages = withSystemMessage(req.Messages, spec.prompt())
+		}
+	}
+	req.SamplingParams = samplingParams(req.SamplingParams).withoutUnsupported(supported).openRouter()
+	return req, true
+}
+
+func requestHasImages(messages []openrouter.Message) bool {
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if part.ImageURL != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func requestHasToolTurns(messages []openrouter.Message) bool {
+	for _, message := range messages {
+		if message.Role == "tool" || len(message.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// withSystemMessage returns a copy of messages with content added after the
+// leading system messages.
+func withSystemMessage(messages []openrouter.Message, content string) []openrouter.Message {
+	index := 0
+	for index < len(messages) && messages[index].Role == "system" {
+		index++
+	}
+	return slices.Insert(slices.Clone(messages), index, openrouter.Message{Role: "system", Content: content})
+}
+
+// modelFallbackWarning returns an onFallback callback that tells the client
+// about the switch and keeps answeredModelID on the model now answering.
+func modelFallbackWarning(stream *generationStream, answeredModelID *string) func(failedModelID, nextModelID string) {
+	return func(failedModelID, nextModelID string) {
+		*answeredModelID = nextModelID
+		_ = stream.send(map[string]any{
+			"type":          "warning",
+			"scope":         "model_fallback",
+			"message":       failedModelID + " is unavailable right now; answering with " + nextModelID + " instead.",
+			"failedModelId": failedModelID,
+			"modelId":       nextModelID,
+		})
+	}
+}
+
+// recordAnsweringModel stores the fallback model on a reply that arrived
+// without a usage payload, so usage_model_id still names who answered.
+func (h Handler) recordAnsweringModel(ctx context.Context, messageID, modelID string) {
+	if _, err := h.db.ExecContext(ctx, `
+UPDATE messages
+SET usage_model_id = ?, usage_provider_name = ?
+WHERE id = ? AND usage_model_id IS NULL;
+`, modelID, nullableString(providerNameFromModelID(modelID)), messageID); err != nil {
+		log.Printf("record answering model failed: message_id=%s model_id=%s err=%v", messageID, modelID, err)
+	}
+}
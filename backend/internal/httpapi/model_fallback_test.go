@@ -0,0 +1,233 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+// failingModelStreamer fails requests for the models in errs, after sending
+// partialTokens, and streams the embedded stub's reply for every other model.
+type failingModelStreamer struct {
+	stubStreamer
+	errs          map[string]error
+	partialTokens []string
+	models        *[]string
+}
+
+func (s failingModelStreamer) StreamChatCompletion(ctx context.Context, req openrouter.StreamRequest, onStart func() error, onDelta func(string) error, onReasoning func(string) error, onUsage func(openrouter.Usage) error) error {
+	if !isTitleRequest(req) {
+		*s.models = append(*s.models, req.Model)
+	}
+	if err, ok := s.errs[req.Model]; ok {
+		for _, token := range s.partialTokens {
+			if err := onDelta(token); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+	return s.stubStreamer.StreamChatCompletion(ctx, req, onStart, onDelta, onReasoning, onUsage)
+}
+
+// failingToolModelStreamer is failingModelStreamer for tool-enabled requests,
+// recording each one it receives.
+type failingToolModelStreamer struct {
+	failingModelStreamer
+	requests *[]openrouter.StreamRequest
+}
+
+func (s failingToolModelStreamer) StreamChatCompletionWithTools(ctx context.Context, req openrouter.StreamRequest, onStart func() error, onDelta func(string) error, onReasoning func(string) error, onUsage func(openrouter.Usage) error, onToolCalls func([]openrouter.ToolCall) error) error {
+	*s.requests = append(*s.requests, req)
+	return s.StreamChatCompletion(ctx, req, onStart, onDelta, onReasoning, onUsage)
+}
+
+func TestChatMessagesFallsBackBeforeFirstToken(t *testing.T) {
+	var models []string
+	streamer := failingModelStreamer{
+		stubStreamer: stubStreamer{tokens: []string{"Answer from the backup."}},
+		errs: map[string]error{
+			"openrouter/free":   errors.New("openrouter returned 429: rate limited"),
+			"backup/overloaded": errors.New("provider returned error"),
+		},
+		models: &models,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+	handler.cfg.OpenRouterFallbackModels = []string{"backup/overloaded", "openrouter/free", "backup/healthy"}
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Hi","modelId":"openrouter/free","grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	if strings.Join(models, ",") != "openrouter/free,backup/overloaded,backup/healthy" {
+		t.Fatalf("expected each model in the chain to be tried once, got %v", models)
+	}
+	var warnings []sseEvent
+	for _, event := range decodeSSEEvents(t, resp.Body.String()) {
+		if event.Type == "error" {
+			t.Fatalf("expected no error event, got %+v", event)
+		}
+		if event.Type == "warning" && event.Data["scope"] == "model_fallback" {
+			warnings = append(warnings, event)
+		}
+	}
+	if len(warnings) != 2 || warnings[1].Data["failedModelId"] != "backup/overloaded" || warnings[1].Data["modelId"] != "backup/healthy" {
+		t.Fatalf("expected a warning per fallback, got %+v", warnings)
+	}
+
+	var content, modelID, usageModelID string
+	if err := db.QueryRow(`SELECT content, model_id, usage_model_id FROM messages WHERE role = 'assistant';`).Scan(&content, &modelID, &usageModelID); err != nil {
+		t.Fatalf("query assistant message: %v", err)
+	}
+	if content != "Answer from the backup." || modelID != "openrouter/free" || usageModelID != "backup/healthy" {
+		t.Fatalf("expected the selected model and the answering model to be recorded, got content=%q model_id=%q usage_model_id=%q", content, modelID, usageModelID)
+	}
+}
+
+func TestChatMessagesDoesNotFallBackAfterOutputStarted(t *testing.T) {
+	var models []string
+	streamer := failingModelStreamer{
+		stubStreamer:  stubStreamer{tokens: []string{"unused"}},
+		errs:          map[string]error{"openrouter/free": errors.New("connection reset")},
+		partialTokens: []string{"Half an ans"},
+		models:        &models,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+	handler.cfg.OpenRouterFallbackModels = []string{"backup/healthy"}
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Hi","modelId":"openrouter/free","grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+
+	if len(models) != 1 {
+		t.Fatalf("expected no fallback once tokens were streamed, got %v", models)
+	}
+	event := findSSEEvent(decodeSSEEvents(t, resp.Body.String()), "error")
+	if event == nil || event.Data["message"] != "stream interrupted" {
+		t.Fatalf("expected stream interrupted error, got %+v", event)
+	}
+}
+
+func TestChatMessagesAdaptsRequestToFallbackModel(t *testing.T) {
+	var models []string
+	var requests []openrouter.StreamRequest
+	streamer := failingToolModelStreamer{
+		failingModelStreamer: failingModelStreamer{
+			stubStreamer: stubStreamer{tokens: []string{"Answer without tools."}},
+			errs:         map[string]error{"openrouter/free": errors.New("openrouter returned 429: rate limited")},
+			models:       &models,
+		},
+		requests: &requests,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+	handler.cfg.OpenRouterFallbackModels = []string{"backup/plain"}
+	handler.tools = newChatToolRegistry(chatTool{
+		Name:       "lookup_order",
+		Parameters: json.RawMessage(`{"type":"object"}`),
+		Run: func(context.Context, json.RawMessage) (chatToolResult, error) {
+			return chatToolResult{Content: "unused"}, nil
+		},
+	})
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	seedModel(t, db, "backup/plain")
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["reasoning","tools","temperature","seed"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("enable tools: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["temperature"]', supports_reasoning = 0 WHERE id = 'backup/plain';`); err != nil {
+		t.Fatalf("limit fallback model: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Hi","modelId":"openrouter/free","grounding":false,"reasoningEffort":"high","sampling":{"temperature":0.2,"seed":7}}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	if len(requests) != 2 || requests[0].Model != "openrouter/free" || requests[1].Model != "backup/plain" {
+		t.Fatalf("expected the primary and then the fallback, got %+v", requests)
+	}
+	primary, fallback := requests[0], requests[1]
+	if len(primary.Tools) != 1 || primary.Reasoning == nil || primary.Seed == nil {
+		t.Fatalf("expected the primary request to keep tools, reasoning and seed, got %+v", primary)
+	}
+	if len(fallback.Tools) != 0 || fallback.ToolChoice != "" || fallback.Reasoning != nil {
+		t.Fatalf("expected tools and reasoning to be dropped for the fallback, got %+v", fallback)
+	}
+	if fallback.Seed != nil || fallback.Temperature == nil || *fallback.Temperature != 0.2 {
+		t.Fatalf("expected only supported sampling keys for the fallback, got %+v", fallback.SamplingParams)
+	}
+	if event := findSSEEvent(decodeSSEEvents(t, resp.Body.String()), "error"); event != nil {
+		t.Fatalf("expected no error event, got %+v", event)
+	}
+}
+
+func TestChatMessagesSkipsFallbackModelsWithoutImageInput(t *testing.T) {
+	var models []string
+	streamer := failingModelStreamer{
+		stubStreamer: stubStreamer{tokens: []string{"It is a cat."}},
+		errs:         map[string]error{"openrouter/free": errors.New("openrouter returned 429: rate limited")},
+		models:       &models,
+	}
+	store := &stubFileStore{objects: make(map[string][]byte)}
+	handler, db := newTestHandlerWithFileStore(t, streamer, store)
+	t.Cleanup(func() { _ = db.Close() })
+	handler.cfg.OpenRouterFallbackModels = []string{"backup/text", "backup/vision"}
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	for _, id := range []string{"openrouter/free", "backup/text", "backup/vision"} {
+		seedModel(t, db, id)
+	}
+	if _, err := db.Exec(`UPDATE models SET input_modalities_json = '["text","image"]' WHERE id IN ('openrouter/free', 'backup/vision');`); err != nil {
+		t.Fatalf("enable image input: %v", err)
+	}
+
+	var uploaded struct {
+		File fileResponse `json:"file"`
+	}
+	decodeJSONBody(t, uploadTestFile(t, handler, user, "square.png", testPNG(t)), &uploaded)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"What is this?","modelId":"openrouter/free","grounding":false,"fileIds":["`+uploaded.File.ID+`"]}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	if strings.Join(models, ",") != "openrouter/free,backup/vision" {
+		t.Fatalf("expected the text-only fallback to be skipped, got %v", models)
+	}
+	warning := findSSEEvent(decodeSSEEvents(t, resp.Body.String()), "warning")
+	if warning == nil || warning.Data["failedModelId"] != "openrouter/free" || warning.Data["modelId"] != "backup/vision" {
+		t.Fatalf("expected a warning naming the model that answered, got %+v", warning)
+	}
+}
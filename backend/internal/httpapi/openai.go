@@ -0,0 +1,577 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat/backend/internal/openrouter"
+
+	"github.com/google/uuid"
+)
+
+var errInvalidOpenAIRequest = errors.New("invalid chat completion request")
+
+type openAIChatCompletionRequest struct {
+	Model               string              `json:"model"`
+	Messages            []openAIChatMessage `json:"messages"`
+	Stream              bool                `json:"stream"`
+	StreamOptions       *openAIStreamOpts   `json:"stream_options"`
+	N                   *int                `json:"n"`
+	Temperature         *float64            `json:"temperature"`
+	TopP                *float64            `json:"top_p"`
+	MaxTokens           *int                `json:"max_tokens"`
+	MaxCompletionTokens *int                `json:"max_completion_tokens"`
+	Stop                json.RawMessage     `json:"stop"`
+	Seed                *int                `json:"seed"`
+	PresencePenalty     *float64            `json:"presence_penalty"`
+	FrequencyPenalty    *float64            `json:"frequency_penalty"`
+	ReasoningEffort     string              `json:"reasoning_effort"`
+	// Grounding is an extension: when true the last user message is researched
+	// like a grounded chat turn and the sources are returned as citations.
+	Grounding bool `json:"grounding"`
+}
+
+type openAIStreamOpts struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type openAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type openAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// OpenAIModels lists the active models in the shape of OpenAI's GET
+// /v1/models.
+func (h Handler) OpenAIModels(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUserFromContext(r.Context()); !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid api token")
+		return
+	}
+
+	models, err := h.listActiveModels(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to read models")
+		return
+	}
+	if len(models) == 0 {
+		models = append(models, modelResponse{ID: h.cfg.OpenRouterDefaultModel, Provider: "openrouter"})
+	}
+
+	data := make([]openAIModel, 0, len(models))
+	for _, model := range models {
+		data = append(data, openAIModel{ID: model.ID, Object: "model", OwnedBy: model.Provider})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": data})
+}
+
+// OpenAIChatCompletions serves OpenAI's POST /v1/chat/completions, streaming
+// or not, on top of the OpenRouter client. The user's reasoning and sampling
+// presets apply, and the last user message and the reply are recorded, with
+// usage, in the token's synthetic conversation.
+func (h Handler) OpenAIChatCompletions(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid api token")
+		return
+	}
+	tokenID, ok := apiTokenIDFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid api token")
+		return
+	}
+
+	// OpenAI SDKs send many optional fields this endpoint does not use, so
+	// unknown fields are ignored rather than rejected.
+	var req openAIChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if req.N != nil && *req.N != 1 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "n must be 1")
+		return
+	}
+	messages, lastUserMessage, err := openAIMessagesToOpenRouter(req.Messages)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	stop, err := openAIStopSequences(req.Stop)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	var flusher http.Flusher
+	if req.Stream {
+		flusher, ok = w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "streaming_unsupported", "server does not support streaming")
+			return
+		}
+	}
+
+	modelID := strings.TrimSpace(req.Model)
+	if modelID == "" || modelID == "default" {
+		preferences, err := h.readUserModelPreferences(r.Context(), user.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to read preferences")
+			return
+		}
+		modelID = fallback(preferences.LastUsedModelID, h.cfg.OpenRouterDefaultModel)
+	}
+	if requestHasImages(messages) {
+		acceptsImages, err := h.modelAcceptsImages(r.Context(), modelID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve model capabilities")
+			return
+		}
+		if !acceptsImages {
+			writeError(w, http.StatusBadRequest, "unsupported_attachment", errImageInputUnsupported.Error())
+			return
+		}
+	}
+
+	reasoningEffort, err := h.resolveReasoningEffort(r.Context(), user.ID, modelID, "chat", req.ReasoningEffort)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidReasoningEffort):
+			writeError(w, http.StatusBadRequest, "invalid_request", "reasoning_effort must be one of: low, medium, high")
+		case errors.Is(err, errReasoningUnsupportedModel):
+			writeError(w, http.StatusBadRequest, "invalid_request", "selected model does not support reasoning controls")
+		default:
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve reasoning effort")
+		}
+		return
+	}
+
+	maxTokens := req.MaxTokens
+	if req.MaxCompletionTokens != nil {
+		maxTokens = req.MaxCompletionTokens
+	}
+	sampling, err := h.resolveSamplingParams(r.Context(), user.ID, modelID, "chat", samplingParams{
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		MaxTokens:        maxTokens,
+		Stop:             stop,
+		Seed:             req.Seed,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidSamplingParams) || errors.Is(err, errSamplingUnsupportedModel) {
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve sampling parameters")
+		return
+	}
+
+	var citations []citationResponse
+	if req.Grounding {
+		timeSensitive := isTimeSensitivePrompt(lastUserMessage)
+		var warning string
+		citations, warning = h.resolveGroundingContext(r.Context(), lastUserMessage, true, timeSensitive, modelID, plannerReasoningEffort(reasoningEffort), nil)
+		if warning != "" {
+			log.Printf("openai grounding warning: user_id=%s warning=%s", user.ID, warning)
+		}
+		if len(citations) > 0 {
+			messages = append([]openrouter.Message{{Role: "system", Content: buildGroundingPrompt(citations, timeSensitive)}}, messages...)
+		}
+	}
+
+	completionID := "chatcmpl-" + uuid.NewString()
+	created := time.Now().Unix()
+	answeredModelID := modelID
+	chunk := func(delta map[string]any, finishReason any) map[string]any {
+		return map[string]any{
+			"id":      completionID,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   answeredModelID,
+			"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+		}
+	}
+	if req.Stream {
+		setSSEHeaders(w)
+		w.WriteHeader(http.StatusOK)
+	}
+	sendChunk := func(payload any) error {
+		if err := writeOpenAISSEData(w, payload); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	var content strings.Builder
+	var reasoning strings.Builder
+	var usage *openrouter.Usage
+	var streamStartedAt time.Time
+	var firstTokenAt time.Time
+	roleSent := false
+	onDelta := func(delta string) error {
+		content.WriteString(delta)
+		if firstTokenAt.IsZero() {
+			firstTokenAt = time.Now()
+		}
+		if !req.Stream {
+			return nil
+		}
+		payload := map[string]any{"content": delta}
+		if !roleSent {
+			payload["role"] = "assistant"
+			roleSent = true
+		}
+		return sendChunk(chunk(payload, nil))
+	}
+	onReasoning := func(delta string) error {
+		reasoning.WriteString(delta)
+		if firstTokenAt.IsZero() {
+			firstTokenAt = time.Now()
+		}
+		if !req.Stream {
+			return nil
+		}
+		return sendChunk(chunk(map[string]any{"reasoning": delta}, nil))
+	}
+
+	_, streamErr := h.streamWithModelFallback(
+		r.Context(),
+		openrouter.StreamRequest{
+			Model:          modelID,
+			Messages:       messages,
+			Reasoning:      openRouterReasoningConfig(reasoningEffort),
+			SamplingParams: sampling,
+		},
+		onDelta,
+		onReasoning,
+		func(failedModelID, nextModelID string) {
+			answeredModelID = nextModelID
+		},
+		func(req openrouter.StreamRequest, onDelta, onReasoning func(string) error) error {
+			return h.openrouter.StreamChatCompletion(
+				r.Context(),
+				req,
+				func() error {
+					if streamStartedAt.IsZero() {
+						streamStartedAt = time.Now()
+					}
+					return nil
+				},
+				onDelta,
+				onReasoning,
+				func(reported openrouter.Usage) error {
+					copied := usageWithLocalUsageFallbacks(reported, answeredModelID, streamStartedAt, firstTokenAt)
+					usage = &copied
+					return nil
+				},
+			)
+		},
+	)
+	if streamErr != nil {
+		log.Printf("openai chat completion failed: user_id=%s model_id=%s err=%v", user.ID, answeredModelID, streamErr)
+	}
+
+	if content.Len() > 0 {
+		h.recordOpenAICompletion(context.WithoutCancel(r.Context()), user.ID, tokenID, lastUserMessage, modelID, answeredModelID, req.Grounding, content.String(), reasoning.String(), citations, usage, streamStartedAt, firstTokenAt)
+	}
+
+	if req.Stream {
+		if streamErr != nil {
+			if r.Context().Err() == nil {
+				_ = sendChunk(errorResponse{Error: errorBody{Code: "upstream_error", Message: "stream interrupted"}})
+			}
+			return
+		}
+		final := chunk(map[string]any{}, "stop")
+		if len(citations) > 0 {
+			final["citations"] = citations
+		}
+		_ = sendChunk(final)
+		if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+			usageChunk := chunk(nil, nil)
+			usageChunk["choices"] = []map[string]any{}
+			usageChunk["usage"] = openAIUsageFromOpenRouter(usage)
+			_ = sendChunk(usageChunk)
+		}
+		_ = writeOpenAISSEData(w, "[DONE]")
+		flusher.Flush()
+		return
+	}
+
+	if streamErr != nil {
+		writeError(w, http.StatusBadGateway, "upstream_error", "model request failed")
+		return
+	}
+	message := map[string]any{"role": "assistant", "content": content.String()}
+	if reasoning.Len() > 0 {
+		message["reasoning"] = reasoning.String()
+	}
+	response := map[string]any{
+		"id":      completionID,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   answeredModelID,
+		"choices": []map[string]any{{"index": 0, "message": message, "finish_reason": "stop"}},
+		"usage":   openAIUsageFromOpenRouter(usage),
+	}
+	if len(citations) > 0 {
+		response["citations"] = citations
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// openAIMessagesToOpenRouter converts OpenAI chat messages, whose content is
+// a string or a list of text and image_url parts, and returns the text of the
+// last user message.
+func openAIMessagesToOpenRouter(in []openAIChatMessage) ([]openrouter.Message, string, error) {
+	if len(in) == 0 {
+		return nil, "", fmt.Errorf("%w: messages is required", errInvalidOpenAIRequest)
+	}
+
+	out := make([]openrouter.Message, 0, len(in))
+	lastUserMessage := ""
+	for i, message := range in {
+		role := strings.TrimSpace(message.Role)
+		switch role {
+		case "developer":
+			role = "system"
+		case "system", "user", "assistant":
+		default:
+			return nil, "", fmt.Errorf("%w: messages[%d].role must be one of: system, developer, user, assistant", errInvalidOpenAIRequest, i)
+		}
+
+		converted := openrouter.Message{Role: role}
+		var text string
+		if err := json.Unmarshal(message.Content, &text); err == nil {
+			converted.Content = text
+		} else {
+			var parts []openAIContentPart
+			if err := json.Unmarshal(message.Content, &parts); err != nil {
+				return nil, "", fmt.Errorf("%w: messages[%d].content must be a string or a list of parts", errInvalidOpenAIRequest, i)
+			}
+			texts := make([]string, 0, len(parts))
+			hasImage := false
+			for _, part := range parts {
+				switch {
+				case part.Type == "text":
+					texts = append(texts, part.Text)
+					converted.Parts = append(converted.Parts, openrouter.TextPart(part.Text))
+				case part.Type == "image_url" && part.ImageURL != nil && role == "user":
+					hasImage = true
+					converted.Parts = append(converted.Parts, openrouter.ImagePart(part.ImageURL.URL))
+				default:
+					return nil, "", fmt.Errorf("%w: messages[%d] has an unsupported content part", errInvalidOpenAIRequest, i)
+				}
+			}
+			converted.Content = strings.Join(texts, "\n")
+			if !hasImage {
+				converted.Parts = nil
+			}
+		}
+
+		if role == "user" {
+			lastUserMessage = converted.Content
+		}
+		out = append(out, converted)
+	}
+	if strings.TrimSpace(lastUserMessage) == "" {
+		return nil, "", fmt.Errorf("%w: messages must include a user message with text", errInvalidOpenAIRequest)
+	}
+	return out, lastUserMessage, nil
+}
+
+// openAIStopSequences accepts stop as a string or a list of strings.
+func openAIStopSequences(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("%w: stop must be a string or a list of strings", errInvalidOpenAIRequest)
+	}
+	return list, nil
+}
+
+func openAIUsageFromOpenRouter(usage *openrouter.Usage) openAIUsage {
+	if usage == nil {
+		return openAIUsage{}
+	}
+	return openAIUsage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+}
+
+func writeOpenAISSEData(w http.ResponseWriter, payload any) error {
+	data, ok := payload.(string)
+	if !ok {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		data = string(encoded)
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return fmt.Errorf("write sse payload: %w", err)
+	}
+	return nil
+}
+
+// recordOpenAICompletion stores the prompt and reply under the token's
+// synthetic conversation so API usage is accounted like chat usage. Failures
+// are logged; the caller already has its reply.
+func (h Handler) recordOpenAICompletion(
+	ctx context.Context,
+	userID, tokenID, prompt, modelID, answeredModelID string,
+	grounding bool,
+	content, reasoning string,
+	citations []citationResponse,
+	usage *openrouter.Usage,
+	streamStartedAt, firstTokenAt time.Time,
+) {
+	conversationID, err := h.apiTokenConversationID(ctx, userID, tokenID)
+	if err != nil {
+		log.Printf("openai completion record failed: token_id=%s err=%v", tokenID, err)
+		return
+	}
+	messageID, err := h.insertOpenAIExchange(ctx, userID, conversationID, prompt, modelID, grounding, content, reasoning, citations, usage)
+	if err != nil {
+		log.Printf("openai completion record failed: conversation_id=%s err=%v", conversationID, err)
+		return
+	}
+	if usage != nil {
+		h.enrichAndPersistMessageUsageAsync(userID, messageID, answeredModelID, *usage, streamStartedAt, firstTokenAt)
+	} else if answeredModelID != modelID {
+		h.recordAnsweringModel(ctx, messageID, answeredModelID)
+	}
+}
+
+// insertOpenAIExchange appends the prompt and reply to the end of the
+// conversation in one transaction, so concurrent calls with the same token
+// each chain onto the reply before them. It returns the reply's id.
+func (h Handler) insertOpenAIExchange(
+	ctx context.Context,
+	userID, conversationID, prompt, modelID string,
+	grounding bool,
+	content, reasoning string,
+	citations []citationResponse,
+	usage *openrouter.Usage,
+) (string, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	parentMessageID, err := readActiveLeafMessageID(ctx, tx, userID, conversationID)
+	if err != nil {
+		return "", err
+	}
+	userMessageID, err := insertUserMessageWithFilesTx(ctx, tx, userID, conversationID, parentMessageID, prompt, modelID, grounding, false, nil)
+	if err != nil {
+		return "", err
+	}
+	messageID, err := insertMessageWithCitationsTx(ctx, tx, userID, conversationID, userMessageID, "assistant", content, reasoning, modelID, grounding, false, citations, nil, messageUsageFromOpenRouter(usage))
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
+
+// apiTokenConversationID returns the conversation calls with tokenID are
+// recorded under, creating it on first use or after it was deleted. When two
+// first calls race, the one that claims the token first wins and the other
+// drops its conversation and uses the winner's.
+func (h Handler) apiTokenConversationID(ctx context.Context, userID, tokenID string) (string, error) {
+	var name string
+	var conversationID sql.NullString
+	if err := h.db.QueryRowContext(ctx, `
+SELECT name, conversation_id
+FROM api_tokens
+WHERE id = ? AND user_id = ?
+LIMIT 1;
+`, tokenID, userID).Scan(&name, &conversationID); err != nil {
+		return "", err
+	}
+	if conversationID.Valid {
+		return conversationID.String, nil
+	}
+
+	id := uuid.NewString()
+	if _, err := h.db.ExecContext(ctx, `
+INSERT INTO conversations (id, user_id, title, title_locked)
+VALUES (?, ?, ?, 1);
+`, id, userID, normalizeConversationTitle("API: "+name)); err != nil {
+		return "", err
+	}
+	result, err := h.db.ExecContext(ctx, `
+UPDATE api_tokens
+SET conversation_id = ?
+WHERE id = ? AND conversation_id IS NULL;
+`, id, tokenID)
+	if err != nil {
+		return "", err
+	}
+	if claimed, err := result.RowsAffected(); err != nil {
+		return "", err
+	} else if claimed == 1 {
+		return id, nil
+	}
+
+	if _, err := h.db.ExecContext(context.WithoutCancel(ctx), `
+DELETE FROM conversations
+WHERE id = ? AND user_id = ?;
+`, id, userID); err != nil {
+		log.Printf("api token conversation cleanup failed: conversation_id=%s err=%v", id, err)
+	}
+	if err := h.db.QueryRowContext(ctx, `
+SELECT conversation_id
+FROM api_tokens
+WHERE id = ? AND user_id = ?
+LIMIT 1;
+`, tokenID, userID).Scan(&conversationID); err != nil {
+		return "", err
+	}
+	if !conversationID.Valid {
+		return "", errors.New("api token conversation was removed while being created")
+	}
+	return conversationID.String, nil
+}
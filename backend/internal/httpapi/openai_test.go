@@ -0,0 +1,336 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+func createTestAPIToken(t *testing.T, handler Handler, user session.User, name string) createAPITokenResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api-tokens", strings.NewReader(`{"name":"`+name+`"}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.CreateAPIToken(resp, req)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusCreated, resp.Code, resp.Body.String())
+	}
+	var created createAPITokenResponse
+	decodeJSONBody(t, resp, &created)
+	return created
+}
+
+func serveOpenAI(handler Handler, next http.HandlerFunc, method, path, secret, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	resp := httptest.NewRecorder()
+	handler.RequireAPIToken(next).ServeHTTP(resp, req)
+	return resp
+}
+
+func TestOpenAIChatCompletionsRecordsUsageUnderTokenConversation(t *testing.T) {
+	var generationRequests []openrouter.StreamRequest
+	streamer := stubStreamer{
+		tokens: []string{"Hello", " world"},
+		usage:  &openrouter.Usage{PromptTokens: 7, CompletionTokens: 2, TotalTokens: 9},
+		onRequest: func(req openrouter.StreamRequest) {
+			generationRequests = append(generationRequests, req)
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	created := createTestAPIToken(t, handler, user, "script")
+	if !strings.HasPrefix(created.Secret, "chat_") || created.Token.Name != "script" {
+		t.Fatalf("unexpected token: %+v", created)
+	}
+
+	body := `{"model":"openrouter/free","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":[{"type":"text","text":"Say hello"}]}],"logprobs":false}`
+	for i := 0; i < 2; i++ {
+		resp := serveOpenAI(handler, handler.OpenAIChatCompletions, http.MethodPost, "/openai/v1/chat/completions", created.Secret, body)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+		}
+		var completion struct {
+			Object  string `json:"object"`
+			Model   string `json:"model"`
+			Choices []struct {
+				Message struct {
+					Role    string `json:"role"`
+					Content string `json:"content"`
+				} `json:"message"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage openAIUsage `json:"usage"`
+		}
+		decodeJSONBody(t, resp, &completion)
+		if completion.Object != "chat.completion" || completion.Model != "openrouter/free" || len(completion.Choices) != 1 ||
+			completion.Choices[0].Message.Content != "Hello world" || completion.Choices[0].FinishReason != "stop" || completion.Usage.TotalTokens != 9 {
+			t.Fatalf("unexpected completion: %+v", completion)
+		}
+	}
+
+	if len(generationRequests) != 2 || generationRequests[0].Messages[0].Role != "system" || generationRequests[0].Messages[1].Content != "Say hello" {
+		t.Fatalf("expected the OpenAI messages to be forwarded, got %+v", generationRequests)
+	}
+
+	var conversationID, title string
+	if err := db.QueryRow(`SELECT c.id, c.title FROM api_tokens t JOIN conversations c ON c.id = t.conversation_id WHERE t.id = ?;`, created.Token.ID).Scan(&conversationID, &title); err != nil {
+		t.Fatalf("query token conversation: %v", err)
+	}
+	if title != "API: script" {
+		t.Fatalf("expected a synthetic conversation named after the token, got %q", title)
+	}
+	messages := listMessagesAs(t, handler, user, conversationID, "").Messages
+	if len(messages) != 4 || messages[0].Content != "Say hello" || messages[3].Usage == nil || messages[3].Usage.TotalTokens != 9 {
+		t.Fatalf("expected both calls to be recorded with usage in one conversation, got %+v", messages)
+	}
+}
+
+func TestAPITokenConversationIDKeepsTheConversationThatClaimedTheToken(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	created := createTestAPIToken(t, handler, user, "script")
+
+	// A concurrent first call claims the token right after this one inserts
+	// its conversation.
+	if _, err := db.Exec(`INSERT INTO conversations (id, user_id, title, title_locked) VALUES ('winner', ?, 'API: script', 1);`, user.ID); err != nil {
+		t.Fatalf("seed winning conversation: %v", err)
+	}
+	if _, err := db.Exec(`
+CREATE TRIGGER claim_token_concurrently AFTER INSERT ON conversations
+WHEN NEW.id != 'winner'
+BEGIN
+  UPDATE api_tokens SET conversation_id = 'winner' WHERE id = '` + created.Token.ID + `';
+END;
+`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	conversationID, err := handler.apiTokenConversationID(context.Background(), user.ID, created.Token.ID)
+	if err != nil {
+		t.Fatalf("resolve token conversation: %v", err)
+	}
+	if conversationID != "winner" {
+		t.Fatalf("expected the conversation that claimed the token, got %q", conversationID)
+	}
+	var conversations int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM conversations WHERE user_id = ?;`, user.ID).Scan(&conversations); err != nil {
+		t.Fatalf("count conversations: %v", err)
+	}
+	if conversations != 1 {
+		t.Fatalf("expected the losing conversation to be deleted, got %d conversations", conversations)
+	}
+}
+
+func TestOpenAIChatCompletionsStreamsChunks(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{
+		tokens: []string{"Hi", "!"},
+		usage:  &openrouter.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5},
+	})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	created := createTestAPIToken(t, handler, user, "ide")
+
+	resp := serveOpenAI(handler, handler.OpenAIChatCompletions, http.MethodPost, "/openai/v1/chat/completions", created.Secret,
+		`{"messages":[{"role":"user","content":"Hello"}],"stream":true,"stream_options":{"include_usage":true}}`)
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q body=%s", resp.Code, resp.Header().Get("Content-Type"), resp.Body.String())
+	}
+
+	var frames []string
+	for _, line := range strings.Split(resp.Body.String(), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			frames = append(frames, data)
+		}
+	}
+	if len(frames) != 5 || frames[len(frames)-1] != "[DONE]" {
+		t.Fatalf("expected two deltas, a finish chunk, a usage chunk and [DONE], got %v", frames)
+	}
+
+	var content strings.Builder
+	for i, frame := range frames[:4] {
+		var chunk struct {
+			Object  string `json:"object"`
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta struct {
+					Role    string `json:"role"`
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *openAIUsage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(frame), &chunk); err != nil {
+			t.Fatalf("decode chunk %q: %v", frame, err)
+		}
+		if chunk.Object != "chat.completion.chunk" || chunk.Model != "openrouter/free" {
+			t.Fatalf("unexpected chunk: %s", frame)
+		}
+		switch i {
+		case 0:
+			if chunk.Choices[0].Delta.Role != "assistant" {
+				t.Fatalf("expected the first delta to carry the role, got %s", frame)
+			}
+		case 2:
+			if chunk.Choices[0].FinishReason == nil || *chunk.Choices[0].FinishReason != "stop" {
+				t.Fatalf("expected a stop chunk, got %s", frame)
+			}
+		case 3:
+			if len(chunk.Choices) != 0 || chunk.Usage == nil || chunk.Usage.TotalTokens != 5 {
+				t.Fatalf("expected a usage chunk, got %s", frame)
+			}
+		}
+		if len(chunk.Choices) > 0 {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if content.String() != "Hi!" {
+		t.Fatalf("expected streamed content, got %q", content.String())
+	}
+}
+
+func TestOpenAIEndpointsRequireValidAPIToken(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{tokens: []string{"unused"}})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	created := createTestAPIToken(t, handler, user, "script")
+
+	resp := serveOpenAI(handler, handler.OpenAIModels, http.MethodGet, "/openai/v1/models", created.Secret, "")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"id":"openrouter/free"`) || !strings.Contains(resp.Body.String(), `"object":"list"`) {
+		t.Fatalf("expected the model list, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	for _, secret := range []string{"", "chat_wrong"} {
+		resp := serveOpenAI(handler, handler.OpenAIModels, http.MethodGet, "/openai/v1/models", secret, "")
+		if resp.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for token %q, got %d", secret, resp.Code)
+		}
+	}
+
+	deleteReq := httptest.NewRequest(http.MethodDelete, "/v1/api-tokens/"+created.Token.ID, nil)
+	deleteReq = requestWithConversationID(requestWithSessionUser(deleteReq, user), created.Token.ID)
+	deleteResp := httptest.NewRecorder()
+	handler.DeleteAPIToken(deleteResp, deleteReq)
+	if deleteResp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", deleteResp.Code, deleteResp.Body.String())
+	}
+	resp = serveOpenAI(handler, handler.OpenAIModels, http.MethodGet, "/openai/v1/models", created.Secret, "")
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a deleted token to be rejected, got %d", resp.Code)
+	}
+}
+
+func TestCreateAPITokenEnforcesPerUserLimit(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	for i := 0; i < maxAPITokensPerUser; i++ {
+		createTestAPIToken(t, handler, user, "script")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api-tokens", strings.NewReader(`{"name":"one too many"}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.CreateAPIToken(resp, req)
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "maximum of 20") {
+		t.Fatalf("expected the limit error, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE user_id = ?;`, user.ID).Scan(&count); err != nil {
+		t.Fatalf("count tokens: %v", err)
+	}
+	if count != maxAPITokensPerUser {
+		t.Fatalf("expected %d tokens, got %d", maxAPITokensPerUser, count)
+	}
+}
+
+func TestAPITokenLastUsedAtIsWrittenAtMostOncePerMinute(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	created := createTestAPIToken(t, handler, user, "script")
+
+	lastUsedAfterRequest := func(stored string) string {
+		t.Helper()
+		if _, err := db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?;`, stored, created.Token.ID); err != nil {
+			t.Fatalf("set last_used_at: %v", err)
+		}
+		if resp := serveOpenAI(handler, handler.OpenAIModels, http.MethodGet, "/openai/v1/models", created.Secret, ""); resp.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+		}
+		var lastUsedAt string
+		if err := db.QueryRow(`SELECT last_used_at FROM api_tokens WHERE id = ?;`, created.Token.ID).Scan(&lastUsedAt); err != nil {
+			t.Fatalf("query last_used_at: %v", err)
+		}
+		return lastUsedAt
+	}
+
+	var recent string
+	if err := db.QueryRow(`SELECT datetime('now', '-30 seconds');`).Scan(&recent); err != nil {
+		t.Fatalf("compute timestamp: %v", err)
+	}
+	if got := lastUsedAfterRequest(recent); got != recent {
+		t.Fatalf("expected a recent last_used_at to be left alone, got %q want %q", got, recent)
+	}
+	if got := lastUsedAfterRequest("2020-01-01 00:00:00"); got == "2020-01-01 00:00:00" {
+		t.Fatalf("expected a stale last_used_at to be refreshed")
+	}
+}
+
+func TestOpenAIChatCompletionsRejectsUnsupportedMessages(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{tokens: []string{"unused"}})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	created := createTestAPIToken(t, handler, user, "script")
+
+	tests := map[string]struct {
+		body string
+		want string
+	}{
+		"no messages":  {`{"messages":[]}`, "messages is required"},
+		"tool role":    {`{"messages":[{"role":"tool","content":"x"}]}`, "role must be one of"},
+		"no user text": {`{"messages":[{"role":"system","content":"x"}]}`, "must include a user message"},
+		"bad stop":     {`{"messages":[{"role":"user","content":"x"}],"stop":3}`, "stop must be a string"},
+		"n above one":  {`{"messages":[{"role":"user","content":"x"}],"n":2}`, "n must be 1"},
+		"image on a text model": {
+			`{"messages":[{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]}]}`,
+			"does not accept image input",
+		},
+	}
+	for name, tc := range tests {
+		resp := serveOpenAI(handler, handler.OpenAIChatCompletions, http.MethodPost, "/openai/v1/chat/completions", created.Secret, tc.body)
+		if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), tc.want) {
+			t.Fatalf("%s: expected 400 mentioning %q, got %d body=%s", name, tc.want, resp.Code, resp.Body.String())
+		}
+	}
+}
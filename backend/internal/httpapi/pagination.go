@@ -0,0 +1,150 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultConversationPageLimit = 200
+	maxConversationPageLimit     = 200
+	defaultMessagePageLimit      = 200
+	maxMessagePageLimit          = 500
+)
+
+// Cursor kinds keep a cursor from one list endpoint from being accepted by
+// another.
+const (
+	pageCursorConversations = "c"
+	pageCursorMessages      = "m"
+)
+
+var errInvalidPageRequest = errors.New("invalid page request")
+
+// pageCursor is the decoded form of the opaque cursors handed to clients.
+// Conversations page on (updated_at, id); messages page on path_position.
+type pageCursor struct {
+	Kind         string `json:"k"`
+	UpdatedAt    string `json:"u,omitempty"`
+	ID           string `json:"i,omitempty"`
+	PathPosition int64  `json:"p,omitempty"`
+}
+
+// pageRequest selects at most Limit items strictly older than Before or
+// strictly newer than After. With neither set, the newest items are returned.
+type pageRequest struct {
+	Limit  int
+	Before *pageCursor
+	After  *pageCursor
+}
+
+// pageInfo carries the cursors to pass back as `before` (older items) and
+// `after` (newer items). A cursor is omitted when that direction is exhausted.
+type pageInfo struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+func parsePageRequest(r *http.Request, kind string, defaultLimit, maxLimit int) (pageRequest, error) {
+	query := r.URL.Query()
+	page := pageRequest{Limit: defaultLimit}
+
+	if rawLimit := strings.TrimSpace(query.Get("limit")); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed <= 0 {
+			return pageRequest{}, errors.New("limit must be a positive integer")
+		}
+		page.Limit = min(parsed, maxLimit)
+	}
+
+	rawBefore := strings.TrimSpace(query.Get("before"))
+	rawAfter := strings.TrimSpace(query.Get("after"))
+	if rawBefore != "" && rawAfter != "" {
+		return pageRequest{}, errors.New("before and after cannot be combined")
+	}
+	if rawBefore != "" {
+		cursor, err := decodePageCursor(rawBefore, kind)
+		if err != nil {
+			return pageRequest{}, errors.New("before is not a valid cursor")
+		}
+		page.Before = &cursor
+	}
+	if rawAfter != "" {
+		cursor, err := decodePageCursor(rawAfter, kind)
+		if err != nil {
+			return pageRequest{}, errors.New("after is not a valid cursor")
+		}
+		page.After = &cursor
+	}
+	return page, nil
+}
+
+func (p pageRequest) limitOrDefault(defaultLimit int) int {
+	if p.Limit <= 0 {
+		return defaultLimit
+	}
+	return p.Limit
+}
+
+// buildPageInfo derives the cursors for a non-empty page. hasMore reports
+// whether the query found a row beyond the page in the direction it read.
+func buildPageInfo(page pageRequest, hasMore bool, oldest, newest pageCursor) pageInfo {
+	olderExist := hasMore
+	newerExist := page.Before != nil
+	if page.After != nil {
+		olderExist = true
+		newerExist = hasMore
+	}
+
+	var info pageInfo
+	if olderExist {
+		info.Before = encodePageCursor(oldest)
+	}
+	if newerExist {
+		info.After = encodePageCursor(newest)
+	}
+	return info
+}
+
+// trimPage drops the probe row fetched beyond limit and optionally reverses
+// the rows into the order the endpoint returns.
+func trimPage[T any](items []T, limit int, reverse bool) ([]T, bool) {
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	if reverse {
+		slices.Reverse(items)
+	}
+	return items, hasMore
+}
+
+func encodePageCursor(cursor pageCursor) string {
+	payload, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodePageCursor(raw, kind string) (pageCursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return pageCursor{}, errInvalidPageRequest
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(payload, &cursor); err != nil {
+		return pageCursor{}, errInvalidPageRequest
+	}
+	switch {
+	case cursor.Kind != kind:
+		return pageCursor{}, errInvalidPageRequest
+	case kind == pageCursorMessages && cursor.PathPosition <= 0:
+		return pageCursor{}, errInvalidPageRequest
+	case kind == pageCursorConversations && (cursor.UpdatedAt == "" || cursor.ID == ""):
+		return pageCursor{}, errInvalidPageRequest
+	}
+	return cursor, nil
+}
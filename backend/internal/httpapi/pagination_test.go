@@ -0,0 +1,255 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"chat/backend/internal/session"
+)
+
+type pagedConversations struct {
+	Conversations []conversationResponse `json:"conversations"`
+	Page          pageInfo               `json:"page"`
+}
+
+type pagedMessages struct {
+	Messages []messageResponse `json:"messages"`
+	Page     pageInfo          `json:"page"`
+}
+
+func TestListConversationsPagesByUpdatedAtAndID(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	// conv-2 and conv-3 share updated_at, so the id tie-break decides order.
+	for i, updatedAt := range []string{"2026-01-01 00:00:01", "2026-01-01 00:00:02", "2026-01-01 00:00:02", "2026-01-01 00:00:04", "2026-01-01 00:00:05"} {
+		if _, err := db.Exec(`
+INSERT INTO conversations (id, user_id, title, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?);
+`, fmt.Sprintf("conv-%d", i+1), user.ID, fmt.Sprintf("Chat %d", i+1), updatedAt, updatedAt); err != nil {
+			t.Fatalf("insert conversation: %v", err)
+		}
+	}
+
+	first := listConversationsAs(t, handler, user, "limit=2")
+	assertConversationIDs(t, first.Conversations, "conv-5", "conv-4")
+	if first.Page.Before == "" || first.Page.After != "" {
+		t.Fatalf("expected only an older cursor on the first page, got %+v", first.Page)
+	}
+
+	second := listConversationsAs(t, handler, user, "limit=2&before="+first.Page.Before)
+	assertConversationIDs(t, second.Conversations, "conv-3", "conv-2")
+	if second.Page.Before == "" || second.Page.After == "" {
+		t.Fatalf("expected both cursors on a middle page, got %+v", second.Page)
+	}
+
+	last := listConversationsAs(t, handler, user, "limit=2&before="+second.Page.Before)
+	assertConversationIDs(t, last.Conversations, "conv-1")
+	if last.Page.Before != "" || last.Page.After == "" {
+		t.Fatalf("expected only a newer cursor on the last page, got %+v", last.Page)
+	}
+
+	back := listConversationsAs(t, handler, user, "limit=2&after="+last.Page.After)
+	assertConversationIDs(t, back.Conversations, "conv-3", "conv-2")
+}
+
+func TestListConversationMessagesPagesActiveBranch(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	ctx := context.Background()
+	conversation, err := handler.insertConversation(ctx, user.ID, "Long thread")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		role := "user"
+		if i%2 == 0 {
+			role = "assistant"
+		}
+		if err := handler.insertMessage(ctx, user.ID, conversation.ID, role, fmt.Sprintf("message %d", i), "", true, false); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+	}
+
+	latest := listMessagesAs(t, handler, user, conversation.ID, "limit=2")
+	assertMessageContents(t, latest.Messages, "message 4", "message 5")
+	if latest.Page.Before == "" || latest.Page.After != "" {
+		t.Fatalf("expected only an older cursor on the latest page, got %+v", latest.Page)
+	}
+
+	older := listMessagesAs(t, handler, user, conversation.ID, "limit=2&before="+latest.Page.Before)
+	assertMessageContents(t, older.Messages, "message 2", "message 3")
+
+	oldest := listMessagesAs(t, handler, user, conversation.ID, "limit=2&before="+older.Page.Before)
+	assertMessageContents(t, oldest.Messages, "message 1")
+	if oldest.Page.Before != "" {
+		t.Fatalf("expected no older cursor at the start of the thread, got %+v", oldest.Page)
+	}
+
+	newer := listMessagesAs(t, handler, user, conversation.ID, "limit=3&after="+oldest.Page.After)
+	assertMessageContents(t, newer.Messages, "message 2", "message 3", "message 4")
+	if newer.Page.After == "" {
+		t.Fatalf("expected a newer cursor while messages remain, got %+v", newer.Page)
+	}
+}
+
+func TestListConversationMessagesPagesInPathOrderWhateverTheRowids(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	ctx := context.Background()
+	conversation, err := handler.insertConversation(ctx, user.ID, "Renumbered thread")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	for i := 1; i <= 4; i++ {
+		role := "user"
+		if i%2 == 0 {
+			role = "assistant"
+		}
+		if err := handler.insertMessage(ctx, user.ID, conversation.ID, role, fmt.Sprintf("message %d", i), "", true, false); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+	}
+	// Give the root the highest rowid, as a VACUUM or import may.
+	if _, err := db.Exec(`UPDATE messages SET rowid = rowid + 100 WHERE content = 'message 1';`); err != nil {
+		t.Fatalf("renumber root: %v", err)
+	}
+
+	latest := listMessagesAs(t, handler, user, conversation.ID, "limit=2")
+	assertMessageContents(t, latest.Messages, "message 3", "message 4")
+	older := listMessagesAs(t, handler, user, conversation.ID, "limit=2&before="+latest.Page.Before)
+	assertMessageContents(t, older.Messages, "message 1", "message 2")
+	if older.Page.Before != "" {
+		t.Fatalf("expected no older cursor at the start of the thread, got %+v", older.Page)
+	}
+}
+
+func TestListEndpointsRejectInvalidPageParams(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	conversation, err := handler.insertConversation(context.Background(), user.ID, "Chat")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+
+	validCursor := encodePageCursor(pageCursor{Kind: pageCursorMessages, PathPosition: 1})
+	for _, rawQuery := range []string{"limit=0", "limit=abc", "before=not-a-cursor", "before=" + validCursor + "&after=" + validCursor} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/conversations?"+rawQuery, nil)
+		req = requestWithSessionUser(req, user)
+		resp := httptest.NewRecorder()
+		handler.ListConversations(resp, req)
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for conversations %q, got %d (%s)", rawQuery, resp.Code, resp.Body.String())
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "/v1/conversations/"+conversation.ID+"/messages?"+rawQuery, nil)
+		req = requestWithConversationID(requestWithSessionUser(req, user), conversation.ID)
+		resp = httptest.NewRecorder()
+		handler.ListConversationMessages(resp, req)
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for messages %q, got %d (%s)", rawQuery, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestListEndpointsRejectCursorsFromOtherEndpoint(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	conversation, err := handler.insertConversation(context.Background(), user.ID, "Chat")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+
+	messageCursor := encodePageCursor(pageCursor{Kind: pageCursorMessages, PathPosition: 1, UpdatedAt: "2026-01-01T00:00:00Z", ID: conversation.ID})
+	req := httptest.NewRequest(http.MethodGet, "/v1/conversations?before="+messageCursor, nil)
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ListConversations(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a message cursor on conversations, got %d (%s)", resp.Code, resp.Body.String())
+	}
+
+	conversationCursor := encodePageCursor(pageCursor{Kind: pageCursorConversations, PathPosition: 1, UpdatedAt: "2026-01-01T00:00:00Z", ID: conversation.ID})
+	req = httptest.NewRequest(http.MethodGet, "/v1/conversations/"+conversation.ID+"/messages?before="+conversationCursor, nil)
+	req = requestWithConversationID(requestWithSessionUser(req, user), conversation.ID)
+	resp = httptest.NewRecorder()
+	handler.ListConversationMessages(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a conversation cursor on messages, got %d (%s)", resp.Code, resp.Body.String())
+	}
+}
+
+func listConversationsAs(t *testing.T, handler Handler, user session.User, rawQuery string) pagedConversations {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/conversations?"+rawQuery, nil)
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+
+	handler.ListConversations(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, resp.Code, resp.Body.String())
+	}
+	var payload pagedConversations
+	decodeJSONBody(t, resp, &payload)
+	return payload
+}
+
+func listMessagesAs(t *testing.T, handler Handler, user session.User, conversationID, rawQuery string) pagedMessages {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/conversations/"+url.PathEscape(conversationID)+"/messages?"+rawQuery, nil)
+	req = requestWithConversationID(requestWithSessionUser(req, user), conversationID)
+	resp := httptest.NewRecorder()
+
+	handler.ListConversationMessages(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, resp.Code, resp.Body.String())
+	}
+	var payload pagedMessages
+	decodeJSONBody(t, resp, &payload)
+	return payload
+}
+
+func assertConversationIDs(t *testing.T, conversations []conversationResponse, want ...string) {
+	t.Helper()
+	got := make([]string, 0, len(conversations))
+	for _, conversation := range conversations {
+		got = append(got, conversation.ID)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("unexpected conversations: got %v, want %v", got, want)
+	}
+}
+
+func assertMessageContents(t *testing.T, messages []messageResponse, want ...string) {
+	t.Helper()
+	got := make([]string, 0, len(messages))
+	for _, message := range messages {
+		got = append(got, message.Content)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("unexpected messages: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,228 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type regenerateMessageRequest struct {
+	ModelID         string         `json:"modelId"`
+	ReasoningEffort string         `json:"reasoningEffort"`
+	Sampling        samplingParams `json:"sampling"`
+	Grounding       *bool          `json:"grounding"`
+	DeepResearch    *bool          `json:"deepResearch"`
+}
+
+type regenerateTarget struct {
+	Content             string
+	ParentMessageID     string
+	ModelID             string
+	GroundingEnabled    bool
+	DeepResearchEnabled bool
+}
+
+// RegenerateMessage streams a new assistant reply to an existing user message.
+// Earlier replies stay as siblings; settings default to the original turn's.
+func (h Handler) RegenerateMessage(w http.ResponseWriter, r *http.Request) {
+	var req regenerateMessageRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	conversationID := strings.TrimSpace(chi.URLParam(r, "id"))
+	messageID := strings.TrimSpace(chi.URLParam(r, "messageId"))
+	if conversationID == "" || messageID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "conversation id and message id are required")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming_unsupported", "server does not support streaming")
+		return
+	}
+	if h.generations.isDraining() {
+		writeError(w, http.StatusServiceUnavailable, "shutting_down", errGenerationsDraining.Error())
+		return
+	}
+
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	exists, err := h.conversationExists(r.Context(), user.ID, conversationID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to read conversation")
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "conversation_not_found", "conversation not found")
+		return
+	}
+
+	target, err := h.resolveRegenerateTarget(r.Context(), user.ID, conversationID, messageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "message_not_found", "message not found")
+		case errors.Is(err, errTargetNotUserMessage):
+			writeError(w, http.StatusBadRequest, "invalid_request", "messageId must reference a user message")
+		default:
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve message")
+		}
+		return
+	}
+
+	grounding := target.GroundingEnabled
+	if req.Grounding != nil {
+		grounding = *req.Grounding
+	}
+
+	deepResearch := target.DeepResearchEnabled
+	if req.DeepResearch != nil {
+		deepResearch = *req.DeepResearch
+	}
+
+	modelID := fallback(req.ModelID, fallback(target.ModelID, h.cfg.OpenRouterDefaultModel))
+	mode := "chat"
+	if deepResearch {
+		mode = "deep_research"
+	}
+	if _, err := h.persistModelSelection(r.Context(), user.ID, mode, modelID); err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to persist model preferences")
+		return
+	}
+
+	reasoningEffort, err := h.resolveReasoningEffort(r.Context(), user.ID, modelID, mode, req.ReasoningEffort)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidReasoningEffort):
+			writeError(w, http.StatusBadRequest, "invalid_request", "reasoningEffort must be one of: low, medium, high")
+		case errors.Is(err, errReasoningUnsupportedModel):
+			writeError(w, http.StatusBadRequest, "invalid_request", "selected model does not support reasoning controls")
+		default:
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve reasoning effort")
+		}
+		return
+	}
+
+	sampling, err := h.resolveSamplingParams(r.Context(), user.ID, modelID, mode, req.Sampling)
+	if err != nil {
+		if errors.Is(err, errInvalidSamplingParams) || errors.Is(err, errSamplingUnsupportedModel) {
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve sampling parameters")
+		return
+	}
+
+	files, err := h.listMessageFiles(r.Context(), user.ID, messageID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve attachments")
+		return
+	}
+	if err := h.checkImageAttachments(r.Context(), modelID, deepResearch, files); err != nil {
+		switch {
+		case errors.Is(err, errImagesInDeepResearch), errors.Is(err, errImageInputUnsupported):
+			writeError(w, http.StatusBadRequest, "unsupported_attachment", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve model capabilities")
+		}
+		return
+	}
+	images, err := h.loadImageParts(r.Context(), files)
+	if err != nil {
+		log.Printf("load image attachments failed: user_id=%s err=%v", user.ID, err)
+		writeError(w, http.StatusBadGateway, "storage_error", "failed to load image attachments")
+		return
+	}
+
+	historyMessages, err := h.listConversationPromptPath(r.Context(), user.ID, conversationID, target.ParentMessageID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to load conversation history")
+		return
+	}
+	instructions, err := h.promptInstructions(r.Context(), user.ID, conversationID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to load instructions")
+		return
+	}
+
+	userPrompt := h.appendFileContextToPrompt(target.Content, files)
+	h.runGeneration(w, r, flusher, user.ID, conversationID, messageID, func(ctx context.Context, stream *generationStream) {
+		if deepResearch {
+			h.streamDeepResearchResponse(ctx, stream, deepResearchStreamInput{
+				UserID:          user.ID,
+				UserMessageID:   messageID,
+				ConversationID:  conversationID,
+				ModelID:         modelID,
+				ReasoningEffort: reasoningEffort,
+				Sampling:        sampling,
+				Message:         target.Content,
+				Prompt:          userPrompt,
+				Grounding:       grounding,
+				IsAnonymous:     user.GoogleSub == "anonymous",
+				Instructions:    instructions,
+				History:         historyMessages,
+			})
+			return
+		}
+
+		h.streamChatResponse(ctx, stream, chatStreamInput{
+			UserID:          user.ID,
+			UserMessageID:   messageID,
+			ConversationID:  conversationID,
+			ModelID:         modelID,
+			ReasoningEffort: reasoningEffort,
+			Sampling:        sampling,
+			Message:         target.Content,
+			Prompt:          userPrompt,
+			Images:          images,
+			Grounding:       grounding,
+			Instructions:    instructions,
+			History:         historyMessages,
+		})
+	})
+}
+
+func (h Handler) resolveRegenerateTarget(ctx context.Context, userID, conversationID, messageID string) (regenerateTarget, error) {
+	var target regenerateTarget
+	var role string
+	var parentMessageID sql.NullString
+	var modelID sql.NullString
+	var groundingEnabled int
+	var deepResearchEnabled int
+	err := h.db.QueryRowContext(ctx, `
+SELECT m.role, m.content, m.parent_message_id, m.model_id, m.grounding_enabled, m.deep_research_enabled
+FROM messages m
+JOIN conversations c ON c.id = m.conversation_id
+WHERE m.id = ? AND m.conversation_id = ? AND c.user_id = ?
+LIMIT 1;
+`, messageID, conversationID, userID).Scan(&role, &target.Content, &parentMessageID, &modelID, &groundingEnabled, &deepResearchEnabled)
+	if err != nil {
+		return regenerateTarget{}, err
+	}
+	if role != "user" {
+		return regenerateTarget{}, errTargetNotUserMessage
+	}
+	target.ParentMessageID = parentMessageID.String
+	target.ModelID = modelID.String
+	target.GroundingEnabled = groundingEnabled == 1
+	target.DeepResearchEnabled = deepResearchEnabled == 1
+	return target, nil
+}
@@ -0,0 +1,137 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRegenerateMessageAddsSiblingReplyWithNewModelAndAttachments(t *testing.T) {
+	capturedRequests := make([]openrouter.StreamRequest, 0, 4)
+	streamer := stubStreamer{
+		tokens: []string{"Answer"},
+		onRequest: func(req openrouter.StreamRequest) {
+			capturedRequests = append(capturedRequests, req)
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	seedModel(t, db, "openrouter/other")
+
+	if _, err := db.Exec(`
+INSERT INTO files (id, user_id, filename, media_type, size_bytes, storage_backend, storage_path, extracted_text)
+VALUES ('file-1', ?, 'notes.md', 'text/markdown', 42, 'gcs', 'chat-uploads/users/user-1/file-1/notes.md', 'Attached facts go here.');
+`, user.ID); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+
+	postChatMessage(t, handler, user, `{"message":"Summarize my notes","modelId":"openrouter/free","grounding":false,"fileIds":["file-1"]}`)
+
+	var conversationID string
+	var userMessageID string
+	if err := db.QueryRow(`SELECT conversation_id, id FROM messages WHERE role = 'user' LIMIT 1;`).Scan(&conversationID, &userMessageID); err != nil {
+		t.Fatalf("query user message: %v", err)
+	}
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/v1/conversations/"+conversationID+"/messages/"+userMessageID+"/regenerate",
+		strings.NewReader(`{"modelId":"openrouter/other"}`),
+	)
+	req = requestWithMessageID(requestWithConversationID(requestWithSessionUser(req, user), conversationID), userMessageID)
+	resp := httptest.NewRecorder()
+	handler.RegenerateMessage(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	events := decodeSSEEvents(t, resp.Body.String())
+	if len(events) == 0 || events[0].Type != "metadata" || events[0].Data["modelId"] != "openrouter/other" || events[0].Data["grounding"] != false {
+		t.Fatalf("expected metadata for the new model with original grounding, got %+v", events)
+	}
+
+	generationRequests := filterGenerationRequests(capturedRequests)
+	if len(generationRequests) != 2 {
+		t.Fatalf("expected 2 generation requests, got %d", len(generationRequests))
+	}
+	regenerated := generationRequests[1]
+	if regenerated.Model != "openrouter/other" {
+		t.Fatalf("expected regenerate to use openrouter/other, got %q", regenerated.Model)
+	}
+	lastPrompt := regenerated.Messages[len(regenerated.Messages)-1]
+	if lastPrompt.Role != "user" || !strings.Contains(lastPrompt.Content, "Attached facts go here.") {
+		t.Fatalf("expected regenerated prompt to include linked attachment, got %+v", lastPrompt)
+	}
+	for _, message := range regenerated.Messages[:len(regenerated.Messages)-1] {
+		if message.Role == "assistant" || message.Role == "user" {
+			t.Fatalf("expected no history before the first turn, got %+v", regenerated.Messages)
+		}
+	}
+
+	var userMessageCount int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM messages WHERE conversation_id = ? AND role = 'user';`, conversationID).Scan(&userMessageCount); err != nil {
+		t.Fatalf("count user messages: %v", err)
+	}
+	if userMessageCount != 1 {
+		t.Fatalf("expected regenerate to reuse the user message, got %d user messages", userMessageCount)
+	}
+
+	activePath, _, err := handler.listActivePathMessages(context.Background(), user.ID, conversationID, pageRequest{})
+	if err != nil {
+		t.Fatalf("list active path: %v", err)
+	}
+	if len(activePath) != 2 {
+		t.Fatalf("expected user message and regenerated reply, got %+v", activePath)
+	}
+	reply := activePath[1]
+	if reply.ModelID == nil || *reply.ModelID != "openrouter/other" {
+		t.Fatalf("expected regenerated reply from openrouter/other, got %+v", reply.ModelID)
+	}
+	if reply.SiblingCount != 2 || reply.SiblingIndex != 1 {
+		t.Fatalf("expected regenerated reply to be the second alternative, got %+v", reply)
+	}
+}
+
+func TestRegenerateMessageRejectsAssistantTarget(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{tokens: []string{"Answer"}})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	postChatMessage(t, handler, user, `{"message":"Hello","modelId":"openrouter/free","grounding":false}`)
+
+	var conversationID string
+	var assistantMessageID string
+	if err := db.QueryRow(`SELECT conversation_id, id FROM messages WHERE role = 'assistant' LIMIT 1;`).Scan(&conversationID, &assistantMessageID); err != nil {
+		t.Fatalf("query assistant message: %v", err)
+	}
+
+	for messageID, wantStatus := range map[string]int{assistantMessageID: http.StatusBadRequest, "missing": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/conversations/"+conversationID+"/messages/"+messageID+"/regenerate", nil)
+		req = requestWithMessageID(requestWithConversationID(requestWithSessionUser(req, user), conversationID), messageID)
+		resp := httptest.NewRecorder()
+		handler.RegenerateMessage(resp, req)
+		if resp.Code != wantStatus {
+			t.Fatalf("expected status %d for %q, got %d (%s)", wantStatus, messageID, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func requestWithMessageID(req *http.Request, messageID string) *http.Request {
+	routeContext := chi.RouteContext(req.Context())
+	routeContext.URLParams.Add("messageId", messageID)
+	return req
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"chat/backend/internal/research"
+	"chat/backend/internal/search"
 )
 
 func (h Handler) buildResearchConfig(profile research.ModeProfile) research.OrchestratorConfig {
@@ -20,7 +21,7 @@ func (h Handler) buildResearchConfig(profile research.ModeProfile) research.Orch
 		overrides.MaxSearchQueries = h.cfg.DeepResearchMaxSearchQ
 		overrides.MaxCitations = h.cfg.ResearchMaxCitationsDeep
 		overrides.Timeout = time.Duration(h.cfg.DeepResearchTimeoutSeconds) * time.Second
-		overrides.MinSearchInterval = braveFreeTierSpacing
+		overrides.MinSearchInterval = search.MinInterval(h.cfg)
 	case research.ModeChat:
 		fallthrough
 	default:
@@ -32,6 +33,12 @@ func (h Handler) buildResearchConfig(profile research.ModeProfile) research.Orch
 	}
 	overrides.SourceFetchTimeout = time.Duration(h.cfg.ResearchSourceTimeoutSecs) * time.Second
 	overrides.SourceMaxBytes = int64(h.cfg.ResearchSourceMaxBytes)
+	overrides.ReadConcurrency = h.cfg.ResearchReadConcurrency
+	overrides.PerHostReadConcurrency = h.cfg.ResearchReadPerHostConc
+	overrides.Cache = h.researchCache
+	overrides.SearchCacheTTL = time.Duration(h.cfg.ResearchSearchCacheTTLSecs) * time.Second
+	overrides.PageCacheTTL = time.Duration(h.cfg.ResearchPageCacheTTLSecs) * time.Second
+	overrides.TimeSensitiveCacheTTL = time.Duration(h.cfg.ResearchFreshCacheTTLSecs) * time.Second
 
 	return research.ResolveProfile(profile, overrides)
 }
@@ -61,7 +68,7 @@ func (h Handler) runResearchOrchestrator(
 	}
 
 	log.Printf(
-		"research orchestrator completed: profile=%s loops=%d searches=%d sources_considered=%d sources_read=%d read_attempts=%d read_failures=%d read_success_rate=%.2f read_failure_reasons=%q stop_reason=%s warning_present=%t err_present=%t",
+		"research orchestrator completed: profile=%s loops=%d searches=%d sources_considered=%d sources_read=%d read_attempts=%d read_failures=%d read_success_rate=%.2f read_failure_reasons=%q cache_hits=%d cache_misses=%d stop_reason=%s warning_present=%t err_present=%t",
 		profile,
 		result.Loops,
 		result.SearchQueries,
@@ -71,6 +78,8 @@ func (h Handler) runResearchOrchestrator(
 		result.ReadFailures,
 		readSuccessRate,
 		formatTopReadFailureReasons(result.ReadFailureReasons, 3),
+		result.CacheHits,
+		result.CacheMisses,
 		result.StopReason,
 		researchWarning(result) != "",
 		err != nil,
@@ -99,10 +108,11 @@ func convertResearchCitations(citations []research.Citation, max int) []citation
 			continue
 		}
 		converted = append(converted, citationResponse{
-			URL:            strings.TrimSpace(item.URL),
-			Title:          trimToRunes(strings.TrimSpace(item.Title), 240),
-			Snippet:        trimToRunes(strings.TrimSpace(item.Snippet), 800),
-			SourceProvider: fallback(item.SourceProvider, "brave"),
+			URL:             strings.TrimSpace(item.URL),
+			Title:           trimToRunes(strings.TrimSpace(item.Title), 240),
+			Snippet:         trimToRunes(strings.TrimSpace(item.Snippet), 800),
+			SourceProvider:  item.SourceProvider,
+			SourceProviders: item.Providers,
 		})
 	}
 	return converted
@@ -1,6 +1,8 @@
 package httpapi
 
 import (
+	"context"
+	"slices"
 	"testing"
 	"time"
 
@@ -8,11 +10,13 @@ import (
 	"chat/backend/internal/research"
 )
 
-func TestBuildResearchConfigAppliesBraveSpacingToDeepResearch(t *testing.T) {
+func TestBuildResearchConfigAppliesSearchSpacingToDeepResearch(t *testing.T) {
 	h := Handler{
 		cfg: config.Config{
 			ChatResearchTimeoutSeconds: 20,
 			DeepResearchTimeoutSeconds: 150,
+			SearchProviders:            []string{"brave"},
+			BraveMinIntervalMS:         1100,
 		},
 	}
 
@@ -25,10 +29,42 @@ func TestBuildResearchConfigAppliesBraveSpacingToDeepResearch(t *testing.T) {
 	}
 
 	deepCfg := h.buildResearchConfig(research.ModeDeepResearch)
-	if deepCfg.MinSearchInterval != braveFreeTierSpacing {
-		t.Fatalf("expected deep min search interval %v, got %v", braveFreeTierSpacing, deepCfg.MinSearchInterval)
+	if deepCfg.MinSearchInterval != 1100*time.Millisecond {
+		t.Fatalf("expected deep min search interval 1.1s, got %v", deepCfg.MinSearchInterval)
 	}
 	if deepCfg.Timeout != 150*time.Second {
 		t.Fatalf("expected deep timeout 150s, got %v", deepCfg.Timeout)
 	}
 }
+
+func TestResearchCitationsKeepEveryProviderThroughPersistence(t *testing.T) {
+	h, db := newTestHandler(t, &stubStreamer{})
+	seedUser(t, db, "user-1", "user-1@example.com")
+	if _, err := db.Exec(`INSERT INTO conversations (id, user_id, title) VALUES ('conv-1', 'user-1', 'Fused');`); err != nil {
+		t.Fatalf("seed conversation: %v", err)
+	}
+
+	citations := convertResearchCitations([]research.Citation{{
+		URL:            "https://example.com/a",
+		Title:          "A",
+		SourceProvider: "tavily",
+		Providers:      []string{"tavily", "brave"},
+	}}, 0)
+	if len(citations) != 1 || !slices.Equal(citations[0].SourceProviders, []string{"tavily", "brave"}) {
+		t.Fatalf("expected converted citation to carry both providers, got %+v", citations)
+	}
+
+	ctx := context.Background()
+	messageID, err := h.insertMessageWithCitations(ctx, "user-1", "conv-1", "", "assistant", "answer", "", "", true, true, citations, nil, nil)
+	if err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	stored, err := h.listMessageCitations(ctx, "user-1", []string{messageID})
+	if err != nil {
+		t.Fatalf("list citations: %v", err)
+	}
+	got := stored[messageID]
+	if len(got) != 1 || got[0].SourceProvider != "tavily" || !slices.Equal(got[0].SourceProviders, []string{"tavily", "brave"}) {
+		t.Fatalf("expected stored citation to keep both providers, got %+v", got)
+	}
+}
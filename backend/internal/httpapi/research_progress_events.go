@@ -33,6 +33,12 @@ func progressEventData(progress research.Progress) map[string]any {
 	if progress.SourcesRead > 0 {
 		event["sourcesRead"] = progress.SourcesRead
 	}
+	if progress.CacheHits > 0 {
+		event["cacheHits"] = progress.CacheHits
+	}
+	if progress.CacheMisses > 0 {
+		event["cacheMisses"] = progress.CacheMisses
+	}
 
 	if title := strings.TrimSpace(progress.Title); title != "" {
 		event["title"] = title
@@ -3,16 +3,17 @@ package httpapi
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"chat/backend/internal/auth"
-	"chat/backend/internal/brave"
 	"chat/backend/internal/config"
 	"chat/backend/internal/openrouter"
 	"chat/backend/internal/research"
+	"chat/backend/internal/search"
 	"chat/backend/internal/session"
 
 	"github.com/go-chi/chi/v5"
@@ -20,7 +21,20 @@ import (
 	"github.com/go-chi/cors"
 )
 
-func NewRouter(cfg config.Config, db *sql.DB) http.Handler {
+// Router serves the API and owns the generations it runs in the background.
+type Router struct {
+	http.Handler
+	generations *generationManager
+}
+
+// Shutdown stops accepting new generations and waits for running ones. When
+// ctx ends first, the remaining ones are interrupted after persisting their
+// partial replies.
+func (r *Router) Shutdown(ctx context.Context) error {
+	return r.generations.Shutdown(ctx)
+}
+
+func NewRouter(cfg config.Config, db *sql.DB) (*Router, error) {
 	store := session.NewStore(db)
 	verifier := auth.NewVerifier(cfg)
 	openRouterClient := openrouter.NewClient(cfg, nil)
@@ -33,14 +47,34 @@ func NewRouter(cfg config.Config, db *sql.DB) http.Handler {
 		} else {
 			files = gcsStore
 		}
+	} else {
+		localStore, err := newLocalObjectStore(cfg.LocalUploadDir, cfg.LocalUploadFsync)
+		if err != nil {
+			log.Printf("attachments disabled: failed to initialize local storage: %v", err)
+		} else {
+			files = localStore
+		}
 	}
 
+	provider, err := search.New(cfg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("initialize search provider: %w", err)
+	}
 	h := NewHandlerWithFileStore(cfg, db, store, verifier, openRouterClient, files)
-	h.grounding = newRateLimitedGroundingSearcher(brave.NewClient(cfg, nil), braveFreeTierSpacing)
+	h.grounding = provider
 	h.researchReader = research.NewHTTPReader(research.ReaderConfig{
-		RequestTimeout: time.Duration(cfg.ResearchSourceTimeoutSecs) * time.Second,
-		MaxBytes:       int64(cfg.ResearchSourceMaxBytes),
+		RequestTimeout:  time.Duration(cfg.ResearchSourceTimeoutSecs) * time.Second,
+		MaxBytes:        int64(cfg.ResearchSourceMaxBytes),
+		MinHostInterval: time.Duration(cfg.ResearchHostIntervalMS) * time.Millisecond,
+		HostConcurrency: cfg.ResearchHostMaxConc,
+		RobotsCacheTTL:  time.Duration(cfg.ResearchRobotsTTLSecs) * time.Second,
 	}, nil)
+	switch cfg.ResearchCache {
+	case "memory":
+		h.researchCache = research.NewMemoryCache(int64(cfg.ResearchCacheMaxBytes))
+	case "db":
+		h.researchCache = research.NewDBCache(db, int64(cfg.ResearchCacheMaxBytes))
+	}
 
 	r := chi.NewRouter()
 	r.Use(chimw.RequestID)
@@ -49,8 +83,8 @@ func NewRouter(cfg config.Config, db *sql.DB) http.Handler {
 	r.Use(chimw.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   cfg.AllowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Test-Email", "X-Test-Google-Sub"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Last-Event-ID", "X-CSRF-Token", "X-Test-Email", "X-Test-Google-Sub"},
 		ExposedHeaders:   []string{"Content-Type"},
 		AllowCredentials: true,
 		MaxAge:           300,
@@ -65,6 +99,7 @@ func NewRouter(cfg config.Config, db *sql.DB) http.Handler {
 		v1.Route("/auth", func(authR chi.Router) {
 			authR.Post("/google", h.AuthGoogle)
 			authR.With(h.RequireSession).Get("/me", h.AuthMe)
+			authR.With(h.RequireSession).Put("/me/instructions", h.UpdateCustomInstructions)
 			authR.With(h.RequireSession).Post("/logout", h.AuthLogout)
 		})
 
@@ -76,15 +111,34 @@ func NewRouter(cfg config.Config, db *sql.DB) http.Handler {
 			p.Put("/models/preferences", h.UpdateModelPreferences)
 			p.Put("/models/favorites", h.UpdateModelFavorite)
 			p.Put("/models/reasoning-presets", h.UpdateModelReasoningPreset)
+			p.Put("/models/sampling-presets", h.UpdateModelSamplingPreset)
+			p.Get("/api-tokens", h.ListAPITokens)
+			p.Post("/api-tokens", h.CreateAPIToken)
+			p.Delete("/api-tokens/{id}", h.DeleteAPIToken)
 			p.Post("/files", h.UploadFile)
 			p.Post("/conversations", h.CreateConversation)
 			p.Get("/conversations", h.ListConversations)
 			p.Delete("/conversations", h.DeleteAllConversations)
+			p.Patch("/conversations/{id}", h.UpdateConversation)
 			p.Delete("/conversations/{id}", h.DeleteConversation)
 			p.Get("/conversations/{id}/messages", h.ListConversationMessages)
+			p.Put("/conversations/{id}/active-branch", h.SwitchConversationBranch)
+			p.Put("/conversations/{id}/messages/{messageId}/winner", h.PickComparisonWinner)
+			p.Put("/conversations/{id}/system-prompt", h.UpdateConversationSystemPrompt)
+			p.Post("/conversations/{id}/messages/{messageId}/regenerate", h.RegenerateMessage)
 			p.Post("/chat/messages", h.ChatMessages)
+			p.Get("/search", h.Search)
+			p.Get("/generations/{id}", h.GenerationStatus)
+			p.Get("/generations/{id}/events", h.GenerationEvents)
+			p.Post("/generations/{id}/cancel", h.CancelGeneration)
 		})
 	})
 
-	return r
+	r.Route("/openai/v1", func(openai chi.Router) {
+		openai.Use(h.RequireAPIToken)
+		openai.Get("/models", h.OpenAIModels)
+		openai.Post("/chat/completions", h.OpenAIChatCompletions)
+	})
+
+	return &Router{Handler: r, generations: h.generations}, nil
 }
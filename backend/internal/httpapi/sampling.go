@@ -0,0 +1,399 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"chat/backend/internal/openrouter"
+)
+
+const (
+	maxStopSequences     = 4
+	maxStopSequenceRunes = 64
+)
+
+var (
+	errInvalidSamplingParams    = errors.New("invalid sampling parameters")
+	errSamplingUnsupportedModel = errors.New("selected model does not support")
+)
+
+// samplingParams mirrors openrouter.SamplingParams with API casing. Nil
+// fields are unset.
+type samplingParams struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxTokens        *int     `json:"maxTokens,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+}
+
+type samplingPresetResponse struct {
+	ModelID string         `json:"modelId"`
+	Mode    string         `json:"mode"`
+	Params  samplingParams `json:"params"`
+}
+
+type updateSamplingPresetRequest struct {
+	ModelID string         `json:"modelId"`
+	Mode    string         `json:"mode"`
+	Params  samplingParams `json:"params"`
+}
+
+func (p samplingParams) isEmpty() bool {
+	return p.Temperature == nil && p.TopP == nil && p.MaxTokens == nil && len(p.Stop) == 0 &&
+		p.Seed == nil && p.PresencePenalty == nil && p.FrequencyPenalty == nil
+}
+
+func (p samplingParams) validate() error {
+	switch {
+	case p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2):
+		return fmt.Errorf("%w: temperature must be between 0 and 2", errInvalidSamplingParams)
+	case p.TopP != nil && (*p.TopP <= 0 || *p.TopP > 1):
+		return fmt.Errorf("%w: topP must be greater than 0 and at most 1", errInvalidSamplingParams)
+	case p.MaxTokens != nil && *p.MaxTokens < 1:
+		return fmt.Errorf("%w: maxTokens must be at least 1", errInvalidSamplingParams)
+	case len(p.Stop) > maxStopSequences:
+		return fmt.Errorf("%w: at most %d stop sequences are allowed", errInvalidSamplingParams, maxStopSequences)
+	case p.PresencePenalty != nil && (*p.PresencePenalty < -2 || *p.PresencePenalty > 2):
+		return fmt.Errorf("%w: presencePenalty must be between -2 and 2", errInvalidSamplingParams)
+	case p.FrequencyPenalty != nil && (*p.FrequencyPenalty < -2 || *p.FrequencyPenalty > 2):
+		return fmt.Errorf("%w: frequencyPenalty must be between -2 and 2", errInvalidSamplingParams)
+	}
+	for _, stop := range p.Stop {
+		if stop == "" || utf8.RuneCountInString(stop) > maxStopSequenceRunes {
+			return fmt.Errorf("%w: stop sequences must be 1 to %d characters", errInvalidSamplingParams, maxStopSequenceRunes)
+		}
+	}
+	return nil
+}
+
+// providerParameters lists the set fields by their supported_parameters name.
+func (p samplingParams) providerParameters() []string {
+	var names []string
+	if p.Temperature != nil {
+		names = append(names, "temperature")
+	}
+	if p.TopP != nil {
+		names = append(names, "top_p")
+	}
+	if p.MaxTokens != nil {
+		names = append(names, "max_tokens")
+	}
+	if len(p.Stop) > 0 {
+		names = append(names, "stop")
+	}
+	if p.Seed != nil {
+		names = append(names, "seed")
+	}
+	if p.PresencePenalty != nil {
+		names = append(names, "presence_penalty")
+	}
+	if p.FrequencyPenalty != nil {
+		names = append(names, "frequency_penalty")
+	}
+	return names
+}
+
+// withoutUnsupported drops the fields the model does not accept. Saved
+// presets go through this so a catalog change cannot break every request.
+func (p samplingParams) withoutUnsupported(supported []string) samplingParams {
+	if !slices.Contains(supported, "temperature") {
+		p.Temperature = nil
+	}
+	if !slices.Contains(supported, "top_p") {
+		p.TopP = nil
+	}
+	if !slices.Contains(supported, "max_tokens") {
+		p.MaxTokens = nil
+	}
+	if !slices.Contains(supported, "stop") {
+		p.Stop = nil
+	}
+	if !slices.Contains(supported, "seed") {
+		p.Seed = nil
+	}
+	if !slices.Contains(supported, "presence_penalty") {
+		p.PresencePenalty = nil
+	}
+	if !slices.Contains(supported, "frequency_penalty") {
+		p.FrequencyPenalty = nil
+	}
+	return p
+}
+
+// overlay returns p with every field set in override replaced.
+func (p samplingParams) overlay(override samplingParams) samplingParams {
+	if override.Temperature != nil {
+		p.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		p.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		p.MaxTokens = override.MaxTokens
+	}
+	if len(override.Stop) > 0 {
+		p.Stop = override.Stop
+	}
+	if override.Seed != nil {
+		p.Seed = override.Seed
+	}
+	if override.PresencePenalty != nil {
+		p.PresencePenalty = override.PresencePenalty
+	}
+	if override.FrequencyPenalty != nil {
+		p.FrequencyPenalty = override.FrequencyPenalty
+	}
+	return p
+}
+
+func (p samplingParams) openRouter() openrouter.SamplingParams {
+	return openrouter.SamplingParams{
+		Temperature:      p.Temperature,
+		TopP:             p.TopP,
+		MaxTokens:        p.MaxTokens,
+		Stop:             p.Stop,
+		Seed:             p.Seed,
+		PresencePenalty:  p.PresencePenalty,
+		FrequencyPenalty: p.FrequencyPenalty,
+	}
+}
+
+// checkSamplingSupport validates params and rejects any the model's
+// supported_parameters do not list.
+func (h Handler) checkSamplingSupport(ctx context.Context, modelID string, params samplingParams) ([]string, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	supported, err := h.modelSupportedParameters(ctx, modelID)
+	if err != nil {
+		return nil, err
+	}
+	if err := params.checkSupported(supported); err != nil {
+		return nil, err
+	}
+	return supported, nil
+}
+
+func (p samplingParams) checkSupported(supported []string) error {
+	var unsupported []string
+	for _, name := range p.providerParameters() {
+		if !slices.Contains(supported, name) {
+			unsupported = append(unsupported, name)
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%w: %s", errSamplingUnsupportedModel, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// resolveSamplingParams layers the request's params over the user's saved
+// preset for the model and mode.
+func (h Handler) resolveSamplingParams(ctx context.Context, userID, modelID, mode string, override samplingParams) (openrouter.SamplingParams, error) {
+	supported, err := h.checkSamplingSupport(ctx, modelID, override)
+	if err != nil {
+		return openrouter.SamplingParams{}, err
+	}
+	preset, err := h.readSamplingPreset(ctx, userID, modelID, mode)
+	if err != nil {
+		return openrouter.SamplingParams{}, err
+	}
+	return preset.withoutUnsupported(supported).overlay(override).openRouter(), nil
+}
+
+func (h Handler) UpdateModelSamplingPreset(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	var req updateSamplingPresetRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	modelID := strings.TrimSpace(req.ModelID)
+	if modelID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "modelId is required")
+		return
+	}
+
+	mode := strings.TrimSpace(req.Mode)
+	if mode != "chat" && mode != "deep_research" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "mode must be one of: chat, deep_research")
+		return
+	}
+
+	if err := h.setSamplingPreset(r.Context(), user.ID, modelID, mode, req.Params); err != nil {
+		if errors.Is(err, errInvalidSamplingParams) || errors.Is(err, errSamplingUnsupportedModel) {
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to update sampling preset")
+		return
+	}
+
+	presets, err := h.listUserSamplingPresets(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to read sampling presets")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"samplingPresets": presets})
+}
+
+// setSamplingPreset saves params as the user's defaults for the model and
+// mode. Empty params clear the preset.
+func (h Handler) setSamplingPreset(ctx context.Context, userID, modelID, mode string, params samplingParams) error {
+	if err := params.validate(); err != nil {
+		return err
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	resolvedModelID, err := ensureModelExists(ctx, tx, modelID)
+	if err != nil {
+		return err
+	}
+
+	if params.isEmpty() {
+		if _, err := tx.ExecContext(ctx, `
+DELETE FROM user_model_sampling_presets
+WHERE user_id = ? AND model_id = ? AND mode = ?;
+`, userID, resolvedModelID, mode); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	supported, err := readModelSupportedParameters(ctx, tx, resolvedModelID)
+	if err != nil {
+		return err
+	}
+	if err := params.checkSupported(supported); err != nil {
+		return err
+	}
+
+	var stopJSON any
+	if len(params.Stop) > 0 {
+		encoded, err := json.Marshal(params.Stop)
+		if err != nil {
+			return err
+		}
+		stopJSON = string(encoded)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO user_model_sampling_presets (
+  user_id,
+  model_id,
+  mode,
+  temperature,
+  top_p,
+  max_tokens,
+  stop_json,
+  seed,
+  presence_penalty,
+  frequency_penalty,
+  updated_at
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(user_id, model_id, mode) DO UPDATE SET
+  temperature = excluded.temperature,
+  top_p = excluded.top_p,
+  max_tokens = excluded.max_tokens,
+  stop_json = excluded.stop_json,
+  seed = excluded.seed,
+  presence_penalty = excluded.presence_penalty,
+  frequency_penalty = excluded.frequency_penalty,
+  updated_at = CURRENT_TIMESTAMP;
+`, userID, resolvedModelID, mode, params.Temperature, params.TopP, params.MaxTokens, stopJSON, params.Seed, params.PresencePenalty, params.FrequencyPenalty); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (h Handler) readSamplingPreset(ctx context.Context, userID, modelID, mode string) (samplingParams, error) {
+	rows, err := h.db.QueryContext(ctx, samplingPresetsQuery+`
+  AND p.model_id = ?
+  AND p.mode = ?;
+`, userID, modelID, mode)
+	if err != nil {
+		return samplingParams{}, err
+	}
+	presets, err := scanSamplingPresets(rows)
+	if err != nil || len(presets) == 0 {
+		return samplingParams{}, err
+	}
+	return presets[0].Params, nil
+}
+
+func (h Handler) listUserSamplingPresets(ctx context.Context, userID string) ([]samplingPresetResponse, error) {
+	rows, err := h.db.QueryContext(ctx, samplingPresetsQuery+`
+  AND m.is_active = 1
+ORDER BY p.updated_at DESC;
+`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSamplingPresets(rows)
+}
+
+const samplingPresetsQuery = `
+SELECT p.model_id, p.mode, p.temperature, p.top_p, p.max_tokens, p.stop_json, p.seed, p.presence_penalty, p.frequency_penalty
+FROM user_model_sampling_presets p
+JOIN models m ON m.id = p.model_id
+WHERE p.user_id = ?`
+
+func scanSamplingPresets(rows *sql.Rows) ([]samplingPresetResponse, error) {
+	defer rows.Close()
+
+	presets := make([]samplingPresetResponse, 0, 16)
+	for rows.Next() {
+		var preset samplingPresetResponse
+		var temperature, topP, presencePenalty, frequencyPenalty sql.NullFloat64
+		var maxTokens, seed sql.NullInt64
+		var stopJSON sql.NullString
+		if err := rows.Scan(&preset.ModelID, &preset.Mode, &temperature, &topP, &maxTokens, &stopJSON, &seed, &presencePenalty, &frequencyPenalty); err != nil {
+			return nil, err
+		}
+		preset.Params = samplingParams{
+			Temperature:      nullableFloatPointer(temperature),
+			TopP:             nullableFloatPointer(topP),
+			MaxTokens:        nullableIntPointer(maxTokens),
+			Seed:             nullableIntPointer(seed),
+			PresencePenalty:  nullableFloatPointer(presencePenalty),
+			FrequencyPenalty: nullableFloatPointer(frequencyPenalty),
+		}
+		if stopJSON.Valid && stopJSON.String != "" {
+			if err := json.Unmarshal([]byte(stopJSON.String), &preset.Params.Stop); err != nil {
+				return nil, fmt.Errorf("decode stop sequences: %w", err)
+			}
+		}
+		presets = append(presets, preset)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return presets, nil
+}
@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+func putSamplingPreset(t *testing.T, handler Handler, user session.User, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/v1/models/sampling-presets", strings.NewReader(body))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.UpdateModelSamplingPreset(resp, req)
+	return resp
+}
+
+func TestChatMessagesLayersSamplingOverridesOnSavedPreset(t *testing.T) {
+	var capturedRequests []openrouter.StreamRequest
+	streamer := stubStreamer{
+		tokens: []string{"ok"},
+		onRequest: func(req openrouter.StreamRequest) {
+			capturedRequests = append(capturedRequests, req)
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["temperature","top_p","max_tokens","stop","seed"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("set supported parameters: %v", err)
+	}
+
+	presetResp := putSamplingPreset(t, handler, user, `{"modelId":"openrouter/free","mode":"chat","params":{"temperature":0.2,"maxTokens":500,"stop":["END"]}}`)
+	if presetResp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", presetResp.Code, presetResp.Body.String())
+	}
+	var presetBody struct {
+		SamplingPresets []samplingPresetResponse `json:"samplingPresets"`
+	}
+	decodeJSONBody(t, presetResp, &presetBody)
+	if len(presetBody.SamplingPresets) != 1 || presetBody.SamplingPresets[0].Params.MaxTokens == nil || *presetBody.SamplingPresets[0].Params.MaxTokens != 500 {
+		t.Fatalf("unexpected saved presets: %+v", presetBody.SamplingPresets)
+	}
+
+	postChatMessage(t, handler, user, `{"message":"Hi","modelId":"openrouter/free","grounding":false,"sampling":{"temperature":0.9,"seed":3}}`)
+
+	generationRequests := filterGenerationRequests(capturedRequests)
+	if len(generationRequests) != 1 {
+		t.Fatalf("expected one generation request, got %d", len(generationRequests))
+	}
+	sampling := generationRequests[0].SamplingParams
+	if sampling.Temperature == nil || *sampling.Temperature != 0.9 {
+		t.Fatalf("expected request temperature to win, got %v", sampling.Temperature)
+	}
+	if sampling.MaxTokens == nil || *sampling.MaxTokens != 500 || !slices.Equal(sampling.Stop, []string{"END"}) {
+		t.Fatalf("expected preset maxTokens and stop, got %+v", sampling)
+	}
+	if sampling.Seed == nil || *sampling.Seed != 3 || sampling.TopP != nil {
+		t.Fatalf("expected seed from the request and no topP, got %+v", sampling)
+	}
+	for _, req := range capturedRequests {
+		if isTitleRequest(req) && req.Temperature != nil {
+			t.Fatalf("expected title requests to keep provider defaults, got %+v", req.SamplingParams)
+		}
+	}
+
+	clearResp := putSamplingPreset(t, handler, user, `{"modelId":"openrouter/free","mode":"chat","params":{}}`)
+	if clearResp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", clearResp.Code, clearResp.Body.String())
+	}
+	decodeJSONBody(t, clearResp, &presetBody)
+	if len(presetBody.SamplingPresets) != 0 {
+		t.Fatalf("expected empty params to clear the preset, got %+v", presetBody.SamplingPresets)
+	}
+}
+
+func TestSamplingParamsAreValidatedAgainstModel(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{tokens: []string{"unused"}})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["temperature"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("set supported parameters: %v", err)
+	}
+
+	tests := map[string]struct {
+		body string
+		want string
+	}{
+		"unsupported parameter": {`{"message":"Hi","modelId":"openrouter/free","sampling":{"seed":1,"presencePenalty":0.5}}`, "seed, presence_penalty"},
+		"out of range":          {`{"message":"Hi","modelId":"openrouter/free","sampling":{"temperature":3}}`, "temperature must be between 0 and 2"},
+		"empty stop sequence":   {`{"message":"Hi","modelId":"openrouter/free","sampling":{"stop":[""]}}`, "stop sequences"},
+	}
+	for name, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(tc.body))
+		req = requestWithSessionUser(req, user)
+		resp := httptest.NewRecorder()
+		handler.ChatMessages(resp, req)
+		if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), tc.want) {
+			t.Fatalf("%s: expected 400 mentioning %q, got %d body=%s", name, tc.want, resp.Code, resp.Body.String())
+		}
+	}
+
+	presetResp := putSamplingPreset(t, handler, user, `{"modelId":"openrouter/free","mode":"deep_research","params":{"topP":0.5}}`)
+	if presetResp.Code != http.StatusBadRequest || !strings.Contains(presetResp.Body.String(), "top_p") {
+		t.Fatalf("expected unsupported preset to be rejected, got %d body=%s", presetResp.Code, presetResp.Body.String())
+	}
+}
@@ -0,0 +1,210 @@
+package httpapi
+
+import (
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultSearchLimit    = 20
+	maxSearchLimit        = 50
+	maxSearchQueryRunes   = 256
+	maxSearchQueryTerms   = 16
+	searchSnippetTokens   = 16
+	searchHighlightOpen   = "<mark>"
+	searchHighlightClose  = "</mark>"
+	searchSnippetEllipsis = "…"
+	// FTS5 marks matches with control characters so the stored text can be
+	// HTML-escaped before the real <mark> tags go in.
+	searchMatchStart = "\x02"
+	searchMatchEnd   = "\x03"
+)
+
+type searchResultResponse struct {
+	Type              string `json:"type"`
+	ConversationID    string `json:"conversationId"`
+	ConversationTitle string `json:"conversationTitle"`
+	MessageID         string `json:"messageId,omitempty"`
+	FileID            string `json:"fileId,omitempty"`
+	Filename          string `json:"filename,omitempty"`
+	Role              string `json:"role,omitempty"`
+	Snippet           string `json:"snippet"`
+	CreatedAt         string `json:"createdAt"`
+}
+
+func (h Handler) Search(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUserFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid session")
+		return
+	}
+	user, err := h.persistedSessionUser(r.Context(), user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to resolve user")
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "q is required")
+		return
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryRunes {
+		writeError(w, http.StatusBadRequest, "invalid_request", "q is too long")
+		return
+	}
+	matchQuery := buildFTSMatchQuery(query)
+	if matchQuery == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "q must contain searchable text")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if rawLimit := strings.TrimSpace(r.URL.Query().Get("limit")); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid_request", "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxSearchLimit)
+	}
+
+	// bm25() is negative with better matches closer to -inf, so ascending rank
+	// puts the strongest hits first across all three indexes.
+	rows, err := h.db.QueryContext(r.Context(), `
+SELECT kind, conversation_id, conversation_title, message_id, file_id, filename, role, snippet, created_at
+FROM (
+  SELECT
+    'message' AS kind,
+    c.id AS conversation_id,
+    c.title AS conversation_title,
+    m.id AS message_id,
+    '' AS file_id,
+    '' AS filename,
+    m.role AS role,
+    snippet(messages_fts, 0, ?, ?, ?, ?) AS snippet,
+    bm25(messages_fts) AS rank,
+    m.created_at AS created_at
+  FROM messages_fts
+  JOIN messages m ON m.search_rowid = messages_fts.rowid
+  JOIN conversations c ON c.id = m.conversation_id
+  WHERE messages_fts MATCH ? AND c.user_id = ? AND m.role IN ('user', 'assistant')
+
+  UNION ALL
+
+  SELECT
+    'conversation',
+    c.id,
+    c.title,
+    '',
+    '',
+    '',
+    '',
+    highlight(conversations_fts, 0, ?, ?),
+    bm25(conversations_fts),
+    c.updated_at
+  FROM conversations_fts
+  JOIN conversations c ON c.search_rowid = conversations_fts.rowid
+  WHERE conversations_fts MATCH ? AND c.user_id = ?
+
+  UNION ALL
+
+  SELECT
+    'file',
+    c.id,
+    c.title,
+    m.id,
+    f.id,
+    f.filename,
+    m.role,
+    snippet(files_fts, 0, ?, ?, ?, ?),
+    bm25(files_fts),
+    m.created_at
+  FROM files_fts
+  JOIN files f ON f.search_rowid = files_fts.rowid
+  JOIN message_files mf ON mf.file_id = f.id
+  JOIN messages m ON m.id = mf.message_id
+  JOIN conversations c ON c.id = m.conversation_id
+  WHERE files_fts MATCH ? AND c.user_id = ? AND f.user_id = ?
+)
+ORDER BY rank ASC, created_at DESC
+LIMIT ?;
+`,
+		searchMatchStart, searchMatchEnd, searchSnippetEllipsis, searchSnippetTokens, matchQuery, user.ID,
+		searchMatchStart, searchMatchEnd, matchQuery, user.ID,
+		searchMatchStart, searchMatchEnd, searchSnippetEllipsis, searchSnippetTokens, matchQuery, user.ID, user.ID,
+		limit,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to search conversations")
+		return
+	}
+	defer rows.Close()
+
+	results := make([]searchResultResponse, 0, limit)
+	for rows.Next() {
+		var result searchResultResponse
+		if err := rows.Scan(
+			&result.Type,
+			&result.ConversationID,
+			&result.ConversationTitle,
+			&result.MessageID,
+			&result.FileID,
+			&result.Filename,
+			&result.Role,
+			&result.Snippet,
+			&result.CreatedAt,
+		); err != nil {
+			writeError(w, http.StatusInternalServerError, "db_error", "failed to parse search results")
+			return
+		}
+		result.Snippet = renderSearchSnippet(result.Snippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, "db_error", "failed to iterate search results")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
+
+// renderSearchSnippet HTML-escapes a snippet and turns the FTS5 match markers
+// into <mark> tags, so it is safe to render as HTML.
+func renderSearchSnippet(raw string) string {
+	return strings.NewReplacer(
+		searchMatchStart, searchHighlightOpen,
+		searchMatchEnd, searchHighlightClose,
+	).Replace(html.EscapeString(raw))
+}
+
+// buildFTSMatchQuery turns free-form user input into an FTS5 query that cannot
+// fail to parse: every term is quoted as a literal phrase, terms are ANDed, and
+// the last term is a prefix match so results update while typing.
+func buildFTSMatchQuery(input string) string {
+	fields := strings.Fields(input)
+	terms := make([]string, 0, min(len(fields), maxSearchQueryTerms))
+	for _, field := range fields {
+		cleaned := strings.TrimSpace(strings.ReplaceAll(field, `"`, ""))
+		if !strings.ContainsFunc(cleaned, isSearchableRune) {
+			continue
+		}
+		terms = append(terms, `"`+cleaned+`"`)
+		if len(terms) >= maxSearchQueryTerms {
+			break
+		}
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += "*"
+	return strings.Join(terms, " ")
+}
+
+func isSearchableRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
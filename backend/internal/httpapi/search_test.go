@@ -0,0 +1,238 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/session"
+)
+
+func TestSearchReturnsRankedHitsScopedToUser(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	owner := session.User{ID: "user-1"}
+	other := session.User{ID: "user-2"}
+	seedUser(t, db, owner.ID, "user1@example.com")
+	seedUser(t, db, other.ID, "user2@example.com")
+
+	ctx := context.Background()
+	ownerConversation, err := handler.insertConversation(ctx, owner.ID, "Sourdough planning")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	otherConversation, err := handler.insertConversation(ctx, other.ID, "Private sourdough notes")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	if err := handler.insertMessage(ctx, owner.ID, ownerConversation.ID, "user", "How long should the levain ferment?", "", true, false); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	if err := handler.insertMessage(ctx, owner.ID, ownerConversation.ID, "assistant", "Let the levain ferment for about eight hours.", "", true, false); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	if err := handler.insertMessage(ctx, other.ID, otherConversation.ID, "user", "My secret levain recipe", "", true, false); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+
+	results := searchAs(t, handler, owner, "levain")
+	if len(results) != 2 {
+		t.Fatalf("expected 2 message hits for owner, got %d: %+v", len(results), results)
+	}
+	for _, result := range results {
+		if result.ConversationID != ownerConversation.ID {
+			t.Fatalf("search leaked another user's conversation: %+v", result)
+		}
+		if result.Type != "message" || result.MessageID == "" {
+			t.Fatalf("expected message hit with message id, got %+v", result)
+		}
+		if !strings.Contains(result.Snippet, searchHighlightOpen+"levain"+searchHighlightClose) {
+			t.Fatalf("expected highlighted snippet, got %q", result.Snippet)
+		}
+	}
+
+	titleHits := searchAs(t, handler, owner, "sourd")
+	if len(titleHits) != 1 || titleHits[0].Type != "conversation" || titleHits[0].ConversationID != ownerConversation.ID {
+		t.Fatalf("expected prefix title hit for own conversation only, got %+v", titleHits)
+	}
+
+	if otherHits := searchAs(t, handler, other, "eight hours"); len(otherHits) != 0 {
+		t.Fatalf("expected no cross-user hits, got %+v", otherHits)
+	}
+}
+
+func TestSearchIndexTracksDeletesAndAttachments(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	ctx := context.Background()
+	conversation, err := handler.insertConversation(ctx, user.ID, "Quarterly report")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	if err := handler.insertMessage(ctx, user.ID, conversation.ID, "user", "Summarize the attachment", "", true, false); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	if err := handler.insertMessage(ctx, user.ID, conversation.ID, "assistant", "Revenue grew in the northeast region.", "", true, false); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	var userMessageID string
+	if err := db.QueryRow(`SELECT id FROM messages WHERE role = 'user' AND conversation_id = ?;`, conversation.ID).Scan(&userMessageID); err != nil {
+		t.Fatalf("query user message: %v", err)
+	}
+	if _, err := db.Exec(`
+INSERT INTO files (id, user_id, filename, media_type, size_bytes, storage_backend, storage_path, extracted_text)
+VALUES ('file-1', ?, 'report.md', 'text/markdown', 10, 'local', 'chat-uploads/users/user-1/file-1/report.md', 'Appendix: widget backlog by warehouse');
+`, user.ID); err != nil {
+		t.Fatalf("insert file: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO message_files (message_id, file_id) VALUES (?, 'file-1');`, userMessageID); err != nil {
+		t.Fatalf("link file: %v", err)
+	}
+
+	fileHits := searchAs(t, handler, user, "warehouse")
+	if len(fileHits) != 1 || fileHits[0].Type != "file" || fileHits[0].FileID != "file-1" || fileHits[0].MessageID != userMessageID {
+		t.Fatalf("expected attachment hit linked to the user message, got %+v", fileHits)
+	}
+
+	if _, err := db.Exec(`DELETE FROM messages WHERE role = 'assistant' AND conversation_id = ?;`, conversation.ID); err != nil {
+		t.Fatalf("delete assistant message: %v", err)
+	}
+	if hits := searchAs(t, handler, user, "revenue"); len(hits) != 0 {
+		t.Fatalf("expected deleted message to leave the index, got %+v", hits)
+	}
+
+	if _, err := db.Exec(`DELETE FROM conversations WHERE id = ?;`, conversation.ID); err != nil {
+		t.Fatalf("delete conversation: %v", err)
+	}
+	if hits := searchAs(t, handler, user, "summarize"); len(hits) != 0 {
+		t.Fatalf("expected cascaded message delete to leave the index, got %+v", hits)
+	}
+	if hits := searchAs(t, handler, user, "quarterly"); len(hits) != 0 {
+		t.Fatalf("expected deleted conversation title to leave the index, got %+v", hits)
+	}
+}
+
+func TestSearchIndexSurvivesVacuum(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	ctx := context.Background()
+	deleted, err := handler.insertConversation(ctx, user.ID, "Alpine hiking")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	if err := handler.insertMessage(ctx, user.ID, deleted.ID, "user", "Which huts stay open in October?", "", true, false); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	kept, err := handler.insertConversation(ctx, user.ID, "Bread baking")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	if err := handler.insertMessage(ctx, user.ID, kept.ID, "user", "How hot should the dutch oven be?", "", true, false); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM conversations WHERE id = ?;`, deleted.ID); err != nil {
+		t.Fatalf("delete conversation: %v", err)
+	}
+	if _, err := db.Exec(`VACUUM;`); err != nil {
+		t.Fatalf("vacuum: %v", err)
+	}
+
+	if hits := searchAs(t, handler, user, "dutch oven"); len(hits) != 1 || hits[0].ConversationID != kept.ID || !strings.Contains(hits[0].Snippet, "dutch") {
+		t.Fatalf("expected the kept message after vacuum, got %+v", hits)
+	}
+	if hits := searchAs(t, handler, user, "bread"); len(hits) != 1 || hits[0].Type != "conversation" || hits[0].ConversationID != kept.ID {
+		t.Fatalf("expected the kept title after vacuum, got %+v", hits)
+	}
+
+	if err := handler.insertMessage(ctx, user.ID, kept.ID, "assistant", "Preheat the dutch oven to 250C.", "", true, false); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	if hits := searchAs(t, handler, user, "preheat"); len(hits) != 1 || hits[0].ConversationID != kept.ID {
+		t.Fatalf("expected messages inserted after vacuum to be indexed, got %+v", hits)
+	}
+}
+
+func TestSearchEscapesSnippetHTML(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	ctx := context.Background()
+	conversation, err := handler.insertConversation(ctx, user.ID, "Markup")
+	if err != nil {
+		t.Fatalf("insert conversation: %v", err)
+	}
+	if err := handler.insertMessage(ctx, user.ID, conversation.ID, "assistant", `<img src=x onerror="alert(1)"> payload`, "", true, false); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+
+	hits := searchAs(t, handler, user, "payload")
+	if len(hits) != 1 {
+		t.Fatalf("expected one hit, got %+v", hits)
+	}
+	want := `&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>payload</mark>`
+	if hits[0].Snippet != want {
+		t.Fatalf("expected escaped snippet %q, got %q", want, hits[0].Snippet)
+	}
+}
+
+func TestSearchRejectsInvalidQueries(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	for _, rawQuery := range []string{"", "q=", "q=%22%28%29", "q=ok&limit=0", "q=ok&limit=abc"} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/search?"+rawQuery, nil)
+		req = requestWithSessionUser(req, user)
+		resp := httptest.NewRecorder()
+
+		handler.Search(resp, req)
+
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d (%s)", rawQuery, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestBuildFTSMatchQueryQuotesTerms(t *testing.T) {
+	got := buildFTSMatchQuery(`levain AND "ferment OR NEAR(`)
+	want := `"levain" "AND" "ferment" "OR" "NEAR("*`
+	if got != want {
+		t.Fatalf("unexpected match query:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func searchAs(t *testing.T, handler Handler, user session.User, query string) []searchResultResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/search?q="+url.QueryEscape(query), nil)
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+
+	handler.Search(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, resp.Code, resp.Body.String())
+	}
+	var payload struct {
+		Results []searchResultResponse `json:"results"`
+	}
+	decodeJSONBody(t, resp, &payload)
+	return payload.Results
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
@@ -61,6 +62,25 @@ func (s *gcsObjectStore) PutObject(ctx context.Context, objectPath, contentType
 	return nil
 }
 
+func (s *gcsObjectStore) GetObject(ctx context.Context, objectPath string) ([]byte, error) {
+	cleanPath := strings.Trim(strings.TrimSpace(objectPath), "/")
+	if cleanPath == "" {
+		return nil, errors.New("object path is required")
+	}
+
+	resp, err := s.service.Objects.Get(s.bucketName, cleanPath).Context(ctx).Download()
+	if err != nil {
+		return nil, fmt.Errorf("read gcs object %q: %w", cleanPath, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read gcs object %q: %w", cleanPath, err)
+	}
+	return data, nil
+}
+
 func (s *gcsObjectStore) DeleteObject(ctx context.Context, objectPath string) error {
 	cleanPath := strings.Trim(strings.TrimSpace(objectPath), "/")
 	if cleanPath == "" {
@@ -0,0 +1,198 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	localObjectDirMode  = 0o750
+	localObjectFileMode = 0o640
+)
+
+var errInvalidObjectPath = errors.New("invalid object path")
+
+type localObjectStore struct {
+	rootDir string
+	fsync   bool
+}
+
+func newLocalObjectStore(rootDir string, fsync bool) (*localObjectStore, error) {
+	trimmedRoot := strings.TrimSpace(rootDir)
+	if trimmedRoot == "" {
+		return nil, errors.New("local upload dir is required")
+	}
+
+	absRoot, err := filepath.Abs(trimmedRoot)
+	if err != nil {
+		return nil, fmt.Errorf("resolve local upload dir: %w", err)
+	}
+	if err := os.MkdirAll(absRoot, localObjectDirMode); err != nil {
+		return nil, fmt.Errorf("create local upload dir: %w", err)
+	}
+
+	return &localObjectStore{rootDir: absRoot, fsync: fsync}, nil
+}
+
+func (s *localObjectStore) Backend() string {
+	return "local"
+}
+
+func (s *localObjectStore) PutObject(ctx context.Context, objectPath, _ string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	target, err := s.resolvePath(objectPath)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, localObjectDirMode); err != nil {
+		return fmt.Errorf("create local object dir %q: %w", objectPath, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("create local temp object %q: %w", objectPath, err)
+	}
+	tmpName := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tmp.Close()
+			_ = os.Remove(tmpName)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("write local object %q: %w", objectPath, err)
+	}
+	if s.fsync {
+		if err := tmp.Sync(); err != nil {
+			return fmt.Errorf("sync local object %q: %w", objectPath, err)
+		}
+	}
+	if err := tmp.Chmod(localObjectFileMode); err != nil {
+		return fmt.Errorf("chmod local object %q: %w", objectPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close local object %q: %w", objectPath, err)
+	}
+	if err := os.Rename(tmpName, target); err != nil {
+		return fmt.Errorf("commit local object %q: %w", objectPath, err)
+	}
+	committed = true
+
+	if s.fsync {
+		if err := syncDir(dir); err != nil {
+			return fmt.Errorf("sync local object dir %q: %w", objectPath, err)
+		}
+	}
+	return nil
+}
+
+func (s *localObjectStore) GetObject(ctx context.Context, objectPath string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	target, err := s.resolvePath(objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return nil, fmt.Errorf("read local object %q: %w", objectPath, err)
+	}
+	return data, nil
+}
+
+func (s *localObjectStore) DeleteObject(ctx context.Context, objectPath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if strings.Trim(strings.TrimSpace(objectPath), "/") == "" {
+		return nil
+	}
+
+	target, err := s.resolvePath(objectPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete local object %q: %w", objectPath, err)
+	}
+
+	// Prune the now-empty per-file and per-user directories; os.Remove refuses
+	// non-empty directories, so this stops at the first one still in use.
+	for dir := filepath.Dir(target); dir != s.rootDir && strings.HasPrefix(dir, s.rootDir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// resolvePath maps an object path onto the upload root. Paths of the form
+// <prefix>/users/<userID>/... are sharded as <prefix>/users/<shard>/<userID>/...
+// so a single directory never holds every user.
+func (s *localObjectStore) resolvePath(objectPath string) (string, error) {
+	cleanPath := strings.Trim(strings.TrimSpace(objectPath), "/")
+	if cleanPath == "" {
+		return "", fmt.Errorf("%w: object path is required", errInvalidObjectPath)
+	}
+	if strings.Contains(cleanPath, "\\") || strings.ContainsRune(cleanPath, 0) {
+		return "", fmt.Errorf("%w: %q", errInvalidObjectPath, objectPath)
+	}
+
+	segments := strings.Split(cleanPath, "/")
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("%w: %q", errInvalidObjectPath, objectPath)
+		}
+	}
+
+	for i := 0; i+2 < len(segments); i++ {
+		if segments[i] != "users" {
+			continue
+		}
+		sharded := make([]string, 0, len(segments)+1)
+		sharded = append(sharded, segments[:i+1]...)
+		sharded = append(sharded, userShard(segments[i+1]))
+		sharded = append(sharded, segments[i+1:]...)
+		segments = sharded
+		break
+	}
+
+	target := filepath.Join(s.rootDir, filepath.FromSlash(path.Join(segments...)))
+	rel, err := filepath.Rel(s.rootDir, target)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%w: %q", errInvalidObjectPath, objectPath)
+	}
+	return target, nil
+}
+
+func userShard(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:1])
+}
+
+func syncDir(dir string) error {
+	handle, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	return handle.Sync()
+}
@@ -0,0 +1,143 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"chat/backend/internal/session"
+)
+
+func TestLocalObjectStorePutAndDeleteShardsByUser(t *testing.T) {
+	root := t.TempDir()
+	store, err := newLocalObjectStore(root, true)
+	if err != nil {
+		t.Fatalf("new local store: %v", err)
+	}
+
+	objectPath := "chat-uploads/users/user-1/file-1/notes.md"
+	if err := store.PutObject(context.Background(), objectPath, "text/markdown", []byte("hello")); err != nil {
+		t.Fatalf("put object: %v", err)
+	}
+
+	diskPath := filepath.Join(root, "chat-uploads", "users", userShard("user-1"), "user-1", "file-1", "notes.md")
+	data, err := os.ReadFile(diskPath)
+	if err != nil {
+		t.Fatalf("read stored object: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("unexpected stored content: %q", data)
+	}
+	if read, err := store.GetObject(context.Background(), objectPath); err != nil || string(read) != "hello" {
+		t.Fatalf("get object = %q, %v", read, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(diskPath))
+	if err != nil {
+		t.Fatalf("read object dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected temp files to be cleaned up, found %d entries", len(entries))
+	}
+
+	if err := store.DeleteObject(context.Background(), objectPath); err != nil {
+		t.Fatalf("delete object: %v", err)
+	}
+	if _, err := os.Stat(diskPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected object to be removed, stat err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(diskPath)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected empty file dir to be pruned, stat err=%v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Fatalf("expected upload root to remain: %v", err)
+	}
+
+	if err := store.DeleteObject(context.Background(), objectPath); err != nil {
+		t.Fatalf("expected deleting a missing object to succeed, got %v", err)
+	}
+}
+
+func TestLocalObjectStoreRejectsPathTraversal(t *testing.T) {
+	store, err := newLocalObjectStore(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("new local store: %v", err)
+	}
+
+	for _, objectPath := range []string{
+		"../escape.txt",
+		"chat-uploads/users/../../escape.txt",
+		"chat-uploads/users/user-1/file-1/..",
+		`chat-uploads\..\escape.txt`,
+		"",
+	} {
+		err := store.PutObject(context.Background(), objectPath, "text/plain", []byte("x"))
+		if !errors.Is(err, errInvalidObjectPath) {
+			t.Fatalf("expected invalid path error for %q, got %v", objectPath, err)
+		}
+	}
+}
+
+func TestUploadFileStoresBlobOnLocalDisk(t *testing.T) {
+	root := t.TempDir()
+	store, err := newLocalObjectStore(root, false)
+	if err != nil {
+		t.Fatalf("new local store: %v", err)
+	}
+	handler, db := newTestHandlerWithFileStore(t, stubStreamer{}, store)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "notes.txt")
+	if err != nil {
+		t.Fatalf("create multipart form file: %v", err)
+	}
+	if _, err := part.Write([]byte("local attachment")); err != nil {
+		t.Fatalf("write multipart payload: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", &body)
+	req = requestWithSessionUser(req, user)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp := httptest.NewRecorder()
+
+	handler.UploadFile(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusCreated, resp.Code, resp.Body.String())
+	}
+
+	var storageBackend string
+	var storagePath string
+	if err := db.QueryRow(`SELECT storage_backend, storage_path FROM files WHERE user_id = ?;`, user.ID).Scan(&storageBackend, &storagePath); err != nil {
+		t.Fatalf("query file metadata: %v", err)
+	}
+	if storageBackend != "local" {
+		t.Fatalf("unexpected storage backend: %s", storageBackend)
+	}
+
+	diskPath, err := store.resolvePath(storagePath)
+	if err != nil {
+		t.Fatalf("resolve stored path: %v", err)
+	}
+	data, err := os.ReadFile(diskPath)
+	if err != nil {
+		t.Fatalf("read stored blob: %v", err)
+	}
+	if string(data) != "local attachment" {
+		t.Fatalf("unexpected stored blob: %q", data)
+	}
+}
@@ -0,0 +1,338 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/research"
+)
+
+const structuredOutputRepairTimeout = 30 * time.Second
+
+var (
+	errInvalidResponseFormat = errors.New("invalid responseFormat")
+	schemaNamePattern        = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+type responseFormatRequest struct {
+	Type       string                   `json:"type"`
+	JSONSchema *jsonSchemaFormatRequest `json:"jsonSchema"`
+}
+
+type jsonSchemaFormatRequest struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict"`
+}
+
+// structuredOutputSpec is a validated responseFormat. native is format when
+// the requested model supports it, and is sent to the provider; otherwise the
+// prompt asks for JSON. The reply is checked against schema either way.
+type structuredOutputSpec struct {
+	format    *openrouter.ResponseFormat
+	native    *openrouter.ResponseFormat
+	schema    map[string]any
+	rawSchema json.RawMessage
+}
+
+// resolveResponseFormat validates the request's responseFormat and decides
+// whether the model can enforce it. A nil request yields a nil spec.
+func (h Handler) resolveResponseFormat(ctx context.Context, modelID string, req *responseFormatRequest) (*structuredOutputSpec, error) {
+	if req == nil {
+		return nil, nil
+	}
+
+	format := &openrouter.ResponseFormat{Type: strings.TrimSpace(req.Type)}
+	spec := &structuredOutputSpec{format: format}
+	switch format.Type {
+	case "json_object":
+	case "json_schema":
+		if req.JSONSchema == nil || len(bytes.TrimSpace(req.JSONSchema.Schema)) == 0 {
+			return nil, fmt.Errorf("%w: jsonSchema.schema is required for json_schema", errInvalidResponseFormat)
+		}
+		name := fallback(req.JSONSchema.Name, "response")
+		if !schemaNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%w: jsonSchema.name must be 1-64 letters, digits, underscores or dashes", errInvalidResponseFormat)
+		}
+		var schema map[string]any
+		if err := json.Unmarshal(req.JSONSchema.Schema, &schema); err != nil || schema == nil {
+			return nil, fmt.Errorf("%w: jsonSchema.schema must be a JSON object", errInvalidResponseFormat)
+		}
+		if schemaType, ok := schema["type"]; ok && schemaType != "object" {
+			return nil, fmt.Errorf("%w: jsonSchema.schema must describe an object", errInvalidResponseFormat)
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, req.JSONSchema.Schema); err != nil {
+			return nil, fmt.Errorf("%w: jsonSchema.schema must be a JSON object", errInvalidResponseFormat)
+		}
+		spec.schema = schema
+		spec.rawSchema = compact.Bytes()
+		format.JSONSchema = &openrouter.JSONSchemaFormat{
+			Name:   name,
+			Strict: req.JSONSchema.Strict,
+			Schema: spec.rawSchema,
+		}
+	default:
+		return nil, fmt.Errorf("%w: type must be one of: json_object, json_schema", errInvalidResponseFormat)
+	}
+
+	supported, err := h.modelSupportedParameters(ctx, modelID)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(supported, responseFormatParameter(format)) {
+		spec.native = format
+	}
+	return spec, nil
+}
+
+// responseFormatParameter is the supported_parameters entry a model must list
+// to enforce format itself.
+func responseFormatParameter(format *openrouter.ResponseFormat) string {
+	if format.JSONSchema != nil {
+		return "structured_outputs"
+	}
+	return "response_format"
+}
+
+// prompt is the system message used when the model cannot enforce the format
+// itself.
+func (s *structuredOutputSpec) prompt() string {
+	prompt := "Reply with a single JSON object and nothing else: no prose before or after it and no markdown code fences."
+	if len(s.rawSchema) > 0 {
+		prompt += " The object must match this JSON schema:\n" + string(s.rawSchema)
+	}
+	return prompt
+}
+
+// parse extracts the JSON object from a reply and checks it against the
+// schema, returning it compacted.
+func (s *structuredOutputSpec) parse(reply string) (json.RawMessage, error) {
+	raw := research.ExtractJSONBlock(reply)
+	if raw == "" {
+		return nil, errors.New("reply did not include a JSON object")
+	}
+	var value any
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return nil, fmt.Errorf("reply is not valid JSON: %w", err)
+	}
+	if s.schema != nil {
+		if err := validateJSONSchema(s.schema, value, "$"); err != nil {
+			return nil, err
+		}
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(raw)); err != nil {
+		return nil, err
+	}
+	return compact.Bytes(), nil
+}
+
+// resolveStructuredOutput validates reply and, if it does not parse or match
+// the schema, asks the model once to repair it. modelID is the model that
+// answered, which may be a fallback, so the native format is sent only when
+// that model supports it. repaired reports whether the returned JSON came
+// from that second request.
+func (h Handler) resolveStructuredOutput(ctx context.Context, modelID string, spec *structuredOutputSpec, reply string) (json.RawMessage, bool, error) {
+	output, err := spec.parse(reply)
+	if err == nil {
+		return output, false, nil
+	}
+
+	repairCtx, cancel := context.WithTimeout(ctx, structuredOutputRepairTimeout)
+	defer cancel()
+	var repairedReply strings.Builder
+	instructions := "You fix JSON. Rewrite the reply below as a single JSON object that keeps its content. Reply with the JSON object only."
+	if len(spec.rawSchema) > 0 {
+		instructions += " The object must match this JSON schema:\n" + string(spec.rawSchema)
+	}
+	var native *openrouter.ResponseFormat
+	if supported, lookupErr := h.modelSupportedParameters(ctx, modelID); lookupErr != nil {
+		log.Printf("structured output repair model lookup failed: model_id=%s err=%v", modelID, lookupErr)
+	} else if slices.Contains(supported, responseFormatParameter(spec.format)) {
+		native = spec.format
+	}
+	repairErr := h.openrouter.StreamChatCompletion(
+		repairCtx,
+		openrouter.StreamRequest{
+			Model: modelID,
+			Messages: []openrouter.Message{
+				{Role: "system", Content: instructions},
+				{Role: "user", Content: "Reply:\n" + reply + "\n\nProblem: " + err.Error()},
+			},
+			ResponseFormat: native,
+		},
+		nil,
+		func(delta string) error {
+			repairedReply.WriteString(delta)
+			return nil
+		},
+		nil,
+		nil,
+	)
+	if repairErr != nil {
+		log.Printf("structured output repair failed: model_id=%s err=%v", modelID, repairErr)
+		return nil, false, err
+	}
+	output, err = spec.parse(repairedReply.String())
+	if err != nil {
+		return nil, false, err
+	}
+	return output, true, nil
+}
+
+// finishStructuredOutput validates a persisted reply against the requested
+// format, stores the JSON and sends a structured_output event, or a warning
+// when even the repaired reply does not match.
+func (h Handler) finishStructuredOutput(ctx context.Context, stream *generationStream, spec *structuredOutputSpec, modelID, messageID, reply string) {
+	output, repaired, err := h.resolveStructuredOutput(ctx, modelID, spec, reply)
+	if err != nil {
+		_ = stream.send(map[string]any{
+			"type":    "warning",
+			"scope":   "structured_output",
+			"message": "Reply did not match the requested format: " + err.Error(),
+		})
+		return
+	}
+	if err := h.persistStructuredOutput(context.WithoutCancel(ctx), messageID, output); err != nil {
+		log.Printf("structured output persist failed: message_id=%s err=%v", messageID, err)
+		_ = stream.send(map[string]any{
+			"type":    "error",
+			"message": "failed to persist structured output",
+		})
+		return
+	}
+	_ = stream.send(map[string]any{
+		"type":             "structured_output",
+		"messageId":        messageID,
+		"structuredOutput": output,
+		"repaired":         repaired,
+	})
+}
+
+func (h Handler) persistStructuredOutput(ctx context.Context, messageID string, output json.RawMessage) error {
+	_, err := h.db.ExecContext(ctx, `
+UPDATE messages
+SET structured_output_json = ?
+WHERE id = ?;
+`, string(output), messageID)
+	return err
+}
+
+// validateJSONSchema checks value against the subset of JSON Schema that
+// structured output schemas use in practice: type, enum, const, properties,
+// required, additionalProperties and items. Other keywords are ignored.
+func validateJSONSchema(schema map[string]any, value any, path string) error {
+	if rawType, ok := schema["type"]; ok {
+		var allowed []string
+		switch typed := rawType.(type) {
+		case string:
+			allowed = []string{typed}
+		case []any:
+			for _, item := range typed {
+				if name, ok := item.(string); ok {
+					allowed = append(allowed, name)
+				}
+			}
+		}
+		if len(allowed) > 0 && !slices.ContainsFunc(allowed, func(name string) bool { return jsonValueHasType(value, name) }) {
+			return fmt.Errorf("%s must be %s", path, strings.Join(allowed, " or "))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(candidate any) bool { return reflect.DeepEqual(candidate, value) }) {
+			return fmt.Errorf("%s must be one of the allowed values", path)
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		return fmt.Errorf("%s must equal the schema's const value", path)
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, item := range required {
+				name, _ := item.(string)
+				if _, present := typed[name]; name != "" && !present {
+					return fmt.Errorf("%s.%s is required", path, name)
+				}
+			}
+		}
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if propertySchema, ok := properties[key].(map[string]any); ok {
+				if err := validateJSONSchema(propertySchema, typed[key], path+"."+key); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, declared := properties[key]; declared {
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s.%s is not allowed", path, key)
+				}
+			case map[string]any:
+				if err := validateJSONSchema(additional, typed[key], path+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range typed {
+				if err := validateJSONSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func jsonValueHasType(value any, name string) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	default:
+		return true
+	}
+}
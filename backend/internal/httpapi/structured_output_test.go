@@ -0,0 +1,228 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+const answerSchemaRequest = `"responseFormat":{"type":"json_schema","jsonSchema":{"name":"answer","strict":true,"schema":{"type":"object","properties":{"answer":{"type":"string"},"confidence":{"type":"number"}},"required":["answer"],"additionalProperties":false}}}`
+
+// repairingStreamer answers repair requests with repairTokens and everything
+// else with the embedded stub's tokens.
+type repairingStreamer struct {
+	stubStreamer
+	repairTokens   []string
+	repairRequests *[]openrouter.StreamRequest
+}
+
+func (s repairingStreamer) StreamChatCompletion(ctx context.Context, req openrouter.StreamRequest, onStart func() error, onDelta func(string) error, onReasoning func(string) error, onUsage func(openrouter.Usage) error) error {
+	if len(req.Messages) > 0 && strings.HasPrefix(req.Messages[0].Content, "You fix JSON.") {
+		*s.repairRequests = append(*s.repairRequests, req)
+		s.stubStreamer.tokens = s.repairTokens
+	}
+	return s.stubStreamer.StreamChatCompletion(ctx, req, onStart, onDelta, onReasoning, onUsage)
+}
+
+func findSSEEvent(events []sseEvent, eventType string) *sseEvent {
+	for i := range events {
+		if events[i].Type == eventType {
+			return &events[i]
+		}
+	}
+	return nil
+}
+
+func TestChatMessagesForwardsResponseFormatToSupportingModels(t *testing.T) {
+	var generationRequests []openrouter.StreamRequest
+	streamer := stubStreamer{
+		tokens: []string{`{"answer":"Paris",`, ` "confidence": 0.9}`},
+		onRequest: func(req openrouter.StreamRequest) {
+			generationRequests = append(generationRequests, req)
+		},
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["response_format","structured_outputs"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("set supported parameters: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Capital of France?","modelId":"openrouter/free","grounding":false,`+answerSchemaRequest+`}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	generationRequests = filterGenerationRequests(generationRequests)
+	if len(generationRequests) != 1 {
+		t.Fatalf("expected one generation request, got %d", len(generationRequests))
+	}
+	format := generationRequests[0].ResponseFormat
+	if format == nil || format.Type != "json_schema" || format.JSONSchema == nil || format.JSONSchema.Name != "answer" || !format.JSONSchema.Strict {
+		t.Fatalf("expected the json schema to be forwarded, got %+v", format)
+	}
+	for _, message := range generationRequests[0].Messages {
+		if strings.Contains(message.Content, "Reply with a single JSON object") {
+			t.Fatalf("expected no prompt-based JSON instructions for a supporting model")
+		}
+	}
+
+	event := findSSEEvent(decodeSSEEvents(t, resp.Body.String()), "structured_output")
+	if event == nil || event.Data["repaired"] != false {
+		t.Fatalf("expected an unrepaired structured_output event, got %+v", event)
+	}
+	output, _ := event.Data["structuredOutput"].(map[string]any)
+	if output["answer"] != "Paris" {
+		t.Fatalf("unexpected structured output: %+v", event.Data)
+	}
+
+	var conversationID string
+	if err := db.QueryRow(`SELECT id FROM conversations LIMIT 1;`).Scan(&conversationID); err != nil {
+		t.Fatalf("query conversation: %v", err)
+	}
+	messages := listMessagesAs(t, handler, user, conversationID, "").Messages
+	if got := string(messages[len(messages)-1].StructuredOutput); got != `{"answer":"Paris","confidence":0.9}` {
+		t.Fatalf("expected persisted structured output, got %q", got)
+	}
+}
+
+func TestChatMessagesRepairsPromptedJSONOnce(t *testing.T) {
+	var generationRequests []openrouter.StreamRequest
+	var repairRequests []openrouter.StreamRequest
+	streamer := repairingStreamer{
+		stubStreamer: stubStreamer{
+			tokens: []string{"Sure! Here it is:\n```json\n", `{"answer": 42}`, "\n```"},
+			onRequest: func(req openrouter.StreamRequest) {
+				generationRequests = append(generationRequests, req)
+			},
+		},
+		repairTokens:   []string{`{"answer":"42"}`},
+		repairRequests: &repairRequests,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"What is six times seven?","modelId":"openrouter/free","grounding":false,`+answerSchemaRequest+`}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	generation := generationRequests[0]
+	if generation.ResponseFormat != nil {
+		t.Fatalf("expected no response_format for a model without support, got %+v", generation.ResponseFormat)
+	}
+	prompted := false
+	for _, message := range generation.Messages {
+		if message.Role == "system" && strings.Contains(message.Content, `"required":["answer"]`) {
+			prompted = true
+		}
+	}
+	if !prompted {
+		t.Fatalf("expected the schema in a system prompt, got %+v", generation.Messages)
+	}
+
+	if len(repairRequests) != 1 || !strings.Contains(repairRequests[0].Messages[1].Content, "$.answer must be string") {
+		t.Fatalf("expected one repair request naming the problem, got %+v", repairRequests)
+	}
+	event := findSSEEvent(decodeSSEEvents(t, resp.Body.String()), "structured_output")
+	if event == nil || event.Data["repaired"] != true {
+		t.Fatalf("expected a repaired structured_output event, got %+v", event)
+	}
+
+	var content, structuredOutput string
+	if err := db.QueryRow(`SELECT content, structured_output_json FROM messages WHERE role = 'assistant';`).Scan(&content, &structuredOutput); err != nil {
+		t.Fatalf("query assistant message: %v", err)
+	}
+	if !strings.HasPrefix(content, "Sure!") || structuredOutput != `{"answer":"42"}` {
+		t.Fatalf("expected raw reply and repaired JSON to be stored side by side, got %q / %q", content, structuredOutput)
+	}
+}
+
+func TestStructuredOutputRepairUsesAnsweringModelsFormatSupport(t *testing.T) {
+	var repairRequests []openrouter.StreamRequest
+	streamer := repairingStreamer{
+		repairTokens:   []string{`{"answer":"42"}`},
+		repairRequests: &repairRequests,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	seedModel(t, db, "openrouter/free")
+	seedModel(t, db, "backup/plain")
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["response_format","structured_outputs"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("set supported parameters: %v", err)
+	}
+
+	ctx := context.Background()
+	request := &responseFormatRequest{Type: "json_object"}
+	nativeSpec, err := handler.resolveResponseFormat(ctx, "openrouter/free", request)
+	if err != nil || nativeSpec.native == nil {
+		t.Fatalf("expected a native format for the requested model, got %+v err=%v", nativeSpec, err)
+	}
+	if _, repaired, err := handler.resolveStructuredOutput(ctx, "backup/plain", nativeSpec, "not json"); err != nil || !repaired {
+		t.Fatalf("expected the reply to be repaired, got repaired=%v err=%v", repaired, err)
+	}
+	promptedSpec, err := handler.resolveResponseFormat(ctx, "backup/plain", request)
+	if err != nil || promptedSpec.native != nil {
+		t.Fatalf("expected a prompted format for the plain model, got %+v err=%v", promptedSpec, err)
+	}
+	if _, repaired, err := handler.resolveStructuredOutput(ctx, "openrouter/free", promptedSpec, "not json"); err != nil || !repaired {
+		t.Fatalf("expected the reply to be repaired, got repaired=%v err=%v", repaired, err)
+	}
+
+	if len(repairRequests) != 2 {
+		t.Fatalf("expected two repair requests, got %d", len(repairRequests))
+	}
+	if repairRequests[0].Model != "backup/plain" || repairRequests[0].ResponseFormat != nil {
+		t.Fatalf("expected no response_format for a fallback without support, got %+v", repairRequests[0])
+	}
+	if repairRequests[1].Model != "openrouter/free" || repairRequests[1].ResponseFormat == nil || repairRequests[1].ResponseFormat.Type != "json_object" {
+		t.Fatalf("expected response_format for a fallback with support, got %+v", repairRequests[1])
+	}
+}
+
+func TestChatMessagesRejectsInvalidResponseFormat(t *testing.T) {
+	handler, db := newTestHandler(t, stubStreamer{tokens: []string{"unused"}})
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	tests := map[string]struct {
+		body string
+		want string
+	}{
+		"unknown type":    {`{"message":"Hi","responseFormat":{"type":"xml"}}`, "type must be one of"},
+		"missing schema":  {`{"message":"Hi","responseFormat":{"type":"json_schema"}}`, "jsonSchema.schema is required"},
+		"non-object root": {`{"message":"Hi","responseFormat":{"type":"json_schema","jsonSchema":{"schema":{"type":"array"}}}}`, "must describe an object"},
+		"deep research":   {`{"message":"Hi","deepResearch":true,"responseFormat":{"type":"json_object"}}`, "not supported with deep research"},
+	}
+	for name, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(tc.body))
+		req = requestWithSessionUser(req, user)
+		resp := httptest.NewRecorder()
+		handler.ChatMessages(resp, req)
+		if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), tc.want) {
+			t.Fatalf("%s: expected 400 mentioning %q, got %d body=%s", name, tc.want, resp.Code, resp.Body.String())
+		}
+	}
+}
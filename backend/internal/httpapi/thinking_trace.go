@@ -3,6 +3,7 @@ package httpapi
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 
 	"chat/backend/internal/research"
@@ -113,6 +114,14 @@ func (c *thinkingTraceCollector) MarkStopped(summary string) {
 	}
 }
 
+// fork copies the trace so far into a new collector, for replies that share
+// the same research but finish independently.
+func (c *thinkingTraceCollector) fork() *thinkingTraceCollector {
+	forked := &thinkingTraceCollector{trace: c.trace}
+	forked.trace.Entries = slices.Clone(c.trace.Entries)
+	return forked
+}
+
 func (c *thinkingTraceCollector) Snapshot() *thinkingTrace {
 	if c == nil {
 		return nil
@@ -0,0 +1,361 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/research"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxToolRounds bounds how many times one reply may stop to call tools;
+	// the round after that forbids tool calls so the model has to answer.
+	maxToolRounds      = 4
+	toolCallTimeout    = 20 * time.Second
+	maxToolResultRunes = 8000
+	// maxToolCitations caps the sources tools may add to one reply on top of
+	// the grounding citations.
+	maxToolCitations = 10
+)
+
+type toolCallingStreamer interface {
+	StreamChatCompletionWithTools(
+		ctx context.Context,
+		req openrouter.StreamRequest,
+		onStart func() error,
+		onDelta func(string) error,
+		onReasoning func(string) error,
+		onUsage func(openrouter.Usage) error,
+		onToolCalls func([]openrouter.ToolCall) error,
+	) error
+}
+
+// chatTool is a Go function the model can call during a chat reply. Run gets
+// the raw JSON arguments.
+type chatTool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+	Run         func(ctx context.Context, arguments json.RawMessage) (chatToolResult, error)
+}
+
+// chatToolResult is what a tool hands back. Citations are numbered after the
+// reply's existing sources and listed ahead of Content for the model; Progress,
+// when set, is recorded in the thinking trace.
+type chatToolResult struct {
+	Content   string
+	Citations []citationResponse
+	Progress  *research.Progress
+}
+
+type chatToolRegistry struct {
+	tools []chatTool
+}
+
+func newChatToolRegistry(tools ...chatTool) chatToolRegistry {
+	return chatToolRegistry{tools: tools}
+}
+
+func defaultChatTools() chatToolRegistry {
+	return newChatToolRegistry(currentTimeTool(time.Now))
+}
+
+func currentTimeTool(now func() time.Time) chatTool {
+	return chatTool{
+		Name:        "get_current_time",
+		Description: "Returns the current date and time in UTC.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{}}`),
+		Run: func(context.Context, json.RawMessage) (chatToolResult, error) {
+			return chatToolResult{Content: now().UTC().Format(time.RFC3339)}, nil
+		},
+	}
+}
+
+func (r chatToolRegistry) definitions() []openrouter.Tool {
+	definitions := make([]openrouter.Tool, 0, len(r.tools))
+	for _, tool := range r.tools {
+		definitions = append(definitions, openrouter.Tool{
+			Type: "function",
+			Function: openrouter.ToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return definitions
+}
+
+func (r chatToolRegistry) run(ctx context.Context, call openrouter.ToolCall) (chatToolResult, error) {
+	index := slices.IndexFunc(r.tools, func(tool chatTool) bool {
+		return tool.Name == call.Function.Name
+	})
+	if index == -1 {
+		return chatToolResult{}, fmt.Errorf("unknown tool %q", call.Function.Name)
+	}
+
+	arguments := strings.TrimSpace(call.Function.Arguments)
+	if arguments == "" {
+		arguments = "{}"
+	}
+	if !json.Valid([]byte(arguments)) {
+		return chatToolResult{}, errors.New("arguments are not valid JSON")
+	}
+
+	toolCtx, cancel := context.WithTimeout(ctx, toolCallTimeout)
+	defer cancel()
+	return r.tools[index].Run(toolCtx, json.RawMessage(arguments))
+}
+
+// chatToolsFor returns the registered tools plus, when grounding is on, the
+// web tools backed by the grounding searcher and the research reader.
+func (h Handler) chatToolsFor(grounding bool) chatToolRegistry {
+	if !grounding {
+		return h.tools
+	}
+	tools := slices.Clone(h.tools.tools)
+	if h.grounding != nil {
+		tools = append(tools, webSearchTool(h.grounding))
+	}
+	if h.researchReader != nil {
+		tools = append(tools, fetchURLTool(h.researchReader))
+	}
+	return newChatToolRegistry(tools...)
+}
+
+// modelAcceptsTools reports whether modelID can be offered tools through the
+// tool-calling client.
+func (h Handler) modelAcceptsTools(ctx context.Context, modelID string) bool {
+	if h.toolStreamer == nil {
+		return false
+	}
+	supported, err := h.modelSupportedParameters(ctx, modelID)
+	if err != nil {
+		log.Printf("tool support lookup failed: model_id=%s err=%v", modelID, err)
+		return false
+	}
+	return slices.Contains(supported, "tools")
+}
+
+// streamWithTools streams req and, whenever the model stops to call tools,
+// runs them and streams again with the results appended. Text from every
+// round goes through onDelta, so the reply reads as one message. citations
+// are the sources already numbered in the prompt; the returned slice extends
+// them with the sources tools found. Each round falls back to the configured
+// models when it fails before its first token; later rounds stay on the model
+// that answered. onUsage receives the running total across rounds.
+func (h Handler) streamWithTools(
+	ctx context.Context,
+	stream *generationStream,
+	input chatStreamInput,
+	req openrouter.StreamRequest,
+	citations []citationResponse,
+	onProgress func(research.Progress),
+	onStart func() error,
+	onDelta func(string) error,
+	onReasoning func(string) error,
+	onUsage func(openrouter.Usage) error,
+	onFallback func(failedModelID, nextModelID string),
+) ([]citationResponse, error) {
+	registry := h.chatToolsFor(input.Grounding)
+	if len(registry.tools) == 0 || !h.modelAcceptsTools(ctx, req.Model) {
+		_, err := h.streamWithModelFallback(ctx, req, onDelta, onReasoning, onFallback, func(req openrouter.StreamRequest, onDelta, onReasoning func(string) error) error {
+			return h.openrouter.StreamChatCompletion(ctx, req, onStart, onDelta, onReasoning, onUsage)
+		})
+		return citations, err
+	}
+	tools := registry.definitions()
+	citationLimit := len(citations) + maxToolCitations
+
+	var totalUsage openrouter.Usage
+	onRoundUsage := func(usage openrouter.Usage) error {
+		totalUsage = addOpenRouterUsage(totalUsage, usage)
+		if onUsage == nil {
+			return nil
+		}
+		return onUsage(totalUsage)
+	}
+
+	messages := slices.Clone(req.Messages)
+	for round := 0; ; round++ {
+		roundReq := req
+		roundReq.Messages = messages
+		roundReq.Tools = tools
+		if round == maxToolRounds {
+			roundReq.ToolChoice = "none"
+		}
+
+		var roundContent strings.Builder
+		var toolCalls []openrouter.ToolCall
+		modelID, err := h.streamWithModelFallback(ctx, roundReq, onDelta, onReasoning, onFallback, func(roundReq openrouter.StreamRequest, onDelta, onReasoning func(string) error) error {
+			toolCalls = nil
+			return h.toolStreamer.StreamChatCompletionWithTools(
+				ctx,
+				roundReq,
+				onStart,
+				func(delta string) error {
+					roundContent.WriteString(delta)
+					return onDelta(delta)
+				},
+				onReasoning,
+				onRoundUsage,
+				func(calls []openrouter.ToolCall) error {
+					toolCalls = calls
+					return nil
+				},
+			)
+		})
+		req.Model = modelID
+		if err != nil || len(toolCalls) == 0 || round == maxToolRounds {
+			return citations, err
+		}
+
+		messages = append(messages, openrouter.Message{
+			Role:      "assistant",
+			Content:   roundContent.String(),
+			ToolCalls: toolCalls,
+		})
+		for _, call := range toolCalls {
+			result, err := registry.run(ctx, call)
+			var content string
+			if err != nil {
+				log.Printf("tool call failed: conversation_id=%s tool=%s err=%v", input.ConversationID, call.Function.Name, err)
+				content = "Tool error: " + err.Error()
+			} else {
+				content, citations = formatToolResult(result, citations, citationLimit)
+				if result.Progress != nil && onProgress != nil {
+					onProgress(*result.Progress)
+				}
+			}
+			messages = append(messages, h.recordToolCall(ctx, stream, input, call, content, err == nil))
+		}
+	}
+}
+
+// formatToolResult renders result for the model. New sources are appended to
+// citations up to limit and labelled [n] by their position; sources already
+// cited keep their number, and any past the limit are listed unnumbered.
+func formatToolResult(result chatToolResult, citations []citationResponse, limit int) (string, []citationResponse) {
+	var builder strings.Builder
+	for _, citation := range result.Citations {
+		label := "-"
+		index := slices.IndexFunc(citations, func(existing citationResponse) bool {
+			return existing.URL == citation.URL
+		})
+		if index == -1 && len(citations) < limit {
+			citations = append(citations, citation)
+			index = len(citations) - 1
+		}
+		if index != -1 {
+			label = fmt.Sprintf("[%d]", index+1)
+		}
+
+		title := strings.TrimSpace(citation.Title)
+		if title == "" {
+			title = citation.URL
+		}
+		fmt.Fprintf(&builder, "%s %s\nURL: %s\n", label, title, citation.URL)
+		if snippet := strings.TrimSpace(citation.Snippet); snippet != "" && strings.TrimSpace(result.Content) == "" {
+			fmt.Fprintf(&builder, "Snippet: %s\n", snippet)
+		}
+		builder.WriteString("\n")
+	}
+	if len(result.Citations) > 0 {
+		builder.WriteString("Cite numbered sources as [n] where you use them.\n\n")
+	}
+	builder.WriteString(strings.TrimSpace(result.Content))
+	return strings.TrimSpace(builder.String()), citations
+}
+
+// recordToolCall persists a tool result and reports it to the client.
+// Failures are returned to the model as the tool result so it can recover
+// instead of ending the reply.
+func (h Handler) recordToolCall(ctx context.Context, stream *generationStream, input chatStreamInput, call openrouter.ToolCall, content string, succeeded bool) openrouter.Message {
+	status := "completed"
+	if !succeeded {
+		status = "failed"
+	}
+	content = trimToRunes(content, maxToolResultRunes)
+
+	if err := h.insertToolMessage(context.WithoutCancel(ctx), input.UserID, input.ConversationID, input.UserMessageID, call, content); err != nil {
+		log.Printf("tool result persist failed: conversation_id=%s tool=%s err=%v", input.ConversationID, call.Function.Name, err)
+	}
+
+	_ = stream.send(map[string]any{
+		"type":       "tool_call",
+		"toolCallId": call.ID,
+		"name":       call.Function.Name,
+		"status":     status,
+	})
+
+	return openrouter.Message{
+		Role:       "tool",
+		Content:    content,
+		ToolCallID: call.ID,
+	}
+}
+
+// insertToolMessage stores a tool result under the user message that led to
+// it. Tool messages never become the active leaf and are left out of branch
+// navigation, so they do not show up as alternative replies.
+func (h Handler) insertToolMessage(ctx context.Context, userID, conversationID, userMessageID string, call openrouter.ToolCall, content string) error {
+	_, err := h.db.ExecContext(ctx, `
+INSERT INTO messages (
+  id,
+  conversation_id,
+  parent_message_id,
+  user_id,
+  role,
+  content,
+  tool_call_id,
+  tool_name,
+  tool_arguments_json,
+  grounding_enabled
+)
+VALUES (?, ?, ?, ?, 'tool', ?, ?, ?, ?, 0);
+`, uuid.NewString(), conversationID, userMessageID, userID, content, nullableString(call.ID), call.Function.Name, nullableString(call.Function.Arguments))
+	return err
+}
+
+func (h Handler) modelSupportedParameters(ctx context.Context, modelID string) ([]string, error) {
+	return readModelSupportedParameters(ctx, h.db, modelID)
+}
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func readModelSupportedParameters(ctx context.Context, q rowQuerier, modelID string) ([]string, error) {
+	var raw sql.NullString
+	err := q.QueryRowContext(ctx, `
+SELECT supported_parameters_json
+FROM models
+WHERE id = ?;
+`, modelID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !raw.Valid || strings.TrimSpace(raw.String) == "" {
+		return nil, nil
+	}
+
+	var supported []string
+	if err := json.Unmarshal([]byte(raw.String), &supported); err != nil {
+		return nil, fmt.Errorf("decode supported parameters: %w", err)
+	}
+	return supported, nil
+}
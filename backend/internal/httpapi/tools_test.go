@@ -0,0 +1,267 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/session"
+)
+
+// toolCallingStubStreamer answers the first len(toolCalls) tool-enabled
+// requests with the scripted calls and later ones like stubStreamer. Every
+// round reports usage when it is set.
+type toolCallingStubStreamer struct {
+	stubStreamer
+	toolCalls [][]openrouter.ToolCall
+	requests  *[]openrouter.StreamRequest
+}
+
+func (s toolCallingStubStreamer) StreamChatCompletionWithTools(ctx context.Context, req openrouter.StreamRequest, onStart func() error, onDelta func(string) error, onReasoning func(string) error, onUsage func(openrouter.Usage) error, onToolCalls func([]openrouter.ToolCall) error) error {
+	round := len(*s.requests)
+	*s.requests = append(*s.requests, req)
+	if round < len(s.toolCalls) {
+		if s.usage != nil && onUsage != nil {
+			if err := onUsage(*s.usage); err != nil {
+				return err
+			}
+		}
+		return onToolCalls(s.toolCalls[round])
+	}
+	return s.StreamChatCompletion(ctx, req, onStart, onDelta, onReasoning, onUsage)
+}
+
+func TestChatMessagesRunsToolCallsAndPersistsResults(t *testing.T) {
+	var toolRequests []openrouter.StreamRequest
+	streamer := toolCallingStubStreamer{
+		stubStreamer: stubStreamer{tokens: []string{"Order 42 has shipped."}},
+		toolCalls: [][]openrouter.ToolCall{{
+			{ID: "call_1", Type: "function", Function: openrouter.ToolCallFunction{Name: "lookup_order", Arguments: `{"id":"42"}`}},
+			{ID: "call_2", Type: "function", Function: openrouter.ToolCallFunction{Name: "missing_tool", Arguments: `{}`}},
+		}},
+		requests: &toolRequests,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	var lookedUp string
+	handler.tools = newChatToolRegistry(chatTool{
+		Name:       "lookup_order",
+		Parameters: json.RawMessage(`{"type":"object","properties":{"id":{"type":"string"}}}`),
+		Run: func(_ context.Context, arguments json.RawMessage) (chatToolResult, error) {
+			var args struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return chatToolResult{}, err
+			}
+			lookedUp = args.ID
+			return chatToolResult{Content: "order " + args.ID + " shipped"}, nil
+		},
+	})
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["reasoning","tools"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("enable tools: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Where is order 42?","modelId":"openrouter/free","grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	if lookedUp != "42" {
+		t.Fatalf("expected tool to run with parsed arguments, got %q", lookedUp)
+	}
+	if len(toolRequests) != 2 {
+		t.Fatalf("expected a tool round and an answer round, got %d requests", len(toolRequests))
+	}
+	if len(toolRequests[0].Tools) != 1 || toolRequests[0].Tools[0].Function.Name != "lookup_order" {
+		t.Fatalf("expected registered tool definitions, got %+v", toolRequests[0].Tools)
+	}
+	followUp := toolRequests[1].Messages
+	if len(followUp) < 3 {
+		t.Fatalf("expected tool exchange in follow-up request, got %+v", followUp)
+	}
+	exchange := followUp[len(followUp)-3:]
+	if exchange[0].Role != "assistant" || len(exchange[0].ToolCalls) != 2 {
+		t.Fatalf("expected assistant tool call message, got %+v", exchange[0])
+	}
+	if exchange[1].Role != "tool" || exchange[1].ToolCallID != "call_1" || exchange[1].Content != "order 42 shipped" {
+		t.Fatalf("unexpected first tool result: %+v", exchange[1])
+	}
+	if exchange[2].ToolCallID != "call_2" || !strings.HasPrefix(exchange[2].Content, "Tool error: unknown tool") {
+		t.Fatalf("expected unknown tool to be reported to the model, got %+v", exchange[2])
+	}
+
+	statuses := map[string]string{}
+	events := decodeSSEEvents(t, resp.Body.String())
+	for _, event := range events {
+		if event.Type == "tool_call" {
+			name, _ := event.Data["name"].(string)
+			statuses[name], _ = event.Data["status"].(string)
+		}
+	}
+	if statuses["lookup_order"] != "completed" || statuses["missing_tool"] != "failed" {
+		t.Fatalf("unexpected tool_call events: %+v", statuses)
+	}
+
+	var conversationID string
+	var userMessageID string
+	if err := db.QueryRow(`SELECT conversation_id, id FROM messages WHERE role = 'user';`).Scan(&conversationID, &userMessageID); err != nil {
+		t.Fatalf("query user message: %v", err)
+	}
+	var toolMessages int
+	if err := db.QueryRow(`
+SELECT COUNT(*)
+FROM messages
+WHERE role = 'tool' AND parent_message_id = ? AND tool_name IS NOT NULL AND tool_call_id IS NOT NULL;
+`, userMessageID).Scan(&toolMessages); err != nil {
+		t.Fatalf("count tool messages: %v", err)
+	}
+	if toolMessages != 2 {
+		t.Fatalf("expected 2 persisted tool messages, got %d", toolMessages)
+	}
+
+	page := listMessagesAs(t, handler, user, conversationID, "")
+	if len(page.Messages) != 2 || page.Messages[1].Role != "assistant" || page.Messages[1].SiblingCount != 1 {
+		t.Fatalf("expected tool messages to stay off the branch, got %+v", page.Messages)
+	}
+	if page.Messages[1].Content != "Order 42 has shipped." {
+		t.Fatalf("unexpected assistant content: %q", page.Messages[1].Content)
+	}
+}
+
+func TestChatMessagesSumsUsageAcrossToolRounds(t *testing.T) {
+	var toolRequests []openrouter.StreamRequest
+	cost, byokCost := 7, 3
+	streamer := toolCallingStubStreamer{
+		stubStreamer: stubStreamer{
+			tokens: []string{"Done."},
+			usage:  &openrouter.Usage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110, CostMicrosUSD: &cost, ByokInferenceCostMicros: &byokCost},
+		},
+		toolCalls: [][]openrouter.ToolCall{{
+			{ID: "call_1", Type: "function", Function: openrouter.ToolCallFunction{Name: "lookup_order", Arguments: `{}`}},
+		}},
+		requests: &toolRequests,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+	handler.tools = newChatToolRegistry(chatTool{
+		Name:       "lookup_order",
+		Parameters: json.RawMessage(`{"type":"object"}`),
+		Run: func(context.Context, json.RawMessage) (chatToolResult, error) {
+			return chatToolResult{Content: "shipped"}, nil
+		},
+	})
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["tools"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("enable tools: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Where is my order?","modelId":"openrouter/free","grounding":false}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+	}
+	if len(toolRequests) != 2 {
+		t.Fatalf("expected two rounds, got %d", len(toolRequests))
+	}
+
+	var promptTokens, completionTokens, totalTokens, costMicros, byokMicros int
+	if err := db.QueryRow(`
+SELECT prompt_tokens, completion_tokens, total_tokens, cost_microusd, byok_inference_cost_microusd
+FROM messages
+WHERE role = 'assistant';
+`).Scan(&promptTokens, &completionTokens, &totalTokens, &costMicros, &byokMicros); err != nil {
+		t.Fatalf("query assistant usage: %v", err)
+	}
+	if promptTokens != 200 || completionTokens != 20 || totalTokens != 220 || costMicros != 14 || byokMicros != 6 {
+		t.Fatalf("expected usage summed over both rounds, got prompt=%d completion=%d total=%d cost=%d byok=%d", promptTokens, completionTokens, totalTokens, costMicros, byokMicros)
+	}
+
+	var lastUsage map[string]any
+	for _, event := range decodeSSEEvents(t, resp.Body.String()) {
+		if event.Type == "usage" {
+			lastUsage, _ = event.Data["usage"].(map[string]any)
+		}
+	}
+	if lastUsage == nil || lastUsage["promptTokens"] != float64(200) {
+		t.Fatalf("expected the last usage event to carry the total, got %+v", lastUsage)
+	}
+}
+
+func TestChatMessagesStopsOfferingToolsAfterMaxRounds(t *testing.T) {
+	var toolRequests []openrouter.StreamRequest
+	scripted := make([][]openrouter.ToolCall, maxToolRounds+2)
+	for i := range scripted {
+		scripted[i] = []openrouter.ToolCall{{ID: "call", Type: "function", Function: openrouter.ToolCallFunction{Name: "get_current_time"}}}
+	}
+	streamer := toolCallingStubStreamer{
+		stubStreamer: stubStreamer{tokens: []string{"Done"}},
+		toolCalls:    scripted,
+		requests:     &toolRequests,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["tools"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("enable tools: %v", err)
+	}
+
+	postChatMessage(t, handler, user, `{"message":"What time is it?","modelId":"openrouter/free","grounding":false}`)
+
+	if len(toolRequests) != maxToolRounds+1 {
+		t.Fatalf("expected %d requests, got %d", maxToolRounds+1, len(toolRequests))
+	}
+	if last := toolRequests[len(toolRequests)-1]; last.ToolChoice != "none" {
+		t.Fatalf("expected the final round to disable tool calls, got %q", last.ToolChoice)
+	}
+}
+
+func TestChatMessagesSkipsToolsForModelsWithoutToolSupport(t *testing.T) {
+	var toolRequests []openrouter.StreamRequest
+	var plainRequests []openrouter.StreamRequest
+	streamer := toolCallingStubStreamer{
+		stubStreamer: stubStreamer{
+			tokens: []string{"Hi"},
+			onRequest: func(req openrouter.StreamRequest) {
+				plainRequests = append(plainRequests, req)
+			},
+		},
+		requests: &toolRequests,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+
+	postChatMessage(t, handler, user, `{"message":"Hello","modelId":"openrouter/free","grounding":false}`)
+
+	if len(toolRequests) != 0 {
+		t.Fatalf("expected no tool-enabled requests, got %d", len(toolRequests))
+	}
+	generationRequests := filterGenerationRequests(plainRequests)
+	if len(generationRequests) != 1 || len(generationRequests[0].Tools) != 0 {
+		t.Fatalf("expected one plain generation request, got %+v", generationRequests)
+	}
+}
@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"chat/backend/internal/research"
+	"chat/backend/internal/search"
+)
+
+const (
+	webSearchToolResults   = 5
+	maxFetchedPageRunes    = 6000
+	maxWebToolSnippetRunes = 800
+)
+
+// webSearchTool lets the model run its own follow-up searches on top of the
+// grounding pass.
+func webSearchTool(searcher groundingSearcher) chatTool {
+	return chatTool{
+		Name:        "web_search",
+		Description: "Searches the web and returns the top results with their titles, URLs and snippets. Use it when the provided sources do not cover the question.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"Search query"}},"required":["query"]}`),
+		Run: func(ctx context.Context, arguments json.RawMessage) (chatToolResult, error) {
+			var args struct {
+				Query string `json:"query"`
+			}
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return chatToolResult{}, err
+			}
+			query := strings.TrimSpace(args.Query)
+			if query == "" {
+				return chatToolResult{}, errors.New("query is required")
+			}
+
+			results, err := searcher.Search(ctx, query, webSearchToolResults)
+			if errors.Is(err, search.ErrNotConfigured) {
+				return chatToolResult{}, errors.New("web search is not configured")
+			}
+			if err != nil {
+				return chatToolResult{}, fmt.Errorf("web search failed: %w", err)
+			}
+
+			citations := make([]citationResponse, 0, len(results))
+			for _, result := range results {
+				rawURL := strings.TrimSpace(result.URL)
+				if rawURL == "" {
+					continue
+				}
+				citations = append(citations, citationResponse{
+					URL:            rawURL,
+					Title:          trimToRunes(strings.TrimSpace(result.Title), 240),
+					Snippet:        trimToRunes(strings.TrimSpace(result.Snippet), maxWebToolSnippetRunes),
+					SourceProvider: result.Provider,
+				})
+			}
+
+			result := chatToolResult{
+				Citations: citations,
+				Progress: &research.Progress{
+					Phase:             research.PhaseSearching,
+					Title:             "Searched the web",
+					Detail:            query,
+					IsQuickStep:       true,
+					SourcesConsidered: len(citations),
+				},
+			}
+			if len(citations) == 0 {
+				result.Content = "No results."
+			}
+			return result, nil
+		},
+	}
+}
+
+// fetchURLTool lets the model read a page by URL. URLs go through the research
+// reader's SSRF rules before anything is fetched.
+func fetchURLTool(reader research.Reader) chatTool {
+	return chatTool{
+		Name:        "fetch_url",
+		Description: "Fetches a public web page and returns its readable text. Use it to read a search result or a link the user shared.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"url":{"type":"string","description":"Absolute http or https URL"}},"required":["url"]}`),
+		Run: func(ctx context.Context, arguments json.RawMessage) (chatToolResult, error) {
+			var args struct {
+				URL string `json:"url"`
+			}
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return chatToolResult{}, err
+			}
+			target, err := research.ValidateURL(args.URL)
+			if err != nil {
+				return chatToolResult{}, fmt.Errorf("url is not allowed: %w", err)
+			}
+
+			page, err := reader.Read(ctx, target.String())
+			if err != nil {
+				return chatToolResult{}, fmt.Errorf("fetch failed: %w", err)
+			}
+			finalURL := strings.TrimSpace(fallback(page.FinalURL, target.String()))
+			text := strings.TrimSpace(page.Text)
+			if text == "" {
+				text = "The page had no readable text."
+			}
+
+			return chatToolResult{
+				Content: trimToRunes(text, maxFetchedPageRunes),
+				Citations: []citationResponse{{
+					URL:            finalURL,
+					Title:          trimToRunes(strings.TrimSpace(page.Title), 240),
+					Snippet:        trimToRunes(strings.TrimSpace(page.Snippet), maxWebToolSnippetRunes),
+					SourceProvider: "web",
+				}},
+				Progress: &research.Progress{
+					Phase:       research.PhaseReading,
+					Title:       "Read a web page",
+					Detail:      finalURL,
+					IsQuickStep: true,
+					SourcesRead: 1,
+				},
+			}, nil
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/openrouter"
+	"chat/backend/internal/research"
+	"chat/backend/internal/search"
+	"chat/backend/internal/session"
+)
+
+func TestChatMessagesWebToolsAddCitationsAndTrace(t *testing.T) {
+	var toolRequests []openrouter.StreamRequest
+	streamer := toolCallingStubStreamer{
+		stubStreamer: stubStreamer{tokens: []string{"Lisbon is sunny [1][2]."}},
+		toolCalls: [][]openrouter.ToolCall{
+			{{ID: "call_search", Type: "function", Function: openrouter.ToolCallFunction{Name: "web_search", Arguments: `{"query":"lisbon weather"}`}}},
+			{
+				{ID: "call_fetch", Type: "function", Function: openrouter.ToolCallFunction{Name: "fetch_url", Arguments: `{"url":"https://example.com/forecast"}`}},
+				{ID: "call_private", Type: "function", Function: openrouter.ToolCallFunction{Name: "fetch_url", Arguments: `{"url":"http://127.0.0.1/admin"}`}},
+			},
+		},
+		requests: &toolRequests,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+
+	handler.grounding = stubGrounder{
+		results: []search.Result{
+			{URL: "https://example.com/weather", Title: "Lisbon weather", Snippet: "Sunny all week"},
+		},
+	}
+	handler.researchReader = stubResearchReader{
+		responses: map[string]research.ReadResult{
+			"https://example.com/forecast": {FinalURL: "https://example.com/forecast", Title: "Forecast", Text: "Highs of 24C."},
+			"http://127.0.0.1/admin":       {FinalURL: "http://127.0.0.1/admin", Title: "Admin", Text: "secret"},
+		},
+	}
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["tools"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("enable tools: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/messages", strings.NewReader(`{"message":"Weather in Lisbon?","modelId":"openrouter/free","grounding":true}`))
+	req = requestWithSessionUser(req, user)
+	resp := httptest.NewRecorder()
+	handler.ChatMessages(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", resp.Code, resp.Body.String())
+	}
+
+	if len(toolRequests) != 3 {
+		t.Fatalf("expected two tool rounds and an answer round, got %d requests", len(toolRequests))
+	}
+	toolNames := map[string]bool{}
+	for _, tool := range toolRequests[0].Tools {
+		toolNames[tool.Function.Name] = true
+	}
+	if !toolNames["web_search"] || !toolNames["fetch_url"] {
+		t.Fatalf("expected web tools to be offered with grounding on, got %+v", toolRequests[0].Tools)
+	}
+
+	final := toolRequests[2].Messages
+	if len(final) < 5 {
+		t.Fatalf("expected both tool exchanges in the final request, got %+v", final)
+	}
+	searchResult := final[len(final)-4]
+	if searchResult.ToolCallID != "call_search" || !strings.Contains(searchResult.Content, "[1] Lisbon weather") {
+		t.Fatalf("expected the grounding source to keep its number, got %+v", searchResult)
+	}
+	fetchResult := final[len(final)-2]
+	if fetchResult.ToolCallID != "call_fetch" || !strings.Contains(fetchResult.Content, "[2] Forecast") || !strings.Contains(fetchResult.Content, "Highs of 24C.") {
+		t.Fatalf("expected fetched page numbered after existing sources, got %+v", fetchResult)
+	}
+	privateResult := final[len(final)-1]
+	if privateResult.ToolCallID != "call_private" || !strings.HasPrefix(privateResult.Content, "Tool error: url is not allowed") {
+		t.Fatalf("expected private address to be rejected before reading, got %+v", privateResult)
+	}
+
+	var citations []citationResponse
+	for _, event := range decodeSSEEvents(t, resp.Body.String()) {
+		if event.Type != "citations" {
+			continue
+		}
+		for _, raw := range event.Data["citations"].([]any) {
+			item := raw.(map[string]any)
+			url, _ := item["url"].(string)
+			citations = append(citations, citationResponse{URL: url})
+		}
+	}
+	if len(citations) != 2 || citations[0].URL != "https://example.com/weather" || citations[1].URL != "https://example.com/forecast" {
+		t.Fatalf("expected grounding and fetched sources once each, got %+v", citations)
+	}
+
+	var persistedCitations int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM citations;`).Scan(&persistedCitations); err != nil {
+		t.Fatalf("count citations: %v", err)
+	}
+	if persistedCitations != 2 {
+		t.Fatalf("expected 2 persisted citations, got %d", persistedCitations)
+	}
+
+	var trace string
+	if err := db.QueryRow(`SELECT thinking_trace_json FROM messages WHERE role = 'assistant';`).Scan(&trace); err != nil {
+		t.Fatalf("query thinking trace: %v", err)
+	}
+	if !strings.Contains(trace, "Searched the web") || !strings.Contains(trace, "Read a web page") {
+		t.Fatalf("expected tool steps in the thinking trace, got %s", trace)
+	}
+}
+
+func TestChatMessagesOffersWebToolsOnlyWithGrounding(t *testing.T) {
+	var toolRequests []openrouter.StreamRequest
+	streamer := toolCallingStubStreamer{
+		stubStreamer: stubStreamer{tokens: []string{"Hi"}},
+		requests:     &toolRequests,
+	}
+	handler, db := newTestHandler(t, streamer)
+	t.Cleanup(func() { _ = db.Close() })
+	handler.grounding = stubGrounder{}
+	handler.researchReader = stubResearchReader{}
+
+	user := session.User{ID: "user-1"}
+	seedUser(t, db, user.ID, "user1@example.com")
+	seedModel(t, db, "openrouter/free")
+	if _, err := db.Exec(`UPDATE models SET supported_parameters_json = '["tools"]' WHERE id = 'openrouter/free';`); err != nil {
+		t.Fatalf("enable tools: %v", err)
+	}
+
+	postChatMessage(t, handler, user, `{"message":"Hello","modelId":"openrouter/free","grounding":false}`)
+
+	if len(toolRequests) != 1 {
+		t.Fatalf("expected one tool-enabled request, got %d", len(toolRequests))
+	}
+	for _, tool := range toolRequests[0].Tools {
+		if tool.Function.Name == "web_search" || tool.Function.Name == "fetch_url" {
+			t.Fatalf("expected web tools to stay off without grounding, got %+v", toolRequests[0].Tools)
+		}
+	}
+}
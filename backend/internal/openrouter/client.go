@@ -25,6 +25,68 @@ var ErrMissingAPIKey = errors.New("openrouter api key is not configured")
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Parts, when set, is sent as the content array instead of Content, so a
+	// message can carry images next to its text.
+	Parts      []ContentPart `json:"-"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+}
+
+// ContentPart is one element of a multimodal message: a text part or an
+// image_url part whose URL may be a base64 data URL.
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+func ImagePart(url string) ContentPart {
+	return ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}}
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	type plainMessage Message
+	if len(m.Parts) == 0 {
+		return json.Marshal(plainMessage(m))
+	}
+	return json.Marshal(struct {
+		plainMessage
+		Content []ContentPart `json:"content"`
+	}{plainMessage: plainMessage(m), Content: m.Parts})
+}
+
+// Tool declares a function the model may call. Parameters is a JSON Schema
+// object.
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a function call requested by the model. Arguments is the raw
+// JSON text the model produced.
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 type Model struct {
@@ -35,6 +97,7 @@ type Model struct {
 	CompletionPriceMicrosUSD float64
 	SupportedParameters      []string
 	SupportsReasoning        bool
+	InputModalities          []string
 }
 
 type Usage struct {
@@ -66,17 +129,52 @@ type ReasoningConfig struct {
 }
 
 type StreamRequest struct {
-	Model     string           `json:"model"`
-	Messages  []Message        `json:"messages"`
-	Reasoning *ReasoningConfig `json:"reasoning,omitempty"`
+	Model      string           `json:"model"`
+	Messages   []Message        `json:"messages"`
+	Reasoning  *ReasoningConfig `json:"reasoning,omitempty"`
+	Tools      []Tool           `json:"tools,omitempty"`
+	ToolChoice string           `json:"tool_choice,omitempty"`
+	// ResponseFormat asks the model for JSON; only send it to models that list
+	// response_format or structured_outputs in their supported parameters.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	SamplingParams
+}
+
+// ResponseFormat is the OpenAI-style response_format. Type is "json_object"
+// or "json_schema"; JSONSchema is set only for the latter.
+type ResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+type JSONSchemaFormat struct {
+	Name   string          `json:"name"`
+	Strict bool            `json:"strict,omitempty"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+// SamplingParams are optional generation controls. Nil fields are omitted so
+// the provider's defaults apply.
+type SamplingParams struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	MaxTokens        *int     `json:"max_tokens,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
 }
 
 type streamAPIRequest struct {
-	Model         string           `json:"model"`
-	Messages      []Message        `json:"messages"`
-	Reasoning     *ReasoningConfig `json:"reasoning,omitempty"`
-	Stream        bool             `json:"stream"`
-	StreamOptions *streamOptions   `json:"stream_options,omitempty"`
+	Model          string           `json:"model"`
+	Messages       []Message        `json:"messages"`
+	Reasoning      *ReasoningConfig `json:"reasoning,omitempty"`
+	Tools          []Tool           `json:"tools,omitempty"`
+	ToolChoice     string           `json:"tool_choice,omitempty"`
+	ResponseFormat *ResponseFormat  `json:"response_format,omitempty"`
+	SamplingParams
+	Stream        bool           `json:"stream"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
 }
 
 type streamOptions struct {
@@ -105,14 +203,25 @@ type streamAPICostDetails struct {
 	UpstreamInferenceCost json.RawMessage `json:"upstream_inference_cost"`
 }
 
+type streamAPIToolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
 type streamAPIResponse struct {
 	ID       string `json:"id,omitempty"`
 	Model    string `json:"model,omitempty"`
 	Provider string `json:"provider,omitempty"`
 	Choices  []struct {
 		Delta struct {
-			Content          string            `json:"content"`
-			ReasoningDetails []reasoningDetail `json:"reasoning_details"`
+			Content          string                   `json:"content"`
+			ReasoningDetails []reasoningDetail        `json:"reasoning_details"`
+			ToolCalls        []streamAPIToolCallDelta `json:"tool_calls"`
 		} `json:"delta"`
 	} `json:"choices"`
 	Usage *streamAPIUsage `json:"usage,omitempty"`
@@ -152,6 +261,10 @@ type listModelsAPIModel struct {
 	TopProvider struct {
 		ContextLength int `json:"context_length"`
 	} `json:"top_provider"`
+	Architecture struct {
+		InputModalities []string `json:"input_modalities"`
+		Modality        string   `json:"modality"`
+	} `json:"architecture"`
 }
 
 type Client struct {
@@ -192,6 +305,21 @@ func (c Client) StreamChatCompletion(
 	onDelta func(string) error,
 	onReasoning func(string) error,
 	onUsage func(Usage) error,
+) error {
+	return c.StreamChatCompletionWithTools(ctx, req, onStart, onDelta, onReasoning, onUsage, nil)
+}
+
+// StreamChatCompletionWithTools streams like StreamChatCompletion. Tool calls
+// arrive as fragments spread over many deltas; once the stream ends they are
+// reported to onToolCalls, assembled and in the order the model made them.
+func (c Client) StreamChatCompletionWithTools(
+	ctx context.Context,
+	req StreamRequest,
+	onStart func() error,
+	onDelta func(string) error,
+	onReasoning func(string) error,
+	onUsage func(Usage) error,
+	onToolCalls func([]ToolCall) error,
 ) error {
 	if strings.TrimSpace(c.apiKey) == "" {
 		return ErrMissingAPIKey
@@ -212,10 +340,14 @@ func (c Client) StreamChatCompletion(
 	}
 
 	payload, err := json.Marshal(streamAPIRequest{
-		Model:     strings.TrimSpace(req.Model),
-		Messages:  req.Messages,
-		Reasoning: reasoning,
-		Stream:    true,
+		Model:          strings.TrimSpace(req.Model),
+		Messages:       req.Messages,
+		Reasoning:      reasoning,
+		Tools:          req.Tools,
+		ToolChoice:     strings.TrimSpace(req.ToolChoice),
+		ResponseFormat: req.ResponseFormat,
+		SamplingParams: req.SamplingParams,
+		Stream:         true,
 		StreamOptions: &streamOptions{
 			IncludeUsage: true,
 		},
@@ -252,6 +384,7 @@ func (c Client) StreamChatCompletion(
 	scanner := bufio.NewScanner(resp.Body)
 	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 	generationID := ""
+	var toolCalls toolCallAssembler
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, ":") || !strings.HasPrefix(line, "data:") {
@@ -263,7 +396,7 @@ func (c Client) StreamChatCompletion(
 			continue
 		}
 		if payload == "[DONE]" {
-			return nil
+			return toolCalls.report(onToolCalls)
 		}
 
 		var parsed streamAPIResponse
@@ -312,6 +445,10 @@ func (c Client) StreamChatCompletion(
 				}
 			}
 
+			for _, fragment := range choice.Delta.ToolCalls {
+				toolCalls.add(fragment)
+			}
+
 			// Handle content tokens
 			delta := choice.Delta.Content
 			if delta == "" {
@@ -328,7 +465,53 @@ func (c Client) StreamChatCompletion(
 	if err := scanner.Err(); err != nil {
 		return fmt.Errorf("read openrouter stream: %w", err)
 	}
-	return nil
+	return toolCalls.report(onToolCalls)
+}
+
+// toolCallAssembler joins streamed tool call fragments by their index: the
+// first fragment carries the id and name, later ones append to the arguments.
+type toolCallAssembler struct {
+	calls []ToolCall
+	index map[int]int
+}
+
+func (a *toolCallAssembler) add(fragment streamAPIToolCallDelta) {
+	if a.index == nil {
+		a.index = make(map[int]int)
+	}
+	position, ok := a.index[fragment.Index]
+	if !ok {
+		position = len(a.calls)
+		a.index[fragment.Index] = position
+		a.calls = append(a.calls, ToolCall{Type: "function"})
+	}
+
+	call := &a.calls[position]
+	if id := strings.TrimSpace(fragment.ID); id != "" {
+		call.ID = id
+	}
+	if kind := strings.TrimSpace(fragment.Type); kind != "" {
+		call.Type = kind
+	}
+	call.Function.Name += fragment.Function.Name
+	call.Function.Arguments += fragment.Function.Arguments
+}
+
+func (a *toolCallAssembler) report(onToolCalls func([]ToolCall) error) error {
+	if onToolCalls == nil {
+		return nil
+	}
+	calls := make([]ToolCall, 0, len(a.calls))
+	for _, call := range a.calls {
+		if strings.TrimSpace(call.Function.Name) == "" {
+			continue
+		}
+		calls = append(calls, call)
+	}
+	if len(calls) == 0 {
+		return nil
+	}
+	return onToolCalls(calls)
 }
 
 func (c Client) GetGeneration(ctx context.Context, generationID string) (Generation, error) {
@@ -468,6 +651,7 @@ func (c Client) listModelsFromPath(ctx context.Context, path string) ([]Model, e
 			CompletionPriceMicrosUSD: parsePriceMicrosDecimal(model.Pricing.Completion),
 			SupportedParameters:      supportedParameters,
 			SupportsReasoning:        supportsReasoningParameter(supportedParameters),
+			InputModalities:          inputModalities(model.Architecture.InputModalities, model.Architecture.Modality),
 		})
 	}
 
@@ -604,6 +788,19 @@ func normalizeSupportedParameters(raw []string) []string {
 	return out
 }
 
+// inputModalities prefers the explicit input_modalities list and falls back
+// to the input side of the "text+image->text" modality string.
+func inputModalities(explicit []string, modality string) []string {
+	if len(explicit) > 0 {
+		return normalizeSupportedParameters(explicit)
+	}
+	input, _, found := strings.Cut(modality, "->")
+	if !found {
+		return nil
+	}
+	return normalizeSupportedParameters(strings.Split(input, "+"))
+}
+
 func supportsReasoningParameter(supported []string) bool {
 	for _, parameter := range supported {
 		switch parameter {
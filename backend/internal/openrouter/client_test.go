@@ -2,10 +2,12 @@ package openrouter
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
 
@@ -128,6 +130,182 @@ func TestStreamChatCompletionIncludesReasoningEffortWhenProvided(t *testing.T) {
 	}
 }
 
+func TestStreamChatCompletionSendsSamplingParams(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if body["temperature"] != float64(0) || body["max_tokens"] != float64(256) || body["seed"] != float64(7) {
+			t.Fatalf("unexpected sampling params: %v", body)
+		}
+		if stop, _ := body["stop"].([]any); len(stop) != 1 || stop[0] != "END" {
+			t.Fatalf("unexpected stop sequences: %v", body["stop"])
+		}
+		for _, unset := range []string{"top_p", "presence_penalty", "frequency_penalty"} {
+			if _, ok := body[unset]; ok {
+				t.Fatalf("expected %s to be omitted, got %v", unset, body)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient(config.Config{
+		OpenRouterAPIKey:  "test-key",
+		OpenRouterBaseURL: server.URL,
+	}, server.Client())
+
+	temperature := 0.0
+	maxTokens := 256
+	seed := 7
+	err := client.StreamChatCompletion(
+		context.Background(),
+		StreamRequest{
+			Model:    "openrouter/free",
+			Messages: []Message{{Role: "user", Content: "hi"}},
+			SamplingParams: SamplingParams{
+				Temperature: &temperature,
+				MaxTokens:   &maxTokens,
+				Stop:        []string{"END"},
+				Seed:        &seed,
+			},
+		},
+		nil,
+		func(string) error { return nil },
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+}
+
+func TestStreamChatCompletionSendsResponseFormat(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		want := `"response_format":{"type":"json_schema","json_schema":{"name":"answer","strict":true,"schema":{"type":"object"}}}`
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("request body missing response_format: %s", body)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient(config.Config{
+		OpenRouterAPIKey:  "test-key",
+		OpenRouterBaseURL: server.URL,
+	}, server.Client())
+
+	err := client.StreamChatCompletion(
+		context.Background(),
+		StreamRequest{
+			Model:    "openrouter/free",
+			Messages: []Message{{Role: "user", Content: "hi"}},
+			ResponseFormat: &ResponseFormat{
+				Type: "json_schema",
+				JSONSchema: &JSONSchemaFormat{
+					Name:   "answer",
+					Strict: true,
+					Schema: json.RawMessage(`{"type":"object"}`),
+				},
+			},
+		},
+		nil,
+		func(string) error { return nil },
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+}
+
+func TestStreamChatCompletionWithToolsAssemblesToolCalls(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		rawBody := string(body)
+		if !strings.Contains(rawBody, `"tools":[{"type":"function","function":{"name":"get_weather"`) {
+			t.Fatalf("request body missing tools: %s", rawBody)
+		}
+		if !strings.Contains(rawBody, `{"role":"tool","content":"sunny","tool_call_id":"call_0"}`) {
+			t.Fatalf("request body missing tool result message: %s", rawBody)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"{\\\"city\\\":\"}}]}}]}\n\n"))
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":1,\"id\":\"call_2\",\"function\":{\"name\":\"get_time\",\"arguments\":\"{}\"}}]}}]}\n\n"))
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"Lisbon\\\"}\"}}]}}]}\n\n"))
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient(config.Config{
+		OpenRouterAPIKey:  "test-key",
+		OpenRouterBaseURL: server.URL,
+	}, server.Client())
+
+	var calls []ToolCall
+	err := client.StreamChatCompletionWithTools(
+		context.Background(),
+		StreamRequest{
+			Model: "openrouter/free",
+			Messages: []Message{
+				{Role: "user", Content: "weather?"},
+				{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_0", Type: "function", Function: ToolCallFunction{Name: "get_weather", Arguments: "{}"}}}},
+				{Role: "tool", Content: "sunny", ToolCallID: "call_0"},
+			},
+			Tools: []Tool{{
+				Type: "function",
+				Function: ToolFunction{
+					Name:       "get_weather",
+					Parameters: []byte(`{"type":"object"}`),
+				},
+			}},
+		},
+		nil,
+		nil,
+		nil, // onReasoning
+		nil, // onUsage
+		func(assembled []ToolCall) error {
+			calls = assembled
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("stream chat completion: %v", err)
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %+v", calls)
+	}
+	if calls[0].ID != "call_1" || calls[0].Function.Name != "get_weather" || calls[0].Function.Arguments != `{"city":"Lisbon"}` {
+		t.Fatalf("unexpected first tool call: %+v", calls[0])
+	}
+	if calls[1].ID != "call_2" || calls[1].Type != "function" || calls[1].Function.Name != "get_time" {
+		t.Fatalf("unexpected second tool call: %+v", calls[1])
+	}
+}
+
 func TestStreamChatCompletionEmitsUsage(t *testing.T) {
 	t.Parallel()
 
@@ -357,12 +535,14 @@ func TestListModelsParsesCatalog(t *testing.T) {
 					"name":"OpenRouter Free",
 					"context_length":131072,
 					"supported_parameters":["reasoning","temperature"],
-					"pricing":{"prompt":"0","completion":"0"}
+					"pricing":{"prompt":"0","completion":"0"},
+					"architecture":{"input_modalities":["text","Image"]}
 				},
 				{
 					"id":"provider/model-two",
 					"name":"",
 					"top_provider":{"context_length":32768},
+					"architecture":{"modality":"text->text"},
 					"pricing":{"prompt":0.0000009,"completion":"0.000002"}
 				}
 			]
@@ -396,6 +576,12 @@ func TestListModelsParsesCatalog(t *testing.T) {
 		t.Fatalf("expected first model to support reasoning")
 	}
 
+	if !slices.Equal(models[0].InputModalities, []string{"text", "image"}) {
+		t.Fatalf("unexpected first model input modalities: %v", models[0].InputModalities)
+	}
+	if !slices.Equal(models[1].InputModalities, []string{"text"}) {
+		t.Fatalf("expected modalities parsed from the modality string, got %v", models[1].InputModalities)
+	}
 	if models[1].Name != "provider/model-two" {
 		t.Fatalf("expected fallback name to model id, got %q", models[1].Name)
 	}
@@ -410,6 +596,31 @@ func TestListModelsParsesCatalog(t *testing.T) {
 	}
 }
 
+func TestMessageMarshalsContentParts(t *testing.T) {
+	t.Parallel()
+
+	plain, err := json.Marshal(Message{Role: "user", Content: "hi"})
+	if err != nil {
+		t.Fatalf("marshal plain message: %v", err)
+	}
+	if string(plain) != `{"role":"user","content":"hi"}` {
+		t.Fatalf("unexpected plain message: %s", plain)
+	}
+
+	multimodal, err := json.Marshal(Message{
+		Role:    "user",
+		Content: "ignored",
+		Parts:   []ContentPart{TextPart("What is this?"), ImagePart("data:image/png;base64,AAAA")},
+	})
+	if err != nil {
+		t.Fatalf("marshal multimodal message: %v", err)
+	}
+	want := `{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]}`
+	if string(multimodal) != want {
+		t.Fatalf("unexpected multimodal message:\n got %s\nwant %s", multimodal, want)
+	}
+}
+
 func TestListModelsFallsBackWhenUserEndpointIsUnavailable(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,368 @@
+package research
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chat/backend/internal/search"
+)
+
+const (
+	// cacheTimeLayout sorts lexically in time order, so expires_at and
+	// created_at can be compared as text.
+	cacheTimeLayout = "2006-01-02T15:04:05.000Z"
+	// dbCachePruneInterval spaces out the sweeps for expired rows; entries
+	// past their expiry are already hidden from Get.
+	dbCachePruneInterval = time.Minute
+)
+
+// Cache stores research search results and fetched pages as JSON.
+// Implementations drop expired entries and stay within a size bound. Get
+// also misses entries written more than maxAge ago, so a run that wants
+// fresher data is not served what a more lenient run stored; a maxAge of
+// zero accepts any unexpired entry.
+type Cache interface {
+	Get(ctx context.Context, key string, maxAge time.Duration) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// MemoryCache is an in-process Cache that evicts the least recently used
+// entries once maxBytes is exceeded.
+type MemoryCache struct {
+	maxBytes int64
+	now      func() time.Time
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key       string
+	value     []byte
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		now:      time.Now,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(_ context.Context, key string, maxAge time.Duration) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	now := c.now()
+	if !now.Before(entry.expiresAt) {
+		c.remove(element)
+		return nil, false, nil
+	}
+	if maxAge > 0 && now.Sub(entry.createdAt) > maxAge {
+		return nil, false, nil
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (c *MemoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 || int64(len(value)) > c.maxBytes {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	now := c.now()
+	c.entries[key] = c.order.PushFront(&memoryCacheEntry{key: key, value: value, createdAt: now, expiresAt: now.Add(ttl)})
+	c.size += int64(len(value))
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *MemoryCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*memoryCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.value))
+}
+
+// DBCache is a Cache in the research_cache table, shared by every instance
+// using the database. Past maxBytes the oldest writes are evicted first.
+// Each instance keeps a running estimate of the stored size and only measures
+// the table when the estimate passes maxBytes or when it sweeps expired rows,
+// at most once per dbCachePruneInterval. Writes from other instances are
+// picked up by those sweeps, so the bound is approximate between them.
+type DBCache struct {
+	db       *sql.DB
+	maxBytes int64
+	now      func() time.Time
+	state    *dbCacheState
+}
+
+type dbCacheState struct {
+	mu          sync.Mutex
+	lastPrune   time.Time
+	storedBytes int64
+}
+
+func NewDBCache(db *sql.DB, maxBytes int64) DBCache {
+	return DBCache{db: db, maxBytes: maxBytes, now: time.Now, state: &dbCacheState{}}
+}
+
+func (c DBCache) Get(ctx context.Context, key string, maxAge time.Duration) ([]byte, bool, error) {
+	query := `
+SELECT value
+FROM research_cache
+WHERE cache_key = ? AND expires_at > ? AND created_at >= ?;
+`
+	now := c.now().UTC()
+	// The zero time formats below every stored created_at.
+	var writtenAfter time.Time
+	if maxAge > 0 {
+		writtenAfter = now.Add(-maxAge)
+	}
+	var value string
+	err := c.db.QueryRowContext(ctx, query, key, now.Format(cacheTimeLayout), writtenAfter.Format(cacheTimeLayout)).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read research cache: %w", err)
+	}
+	return []byte(value), true, nil
+}
+
+func (c DBCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 || int64(len(value)) > c.maxBytes {
+		return nil
+	}
+
+	now := c.now().UTC()
+	upsert := `
+INSERT INTO research_cache (cache_key, value, size_bytes, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(cache_key) DO UPDATE SET
+  value = excluded.value,
+  size_bytes = excluded.size_bytes,
+  created_at = excluded.created_at,
+  expires_at = excluded.expires_at;
+`
+	if _, err := c.db.ExecContext(ctx, upsert, key, string(value), len(value), now.Format(cacheTimeLayout), now.Add(ttl).Format(cacheTimeLayout)); err != nil {
+		return fmt.Errorf("write research cache: %w", err)
+	}
+
+	c.state.mu.Lock()
+	c.state.storedBytes += int64(len(value))
+	sweep := now.Sub(c.state.lastPrune) >= dbCachePruneInterval
+	if sweep {
+		c.state.lastPrune = now
+	}
+	oversize := c.state.storedBytes > c.maxBytes
+	c.state.mu.Unlock()
+	if !sweep && !oversize {
+		return nil
+	}
+
+	pruneExpired := `
+DELETE FROM research_cache
+WHERE expires_at <= ?;
+`
+	if _, err := c.db.ExecContext(ctx, pruneExpired, now.Format(cacheTimeLayout)); err != nil {
+		return fmt.Errorf("prune research cache: %w", err)
+	}
+	measure := `
+SELECT COALESCE(SUM(size_bytes), 0)
+FROM research_cache;
+`
+	var storedBytes int64
+	if err := c.db.QueryRowContext(ctx, measure).Scan(&storedBytes); err != nil {
+		return fmt.Errorf("measure research cache: %w", err)
+	}
+	if storedBytes > c.maxBytes {
+		evicted, err := c.evictOldest(ctx)
+		if err != nil {
+			return err
+		}
+		storedBytes -= evicted
+	}
+
+	c.state.mu.Lock()
+	c.state.storedBytes = storedBytes
+	c.state.mu.Unlock()
+	return nil
+}
+
+// evictOldest deletes the oldest writes past maxBytes and returns how many
+// bytes they held.
+func (c DBCache) evictOldest(ctx context.Context) (int64, error) {
+	pruneOversize := `
+DELETE FROM research_cache
+WHERE cache_key IN (
+  SELECT cache_key
+  FROM (
+    SELECT cache_key, SUM(size_bytes) OVER (ORDER BY created_at DESC, cache_key) AS running_bytes
+    FROM research_cache
+  )
+  WHERE running_bytes > ?
+)
+RETURNING size_bytes;
+`
+	rows, err := c.db.QueryContext(ctx, pruneOversize, c.maxBytes)
+	if err != nil {
+		return 0, fmt.Errorf("prune research cache: %w", err)
+	}
+	defer rows.Close()
+
+	var evicted int64
+	for rows.Next() {
+		var size int64
+		if err := rows.Scan(&size); err != nil {
+			return 0, fmt.Errorf("prune research cache: %w", err)
+		}
+		evicted += size
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("prune research cache: %w", err)
+	}
+	return evicted, nil
+}
+
+// cacheStats counts cache lookups for one orchestrator run.
+type cacheStats struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (s *cacheStats) counts() (int, int) {
+	if s == nil {
+		return 0, 0
+	}
+	return int(s.hits.Load()), int(s.misses.Load())
+}
+
+// cachedSearcher serves repeated searches from a Cache. Keys include the
+// provider name so fused providers do not share entries.
+type cachedSearcher struct {
+	inner  Searcher
+	name   string
+	cache  Cache
+	ttl    time.Duration
+	maxAge time.Duration
+	stats  *cacheStats
+}
+
+func (s cachedSearcher) Name() string {
+	return s.name
+}
+
+func (s cachedSearcher) Search(ctx context.Context, query string, count int) ([]search.Result, error) {
+	key := searchCacheKey(s.name, query, count)
+	if data, ok := cacheLookup(ctx, s.cache, key, s.maxAge); ok {
+		var results []search.Result
+		if err := json.Unmarshal(data, &results); err == nil {
+			s.stats.hits.Add(1)
+			return results, nil
+		}
+	}
+	s.stats.misses.Add(1)
+
+	results, err := s.inner.Search(ctx, query, count)
+	if err != nil || len(results) == 0 {
+		return results, err
+	}
+	if data, err := json.Marshal(results); err == nil {
+		cacheStore(ctx, s.cache, key, data, s.ttl)
+	}
+	return results, nil
+}
+
+// cachedReader serves pages fetched within the TTL from a Cache, keyed on the
+// canonical URL. Failed reads are not cached.
+type cachedReader struct {
+	inner  Reader
+	cache  Cache
+	ttl    time.Duration
+	maxAge time.Duration
+	stats  *cacheStats
+}
+
+func (r cachedReader) Read(ctx context.Context, rawURL string) (ReadResult, error) {
+	key := "page:" + canonicalOrRawURL(rawURL)
+	if data, ok := cacheLookup(ctx, r.cache, key, r.maxAge); ok {
+		var result ReadResult
+		if err := json.Unmarshal(data, &result); err == nil {
+			r.stats.hits.Add(1)
+			return result, nil
+		}
+	}
+	r.stats.misses.Add(1)
+
+	result, err := r.inner.Read(ctx, rawURL)
+	if err != nil {
+		return result, err
+	}
+	if data, err := json.Marshal(result); err == nil {
+		cacheStore(ctx, r.cache, key, data, r.ttl)
+	}
+	return result, nil
+}
+
+// searchCacheKey normalizes case, spacing and surrounding punctuation so
+// near-identical queries share an entry.
+func searchCacheKey(provider, query string, count int) string {
+	words := strings.Fields(strings.ToLower(query))
+	normalized := make([]string, 0, len(words))
+	for _, word := range words {
+		if trimmed := strings.Trim(word, `.,;:!?"'()[]{}`); trimmed != "" {
+			normalized = append(normalized, trimmed)
+		}
+	}
+	return "search:" + provider + ":" + strconv.Itoa(count) + ":" + strings.Join(normalized, " ")
+}
+
+func searcherName(searcher Searcher) string {
+	if named, ok := searcher.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return "default"
+}
+
+func cacheLookup(ctx context.Context, cache Cache, key string, maxAge time.Duration) ([]byte, bool) {
+	data, ok, err := cache.Get(ctx, key, maxAge)
+	if err != nil {
+		log.Printf("research cache lookup failed: err=%v", err)
+		return nil, false
+	}
+	return data, ok
+}
+
+func cacheStore(ctx context.Context, cache Cache, key string, value []byte, ttl time.Duration) {
+	if err := cache.Set(ctx, key, value, ttl); err != nil {
+		log.Printf("research cache store failed: err=%v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package research
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appdb "chat/backend/internal/db"
+	"chat/backend/internal/search"
+
+	_ "modernc.org/sqlite"
+)
+
+type countingSearcher struct {
+	inner searcherStub
+	calls *atomic.Int64
+}
+
+func (s countingSearcher) Search(ctx context.Context, query string, count int) ([]search.Result, error) {
+	s.calls.Add(1)
+	return s.inner.Search(ctx, query, count)
+}
+
+func TestMemoryCacheExpiresAndEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewMemoryCache(10)
+	cache.now = func() time.Time { return now }
+
+	_ = cache.Set(ctx, "a", []byte("aaaa"), time.Minute)
+	_ = cache.Set(ctx, "b", []byte("bbbb"), time.Hour)
+	if _, ok, _ := cache.Get(ctx, "a", 0); !ok {
+		t.Fatalf("expected a to be cached")
+	}
+	_ = cache.Set(ctx, "c", []byte("cccc"), time.Hour)
+	if _, ok, _ := cache.Get(ctx, "b", 0); ok {
+		t.Fatalf("expected least recently used entry b to be evicted")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := cache.Get(ctx, "a", 0); ok {
+		t.Fatalf("expected a to expire")
+	}
+	if value, ok, _ := cache.Get(ctx, "c", 0); !ok || string(value) != "cccc" {
+		t.Fatalf("expected c to survive, got %q ok=%t", value, ok)
+	}
+}
+
+func TestDBCacheExpiresAndStaysWithinMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	database, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	database.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = database.Close() })
+	if _, err := appdb.Migrate(ctx, database); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewDBCache(database, 10)
+	cache.now = func() time.Time { return now }
+
+	if err := cache.Set(ctx, "a", []byte("aaaa"), time.Minute); err != nil {
+		t.Fatalf("set a: %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := cache.Set(ctx, "b", []byte("bbbb"), time.Hour); err != nil {
+		t.Fatalf("set b: %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := cache.Set(ctx, "c", []byte("cccc"), time.Hour); err != nil {
+		t.Fatalf("set c: %v", err)
+	}
+	if _, ok, _ := cache.Get(ctx, "a", 0); ok {
+		t.Fatalf("expected oldest entry a to be evicted")
+	}
+	if value, ok, err := cache.Get(ctx, "c", 0); err != nil || !ok || string(value) != "cccc" {
+		t.Fatalf("expected c to be cached, got %q ok=%t err=%v", value, ok, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, ok, _ := cache.Get(ctx, "b", 0); ok {
+		t.Fatalf("expected b to expire")
+	}
+}
+
+func TestDBCacheSweepsExpiredRowsAtMostOncePerInterval(t *testing.T) {
+	ctx := context.Background()
+	database, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	database.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = database.Close() })
+	if _, err := appdb.Migrate(ctx, database); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewDBCache(database, 1<<20)
+	cache.now = func() time.Time { return now }
+	storedKeys := func() int {
+		t.Helper()
+		var count int
+		if err := database.QueryRow(`SELECT COUNT(*) FROM research_cache;`).Scan(&count); err != nil {
+			t.Fatalf("count cache rows: %v", err)
+		}
+		return count
+	}
+
+	if err := cache.Set(ctx, "a", []byte("aaaa"), time.Second); err != nil {
+		t.Fatalf("set a: %v", err)
+	}
+	now = now.Add(2 * time.Second)
+	if err := cache.Set(ctx, "b", []byte("bbbb"), time.Hour); err != nil {
+		t.Fatalf("set b: %v", err)
+	}
+	if got := storedKeys(); got != 2 {
+		t.Fatalf("expected the expired row to wait for the next sweep, got %d rows", got)
+	}
+	if _, ok, _ := cache.Get(ctx, "a", 0); ok {
+		t.Fatalf("expected expired entry a to be hidden before it is swept")
+	}
+
+	now = now.Add(dbCachePruneInterval)
+	if err := cache.Set(ctx, "c", []byte("cccc"), time.Hour); err != nil {
+		t.Fatalf("set c: %v", err)
+	}
+	if got := storedKeys(); got != 2 {
+		t.Fatalf("expected the expired row to be swept once the interval passed, got %d rows", got)
+	}
+}
+
+func TestCachesMissEntriesOlderThanMaxAge(t *testing.T) {
+	ctx := context.Background()
+	database, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	database.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = database.Close() })
+	if _, err := appdb.Migrate(ctx, database); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	memory := NewMemoryCache(1 << 20)
+	memory.now = func() time.Time { return now }
+	db := NewDBCache(database, 1<<20)
+	db.now = func() time.Time { return now }
+
+	for name, cache := range map[string]Cache{"memory": memory, "db": db} {
+		if err := cache.Set(ctx, name, []byte("value"), time.Hour); err != nil {
+			t.Fatalf("%s: set: %v", name, err)
+		}
+	}
+	now = now.Add(10 * time.Minute)
+	for name, cache := range map[string]Cache{"memory": memory, "db": db} {
+		if _, ok, err := cache.Get(ctx, name, 5*time.Minute); err != nil || ok {
+			t.Fatalf("%s: expected an entry older than maxAge to miss, got ok=%t err=%v", name, ok, err)
+		}
+		if _, ok, err := cache.Get(ctx, name, 15*time.Minute); err != nil || !ok {
+			t.Fatalf("%s: expected an entry within maxAge to hit, got ok=%t err=%v", name, ok, err)
+		}
+		if _, ok, err := cache.Get(ctx, name, 0); err != nil || !ok {
+			t.Fatalf("%s: expected no maxAge to accept any unexpired entry, got ok=%t err=%v", name, ok, err)
+		}
+	}
+}
+
+func TestSearchCacheKeyNormalizesQueries(t *testing.T) {
+	a := searchCacheKey("brave", "  Go  generics? ", 5)
+	b := searchCacheKey("brave", "go Generics", 5)
+	if a != b {
+		t.Fatalf("expected equal keys, got %q and %q", a, b)
+	}
+	if a == searchCacheKey("tavily", "go generics", 5) {
+		t.Fatalf("expected provider to be part of the key")
+	}
+}
+
+func TestOrchestratorServesRepeatedRunsFromCache(t *testing.T) {
+	var calls atomic.Int64
+	searcher := countingSearcher{
+		inner: searcherStub{responses: map[string][]search.Result{"q1": {{URL: "https://example.com/a", Title: "A", Snippet: "snippet"}}}},
+		calls: &calls,
+	}
+	reader := readerStub{responses: map[string]ReadResult{
+		"https://example.com/a": {URL: "https://example.com/a", FinalURL: "https://example.com/a", ContentType: "text/plain", Text: "full text a", Snippet: "full text a", FetchStatus: "ok", FetchedAt: time.Now().UTC()},
+	}}
+	orchestrator := NewOrchestrator(
+		searcher,
+		plannerStub{
+			initial: PlannerDecision{NextAction: NextActionSearchMore, Queries: []string{"q1"}},
+			eval:    PlannerDecision{NextAction: NextActionFinalize},
+		},
+		reader,
+		OrchestratorConfig{
+			MaxLoops:          1,
+			MaxSearchQueries:  2,
+			MaxSourcesRead:    2,
+			MaxCitations:      4,
+			SearchResultsPerQ: 3,
+			Cache:             NewMemoryCache(1 << 20),
+			SearchCacheTTL:    time.Hour,
+			PageCacheTTL:      time.Hour,
+		},
+	)
+
+	first, err := orchestrator.Run(context.Background(), "question", false, nil)
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if first.CacheHits != 0 || first.CacheMisses == 0 {
+		t.Fatalf("expected only misses on first run, got hits=%d misses=%d", first.CacheHits, first.CacheMisses)
+	}
+
+	var last Progress
+	second, err := orchestrator.Run(context.Background(), "question", false, func(progress Progress) {
+		last = progress
+	})
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected one upstream search, got %d", calls.Load())
+	}
+	if second.CacheHits != first.CacheMisses || second.CacheMisses != 0 {
+		t.Fatalf("expected second run to hit cache, got hits=%d misses=%d", second.CacheHits, second.CacheMisses)
+	}
+	if last.CacheHits == 0 {
+		t.Fatalf("expected progress to report cache hits")
+	}
+	if second.SourcesRead != 1 {
+		t.Fatalf("expected cached page to count as read, got %d", second.SourcesRead)
+	}
+}
+
+func TestOrchestratorTimeSensitiveRunsSkipOlderCacheEntries(t *testing.T) {
+	var calls atomic.Int64
+	searcher := countingSearcher{
+		inner: searcherStub{responses: map[string][]search.Result{"q1": {{URL: "https://example.com/a", Title: "A", Snippet: "snippet"}}}},
+		calls: &calls,
+	}
+	reader := readerStub{responses: map[string]ReadResult{
+		"https://example.com/a": {URL: "https://example.com/a", FinalURL: "https://example.com/a", ContentType: "text/plain", Text: "full text a", Snippet: "full text a", FetchStatus: "ok", FetchedAt: time.Now().UTC()},
+	}}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewMemoryCache(1 << 20)
+	cache.now = func() time.Time { return now }
+	orchestrator := NewOrchestrator(
+		searcher,
+		plannerStub{
+			initial: PlannerDecision{NextAction: NextActionSearchMore, Queries: []string{"q1"}},
+			eval:    PlannerDecision{NextAction: NextActionFinalize},
+		},
+		reader,
+		OrchestratorConfig{
+			MaxLoops:              1,
+			MaxSearchQueries:      2,
+			MaxSourcesRead:        2,
+			MaxCitations:          4,
+			SearchResultsPerQ:     3,
+			Cache:                 cache,
+			SearchCacheTTL:        time.Hour,
+			PageCacheTTL:          time.Hour,
+			TimeSensitiveCacheTTL: 5 * time.Minute,
+		},
+	)
+
+	if _, err := orchestrator.Run(context.Background(), "question", false, nil); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	now = now.Add(10 * time.Minute)
+	if _, err := orchestrator.Run(context.Background(), "question", false, nil); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected a normal run to reuse the entry, got %d searches", calls.Load())
+	}
+
+	sensitive, err := orchestrator.Run(context.Background(), "question", true, nil)
+	if err != nil {
+		t.Fatalf("time-sensitive run: %v", err)
+	}
+	if calls.Load() != 2 || sensitive.CacheHits != 0 {
+		t.Fatalf("expected a time-sensitive run to skip entries older than its TTL, got searches=%d hits=%d", calls.Load(), sensitive.CacheHits)
+	}
+}
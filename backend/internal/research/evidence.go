@@ -3,6 +3,7 @@ package research
 import (
 	"math"
 	"net/url"
+	"slices"
 	"sort"
 	"strings"
 )
@@ -167,6 +168,11 @@ func mergeCitation(base, incoming Citation) Citation {
 	if out.SourceProvider == "" {
 		out.SourceProvider = incoming.SourceProvider
 	}
+	for _, provider := range incoming.Providers {
+		if !slices.Contains(out.Providers, provider) {
+			out.Providers = append(slices.Clip(out.Providers), provider)
+		}
+	}
 	if incoming.Query != "" {
 		out.Query = incoming.Query
 	}
@@ -0,0 +1,101 @@
+package research
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"chat/backend/internal/search"
+)
+
+const (
+	defaultReaderHostConcurrency = 2
+	maxHostLimiterHosts          = 1024
+)
+
+// hostLimiter spaces requests to the same host and caps how many run at
+// once. It is shared by every read through an HTTPReader, unlike the
+// per-run limits in readCandidates.
+type hostLimiter struct {
+	concurrency int
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	slots chan struct{}
+	next  time.Time
+}
+
+// heldHostKey marks a request context that already holds a slot for the
+// *heldHost it carries, so the robots.txt check on the request's redirects
+// does not wait for a second slot on the same host.
+type heldHostKey struct{}
+
+// heldHost is the host slot a read currently holds. A redirect to another
+// host swaps it for a slot on the new host.
+type heldHost struct {
+	host    string
+	release func()
+}
+
+// holds reports whether ctx already holds a slot for host.
+func holdsHost(ctx context.Context, host string) bool {
+	held, _ := ctx.Value(heldHostKey{}).(*heldHost)
+	return held != nil && strings.EqualFold(held.host, host)
+}
+
+func newHostLimiter(concurrency int) *hostLimiter {
+	return &hostLimiter{concurrency: concurrency, hosts: make(map[string]*hostState)}
+}
+
+// acquire waits for a free slot on host and until interval has passed since
+// the previous request to it. The returned release must be called once the
+// request is done.
+func (l *hostLimiter) acquire(ctx context.Context, host string, interval time.Duration) (func(), error) {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	state, ok := l.hosts[host]
+	if !ok {
+		if len(l.hosts) >= maxHostLimiterHosts {
+			l.pruneLocked(time.Now())
+		}
+		state = &hostState{slots: make(chan struct{}, l.concurrency)}
+		l.hosts[host] = state
+	}
+	l.mu.Unlock()
+
+	select {
+	case state.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-state.slots }
+
+	l.mu.Lock()
+	now := time.Now()
+	start := state.next
+	if start.Before(now) {
+		start = now
+	}
+	state.next = start.Add(interval)
+	l.mu.Unlock()
+
+	if err := search.Wait(ctx, start.Sub(now)); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// pruneLocked drops idle hosts whose spacing has already elapsed.
+func (l *hostLimiter) pruneLocked(now time.Time) {
+	for host, state := range l.hosts {
+		if len(state.slots) == 0 && !now.Before(state.next) {
+			delete(l.hosts, host)
+		}
+	}
+}
@@ -8,16 +8,22 @@ import (
 	"net"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"chat/backend/internal/brave"
+	"chat/backend/internal/search"
 )
 
 type Orchestrator struct {
 	planner  Planner
 	searcher Searcher
-	reader   Reader
-	cfg      OrchestratorConfig
+	// providers is set when searcher fronts more than one provider; each
+	// query then fans out to all of them.
+	providers []search.Provider
+	reader    Reader
+	cfg       OrchestratorConfig
+	// cacheStats is set per run when cfg.Cache is configured.
+	cacheStats *cacheStats
 }
 
 func NewOrchestrator(searcher Searcher, planner Planner, reader Reader, cfg OrchestratorConfig) Orchestrator {
@@ -45,12 +51,24 @@ func NewOrchestrator(searcher Searcher, planner Planner, reader Reader, cfg Orch
 	if cfg.SourceMaxBytes <= 0 {
 		cfg.SourceMaxBytes = defaultSourceMaxBytes
 	}
+	if cfg.ReadConcurrency < 1 {
+		cfg.ReadConcurrency = defaultReadConcurrency
+	}
+	if cfg.PerHostReadConcurrency < 1 {
+		cfg.PerHostReadConcurrency = defaultPerHostReadConcurrency
+	}
+
+	var providers []search.Provider
+	if multi, ok := searcher.(MultiSearcher); ok && len(multi.Providers()) > 1 {
+		providers = multi.Providers()
+	}
 
 	return Orchestrator{
-		planner:  planner,
-		searcher: searcher,
-		reader:   reader,
-		cfg:      cfg,
+		planner:   planner,
+		searcher:  searcher,
+		providers: providers,
+		reader:    reader,
+		cfg:       cfg,
 	}
 }
 
@@ -81,6 +99,17 @@ func (o Orchestrator) Run(ctx context.Context, question string, timeSensitive bo
 		}, nil
 	}
 
+	if o.cfg.Cache != nil {
+		o = o.withCache(timeSensitive)
+		inner := onProgress
+		if inner != nil {
+			onProgress = func(progress Progress) {
+				progress.CacheHits, progress.CacheMisses = o.cacheStats.counts()
+				inner(progress)
+			}
+		}
+	}
+
 	pool := NewEvidencePool()
 	warnings := make([]string, 0, 4)
 	previousQueries := make([]string, 0, o.cfg.MaxSearchQueries)
@@ -197,14 +226,26 @@ func (o Orchestrator) Run(ctx context.Context, question string, timeSensitive bo
 
 			usedQueries++
 			previousQueries = append(previousQueries, query)
+			if len(o.providers) > 0 {
+				fused, providerWarnings := o.fanOutSearch(runCtx, query, loop, timeSensitive)
+				lastSearchAttemptAt = time.Now()
+				for _, warning := range providerWarnings {
+					warnings = appendUniqueWarning(warnings, warning)
+				}
+				for _, candidate := range fused {
+					pool.AddSearchCandidate(candidate, timeSensitive)
+					candidates = append(candidates, candidate)
+				}
+				continue
+			}
 			results, searchErr := o.searcher.Search(runCtx, query, o.cfg.SearchResultsPerQ)
 			lastSearchAttemptAt = time.Now()
-			if searchErr != nil && isBraveRateLimitError(searchErr) {
+			if searchErr != nil && isSearchRateLimitError(searchErr) {
 				retryDelay := o.cfg.MinSearchInterval
 				if retryDelay <= 0 {
 					retryDelay = defaultRateLimitRetryDelay
 				}
-				if waitErr := waitForRetry(runCtx, retryDelay); waitErr != nil {
+				if waitErr := search.Wait(runCtx, retryDelay); waitErr != nil {
 					return o.resultWithStop(pool, loop-1, usedQueries, sourcesConsidered, sourcesRead, readAttempts, readFailures, readFailureReasons, warnings, StopReasonTimeout), waitErr
 				}
 				if err := waitBeforeSearchAttempt(runCtx, &lastSearchAttemptAt, o.cfg.MinSearchInterval); err != nil {
@@ -215,7 +256,7 @@ func (o Orchestrator) Run(ctx context.Context, question string, timeSensitive bo
 			}
 			if searchErr != nil {
 				statusCode := 0
-				var apiErr brave.APIError
+				var apiErr search.APIError
 				if errors.As(searchErr, &apiErr) {
 					statusCode = apiErr.StatusCode
 				}
@@ -226,8 +267,8 @@ func (o Orchestrator) Run(ctx context.Context, question string, timeSensitive bo
 					statusCode,
 					searchErr,
 				)
-				if errors.Is(searchErr, brave.ErrMissingAPIKey) {
-					warnings = appendUniqueWarning(warnings, "Grounding is unavailable because BRAVE_API_KEY is not configured.")
+				if errors.Is(searchErr, search.ErrNotConfigured) {
+					warnings = appendUniqueWarning(warnings, "Grounding is unavailable because the web search provider is not configured.")
 				} else {
 					warnings = appendUniqueWarning(warnings, "A web search pass failed; continuing with available evidence.")
 				}
@@ -275,25 +316,54 @@ func (o Orchestrator) Run(ctx context.Context, question string, timeSensitive bo
 			Decision:       DecisionFromNextAction(decision.NextAction),
 		}))
 
+		toRead := make([]Citation, 0, len(candidates))
 		for _, candidate := range candidates {
 			if pool.HasRead(candidate.URL) {
 				continue
 			}
 			sourcesConsidered++
-			if o.reader == nil {
-				continue
-			}
-			readAttempts++
-			readResult, readErr := o.reader.Read(runCtx, candidate.URL)
-			if readErr != nil {
-				readFailures++
-				readFailureReasons[classifyReadFailure(readErr, readResult)]++
-				continue
-			}
-			pool.AddReadResult(candidate, readResult, timeSensitive)
-			sourcesRead++
-			if sourcesRead >= o.cfg.MaxSourcesRead {
-				break
+			toRead = append(toRead, candidate)
+		}
+		if o.reader != nil {
+			// Reads run concurrently and report progress as they finish, but are
+			// merged into the pool in candidate order so results do not depend
+			// on which host answered first.
+			completed := 0
+			succeeded := 0
+			reads := o.readCandidates(runCtx, toRead, func(candidate Citation, read sourceRead) {
+				completed++
+				title := "Read a source"
+				if read.err == nil {
+					succeeded++
+				} else {
+					title = "Could not read a source"
+				}
+				emitProgress(onProgress, Progress{
+					Phase:             PhaseReading,
+					Message:           fmt.Sprintf("Read %d of %d sources", completed, len(toRead)),
+					Title:             title,
+					Detail:            candidate.URL,
+					IsQuickStep:       true,
+					Loop:              loop,
+					MaxLoops:          o.cfg.MaxLoops,
+					Pass:              loop,
+					TotalPasses:       o.cfg.MaxLoops,
+					SourcesRead:       sourcesRead + succeeded,
+					SourcesConsidered: sourcesConsidered,
+				})
+			})
+			for i, read := range reads {
+				if !read.started {
+					continue
+				}
+				readAttempts++
+				if read.err != nil {
+					readFailures++
+					readFailureReasons[classifyReadFailure(read.err, read.result)]++
+					continue
+				}
+				pool.AddReadResult(toRead[i], read.result, timeSensitive)
+				sourcesRead++
 			}
 		}
 
@@ -396,6 +466,7 @@ func (o Orchestrator) resultWithStop(
 		Warnings:           warnings,
 		StopReason:         stop,
 	}
+	result.CacheHits, result.CacheMisses = o.cacheStats.counts()
 	if len(warnings) > 0 {
 		result.Warning = warnings[0]
 	}
@@ -439,6 +510,9 @@ func classifyReadFailure(err error, result ReadResult) string {
 		return "timeout"
 	}
 
+	if status == "robots_disallowed" || errors.Is(err, errRobotsDisallowed) {
+		return "robots_disallowed"
+	}
 	if status == "blocked" ||
 		errors.Is(err, errInvalidURLScheme) ||
 		errors.Is(err, errBlockedURLHost) ||
@@ -472,6 +546,95 @@ func classifyReadFailure(err error, result ReadResult) string {
 	return "other"
 }
 
+// withCache returns a copy of o whose searcher, providers and reader go
+// through cfg.Cache, counting hits and misses for this run. Time-sensitive
+// runs write with the shorter TTL and only read entries written within it,
+// whichever run stored them.
+func (o Orchestrator) withCache(timeSensitive bool) Orchestrator {
+	searchTTL, pageTTL := o.cfg.SearchCacheTTL, o.cfg.PageCacheTTL
+	var maxAge time.Duration
+	if timeSensitive && o.cfg.TimeSensitiveCacheTTL > 0 {
+		searchTTL = minDuration(searchTTL, o.cfg.TimeSensitiveCacheTTL)
+		pageTTL = minDuration(pageTTL, o.cfg.TimeSensitiveCacheTTL)
+		maxAge = o.cfg.TimeSensitiveCacheTTL
+	}
+
+	stats := &cacheStats{}
+	o.cacheStats = stats
+	o.searcher = cachedSearcher{inner: o.searcher, name: searcherName(o.searcher), cache: o.cfg.Cache, ttl: searchTTL, maxAge: maxAge, stats: stats}
+	if len(o.providers) > 0 {
+		providers := make([]search.Provider, 0, len(o.providers))
+		for _, provider := range o.providers {
+			providers = append(providers, cachedSearcher{inner: provider, name: provider.Name(), cache: o.cfg.Cache, ttl: searchTTL, maxAge: maxAge, stats: stats})
+		}
+		o.providers = providers
+	}
+	if o.reader != nil {
+		o.reader = cachedReader{inner: o.reader, cache: o.cfg.Cache, ttl: pageTTL, maxAge: maxAge, stats: stats}
+	}
+	return o
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// fanOutSearch runs query against every provider at once and fuses the
+// rankings. A provider that fails becomes a warning; the others still count.
+func (o Orchestrator) fanOutSearch(ctx context.Context, query string, loop int, timeSensitive bool) ([]Citation, []string) {
+	lists := make([][]search.Result, len(o.providers))
+	errs := make([]error, len(o.providers))
+	var wg sync.WaitGroup
+	for i, provider := range o.providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := provider.Search(ctx, query, o.cfg.SearchResultsPerQ)
+			if err != nil && isSearchRateLimitError(err) {
+				retryDelay := o.cfg.MinSearchInterval
+				if retryDelay <= 0 {
+					retryDelay = defaultRateLimitRetryDelay
+				}
+				if waitErr := search.Wait(ctx, retryDelay); waitErr == nil {
+					results, err = provider.Search(ctx, query, o.cfg.SearchResultsPerQ)
+				}
+			}
+			lists[i], errs[i] = results, err
+		}()
+	}
+	wg.Wait()
+
+	var warnings []string
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		name := o.providers[i].Name()
+		statusCode := 0
+		var apiErr search.APIError
+		if errors.As(err, &apiErr) {
+			statusCode = apiErr.StatusCode
+		}
+		log.Printf(
+			"research search failed: provider=%s loop=%d query_chars=%d status_code=%d err=%v",
+			name,
+			loop,
+			len([]rune(strings.TrimSpace(query))),
+			statusCode,
+			err,
+		)
+		if errors.Is(err, search.ErrNotConfigured) {
+			warnings = append(warnings, fmt.Sprintf("The %s search provider is not configured; continuing with the other providers.", name))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("The %s search provider failed; continuing with the other providers.", name))
+		}
+	}
+	return fuseSearchResults(query, loop, timeSensitive, lists), warnings
+}
+
 func dedupeCandidateCitations(citations []Citation) []Citation {
 	if len(citations) == 0 {
 		return nil
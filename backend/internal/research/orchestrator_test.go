@@ -4,10 +4,11 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
-	"chat/backend/internal/brave"
+	"chat/backend/internal/search"
 )
 
 type plannerStub struct {
@@ -42,12 +43,12 @@ func (p *plannerCallCounter) EvaluateEvidence(_ context.Context, _ PlannerInput)
 }
 
 type searcherStub struct {
-	responses map[string][]brave.SearchResult
+	responses map[string][]search.Result
 	err       error
 	block     bool
 }
 
-func (s searcherStub) Search(ctx context.Context, query string, _ int) ([]brave.SearchResult, error) {
+func (s searcherStub) Search(ctx context.Context, query string, _ int) ([]search.Result, error) {
 	if s.block {
 		<-ctx.Done()
 		return nil, ctx.Err()
@@ -82,7 +83,7 @@ func (r readerStub) Read(_ context.Context, rawURL string) (ReadResult, error) {
 
 func TestOrchestratorTerminatesAtMaxLoops(t *testing.T) {
 	orchestrator := NewOrchestrator(
-		searcherStub{responses: map[string][]brave.SearchResult{"q1": {{URL: "https://example.com/a", Title: "A", Snippet: "snippet"}}}},
+		searcherStub{responses: map[string][]search.Result{"q1": {{URL: "https://example.com/a", Title: "A", Snippet: "snippet"}}}},
 		plannerStub{
 			initial: PlannerDecision{NextAction: NextActionSearchMore, Queries: []string{"q1"}},
 			eval:    PlannerDecision{NextAction: NextActionSearchMore, Queries: []string{"q1"}},
@@ -105,7 +106,7 @@ func TestOrchestratorTerminatesAtMaxLoops(t *testing.T) {
 
 func TestOrchestratorEnforcesQueryAndReadCaps(t *testing.T) {
 	orchestrator := NewOrchestrator(
-		searcherStub{responses: map[string][]brave.SearchResult{
+		searcherStub{responses: map[string][]search.Result{
 			"q1": {{URL: "https://example.com/a", Title: "A", Snippet: "snippet a"}},
 			"q2": {{URL: "https://example.com/b", Title: "B", Snippet: "snippet b"}},
 			"q3": {{URL: "https://example.com/c", Title: "C", Snippet: "snippet c"}},
@@ -173,7 +174,7 @@ func TestOrchestratorCallsInitialPlannerOnlyOnFirstLoop(t *testing.T) {
 		eval:    PlannerDecision{NextAction: NextActionSearchMore, Queries: []string{"q1"}},
 	}
 	orchestrator := NewOrchestrator(
-		searcherStub{responses: map[string][]brave.SearchResult{
+		searcherStub{responses: map[string][]search.Result{
 			"q1": {
 				{URL: "https://example.com/a", Title: "A", Snippet: "snippet a"},
 			},
@@ -200,7 +201,7 @@ func TestOrchestratorCallsInitialPlannerOnlyOnFirstLoop(t *testing.T) {
 
 func TestOrchestratorWarnsOnlyWhenAllReadAttemptsFail(t *testing.T) {
 	orchestrator := NewOrchestrator(
-		searcherStub{responses: map[string][]brave.SearchResult{
+		searcherStub{responses: map[string][]search.Result{
 			"q1": {
 				{URL: "https://example.com/a", Title: "A", Snippet: "snippet a"},
 				{URL: "https://example.com/b", Title: "B", Snippet: "snippet b"},
@@ -245,7 +246,7 @@ func TestOrchestratorWarnsOnlyWhenAllReadAttemptsFail(t *testing.T) {
 
 func TestOrchestratorWarnsWhenAllReadAttemptsFail(t *testing.T) {
 	orchestrator := NewOrchestrator(
-		searcherStub{responses: map[string][]brave.SearchResult{
+		searcherStub{responses: map[string][]search.Result{
 			"q1": {
 				{URL: "https://example.com/a", Title: "A", Snippet: "snippet a"},
 				{URL: "https://example.com/b", Title: "B", Snippet: "snippet b"},
@@ -286,3 +287,113 @@ func TestOrchestratorWarnsWhenAllReadAttemptsFail(t *testing.T) {
 		t.Fatalf("expected fallback warning message, got %+v", result.Warnings)
 	}
 }
+
+func TestRankSearchResultsKeepsResultProvider(t *testing.T) {
+	ranked := rankSearchResults("go release", 1, false, []search.Result{
+		{URL: "https://go.dev/doc/devel/release", Title: "Release History", Snippet: "Go release notes", Provider: "searxng"},
+	})
+	if len(ranked) != 1 || ranked[0].SourceProvider != "searxng" {
+		t.Fatalf("expected the search provider on the citation, got %+v", ranked)
+	}
+}
+
+type providerStub struct {
+	name    string
+	results []search.Result
+	err     error
+	// arrived is marked done when the search starts; the stub then waits for
+	// every provider to arrive so a sequential fan-out would time out.
+	arrived *sync.WaitGroup
+}
+
+func (p providerStub) Name() string {
+	return p.name
+}
+
+func (p providerStub) Search(ctx context.Context, _ string, _ int) ([]search.Result, error) {
+	if p.arrived != nil {
+		p.arrived.Done()
+		allArrived := make(chan struct{})
+		go func() {
+			p.arrived.Wait()
+			close(allArrived)
+		}()
+		select {
+		case <-allArrived:
+		case <-time.After(time.Second):
+			return nil, errors.New("providers were not queried concurrently")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return p.results, p.err
+}
+
+type multiSearcherStub struct {
+	providers []search.Provider
+}
+
+func (m multiSearcherStub) Search(context.Context, string, int) ([]search.Result, error) {
+	return nil, errors.New("the orchestrator should fan out to each provider")
+}
+
+func (m multiSearcherStub) Providers() []search.Provider {
+	return m.providers
+}
+
+func TestOrchestratorFansOutToProvidersAndFusesRankings(t *testing.T) {
+	var arrived sync.WaitGroup
+	arrived.Add(3)
+	searcher := multiSearcherStub{providers: []search.Provider{
+		providerStub{name: "brave", arrived: &arrived, results: []search.Result{
+			{URL: "https://only-brave.example.com/a", Title: "Only Brave", Snippet: "go release notes", Provider: "brave"},
+			{URL: "https://shared.example.com/notes/", Title: "Shared", Snippet: "go release notes", Provider: "brave"},
+		}},
+		providerStub{name: "searxng", arrived: &arrived, results: []search.Result{
+			{URL: "https://Shared.example.com/notes?utm_source=searx", Title: "Shared", Snippet: "go release notes", Provider: "searxng"},
+			{URL: "https://only-searx.example.com/b", Title: "Only SearXNG", Snippet: "go release notes", Provider: "searxng"},
+		}},
+		providerStub{name: "tavily", arrived: &arrived, err: search.APIError{Provider: "tavily", StatusCode: 503, Body: "down"}},
+	}}
+	orchestrator := NewOrchestrator(searcher, plannerStub{
+		initial: PlannerDecision{NextAction: NextActionSearchMore, Queries: []string{"go release notes"}},
+		eval:    PlannerDecision{NextAction: NextActionFinalize},
+	}, nil, OrchestratorConfig{MaxLoops: 1, MaxSearchQueries: 1, MaxSourcesRead: 1, MaxCitations: 5, SearchResultsPerQ: 5})
+
+	result, err := orchestrator.Run(context.Background(), "go release notes", false, nil)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if len(result.Citations) != 3 {
+		t.Fatalf("expected the shared URL to be fused into one citation, got %+v", result.Citations)
+	}
+	shared := result.Citations[0]
+	if !strings.Contains(shared.URL, "shared.example.com") || shared.SourceProvider != "searxng" || len(shared.Providers) != 2 {
+		t.Fatalf("expected the URL found by both providers to rank first with both origins, got %+v", shared)
+	}
+	providers := map[string]string{}
+	for _, citation := range result.Citations[1:] {
+		providers[citation.URL] = citation.SourceProvider
+	}
+	if providers["https://only-brave.example.com/a"] != "brave" || providers["https://only-searx.example.com/b"] != "searxng" {
+		t.Fatalf("expected single-provider hits to keep their origin, got %+v", result.Citations)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "tavily") {
+		t.Fatalf("expected the failed provider to become a warning, got %v", result.Warnings)
+	}
+}
+
+func TestFuseSearchResultsRewardsAgreementAcrossProviders(t *testing.T) {
+	fused := fuseSearchResults("query", 1, false, [][]search.Result{
+		{{URL: "https://a.example.com", Title: "A", Provider: "brave"}, {URL: "https://b.example.com", Title: "B", Provider: "brave"}},
+		{{URL: "https://c.example.com", Title: "C", Provider: "tavily"}, {URL: "https://b.example.com/", Title: "B", Snippet: "longer snippet", Provider: "tavily"}},
+	})
+
+	if len(fused) != 3 || fused[0].URL != "https://b.example.com" {
+		t.Fatalf("expected the URL both providers returned to rank first, got %+v", fused)
+	}
+	if fused[0].SourceProvider != "brave" || fused[0].Snippet != "longer snippet" || strings.Join(fused[0].Providers, ",") != "brave,tavily" {
+		t.Fatalf("unexpected fused citation: %+v", fused[0])
+	}
+}
@@ -146,7 +146,7 @@ func (HeuristicPlanner) EvaluateEvidence(input PlannerInput) PlannerDecision {
 }
 
 func parsePlannerDecision(raw string) (PlannerDecision, error) {
-	jsonRaw := extractJSONBlock(raw)
+	jsonRaw := ExtractJSONBlock(raw)
 	if jsonRaw == "" {
 		return PlannerDecision{}, errors.New("planner response did not include json")
 	}
@@ -233,7 +233,9 @@ func dedupeStrings(values []string) []string {
 	return out
 }
 
-func extractJSONBlock(raw string) string {
+// ExtractJSONBlock returns the outermost {...} span of raw, tolerating prose or
+// code fences around it. It returns "" when raw holds no object.
+func ExtractJSONBlock(raw string) string {
 	value := strings.TrimSpace(raw)
 	if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
 		return value
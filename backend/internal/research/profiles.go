@@ -10,46 +10,61 @@ const (
 )
 
 const (
-	defaultChatMaxLoops                = 2
-	defaultChatMaxSourcesRead          = 4
-	defaultChatMaxSearchQueries        = 4
-	defaultChatMaxCitations            = 8
-	defaultChatTimeout                 = 20 * time.Second
-	defaultDeepMaxLoops                = 6
-	defaultDeepMaxSourcesRead          = 16
-	defaultDeepMaxSearchQueries        = 18
-	defaultDeepMaxCitations            = 12
-	defaultDeepTimeout                 = 150 * time.Second
-	defaultSearchResultsPerQuery       = 6
-	defaultSourceFetchTimeout          = 12 * time.Second
-	defaultSourceMaxBytes        int64 = 1_500_000
+	defaultChatMaxLoops                 = 2
+	defaultChatMaxSourcesRead           = 4
+	defaultChatMaxSearchQueries         = 4
+	defaultChatMaxCitations             = 8
+	defaultChatTimeout                  = 20 * time.Second
+	defaultDeepMaxLoops                 = 6
+	defaultDeepMaxSourcesRead           = 16
+	defaultDeepMaxSearchQueries         = 18
+	defaultDeepMaxCitations             = 12
+	defaultDeepTimeout                  = 150 * time.Second
+	defaultSearchResultsPerQuery        = 6
+	defaultSourceFetchTimeout           = 12 * time.Second
+	defaultSourceMaxBytes         int64 = 1_500_000
+	defaultReadConcurrency              = 4
+	defaultPerHostReadConcurrency       = 2
+	defaultSearchCacheTTL               = time.Hour
+	defaultPageCacheTTL                 = 6 * time.Hour
+	defaultTimeSensitiveCacheTTL        = 5 * time.Minute
 )
 
 func DefaultProfile(mode ModeProfile) OrchestratorConfig {
 	switch mode {
 	case ModeDeepResearch:
 		return OrchestratorConfig{
-			MaxLoops:           defaultDeepMaxLoops,
-			MaxSourcesRead:     defaultDeepMaxSourcesRead,
-			MaxSearchQueries:   defaultDeepMaxSearchQueries,
-			MaxCitations:       defaultDeepMaxCitations,
-			SearchResultsPerQ:  defaultSearchResultsPerQuery,
-			Timeout:            defaultDeepTimeout,
-			MinSearchInterval:  defaultRateLimitRetryDelay,
-			SourceFetchTimeout: defaultSourceFetchTimeout,
-			SourceMaxBytes:     defaultSourceMaxBytes,
+			MaxLoops:               defaultDeepMaxLoops,
+			MaxSourcesRead:         defaultDeepMaxSourcesRead,
+			MaxSearchQueries:       defaultDeepMaxSearchQueries,
+			MaxCitations:           defaultDeepMaxCitations,
+			SearchResultsPerQ:      defaultSearchResultsPerQuery,
+			Timeout:                defaultDeepTimeout,
+			MinSearchInterval:      defaultRateLimitRetryDelay,
+			SourceFetchTimeout:     defaultSourceFetchTimeout,
+			SourceMaxBytes:         defaultSourceMaxBytes,
+			ReadConcurrency:        defaultReadConcurrency,
+			PerHostReadConcurrency: defaultPerHostReadConcurrency,
+			SearchCacheTTL:         defaultSearchCacheTTL,
+			PageCacheTTL:           defaultPageCacheTTL,
+			TimeSensitiveCacheTTL:  defaultTimeSensitiveCacheTTL,
 		}
 	default:
 		return OrchestratorConfig{
-			MaxLoops:           defaultChatMaxLoops,
-			MaxSourcesRead:     defaultChatMaxSourcesRead,
-			MaxSearchQueries:   defaultChatMaxSearchQueries,
-			MaxCitations:       defaultChatMaxCitations,
-			SearchResultsPerQ:  defaultSearchResultsPerQuery,
-			Timeout:            defaultChatTimeout,
-			MinSearchInterval:  0,
-			SourceFetchTimeout: defaultSourceFetchTimeout,
-			SourceMaxBytes:     defaultSourceMaxBytes,
+			MaxLoops:               defaultChatMaxLoops,
+			MaxSourcesRead:         defaultChatMaxSourcesRead,
+			MaxSearchQueries:       defaultChatMaxSearchQueries,
+			MaxCitations:           defaultChatMaxCitations,
+			SearchResultsPerQ:      defaultSearchResultsPerQuery,
+			Timeout:                defaultChatTimeout,
+			MinSearchInterval:      0,
+			SourceFetchTimeout:     defaultSourceFetchTimeout,
+			SourceMaxBytes:         defaultSourceMaxBytes,
+			ReadConcurrency:        defaultReadConcurrency,
+			PerHostReadConcurrency: defaultPerHostReadConcurrency,
+			SearchCacheTTL:         defaultSearchCacheTTL,
+			PageCacheTTL:           defaultPageCacheTTL,
+			TimeSensitiveCacheTTL:  defaultTimeSensitiveCacheTTL,
 		}
 	}
 }
@@ -84,6 +99,24 @@ func ResolveProfile(mode ModeProfile, overrides OrchestratorConfig) Orchestrator
 	if overrides.SourceMaxBytes > 0 {
 		resolved.SourceMaxBytes = overrides.SourceMaxBytes
 	}
+	if overrides.ReadConcurrency > 0 {
+		resolved.ReadConcurrency = overrides.ReadConcurrency
+	}
+	if overrides.PerHostReadConcurrency > 0 {
+		resolved.PerHostReadConcurrency = overrides.PerHostReadConcurrency
+	}
+	if overrides.Cache != nil {
+		resolved.Cache = overrides.Cache
+	}
+	if overrides.SearchCacheTTL > 0 {
+		resolved.SearchCacheTTL = overrides.SearchCacheTTL
+	}
+	if overrides.PageCacheTTL > 0 {
+		resolved.PageCacheTTL = overrides.PageCacheTTL
+	}
+	if overrides.TimeSensitiveCacheTTL > 0 {
+		resolved.TimeSensitiveCacheTTL = overrides.TimeSensitiveCacheTTL
+	}
 
 	if resolved.MaxLoops < 1 {
 		resolved.MaxLoops = 1
@@ -106,6 +139,12 @@ func ResolveProfile(mode ModeProfile, overrides OrchestratorConfig) Orchestrator
 	if resolved.SourceMaxBytes <= 0 {
 		resolved.SourceMaxBytes = defaultSourceMaxBytes
 	}
+	if resolved.ReadConcurrency < 1 {
+		resolved.ReadConcurrency = defaultReadConcurrency
+	}
+	if resolved.PerHostReadConcurrency < 1 {
+		resolved.PerHostReadConcurrency = defaultPerHostReadConcurrency
+	}
 
 	return resolved
 }
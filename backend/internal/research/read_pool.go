@@ -0,0 +1,84 @@
+package research
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// sourceRead is the outcome of reading one candidate. started is false when
+// the run ended before the read could begin, so it does not count as an
+// attempt.
+type sourceRead struct {
+	result  ReadResult
+	err     error
+	started bool
+}
+
+// readCandidates reads candidates concurrently, at most ReadConcurrency at a
+// time and PerHostReadConcurrency per host. onRead is called once per started
+// read, in completion order and never concurrently. The returned outcomes are
+// in candidate order so callers can merge them deterministically.
+func (o Orchestrator) readCandidates(ctx context.Context, candidates []Citation, onRead func(candidate Citation, read sourceRead)) []sourceRead {
+	reads := make([]sourceRead, len(candidates))
+	if len(candidates) == 0 {
+		return reads
+	}
+
+	slots := make(chan struct{}, o.cfg.ReadConcurrency)
+	hostSlots := make(map[string]chan struct{}, len(candidates))
+	for _, candidate := range candidates {
+		host := readHostKey(candidate.URL)
+		if _, ok := hostSlots[host]; !ok {
+			hostSlots[host] = make(chan struct{}, o.cfg.PerHostReadConcurrency)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		hostSlot := hostSlots[readHostKey(candidate.URL)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Take the host slot first so a busy host never holds a global slot
+			// that another host could use.
+			select {
+			case hostSlot <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-hostSlot }()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+
+			result, err := o.reader.Read(ctx, candidate.URL)
+			read := sourceRead{result: result, err: err, started: true}
+
+			mu.Lock()
+			defer mu.Unlock()
+			reads[i] = read
+			if onRead != nil {
+				onRead(candidate, read)
+			}
+		}()
+	}
+	wg.Wait()
+	return reads
+}
+
+// readHostKey groups candidates by hostname for the per-host limit. URLs that
+// do not parse share one bucket.
+func readHostKey(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
@@ -0,0 +1,259 @@
+package research
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"chat/backend/internal/search"
+)
+
+// gatedReader holds every read until the test releases its URL, and records
+// how many reads were in flight, overall and per host.
+type gatedReader struct {
+	errs    map[string]error
+	started chan string
+	release map[string]chan struct{}
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	hostFlight  map[string]int
+	maxPerHost  map[string]int
+}
+
+func newGatedReader(urls []string, errs map[string]error) *gatedReader {
+	release := make(map[string]chan struct{}, len(urls))
+	for _, rawURL := range urls {
+		release[rawURL] = make(chan struct{})
+	}
+	return &gatedReader{
+		errs:       errs,
+		started:    make(chan string, len(urls)),
+		release:    release,
+		hostFlight: map[string]int{},
+		maxPerHost: map[string]int{},
+	}
+}
+
+func (r *gatedReader) Read(ctx context.Context, rawURL string) (ReadResult, error) {
+	host := readHostKey(rawURL)
+	r.mu.Lock()
+	r.inFlight++
+	r.hostFlight[host]++
+	r.maxInFlight = max(r.maxInFlight, r.inFlight)
+	r.maxPerHost[host] = max(r.maxPerHost[host], r.hostFlight[host])
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.inFlight--
+		r.hostFlight[host]--
+		r.mu.Unlock()
+	}()
+
+	r.started <- rawURL
+	select {
+	case <-r.release[rawURL]:
+	case <-ctx.Done():
+		return ReadResult{}, ctx.Err()
+	}
+	if err, ok := r.errs[rawURL]; ok {
+		return ReadResult{URL: rawURL, FetchStatus: "http_500"}, err
+	}
+	text := "full text for " + rawURL
+	return ReadResult{URL: rawURL, FinalURL: rawURL, ContentType: "text/plain", Text: text, Snippet: text, FetchStatus: "ok", FetchedAt: time.Now().UTC()}, nil
+}
+
+// next waits for the next read to start. The timeout only guards against a
+// hung pool; no assertion depends on it.
+func (r *gatedReader) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case rawURL := <-r.started:
+		return rawURL
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a read to start")
+		return ""
+	}
+}
+
+func (r *gatedReader) finish(rawURL string) {
+	close(r.release[rawURL])
+}
+
+func (r *gatedReader) readsInFlight() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.inFlight
+}
+
+type orchestratorRun struct {
+	result OrchestratorResult
+	err    error
+}
+
+// runInBackground starts the orchestrator so the test goroutine can drive the
+// gated reader.
+func runInBackground(orchestrator Orchestrator, onProgress func(Progress)) <-chan orchestratorRun {
+	done := make(chan orchestratorRun, 1)
+	go func() {
+		result, err := orchestrator.Run(context.Background(), "question", false, onProgress)
+		done <- orchestratorRun{result: result, err: err}
+	}()
+	return done
+}
+
+func readPoolFixture(urls []string) (searcherStub, plannerStub) {
+	results := make([]search.Result, 0, len(urls))
+	for _, rawURL := range urls {
+		results = append(results, search.Result{URL: rawURL, Title: "Title " + rawURL, Snippet: "snippet"})
+	}
+	return searcherStub{responses: map[string][]search.Result{"q1": results}},
+		plannerStub{
+			initial: PlannerDecision{NextAction: NextActionSearchMore, Queries: []string{"q1"}},
+			eval:    PlannerDecision{NextAction: NextActionFinalize},
+		}
+}
+
+func TestOrchestratorReadsSourcesInParallelWithinLimits(t *testing.T) {
+	urls := []string{
+		"https://a.example.com/1", "https://a.example.com/2", "https://a.example.com/3", "https://a.example.com/4",
+		"https://b.example.com/1", "https://c.example.com/1", "https://d.example.com/1", "https://e.example.com/1",
+	}
+	reader := newGatedReader(urls, nil)
+	searcher, planner := readPoolFixture(urls)
+	orchestrator := NewOrchestrator(searcher, planner, reader, OrchestratorConfig{
+		MaxLoops: 1, MaxSearchQueries: 1, MaxSourcesRead: 8, MaxCitations: 8, SearchResultsPerQ: 8,
+		ReadConcurrency: 3, PerHostReadConcurrency: 1,
+	})
+	done := runInBackground(orchestrator, nil)
+
+	// Three reads start while none has finished, so they overlap.
+	held := []string{reader.next(t), reader.next(t), reader.next(t)}
+	if inFlight := reader.readsInFlight(); inFlight != 3 {
+		t.Fatalf("expected 3 reads in flight, got %d", inFlight)
+	}
+	for _, rawURL := range held {
+		reader.finish(rawURL)
+	}
+	for range len(urls) - len(held) {
+		reader.finish(reader.next(t))
+	}
+	run := <-done
+	if run.err != nil {
+		t.Fatalf("run: %v", run.err)
+	}
+
+	if run.result.SourcesRead != 8 || run.result.ReadAttempts != 8 {
+		t.Fatalf("expected every source to be read once, got read=%d attempts=%d", run.result.SourcesRead, run.result.ReadAttempts)
+	}
+	if reader.maxInFlight != 3 {
+		t.Fatalf("expected at most 3 concurrent reads, got %d", reader.maxInFlight)
+	}
+	if reader.maxPerHost["a.example.com"] != 1 {
+		t.Fatalf("expected one read at a time per host, got %d", reader.maxPerHost["a.example.com"])
+	}
+}
+
+func TestOrchestratorMergesParallelReadsDeterministically(t *testing.T) {
+	urls := make([]string, 0, 6)
+	for i := 0; i < 6; i++ {
+		urls = append(urls, fmt.Sprintf("https://site%d.example.com/page", i))
+	}
+	errs := map[string]error{
+		urls[1]: errors.New("upstream returned status 500"),
+		urls[4]: context.DeadlineExceeded,
+	}
+
+	run := func(concurrency int) OrchestratorResult {
+		reader := newGatedReader(urls, errs)
+		searcher, planner := readPoolFixture(urls)
+		orchestrator := NewOrchestrator(searcher, planner, reader, OrchestratorConfig{
+			MaxLoops: 1, MaxSearchQueries: 1, MaxSourcesRead: 6, MaxCitations: 6, SearchResultsPerQ: 6,
+			ReadConcurrency: concurrency, PerHostReadConcurrency: 2,
+		})
+		done := runInBackground(orchestrator, nil)
+		if concurrency == 1 {
+			for range urls {
+				reader.finish(reader.next(t))
+			}
+		} else {
+			// Start every read, then let later candidates finish first.
+			for range urls {
+				reader.next(t)
+			}
+			for i := len(urls) - 1; i >= 0; i-- {
+				reader.finish(urls[i])
+			}
+		}
+		outcome := <-done
+		if outcome.err != nil {
+			t.Fatalf("run: %v", outcome.err)
+		}
+		return outcome.result
+	}
+	sequential := run(1)
+	parallel := run(6)
+	if sequential.SourcesRead != 4 || parallel.SourcesRead != 4 || parallel.ReadAttempts != 6 || parallel.ReadFailures != 2 {
+		t.Fatalf("unexpected read accounting: sequential=%+v parallel=%+v", sequential, parallel)
+	}
+	if parallel.ReadFailureReasons["http_status"] != 1 || parallel.ReadFailureReasons["timeout"] != 1 {
+		t.Fatalf("expected failure reasons to survive parallel reads, got %+v", parallel.ReadFailureReasons)
+	}
+	citationURLs := func(result OrchestratorResult) string {
+		out := make([]string, 0, len(result.Citations))
+		for _, citation := range result.Citations {
+			out = append(out, citation.URL)
+		}
+		return strings.Join(out, ",")
+	}
+	if citationURLs(sequential) != citationURLs(parallel) {
+		t.Fatalf("expected the same evidence order regardless of completion order:\nsequential=%s\nparallel=%s", citationURLs(sequential), citationURLs(parallel))
+	}
+}
+
+func TestOrchestratorReportsReadsAsTheyComplete(t *testing.T) {
+	urls := []string{"https://slow.example.com/a", "https://fast.example.com/b"}
+	reader := newGatedReader(urls, nil)
+	searcher, planner := readPoolFixture(urls)
+	orchestrator := NewOrchestrator(searcher, planner, reader, OrchestratorConfig{
+		MaxLoops: 1, MaxSearchQueries: 1, MaxSourcesRead: 2, MaxCitations: 2, SearchResultsPerQ: 2,
+		ReadConcurrency: 2, PerHostReadConcurrency: 1,
+	})
+
+	reads := make(chan Progress, len(urls))
+	done := runInBackground(orchestrator, func(progress Progress) {
+		if progress.Phase == PhaseReading && progress.IsQuickStep {
+			reads <- progress
+		}
+	})
+
+	reader.next(t)
+	reader.next(t)
+	reader.finish(urls[1])
+	first := <-reads
+	if first.Detail != urls[1] || first.Message != "Read 1 of 2 sources" || first.SourcesRead != 1 {
+		t.Fatalf("expected the fast read to be reported before the slow one finishes, got %+v", first)
+	}
+	reader.finish(urls[0])
+	run := <-done
+	if run.err != nil {
+		t.Fatalf("run: %v", run.err)
+	}
+
+	close(reads)
+	var rest []Progress
+	for progress := range reads {
+		rest = append(rest, progress)
+	}
+	if len(rest) != 1 {
+		t.Fatalf("expected one progress event per read, got %+v", append([]Progress{first}, rest...))
+	}
+	if rest[0].Detail != urls[0] || rest[0].SourcesRead != 2 {
+		t.Fatalf("expected the slow read to be reported last, got %+v", rest[0])
+	}
+}
@@ -2,11 +2,13 @@ package research
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -23,11 +25,20 @@ type ReaderConfig struct {
 	MaxBytes       int64
 	MaxRedirects   int
 	MaxTextRunes   int
+	// MinHostInterval spaces requests to one host. A longer robots.txt
+	// Crawl-delay wins, up to maxRobotsCrawlDelay.
+	MinHostInterval time.Duration
+	HostConcurrency int
+	RobotsCacheTTL  time.Duration
 }
 
+// HTTPReader fetches pages allowed by each site's robots.txt for
+// defaultReaderUserAgent, limiting requests per host across all reads.
 type HTTPReader struct {
 	cfg        ReaderConfig
 	httpClient *http.Client
+	robots     *robotsCache
+	hosts      *hostLimiter
 }
 
 func NewHTTPReader(cfg ReaderConfig, httpClient *http.Client) *HTTPReader {
@@ -43,6 +54,12 @@ func NewHTTPReader(cfg ReaderConfig, httpClient *http.Client) *HTTPReader {
 	if cfg.MaxTextRunes <= 0 {
 		cfg.MaxTextRunes = defaultReaderMaxRunes
 	}
+	if cfg.HostConcurrency <= 0 {
+		cfg.HostConcurrency = defaultReaderHostConcurrency
+	}
+	if cfg.RobotsCacheTTL <= 0 {
+		cfg.RobotsCacheTTL = defaultRobotsCacheTTL
+	}
 
 	if httpClient == nil {
 		transport := http.DefaultTransport.(*http.Transport).Clone()
@@ -59,8 +76,40 @@ func NewHTTPReader(cfg ReaderConfig, httpClient *http.Client) *HTTPReader {
 		}
 		return nil
 	}
+	// robots.txt is fetched without the robots check on its own redirects.
+	robotsClient := *httpClient
+	hosts := newHostLimiter(cfg.HostConcurrency)
 
-	return &HTTPReader{cfg: cfg, httpClient: httpClient}
+	reader := &HTTPReader{
+		cfg:        cfg,
+		httpClient: httpClient,
+		robots:     newRobotsCache(defaultReaderUserAgent, cfg.RobotsCacheTTL, &robotsClient, hosts, cfg.MinHostInterval),
+		hosts:      hosts,
+	}
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := robotsClient.CheckRedirect(req, via); err != nil {
+			return err
+		}
+		policy, err := reader.checkRobots(req.Context(), req.URL)
+		if err != nil {
+			return err
+		}
+		held, _ := req.Context().Value(heldHostKey{}).(*heldHost)
+		if held == nil || holdsHost(req.Context(), req.URL.Hostname()) {
+			return nil
+		}
+		// The previous hop is done, so its host's slot is handed back
+		// before waiting for the new host's.
+		held.release()
+		held.release = func() {}
+		release, err := reader.hosts.acquire(req.Context(), req.URL.Hostname(), reader.hostInterval(policy))
+		if err != nil {
+			return err
+		}
+		held.host, held.release = req.URL.Hostname(), release
+		return nil
+	}
+	return reader
 }
 
 func (r *HTTPReader) Read(ctx context.Context, rawURL string) (ReadResult, error) {
@@ -73,6 +122,8 @@ func (r *HTTPReader) Read(ctx context.Context, rawURL string) (ReadResult, error
 		return ReadResult{URL: rawURL, FetchStatus: "blocked"}, err
 	}
 
+	// The robots.txt check, the wait for the host and the page itself share
+	// one deadline.
 	requestCtx := ctx
 	cancel := func() {}
 	if r.cfg.RequestTimeout > 0 {
@@ -80,6 +131,21 @@ func (r *HTTPReader) Read(ctx context.Context, rawURL string) (ReadResult, error
 	}
 	defer cancel()
 
+	policy, err := r.checkRobots(requestCtx, parsed)
+	if errors.Is(err, errRobotsDisallowed) {
+		return ReadResult{URL: parsed.String(), FetchStatus: "robots_disallowed"}, err
+	}
+	if err != nil {
+		return ReadResult{URL: parsed.String(), FetchStatus: "fetch_failed"}, err
+	}
+	release, err := r.hosts.acquire(requestCtx, parsed.Hostname(), r.hostInterval(policy))
+	if err != nil {
+		return ReadResult{URL: parsed.String(), FetchStatus: "fetch_failed"}, err
+	}
+	held := &heldHost{host: parsed.Hostname(), release: release}
+	defer func() { held.release() }()
+	requestCtx = context.WithValue(requestCtx, heldHostKey{}, held)
+
 	req, err := http.NewRequestWithContext(requestCtx, http.MethodGet, parsed.String(), nil)
 	if err != nil {
 		return ReadResult{URL: parsed.String(), FetchStatus: "request_failed"}, err
@@ -88,6 +154,9 @@ func (r *HTTPReader) Read(ctx context.Context, rawURL string) (ReadResult, error
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain,text/markdown,application/json,text/csv,application/pdf;q=0.9,*/*;q=0.2")
 
 	resp, err := r.httpClient.Do(req)
+	if errors.Is(err, errRobotsDisallowed) {
+		return ReadResult{URL: parsed.String(), FetchStatus: "robots_disallowed"}, err
+	}
 	if err != nil {
 		return ReadResult{URL: parsed.String(), FetchStatus: "fetch_failed"}, err
 	}
@@ -141,6 +210,27 @@ func (r *HTTPReader) Read(ctx context.Context, rawURL string) (ReadResult, error
 	return result, nil
 }
 
+// hostInterval is the spacing to keep between requests to a host: the
+// configured minimum, or the host's capped robots.txt Crawl-delay if longer.
+func (r *HTTPReader) hostInterval(policy robotsPolicy) time.Duration {
+	interval := r.cfg.MinHostInterval
+	if crawlDelay := min(policy.crawlDelay, maxRobotsCrawlDelay); crawlDelay > interval {
+		interval = crawlDelay
+	}
+	return interval
+}
+
+func (r *HTTPReader) checkRobots(ctx context.Context, target *url.URL) (robotsPolicy, error) {
+	policy, err := r.robots.policy(ctx, target)
+	if err != nil {
+		return policy, err
+	}
+	if !policy.allowed(robotsPath(target)) {
+		return policy, fmt.Errorf("%w: %s", errRobotsDisallowed, target.String())
+	}
+	return policy, nil
+}
+
 func readBoundedBody(r io.Reader, maxBytes int64) ([]byte, bool, error) {
 	if maxBytes <= 0 {
 		maxBytes = defaultReaderMaxBodyCap
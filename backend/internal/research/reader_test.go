@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -136,3 +138,187 @@ func TestClassifyReadFailureBlockedURL(t *testing.T) {
 		t.Fatalf("expected blocked_url reason, got %q", reason)
 	}
 }
+
+func TestReaderRespectsRobotsTxt(t *testing.T) {
+	var robotsFetches, pageFetches atomic.Int64
+	client := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			body := "allowed page"
+			if req.URL.Path == "/robots.txt" {
+				robotsFetches.Add(1)
+				body = "User-agent: *\nDisallow: /private\n"
+			} else {
+				pageFetches.Add(1)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/plain"}},
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Request:    req,
+			}, nil
+		}),
+	}
+	reader := NewHTTPReader(ReaderConfig{RequestTimeout: time.Second}, client)
+
+	result, err := reader.Read(context.Background(), "https://example.com/private/page")
+	if !errors.Is(err, errRobotsDisallowed) {
+		t.Fatalf("expected robots disallow error, got %v", err)
+	}
+	if result.FetchStatus != "robots_disallowed" {
+		t.Fatalf("expected robots_disallowed status, got %q", result.FetchStatus)
+	}
+	if _, err := reader.Read(context.Background(), "https://example.com/public"); err != nil {
+		t.Fatalf("read allowed page: %v", err)
+	}
+	if robotsFetches.Load() != 1 || pageFetches.Load() != 1 {
+		t.Fatalf("expected one cached robots fetch and one page fetch, got robots=%d pages=%d", robotsFetches.Load(), pageFetches.Load())
+	}
+}
+
+func TestReaderSpacesRequestsToSameHost(t *testing.T) {
+	client := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/robots.txt" {
+				return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/plain"}},
+				Body:       io.NopCloser(strings.NewReader("page")),
+				Request:    req,
+			}, nil
+		}),
+	}
+	reader := NewHTTPReader(ReaderConfig{RequestTimeout: time.Second, MinHostInterval: 50 * time.Millisecond}, client)
+
+	start := time.Now()
+	for _, rawURL := range []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"} {
+		if _, err := reader.Read(context.Background(), rawURL); err != nil {
+			t.Fatalf("read %s: %v", rawURL, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected reads to be spaced by the host interval, took %s", elapsed)
+	}
+}
+
+func TestReaderFetchesRobotsTxtUnderHostLimitWithinRequestDeadline(t *testing.T) {
+	var mu sync.Mutex
+	var robotsAt, pageAt time.Time
+	client := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			if req.URL.Path == "/robots.txt" {
+				robotsAt = time.Now()
+			} else {
+				pageAt = time.Now()
+			}
+			mu.Unlock()
+			if req.URL.Host == "slow.example.com" {
+				wait := time.After(150 * time.Millisecond)
+				if req.URL.Path != "/robots.txt" {
+					wait = nil
+				}
+				select {
+				case <-wait:
+					return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				}
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/plain"}},
+				Body:       io.NopCloser(strings.NewReader("page")),
+				Request:    req,
+			}, nil
+		}),
+	}
+	reader := NewHTTPReader(ReaderConfig{RequestTimeout: 200 * time.Millisecond, MinHostInterval: 120 * time.Millisecond}, client)
+
+	if _, err := reader.Read(context.Background(), "https://example.com/a"); err != nil {
+		t.Fatalf("read page: %v", err)
+	}
+	if gap := pageAt.Sub(robotsAt); gap < 120*time.Millisecond {
+		t.Fatalf("expected robots.txt to count against the host interval, page followed it after %s", gap)
+	}
+
+	start := time.Now()
+	_, err := reader.Read(context.Background(), "https://slow.example.com/page")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("expected robots.txt and the page to share one deadline, took %s", elapsed)
+	}
+}
+
+func TestReaderTakesTheHostSlotOfRedirectTargets(t *testing.T) {
+	targetFetched := make(chan struct{}, 1)
+	client := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			switch {
+			case req.URL.Path == "/robots.txt":
+				return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+			case req.URL.Host == "origin.example.com":
+				return &http.Response{
+					StatusCode: http.StatusFound,
+					Header:     http.Header{"Location": []string{"https://target.example.com/page"}},
+					Body:       io.NopCloser(strings.NewReader("")),
+					Request:    req,
+				}, nil
+			}
+			targetFetched <- struct{}{}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/plain"}},
+				Body:       io.NopCloser(strings.NewReader("page")),
+				Request:    req,
+			}, nil
+		}),
+	}
+	reader := NewHTTPReader(ReaderConfig{RequestTimeout: 5 * time.Second, HostConcurrency: 1}, client)
+
+	release, err := reader.hosts.acquire(context.Background(), "target.example.com", 0)
+	if err != nil {
+		t.Fatalf("acquire target slot: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		result, err := reader.Read(context.Background(), "https://origin.example.com/start")
+		if err == nil && result.FinalURL != "https://target.example.com/page" {
+			err = fmt.Errorf("unexpected final url %q", result.FinalURL)
+		}
+		done <- err
+	}()
+
+	select {
+	case <-targetFetched:
+		t.Fatal("expected the redirect to wait for the target host's slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	if err := <-done; err != nil {
+		t.Fatalf("read through redirect: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	release, err = reader.hosts.acquire(ctx, "target.example.com", 0)
+	if err != nil {
+		t.Fatalf("expected the target slot to be handed back: %v", err)
+	}
+	release()
+	release, err = reader.hosts.acquire(ctx, "origin.example.com", 0)
+	if err != nil {
+		t.Fatalf("expected the origin slot to be handed back: %v", err)
+	}
+	release()
+}
+
+func TestClassifyReadFailureRobotsDisallowed(t *testing.T) {
+	reason := classifyReadFailure(fmt.Errorf("%w: https://example.com/private", errRobotsDisallowed), ReadResult{FetchStatus: "robots_disallowed"})
+	if reason != "robots_disallowed" {
+		t.Fatalf("expected robots_disallowed reason, got %q", reason)
+	}
+}
@@ -0,0 +1,290 @@
+package research
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRobotsCacheTTL = time.Hour
+	// An unavailable robots.txt is retried sooner than a fetched one so a
+	// brief outage does not block the host for the whole cache TTL.
+	robotsUnavailableTTL = time.Minute
+	// RFC 9309 asks crawlers to parse at least 500 KiB of robots.txt.
+	maxRobotsBytes = int64(500 << 10)
+	// Crawl-delay is honored up to this cap so one host cannot stall a run.
+	maxRobotsCrawlDelay = 10 * time.Second
+	maxRobotsCacheHosts = 1024
+)
+
+var errRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// robotsPolicy is the group of a robots.txt that applies to one user agent.
+type robotsPolicy struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+var (
+	robotsAllowAll    = robotsPolicy{}
+	robotsDisallowAll = robotsPolicy{rules: []robotsRule{{pattern: "/"}}}
+)
+
+// allowed applies the longest matching rule, preferring allow on ties.
+func (p robotsPolicy) allowed(path string) bool {
+	best := -1
+	allow := true
+	for _, rule := range p.rules {
+		if len(rule.pattern) < best || !robotsPatternMatches(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > best || rule.allow {
+			allow = rule.allow
+		}
+		best = len(rule.pattern)
+	}
+	return allow
+}
+
+// parseRobots returns the rules of the groups naming agent, or of the "*"
+// groups when none do. Unknown lines are ignored.
+func parseRobots(data []byte, agent string) robotsPolicy {
+	agent = strings.ToLower(agent)
+	var matched, wildcard robotsPolicy
+	var hasMatched bool
+	var groupAgents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 4096), int(maxRobotsBytes))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if inRules {
+				groupAgents = nil
+				inRules = false
+			}
+			groupAgent, _, _ := strings.Cut(strings.ToLower(value), "/")
+			groupAgents = append(groupAgents, strings.TrimSpace(groupAgent))
+			continue
+		}
+		if key != "allow" && key != "disallow" && key != "crawl-delay" {
+			continue
+		}
+		inRules = true
+
+		for _, groupAgent := range groupAgents {
+			var target *robotsPolicy
+			switch groupAgent {
+			case agent:
+				target = &matched
+				hasMatched = true
+			case "*":
+				target = &wildcard
+			default:
+				continue
+			}
+			switch key {
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					target.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			default:
+				if value != "" {
+					target.rules = append(target.rules, robotsRule{pattern: value, allow: key == "allow"})
+				}
+			}
+		}
+	}
+	if hasMatched {
+		return matched
+	}
+	return wildcard
+}
+
+// robotsPatternMatches supports the "*" wildcard and "$" end anchor.
+func robotsPatternMatches(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		index := strings.Index(rest, part)
+		if index < 0 {
+			return false
+		}
+		rest = rest[index+len(part):]
+	}
+	return !anchored || rest == ""
+}
+
+func robotsPath(target *url.URL) string {
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+	return path
+}
+
+type robotsEntry struct {
+	ready     chan struct{}
+	policy    robotsPolicy
+	err       error
+	expiresAt time.Time
+}
+
+// robotsCache fetches each origin's robots.txt once per TTL. Concurrent
+// lookups for the same origin share a single fetch. Fetches take a slot from
+// hosts like any other request and are bounded by the caller's deadline.
+type robotsCache struct {
+	agent      string
+	ttl        time.Duration
+	httpClient *http.Client
+	hosts      *hostLimiter
+	interval   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+func newRobotsCache(userAgent string, ttl time.Duration, httpClient *http.Client, hosts *hostLimiter, interval time.Duration) *robotsCache {
+	agent, _, _ := strings.Cut(userAgent, "/")
+	return &robotsCache{
+		agent:      agent,
+		ttl:        ttl,
+		httpClient: httpClient,
+		hosts:      hosts,
+		interval:   interval,
+		entries:    make(map[string]*robotsEntry),
+	}
+}
+
+func (c *robotsCache) policy(ctx context.Context, target *url.URL) (robotsPolicy, error) {
+	origin := strings.ToLower(target.Scheme + "://" + target.Host)
+	for {
+		now := time.Now()
+		c.mu.Lock()
+		entry, ok := c.entries[origin]
+		if !ok || (isClosed(entry.ready) && !now.Before(entry.expiresAt)) {
+			if len(c.entries) >= maxRobotsCacheHosts {
+				c.pruneLocked(now)
+			}
+			entry = &robotsEntry{ready: make(chan struct{})}
+			c.entries[origin] = entry
+			c.mu.Unlock()
+
+			var ttl time.Duration
+			entry.policy, ttl, entry.err = c.fetch(ctx, target)
+			entry.expiresAt = time.Now().Add(ttl)
+			if entry.err != nil {
+				c.mu.Lock()
+				if c.entries[origin] == entry {
+					delete(c.entries, origin)
+				}
+				c.mu.Unlock()
+			}
+			close(entry.ready)
+			return entry.policy, entry.err
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			return robotsPolicy{}, ctx.Err()
+		}
+		// A failed fetch may have been cut short by the other caller's
+		// context, so try again with ours.
+		if entry.err == nil || ctx.Err() != nil {
+			return entry.policy, entry.err
+		}
+	}
+}
+
+// fetch follows RFC 9309: a missing robots.txt allows everything and an
+// unavailable one (5xx, 429) disallows everything until it is fetched again,
+// which is after robotsUnavailableTTL rather than the full TTL. Network errors
+// are returned uncached.
+func (c *robotsCache) fetch(ctx context.Context, target *url.URL) (robotsPolicy, time.Duration, error) {
+	if !holdsHost(ctx, target.Hostname()) {
+		release, err := c.hosts.acquire(ctx, target.Hostname(), c.interval)
+		if err != nil {
+			return robotsPolicy{}, 0, err
+		}
+		defer release()
+	}
+
+	robotsURL := url.URL{Scheme: target.Scheme, Host: target.Host, Path: "/robots.txt"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return robotsPolicy{}, 0, err
+	}
+	req.Header.Set("User-Agent", defaultReaderUserAgent)
+	req.Header.Set("Accept", "text/plain,*/*;q=0.2")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return robotsPolicy{}, 0, fmt.Errorf("fetch robots.txt: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return robotsDisallowAll, min(c.ttl, robotsUnavailableTTL), nil
+	case resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices:
+		return robotsAllowAll, c.ttl, nil
+	}
+
+	payload, _, err := readBoundedBody(resp.Body, maxRobotsBytes)
+	if err != nil {
+		return robotsPolicy{}, 0, fmt.Errorf("read robots.txt: %w", err)
+	}
+	return parseRobots(payload, c.agent), c.ttl, nil
+}
+
+func (c *robotsCache) pruneLocked(now time.Time) {
+	for origin, entry := range c.entries {
+		if isClosed(entry.ready) && !now.Before(entry.expiresAt) {
+			delete(c.entries, origin)
+		}
+	}
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
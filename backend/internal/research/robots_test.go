@@ -0,0 +1,80 @@
+package research
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobotsPrefersAgentGroupAndLongestMatch(t *testing.T) {
+	data := []byte(`# comment
+User-agent: *
+Disallow: /
+
+User-agent: other-bot
+User-agent: Chat-Research-Bot/2.0
+Disallow: /docs/
+Allow: /docs/public
+Disallow: /*.pdf$
+Crawl-delay: 2
+`)
+	policy := parseRobots(data, "chat-research-bot")
+
+	tests := map[string]bool{
+		"/":                   true,
+		"/docs/":              false,
+		"/docs/public/intro":  true,
+		"/files/report.pdf":   false,
+		"/files/report.pdf?x": true,
+	}
+	for path, want := range tests {
+		if got := policy.allowed(path); got != want {
+			t.Fatalf("allowed(%q) = %t, want %t", path, got, want)
+		}
+	}
+	if policy.crawlDelay != 2*time.Second {
+		t.Fatalf("expected 2s crawl delay, got %s", policy.crawlDelay)
+	}
+}
+
+func TestParseRobotsFallsBackToWildcardGroup(t *testing.T) {
+	policy := parseRobots([]byte("User-agent: *\nDisallow: /private\nAllow: /private\n"), "chat-research-bot")
+	if !policy.allowed("/private/page") {
+		t.Fatalf("expected allow to win a tie with disallow")
+	}
+	if !parseRobots(nil, "chat-research-bot").allowed("/anything") {
+		t.Fatalf("expected empty robots.txt to allow everything")
+	}
+}
+
+func TestRobotsCacheRetriesUnavailableRobotsSooner(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	client := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+		}),
+	}
+	cache := newRobotsCache(defaultReaderUserAgent, time.Hour, client, newHostLimiter(1), 0)
+	target, _ := url.Parse("https://example.com/page")
+
+	policy, err := cache.policy(context.Background(), target)
+	if err != nil || policy.allowed("/page") {
+		t.Fatalf("expected an unavailable robots.txt to disallow everything, got allowed=%t err=%v", policy.allowed("/page"), err)
+	}
+	if expiresIn := time.Until(cache.entries["https://example.com"].expiresAt); expiresIn > robotsUnavailableTTL {
+		t.Fatalf("expected an unavailable robots.txt to be cached for at most %s, got %s", robotsUnavailableTTL, expiresIn)
+	}
+
+	status = http.StatusNotFound
+	other, _ := url.Parse("https://other.example.com/page")
+	if _, err := cache.policy(context.Background(), other); err != nil {
+		t.Fatalf("fetch robots.txt: %v", err)
+	}
+	if expiresIn := time.Until(cache.entries["https://other.example.com"].expiresAt); expiresIn <= robotsUnavailableTTL {
+		t.Fatalf("expected a fetched robots.txt to keep the full TTL, got %s", expiresIn)
+	}
+}
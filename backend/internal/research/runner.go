@@ -13,7 +13,7 @@ import (
 	"time"
 	"unicode"
 
-	"chat/backend/internal/brave"
+	"chat/backend/internal/search"
 )
 
 const (
@@ -50,6 +50,8 @@ type Progress struct {
 	MaxLoops          int              `json:"maxLoops,omitempty"`
 	SourcesConsidered int              `json:"sourcesConsidered,omitempty"`
 	SourcesRead       int              `json:"sourcesRead,omitempty"`
+	CacheHits         int              `json:"cacheHits,omitempty"`
+	CacheMisses       int              `json:"cacheMisses,omitempty"`
 }
 
 type Citation struct {
@@ -60,6 +62,10 @@ type Citation struct {
 	Query          string
 	Pass           int
 	Score          float64
+	// Providers lists every search provider that returned the URL when
+	// results from several providers were fused; SourceProvider ranked it
+	// highest.
+	Providers []string
 }
 
 type Result struct {
@@ -69,7 +75,14 @@ type Result struct {
 }
 
 type Searcher interface {
-	Search(ctx context.Context, query string, count int) ([]brave.SearchResult, error)
+	Search(ctx context.Context, query string, count int) ([]search.Result, error)
+}
+
+// MultiSearcher fronts several search providers. The orchestrator queries
+// each of them and fuses their rankings.
+type MultiSearcher interface {
+	Searcher
+	Providers() []search.Provider
 }
 
 type Config struct {
@@ -167,12 +180,12 @@ func (r Runner) Run(ctx context.Context, question string, timeSensitive bool, on
 		}
 		results, err := r.searcher.Search(ctx, query, cfg.ResultsPerPass)
 		lastSearchAttemptAt = time.Now()
-		if err != nil && isBraveRateLimitError(err) {
+		if err != nil && isSearchRateLimitError(err) {
 			retryDelay := cfg.MinSearchInterval
 			if retryDelay <= 0 {
 				retryDelay = defaultRateLimitRetryDelay
 			}
-			if waitErr := waitForRetry(ctx, retryDelay); waitErr != nil {
+			if waitErr := search.Wait(ctx, retryDelay); waitErr != nil {
 				return Result{}, waitErr
 			}
 			if err := waitBeforeSearchAttempt(ctx, &lastSearchAttemptAt, cfg.MinSearchInterval); err != nil {
@@ -183,7 +196,7 @@ func (r Runner) Run(ctx context.Context, question string, timeSensitive bool, on
 		}
 		if err != nil {
 			statusCode := 0
-			var apiErr brave.APIError
+			var apiErr search.APIError
 			if errors.As(err, &apiErr) {
 				statusCode = apiErr.StatusCode
 			}
@@ -198,7 +211,7 @@ func (r Runner) Run(ctx context.Context, question string, timeSensitive bool, on
 			if errors.Is(ctx.Err(), context.Canceled) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
 				return Result{}, ctx.Err()
 			}
-			if errors.Is(err, brave.ErrMissingAPIKey) {
+			if errors.Is(err, search.ErrNotConfigured) {
 				missingAPIKey = true
 			}
 			searchErrors++
@@ -220,7 +233,7 @@ func (r Runner) Run(ctx context.Context, question string, timeSensitive bool, on
 				URL:            rawURL,
 				Title:          strings.TrimSpace(item.Title),
 				Snippet:        strings.TrimSpace(item.Snippet),
-				SourceProvider: "brave",
+				SourceProvider: item.Provider,
 				Query:          query,
 				Pass:           i + 1,
 				Score:          scoreEvidence(query, item, timeSensitive),
@@ -244,7 +257,7 @@ func (r Runner) Run(ctx context.Context, question string, timeSensitive bool, on
 	if len(candidates) == 0 {
 		switch {
 		case missingAPIKey:
-			result.Warning = "Grounding is unavailable because BRAVE_API_KEY is not configured."
+			result.Warning = "Grounding is unavailable because the web search provider is not configured."
 		case searchErrors > 0:
 			result.Warning = "Deep research search failed. Continuing without web sources."
 		}
@@ -293,28 +306,14 @@ func waitBeforeSearchAttempt(ctx context.Context, lastAttempt *time.Time, interv
 	if lastAttempt == nil || interval <= 0 || lastAttempt.IsZero() {
 		return nil
 	}
-	return waitForRetry(ctx, time.Until(lastAttempt.Add(interval)))
+	return search.Wait(ctx, time.Until(lastAttempt.Add(interval)))
 }
 
-func isBraveRateLimitError(err error) bool {
-	var apiErr brave.APIError
+func isSearchRateLimitError(err error) bool {
+	var apiErr search.APIError
 	return errors.As(err, &apiErr) && apiErr.StatusCode == 429
 }
 
-func waitForRetry(ctx context.Context, delay time.Duration) error {
-	if delay <= 0 {
-		return nil
-	}
-	timer := time.NewTimer(delay)
-	defer timer.Stop()
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-timer.C:
-		return nil
-	}
-}
-
 func buildPassQueries(question string, timeSensitive bool, minPasses, maxPasses int) []string {
 	base := strings.Join(strings.Fields(strings.TrimSpace(question)), " ")
 	if base == "" {
@@ -388,7 +387,7 @@ func canonicalURL(raw string) string {
 	return parsed.String()
 }
 
-func scoreEvidence(query string, result brave.SearchResult, timeSensitive bool) float64 {
+func scoreEvidence(query string, result search.Result, timeSensitive bool) float64 {
 	score := 0.20
 	title := strings.TrimSpace(result.Title)
 	snippet := strings.TrimSpace(result.Snippet)
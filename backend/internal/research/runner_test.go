@@ -6,7 +6,7 @@ import (
 	"testing"
 	"time"
 
-	"chat/backend/internal/brave"
+	"chat/backend/internal/search"
 )
 
 func TestBuildPassQueriesRespectsBounds(t *testing.T) {
@@ -23,7 +23,7 @@ func TestBuildPassQueriesRespectsBounds(t *testing.T) {
 
 func TestRunnerDedupesAndRanksCitations(t *testing.T) {
 	runner := NewRunner(stubSearcher{
-		responses: map[string][]brave.SearchResult{
+		responses: map[string][]search.Result{
 			"question": {
 				{URL: "https://example.com/a?ref=1", Title: "A title", Snippet: "Longer snippet with relevant facts and publication date 2026."},
 				{URL: "https://example.com/a?ref=2", Title: "Duplicate URL", Snippet: "Should be deduped by canonical url."},
@@ -95,10 +95,10 @@ func TestRunnerRetriesOnRateLimit(t *testing.T) {
 }
 
 type stubSearcher struct {
-	responses map[string][]brave.SearchResult
+	responses map[string][]search.Result
 }
 
-func (s stubSearcher) Search(_ context.Context, query string, _ int) ([]brave.SearchResult, error) {
+func (s stubSearcher) Search(_ context.Context, query string, _ int) ([]search.Result, error) {
 	if values, ok := s.responses[query]; ok {
 		return values, nil
 	}
@@ -107,7 +107,7 @@ func (s stubSearcher) Search(_ context.Context, query string, _ int) ([]brave.Se
 
 type blockingSearcher struct{}
 
-func (blockingSearcher) Search(ctx context.Context, _ string, _ int) ([]brave.SearchResult, error) {
+func (blockingSearcher) Search(ctx context.Context, _ string, _ int) ([]search.Result, error) {
 	<-ctx.Done()
 	return nil, ctx.Err()
 }
@@ -116,12 +116,12 @@ type rateLimitThenSuccessSearcher struct {
 	calls int
 }
 
-func (s *rateLimitThenSuccessSearcher) Search(_ context.Context, _ string, _ int) ([]brave.SearchResult, error) {
+func (s *rateLimitThenSuccessSearcher) Search(_ context.Context, _ string, _ int) ([]search.Result, error) {
 	s.calls++
 	if s.calls == 1 {
-		return nil, brave.APIError{StatusCode: 429, Body: `{"error":"rate limit"}`}
+		return nil, search.APIError{StatusCode: 429, Body: `{"error":"rate limit"}`}
 	}
-	return []brave.SearchResult{
+	return []search.Result{
 		{URL: "https://example.com/recovered", Title: "Recovered source", Snippet: "Detailed evidence after retry."},
 	}, nil
 }
@@ -1,13 +1,96 @@
 package research
 
 import (
+	"slices"
 	"sort"
 	"strings"
 
-	"chat/backend/internal/brave"
+	"chat/backend/internal/search"
 )
 
-func rankSearchResults(query string, loop int, timeSensitive bool, results []brave.SearchResult) []Citation {
+const (
+	// rrfK is the usual reciprocal rank fusion constant; it keeps the first
+	// few ranks from dominating.
+	rrfK = 60
+	// fusedRankWeight scales the fused rank into the evidence score, so a
+	// provider's top hit adds 0.1 and agreement between providers adds more.
+	fusedRankWeight = 0.1
+)
+
+type fusedResult struct {
+	citation Citation
+	rrf      float64
+	bestRank int
+}
+
+// fuseSearchResults merges per-provider result lists with reciprocal rank
+// fusion keyed on canonicalURL. Each list must be in the provider's own rank
+// order.
+func fuseSearchResults(query string, loop int, timeSensitive bool, lists [][]search.Result) []Citation {
+	fused := make(map[string]*fusedResult)
+	order := make([]string, 0)
+	for _, results := range lists {
+		rank := 0
+		for _, result := range results {
+			rawURL := strings.TrimSpace(result.URL)
+			if rawURL == "" {
+				continue
+			}
+			rank++
+			key := canonicalOrRawURL(rawURL)
+			score := scoreEvidence(query, result, timeSensitive)
+			entry, ok := fused[key]
+			if !ok {
+				entry = &fusedResult{
+					citation: Citation{
+						URL:            rawURL,
+						Title:          trimToRunes(strings.TrimSpace(result.Title), 240),
+						Snippet:        trimToRunes(strings.TrimSpace(result.Snippet), 800),
+						SourceProvider: result.Provider,
+						Query:          query,
+						Pass:           loop,
+						Score:          score,
+					},
+					bestRank: rank,
+				}
+				fused[key] = entry
+				order = append(order, key)
+			} else {
+				if rank < entry.bestRank {
+					entry.bestRank = rank
+					entry.citation.SourceProvider = result.Provider
+				}
+				if snippet := strings.TrimSpace(result.Snippet); len(snippet) > len(entry.citation.Snippet) {
+					entry.citation.Snippet = trimToRunes(snippet, 800)
+				}
+				if score > entry.citation.Score {
+					entry.citation.Score = score
+				}
+			}
+			entry.rrf += 1 / float64(rrfK+rank)
+			if result.Provider != "" && !slices.Contains(entry.citation.Providers, result.Provider) {
+				entry.citation.Providers = append(entry.citation.Providers, result.Provider)
+			}
+		}
+	}
+
+	candidates := make([]Citation, 0, len(order))
+	for _, key := range order {
+		entry := fused[key]
+		citation := entry.citation
+		citation.Score += fusedRankWeight * entry.rrf * (rrfK + 1)
+		candidates = append(candidates, citation)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score == candidates[j].Score {
+			return candidates[i].URL < candidates[j].URL
+		}
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+func rankSearchResults(query string, loop int, timeSensitive bool, results []search.Result) []Citation {
 	candidates := make([]Citation, 0, len(results))
 	for _, result := range results {
 		rawURL := strings.TrimSpace(result.URL)
@@ -18,7 +101,7 @@ func rankSearchResults(query string, loop int, timeSensitive bool, results []bra
 			URL:            rawURL,
 			Title:          trimToRunes(strings.TrimSpace(result.Title), 240),
 			Snippet:        trimToRunes(strings.TrimSpace(result.Snippet), 800),
-			SourceProvider: "brave",
+			SourceProvider: result.Provider,
 			Query:          query,
 			Pass:           loop,
 			Score:          scoreEvidence(query, result, timeSensitive),
@@ -31,6 +31,17 @@ type OrchestratorConfig struct {
 	MinSearchInterval  time.Duration
 	SourceFetchTimeout time.Duration
 	SourceMaxBytes     int64
+	// ReadConcurrency caps source reads in flight; PerHostReadConcurrency caps
+	// them per hostname.
+	ReadConcurrency        int
+	PerHostReadConcurrency int
+	// Cache, when set, keeps search results for SearchCacheTTL and fetched
+	// pages for PageCacheTTL; time-sensitive runs use at most
+	// TimeSensitiveCacheTTL for both.
+	Cache                 Cache
+	SearchCacheTTL        time.Duration
+	PageCacheTTL          time.Duration
+	TimeSensitiveCacheTTL time.Duration
 }
 
 type PlannerInput struct {
@@ -104,4 +115,6 @@ type OrchestratorResult struct {
 	Warnings           []string
 	Warning            string
 	StopReason         StopReason
+	CacheHits          int
+	CacheMisses        int
 }
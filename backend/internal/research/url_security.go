@@ -17,6 +17,13 @@ var (
 	errBlockedURLPort   = errors.New("blocked url port")
 )
 
+// ValidateURL applies the reader's URL rules (http/https, public hosts,
+// default ports) without fetching anything. Resolved addresses are checked
+// again at dial time.
+func ValidateURL(rawURL string) (*url.URL, error) {
+	return validateResearchURL(rawURL)
+}
+
 func validateResearchURL(rawURL string) (*url.URL, error) {
 	parsed, err := url.Parse(strings.TrimSpace(rawURL))
 	if err != nil {
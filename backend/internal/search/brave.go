@@ -0,0 +1,46 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"chat/backend/internal/brave"
+	"chat/backend/internal/config"
+)
+
+type braveProvider struct {
+	client brave.Client
+}
+
+func newBraveProvider(cfg config.Config, httpClient *http.Client) braveProvider {
+	return braveProvider{client: brave.NewClient(cfg, httpClient)}
+}
+
+func (p braveProvider) Name() string {
+	return ProviderBrave
+}
+
+func (p braveProvider) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	if count <= 0 {
+		count = 5
+	}
+	results, err := p.client.Search(ctx, query, count)
+	if err != nil {
+		var apiErr brave.APIError
+		switch {
+		case errors.Is(err, brave.ErrMissingAPIKey):
+			return nil, fmt.Errorf("%w: BRAVE_API_KEY is empty", ErrNotConfigured)
+		case errors.As(err, &apiErr):
+			return nil, APIError{Provider: ProviderBrave, StatusCode: apiErr.StatusCode, Body: apiErr.Body}
+		}
+		return nil, err
+	}
+
+	raw := make([]Result, 0, len(results))
+	for _, item := range results {
+		raw = append(raw, Result{URL: item.URL, Title: item.Title, Snippet: item.Snippet})
+	}
+	return normalizeResults(ProviderBrave, raw, count), nil
+}
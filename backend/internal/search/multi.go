@@ -0,0 +1,41 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Multi fronts several providers. Search tries them in order and returns the
+// first answer; the research orchestrator queries Providers concurrently and
+// fuses their rankings instead.
+type Multi struct {
+	providers []Provider
+}
+
+func (m Multi) Name() string {
+	names := make([]string, 0, len(m.providers))
+	for _, provider := range m.providers {
+		names = append(names, provider.Name())
+	}
+	return strings.Join(names, "+")
+}
+
+func (m Multi) Providers() []Provider {
+	return m.providers
+}
+
+func (m Multi) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	errs := make([]error, 0, len(m.providers))
+	for _, provider := range m.providers {
+		results, err := provider.Search(ctx, query, count)
+		if err == nil {
+			return results, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,183 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"chat/backend/internal/config"
+)
+
+const (
+	ProviderBrave   = "brave"
+	ProviderSearXNG = "searxng"
+	ProviderTavily  = "tavily"
+	ProviderStatic  = "static"
+)
+
+const (
+	maxErrorBodyBytes = 8 * 1024
+	maxQueryWords     = 50
+)
+
+// ErrNotConfigured is returned when the selected provider is missing its API
+// key, base URL or fixture.
+var ErrNotConfigured = errors.New("search provider is not configured")
+
+// Result is one normalized search hit. Provider is stored as the citation's
+// source provider.
+type Result struct {
+	URL      string
+	Title    string
+	Snippet  string
+	Provider string
+}
+
+type Provider interface {
+	Name() string
+	Search(ctx context.Context, query string, count int) ([]Result, error)
+}
+
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e APIError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+type factory func(cfg config.Config, httpClient *http.Client) (Provider, error)
+
+var registry = map[string]factory{
+	ProviderBrave: func(cfg config.Config, httpClient *http.Client) (Provider, error) {
+		return newBraveProvider(cfg, httpClient), nil
+	},
+	ProviderSearXNG: func(cfg config.Config, httpClient *http.Client) (Provider, error) {
+		return newSearXNGProvider(cfg, httpClient), nil
+	},
+	ProviderTavily: func(cfg config.Config, httpClient *http.Client) (Provider, error) {
+		return newTavilyProvider(cfg, httpClient), nil
+	},
+	ProviderStatic: func(cfg config.Config, _ *http.Client) (Provider, error) {
+		return newStaticProviderFromFile(cfg.SearchFixturePath)
+	},
+}
+
+// New builds the providers listed in cfg.SearchProviders, each spaced by its
+// own minimum interval between requests. Several providers are returned as a
+// Multi.
+func New(cfg config.Config, httpClient *http.Client) (Provider, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	names := providerNames(cfg.SearchProviders)
+	providers := make([]Provider, 0, len(names))
+	for _, name := range names {
+		build, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown search provider %q", name)
+		}
+		provider, err := build(cfg, httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		providers = append(providers, newSpacedProvider(provider, minInterval(cfg, name)))
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return Multi{providers: providers}, nil
+}
+
+// MinInterval returns the longest request spacing among the configured
+// providers.
+func MinInterval(cfg config.Config) time.Duration {
+	var longest time.Duration
+	for _, name := range providerNames(cfg.SearchProviders) {
+		longest = max(longest, minInterval(cfg, name))
+	}
+	return longest
+}
+
+func minInterval(cfg config.Config, name string) time.Duration {
+	switch name {
+	case ProviderBrave:
+		return millis(cfg.BraveMinIntervalMS)
+	case ProviderSearXNG:
+		return millis(cfg.SearXNGMinIntervalMS)
+	case ProviderTavily:
+		return millis(cfg.TavilyMinIntervalMS)
+	default:
+		return 0
+	}
+}
+
+func providerNames(raw []string) []string {
+	names := make([]string, 0, len(raw))
+	for _, item := range raw {
+		name := strings.ToLower(strings.TrimSpace(item))
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []string{ProviderBrave}
+	}
+	return names
+}
+
+func millis(value int) time.Duration {
+	if value <= 0 {
+		return 0
+	}
+	return time.Duration(value) * time.Millisecond
+}
+
+// normalizeResults trims fields, drops empty and duplicate URLs, falls back to
+// the URL for a missing title and stamps the provider name.
+func normalizeResults(provider string, raw []Result, count int) []Result {
+	results := make([]Result, 0, min(len(raw), count))
+	seenURLs := make(map[string]struct{}, len(raw))
+	for _, item := range raw {
+		rawURL := strings.TrimSpace(item.URL)
+		if rawURL == "" {
+			continue
+		}
+		if _, exists := seenURLs[rawURL]; exists {
+			continue
+		}
+		seenURLs[rawURL] = struct{}{}
+
+		title := strings.TrimSpace(item.Title)
+		if title == "" {
+			title = rawURL
+		}
+		results = append(results, Result{
+			URL:      rawURL,
+			Title:    title,
+			Snippet:  strings.TrimSpace(item.Snippet),
+			Provider: provider,
+		})
+		if len(results) >= count {
+			break
+		}
+	}
+	return results
+}
+
+func trimToWordLimit(input string, maxWords int) string {
+	if maxWords <= 0 {
+		return ""
+	}
+	words := strings.Fields(strings.TrimSpace(input))
+	if len(words) <= maxWords {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(words[:maxWords], " ")
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"chat/backend/internal/config"
+)
+
+func TestNewSelectsConfiguredProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[{"url":"https://example.com","title":"Example","content":"Snippet"}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := New(config.Config{SearchProviders: []string{"SearXNG"}, SearXNGBaseURL: server.URL, SearXNGMinIntervalMS: 5}, server.Client())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if provider.Name() != ProviderSearXNG {
+		t.Fatalf("expected searxng, got %s", provider.Name())
+	}
+	if _, ok := provider.(*spacedProvider); !ok {
+		t.Fatalf("expected the provider to be spaced by its configured interval, got %T", provider)
+	}
+	results, err := provider.Search(context.Background(), "example", 5)
+	if err != nil || len(results) != 1 || results[0].Provider != ProviderSearXNG {
+		t.Fatalf("unexpected results: %+v err=%v", results, err)
+	}
+
+	if _, err := New(config.Config{SearchProviders: []string{"bing"}}, nil); err == nil {
+		t.Fatal("expected an unknown provider to be rejected")
+	}
+}
+
+func TestBraveProviderMapsClientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":"rate limited"}`))
+	}))
+	defer server.Close()
+
+	provider := newBraveProvider(config.Config{BraveAPIKey: "brave-key", BraveBaseURL: server.URL}, server.Client())
+	_, err := provider.Search(context.Background(), "test", 3)
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || apiErr.Provider != ProviderBrave || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected a brave api error, got %v", err)
+	}
+
+	_, err = newBraveProvider(config.Config{BraveBaseURL: server.URL}, server.Client()).Search(context.Background(), "test", 3)
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("expected a not configured error, got %v", err)
+	}
+}
+
+func TestStaticProviderServesFixtureByQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	fixture := `{
+	  "Go release notes": [{"url":"https://go.dev/doc/devel/release","title":"Release History","snippet":"All Go releases"}],
+	  "*": [{"url":"https://example.com/fallback","title":"Fallback"}]
+	}`
+	if err := os.WriteFile(path, []byte(fixture), 0o600); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	provider, err := New(config.Config{SearchProviders: []string{ProviderStatic}, SearchFixturePath: path}, nil)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	results, err := provider.Search(context.Background(), "  go RELEASE   notes", 5)
+	if err != nil || len(results) != 1 || results[0].URL != "https://go.dev/doc/devel/release" || results[0].Provider != ProviderStatic {
+		t.Fatalf("unexpected results: %+v err=%v", results, err)
+	}
+	results, err = provider.Search(context.Background(), "anything else", 5)
+	if err != nil || len(results) != 1 || results[0].URL != "https://example.com/fallback" {
+		t.Fatalf("expected the fallback fixture, got %+v err=%v", results, err)
+	}
+
+	if _, err := New(config.Config{SearchProviders: []string{ProviderStatic}}, nil); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("expected a missing fixture path to be rejected, got %v", err)
+	}
+}
+
+func TestNewCombinesSeveralProvidersIntoMulti(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	if err := os.WriteFile(path, []byte(`{"*":[{"url":"https://example.com/static","title":"Static"}]}`), 0o600); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	provider, err := New(config.Config{
+		SearchProviders:   []string{ProviderTavily, ProviderStatic},
+		TavilyBaseURL:     "https://api.tavily.com",
+		SearchFixturePath: path,
+	}, nil)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	multi, ok := provider.(Multi)
+	if !ok || len(multi.Providers()) != 2 || multi.Name() != "tavily+static" {
+		t.Fatalf("expected a multi provider, got %T %v", provider, provider.Name())
+	}
+
+	// Tavily has no API key, so Search fails over to the fixture.
+	results, err := multi.Search(context.Background(), "anything", 5)
+	if err != nil || len(results) != 1 || results[0].Provider != ProviderStatic {
+		t.Fatalf("expected the static provider to answer, got %+v err=%v", results, err)
+	}
+}
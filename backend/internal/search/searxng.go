@@ -0,0 +1,97 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"chat/backend/internal/config"
+)
+
+// searxngProvider queries a SearXNG instance through its JSON output format,
+// which must be enabled in the instance's settings.yml.
+type searxngProvider struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+type searxngResponse struct {
+	Results []struct {
+		URL     string `json:"url"`
+		Title   string `json:"title"`
+		Content string `json:"content"`
+	} `json:"results"`
+}
+
+func newSearXNGProvider(cfg config.Config, httpClient *http.Client) searxngProvider {
+	return searxngProvider{
+		apiKey:     strings.TrimSpace(cfg.SearXNGAPIKey),
+		baseURL:    strings.TrimRight(strings.TrimSpace(cfg.SearXNGBaseURL), "/"),
+		httpClient: httpClient,
+	}
+}
+
+func (p searxngProvider) Name() string {
+	return ProviderSearXNG
+}
+
+func (p searxngProvider) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	if p.baseURL == "" {
+		return nil, fmt.Errorf("%w: SEARXNG_BASE_URL is empty", ErrNotConfigured)
+	}
+
+	trimmedQuery := trimToWordLimit(query, maxQueryWords)
+	if trimmedQuery == "" {
+		return nil, nil
+	}
+	if count <= 0 {
+		count = 5
+	}
+
+	endpoint, err := url.Parse(p.baseURL + "/search")
+	if err != nil {
+		return nil, fmt.Errorf("parse searxng endpoint: %w", err)
+	}
+	params := endpoint.Query()
+	params.Set("q", trimmedQuery)
+	params.Set("format", "json")
+	params.Set("pageno", "1")
+	params.Set("safesearch", "0")
+	endpoint.RawQuery = params.Encode()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("build searxng request: %w", err)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request searxng: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return nil, APIError{Provider: ProviderSearXNG, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	var parsed searxngResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("decode searxng response: %w", err)
+	}
+
+	raw := make([]Result, 0, len(parsed.Results))
+	for _, item := range parsed.Results {
+		raw = append(raw, Result{URL: item.URL, Title: item.Title, Snippet: item.Content})
+	}
+	return normalizeResults(ProviderSearXNG, raw, count), nil
+}
@@ -0,0 +1,74 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/config"
+)
+
+func TestSearXNGSearchNormalizesResults(t *testing.T) {
+	var receivedQuery, receivedFormat, receivedAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		receivedQuery = r.URL.Query().Get("q")
+		receivedFormat = r.URL.Query().Get("format")
+		receivedAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+		  "results": [
+		    {"url":"https://example.com/a","title":" Example A ","content":"Snippet A"},
+		    {"url":"https://example.com/a","title":"Duplicate","content":"Duplicate"},
+		    {"url":"","title":"Missing URL"},
+		    {"url":"https://example.com/b","title":"","content":"Snippet B"},
+		    {"url":"https://example.com/c","title":"Example C","content":"Snippet C"}
+		  ]
+		}`))
+	}))
+	defer server.Close()
+
+	provider := newSearXNGProvider(config.Config{SearXNGBaseURL: server.URL + "/", SearXNGAPIKey: "searx-key"}, server.Client())
+	results, err := provider.Search(context.Background(), "  latest   go release ", 2)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if receivedQuery != "latest go release" || receivedFormat != "json" || receivedAuth != "Bearer searx-key" {
+		t.Fatalf("unexpected request: q=%q format=%q auth=%q", receivedQuery, receivedFormat, receivedAuth)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected results capped at 2, got %+v", results)
+	}
+	if results[0] != (Result{URL: "https://example.com/a", Title: "Example A", Snippet: "Snippet A", Provider: ProviderSearXNG}) {
+		t.Fatalf("unexpected first result: %+v", results[0])
+	}
+	if results[1].URL != "https://example.com/b" || results[1].Title != "https://example.com/b" {
+		t.Fatalf("expected the url as fallback title, got %+v", results[1])
+	}
+}
+
+func TestSearXNGSearchReportsUpstreamErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("slow down"))
+	}))
+	defer server.Close()
+
+	provider := newSearXNGProvider(config.Config{SearXNGBaseURL: server.URL}, server.Client())
+	_, err := provider.Search(context.Background(), "test", 3)
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Provider != ProviderSearXNG {
+		t.Fatalf("expected a searxng api error, got %v", err)
+	}
+
+	_, err = newSearXNGProvider(config.Config{}, nil).Search(context.Background(), "test", 3)
+	if !errors.Is(err, ErrNotConfigured) || !strings.Contains(err.Error(), "SEARXNG_BASE_URL") {
+		t.Fatalf("expected a not configured error, got %v", err)
+	}
+}
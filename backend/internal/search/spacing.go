@@ -1,39 +1,43 @@
-package httpapi
+package search
 
 import (
 	"context"
 	"sync"
 	"time"
-
-	"chat/backend/internal/brave"
 )
 
-type rateLimitedGroundingSearcher struct {
-	inner       groundingSearcher
+// spacedProvider keeps at least minInterval between calls to inner, across
+// every caller sharing it.
+type spacedProvider struct {
+	inner       Provider
 	minInterval time.Duration
 
 	mu            sync.Mutex
 	nextAllowedAt time.Time
 }
 
-func newRateLimitedGroundingSearcher(inner groundingSearcher, minInterval time.Duration) groundingSearcher {
+func newSpacedProvider(inner Provider, minInterval time.Duration) Provider {
 	if inner == nil || minInterval <= 0 {
 		return inner
 	}
-	return &rateLimitedGroundingSearcher{
+	return &spacedProvider{
 		inner:       inner,
 		minInterval: minInterval,
 	}
 }
 
-func (s *rateLimitedGroundingSearcher) Search(ctx context.Context, query string, count int) ([]brave.SearchResult, error) {
+func (s *spacedProvider) Name() string {
+	return s.inner.Name()
+}
+
+func (s *spacedProvider) Search(ctx context.Context, query string, count int) ([]Result, error) {
 	if err := s.waitTurn(ctx); err != nil {
 		return nil, err
 	}
 	return s.inner.Search(ctx, query, count)
 }
 
-func (s *rateLimitedGroundingSearcher) waitTurn(ctx context.Context) error {
+func (s *spacedProvider) waitTurn(ctx context.Context) error {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -49,13 +53,15 @@ func (s *rateLimitedGroundingSearcher) waitTurn(ctx context.Context) error {
 		wait := time.Until(s.nextAllowedAt)
 		s.mu.Unlock()
 
-		if err := waitWithContext(ctx, wait); err != nil {
+		if err := Wait(ctx, wait); err != nil {
 			return err
 		}
 	}
 }
 
-func waitWithContext(ctx context.Context, delay time.Duration) error {
+// Wait sleeps for delay, returning early with the context's error if ctx is
+// done first. A non-positive delay returns immediately.
+func Wait(ctx context.Context, delay time.Duration) error {
 	if delay <= 0 {
 		return nil
 	}
@@ -1,4 +1,4 @@
-package httpapi
+package search
 
 import (
 	"context"
@@ -6,23 +6,25 @@ import (
 	"sync"
 	"testing"
 	"time"
-
-	"chat/backend/internal/brave"
 )
 
-type timedGroundingSearcher struct {
+type timedProvider struct {
 	mu        sync.Mutex
 	callTimes []time.Time
 }
 
-func (s *timedGroundingSearcher) Search(_ context.Context, _ string, _ int) ([]brave.SearchResult, error) {
+func (s *timedProvider) Name() string {
+	return "timed"
+}
+
+func (s *timedProvider) Search(_ context.Context, _ string, _ int) ([]Result, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.callTimes = append(s.callTimes, time.Now())
 	return nil, nil
 }
 
-func (s *timedGroundingSearcher) times() []time.Time {
+func (s *timedProvider) times() []time.Time {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	out := make([]time.Time, len(s.callTimes))
@@ -30,9 +32,9 @@ func (s *timedGroundingSearcher) times() []time.Time {
 	return out
 }
 
-func TestRateLimitedGroundingSearcherAppliesMinimumSpacing(t *testing.T) {
-	searcher := &timedGroundingSearcher{}
-	limited := newRateLimitedGroundingSearcher(searcher, 40*time.Millisecond)
+func TestSpacedProviderAppliesMinimumSpacing(t *testing.T) {
+	searcher := &timedProvider{}
+	limited := newSpacedProvider(searcher, 40*time.Millisecond)
 
 	if _, err := limited.Search(context.Background(), "one", 5); err != nil {
 		t.Fatalf("first search: %v", err)
@@ -50,9 +52,9 @@ func TestRateLimitedGroundingSearcherAppliesMinimumSpacing(t *testing.T) {
 	}
 }
 
-func TestRateLimitedGroundingSearcherHonorsContextCancel(t *testing.T) {
-	searcher := &timedGroundingSearcher{}
-	limited := newRateLimitedGroundingSearcher(searcher, 120*time.Millisecond)
+func TestSpacedProviderHonorsContextCancel(t *testing.T) {
+	searcher := &timedProvider{}
+	limited := newSpacedProvider(searcher, 120*time.Millisecond)
 
 	if _, err := limited.Search(context.Background(), "first", 5); err != nil {
 		t.Fatalf("first search: %v", err)
@@ -0,0 +1,71 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// staticFallbackQuery is the fixture key used for queries without their own
+// entry.
+const staticFallbackQuery = "*"
+
+type staticResult struct {
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	Snippet string `json:"snippet"`
+}
+
+// staticProvider serves canned results for offline development and tests.
+// Fixtures map a query to its results; lookups ignore case and extra spaces.
+type staticProvider struct {
+	results map[string][]Result
+}
+
+func newStaticProvider(fixture map[string][]staticResult) staticProvider {
+	results := make(map[string][]Result, len(fixture))
+	for query, items := range fixture {
+		raw := make([]Result, 0, len(items))
+		for _, item := range items {
+			raw = append(raw, Result{URL: item.URL, Title: item.Title, Snippet: item.Snippet})
+		}
+		results[normalizeStaticQuery(query)] = raw
+	}
+	return staticProvider{results: results}
+}
+
+func newStaticProviderFromFile(path string) (staticProvider, error) {
+	if strings.TrimSpace(path) == "" {
+		return staticProvider{}, fmt.Errorf("%w: SEARCH_STATIC_FIXTURE_PATH is empty", ErrNotConfigured)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return staticProvider{}, fmt.Errorf("read search fixture: %w", err)
+	}
+	var fixture map[string][]staticResult
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return staticProvider{}, fmt.Errorf("decode search fixture: %w", err)
+	}
+	return newStaticProvider(fixture), nil
+}
+
+func (p staticProvider) Name() string {
+	return ProviderStatic
+}
+
+func (p staticProvider) Search(_ context.Context, query string, count int) ([]Result, error) {
+	if count <= 0 {
+		count = 5
+	}
+	raw, ok := p.results[normalizeStaticQuery(query)]
+	if !ok {
+		raw = p.results[staticFallbackQuery]
+	}
+	return normalizeResults(ProviderStatic, raw, count), nil
+}
+
+func normalizeStaticQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
@@ -0,0 +1,100 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"chat/backend/internal/config"
+)
+
+// Tavily rejects queries longer than this many characters.
+const maxTavilyQueryRunes = 400
+
+type tavilyProvider struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+type tavilyRequest struct {
+	Query       string `json:"query"`
+	MaxResults  int    `json:"max_results"`
+	SearchDepth string `json:"search_depth"`
+}
+
+type tavilyResponse struct {
+	Results []struct {
+		URL     string  `json:"url"`
+		Title   string  `json:"title"`
+		Content string  `json:"content"`
+		Score   float64 `json:"score"`
+	} `json:"results"`
+}
+
+func newTavilyProvider(cfg config.Config, httpClient *http.Client) tavilyProvider {
+	return tavilyProvider{
+		apiKey:     strings.TrimSpace(cfg.TavilyAPIKey),
+		baseURL:    strings.TrimRight(strings.TrimSpace(cfg.TavilyBaseURL), "/"),
+		httpClient: httpClient,
+	}
+}
+
+func (p tavilyProvider) Name() string {
+	return ProviderTavily
+}
+
+func (p tavilyProvider) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("%w: TAVILY_API_KEY is empty", ErrNotConfigured)
+	}
+
+	trimmedQuery := trimToWordLimit(query, maxQueryWords)
+	if runes := []rune(trimmedQuery); len(runes) > maxTavilyQueryRunes {
+		trimmedQuery = strings.TrimSpace(string(runes[:maxTavilyQueryRunes]))
+	}
+	if trimmedQuery == "" {
+		return nil, nil
+	}
+	if count <= 0 {
+		count = 5
+	}
+
+	payload, err := json.Marshal(tavilyRequest{Query: trimmedQuery, MaxResults: count, SearchDepth: "basic"})
+	if err != nil {
+		return nil, fmt.Errorf("encode tavily request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/search", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("build tavily request: %w", err)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request tavily: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return nil, APIError{Provider: ProviderTavily, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	var parsed tavilyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("decode tavily response: %w", err)
+	}
+
+	raw := make([]Result, 0, len(parsed.Results))
+	for _, item := range parsed.Results {
+		raw = append(raw, Result{URL: item.URL, Title: item.Title, Snippet: item.Content})
+	}
+	return normalizeResults(ProviderTavily, raw, count), nil
+}
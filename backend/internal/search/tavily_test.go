@@ -0,0 +1,56 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/backend/internal/config"
+)
+
+func TestTavilySearchSendsQueryAndNormalizesResults(t *testing.T) {
+	var received tavilyRequest
+	var receivedAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/search" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		receivedAuth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+		  "query": "go 1.24",
+		  "results": [
+		    {"url":"https://go.dev/doc/go1.24","title":"Go 1.24 Release Notes","content":"Go 1.24 adds generic type aliases.","score":0.91},
+		    {"url":"https://go.dev/blog/go1.24","title":"Go 1.24 is released","content":"","score":0.7}
+		  ]
+		}`))
+	}))
+	defer server.Close()
+
+	provider := newTavilyProvider(config.Config{TavilyAPIKey: "tvly-key", TavilyBaseURL: server.URL}, server.Client())
+	results, err := provider.Search(context.Background(), "go 1.24", 4)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if receivedAuth != "Bearer tvly-key" || received.Query != "go 1.24" || received.MaxResults != 4 || received.SearchDepth != "basic" {
+		t.Fatalf("unexpected request: auth=%q body=%+v", receivedAuth, received)
+	}
+	if len(results) != 2 || results[0].Snippet != "Go 1.24 adds generic type aliases." || results[1].Provider != ProviderTavily {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
+
+func TestTavilySearchRequiresAPIKey(t *testing.T) {
+	_, err := newTavilyProvider(config.Config{TavilyBaseURL: "https://api.tavily.com"}, nil).Search(context.Background(), "test", 3)
+	if !errors.Is(err, ErrNotConfigured) || !strings.Contains(err.Error(), "TAVILY_API_KEY") {
+		t.Fatalf("expected a not configured error, got %v", err)
+	}
+}
@@ -14,16 +14,20 @@ import (
 	"github.com/google/uuid"
 )
 
-var ErrNotFound = errors.New("session not found")
+var (
+	ErrNotFound      = errors.New("session not found")
+	ErrAPITokenLimit = errors.New("api token limit reached")
+)
 
 type User struct {
-	ID        string `json:"id"`
-	Email     string `json:"email"`
-	Name      string `json:"name,omitempty"`
-	AvatarURL string `json:"avatarUrl,omitempty"`
-	GoogleSub string `json:"googleSub"`
-	CreatedAt string `json:"createdAt"`
-	UpdatedAt string `json:"updatedAt"`
+	ID                 string `json:"id"`
+	Email              string `json:"email"`
+	Name               string `json:"name,omitempty"`
+	AvatarURL          string `json:"avatarUrl,omitempty"`
+	GoogleSub          string `json:"googleSub"`
+	CreatedAt          string `json:"createdAt"`
+	UpdatedAt          string `json:"updatedAt"`
+	CustomInstructions string `json:"customInstructions"`
 }
 
 type Store struct {
@@ -44,7 +48,7 @@ ON CONFLICT(google_sub) DO UPDATE SET
   display_name = excluded.display_name,
   avatar_url = excluded.avatar_url,
   updated_at = CURRENT_TIMESTAMP
-RETURNING id, google_sub, email, COALESCE(display_name, ''), COALESCE(avatar_url, ''), created_at, updated_at;
+RETURNING id, google_sub, email, COALESCE(display_name, ''), COALESCE(avatar_url, ''), created_at, updated_at, custom_instructions;
 `
 
 	var out User
@@ -56,6 +60,7 @@ RETURNING id, google_sub, email, COALESCE(display_name, ''), COALESCE(avatar_url
 		&out.AvatarURL,
 		&out.CreatedAt,
 		&out.UpdatedAt,
+		&out.CustomInstructions,
 	); err != nil {
 		return User{}, fmt.Errorf("upsert user: %w", err)
 	}
@@ -81,7 +86,7 @@ func (s Store) CreateSession(ctx context.Context, userID string, ttl time.Durati
 
 func (s Store) ResolveSession(ctx context.Context, rawToken string) (User, error) {
 	query := `
-SELECT u.id, u.google_sub, u.email, COALESCE(u.display_name, ''), COALESCE(u.avatar_url, ''), u.created_at, u.updated_at
+SELECT u.id, u.google_sub, u.email, COALESCE(u.display_name, ''), COALESCE(u.avatar_url, ''), u.created_at, u.updated_at, u.custom_instructions
 FROM sessions s
 JOIN users u ON u.id = s.user_id
 WHERE s.token_hash = ? AND s.expires_at > CURRENT_TIMESTAMP
@@ -97,6 +102,7 @@ LIMIT 1;
 		&out.AvatarURL,
 		&out.CreatedAt,
 		&out.UpdatedAt,
+		&out.CustomInstructions,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return User{}, ErrNotFound
@@ -109,7 +115,7 @@ LIMIT 1;
 
 func (s Store) GetUserByEmail(ctx context.Context, email string) (User, error) {
 	query := `
-SELECT id, google_sub, email, COALESCE(display_name, ''), COALESCE(avatar_url, ''), created_at, updated_at
+SELECT id, google_sub, email, COALESCE(display_name, ''), COALESCE(avatar_url, ''), created_at, updated_at, custom_instructions
 FROM users
 WHERE email = ?
 LIMIT 1;
@@ -123,6 +129,7 @@ LIMIT 1;
 		&out.AvatarURL,
 		&out.CreatedAt,
 		&out.UpdatedAt,
+		&out.CustomInstructions,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return User{}, ErrNotFound
@@ -133,6 +140,33 @@ LIMIT 1;
 	return out, nil
 }
 
+func (s Store) UpdateCustomInstructions(ctx context.Context, userID, instructions string) (User, error) {
+	query := `
+UPDATE users
+SET custom_instructions = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, google_sub, email, COALESCE(display_name, ''), COALESCE(avatar_url, ''), created_at, updated_at, custom_instructions;
+`
+	var out User
+	err := s.db.QueryRowContext(ctx, query, instructions, userID).Scan(
+		&out.ID,
+		&out.GoogleSub,
+		&out.Email,
+		&out.Name,
+		&out.AvatarURL,
+		&out.CreatedAt,
+		&out.UpdatedAt,
+		&out.CustomInstructions,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("update custom instructions: %w", err)
+	}
+	return out, nil
+}
+
 func (s Store) DeleteSession(ctx context.Context, rawToken string) error {
 	if strings.TrimSpace(rawToken) == "" {
 		return nil
@@ -144,6 +178,130 @@ func (s Store) DeleteSession(ctx context.Context, rawToken string) error {
 	return nil
 }
 
+// APIToken is a bearer token for the OpenAI-compatible endpoints. The raw
+// value is only returned once, by CreateAPIToken.
+type APIToken struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	LastUsedAt *string `json:"lastUsedAt,omitempty"`
+	CreatedAt  string  `json:"createdAt"`
+}
+
+const apiTokenPrefix = "chat_"
+
+// CreateAPIToken issues a token for userID unless they already hold limit
+// tokens, in which case it returns ErrAPITokenLimit. The count and the insert
+// are one statement, so concurrent requests cannot overshoot the limit.
+func (s Store) CreateAPIToken(ctx context.Context, userID, name string, limit int) (APIToken, string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return APIToken{}, "", fmt.Errorf("generate api token: %w", err)
+	}
+	rawToken := apiTokenPrefix + secret
+
+	var out APIToken
+	err = s.db.QueryRowContext(ctx, `
+INSERT INTO api_tokens (id, user_id, name, token_hash)
+SELECT ?, ?, ?, ?
+WHERE (SELECT COUNT(*) FROM api_tokens WHERE user_id = ?) < ?
+RETURNING id, name, created_at;
+`, uuid.NewString(), userID, strings.TrimSpace(name), hashToken(rawToken), userID, limit).Scan(&out.ID, &out.Name, &out.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIToken{}, "", ErrAPITokenLimit
+	}
+	if err != nil {
+		return APIToken{}, "", fmt.Errorf("create api token: %w", err)
+	}
+	return out, rawToken, nil
+}
+
+func (s Store) ListAPITokens(ctx context.Context, userID string) ([]APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, name, last_used_at, created_at
+FROM api_tokens
+WHERE user_id = ?
+ORDER BY created_at DESC, rowid DESC;
+`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := make([]APIToken, 0, 4)
+	for rows.Next() {
+		var token APIToken
+		var lastUsedAt sql.NullString
+		if err := rows.Scan(&token.ID, &token.Name, &lastUsedAt, &token.CreatedAt); err != nil {
+			return nil, fmt.Errorf("list api tokens: %w", err)
+		}
+		if lastUsedAt.Valid {
+			token.LastUsedAt = &lastUsedAt.String
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (s Store) DeleteAPIToken(ctx context.Context, userID, tokenID string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ? AND user_id = ?;`, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("delete api token: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete api token: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ResolveAPIToken returns the owner of rawToken and the token's id, and
+// records the use. last_used_at is only rewritten once it is more than a
+// minute old, so a busy token does not write on every request.
+func (s Store) ResolveAPIToken(ctx context.Context, rawToken string) (User, string, error) {
+	query := `
+SELECT t.id, u.id, u.google_sub, u.email, COALESCE(u.display_name, ''), COALESCE(u.avatar_url, ''), u.created_at, u.updated_at, u.custom_instructions
+FROM api_tokens t
+JOIN users u ON u.id = t.user_id
+WHERE t.token_hash = ?
+LIMIT 1;
+`
+
+	var tokenID string
+	var out User
+	err := s.db.QueryRowContext(ctx, query, hashToken(rawToken)).Scan(
+		&tokenID,
+		&out.ID,
+		&out.GoogleSub,
+		&out.Email,
+		&out.Name,
+		&out.AvatarURL,
+		&out.CreatedAt,
+		&out.UpdatedAt,
+		&out.CustomInstructions,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, "", ErrNotFound
+	}
+	if err != nil {
+		return User{}, "", fmt.Errorf("resolve api token: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+UPDATE api_tokens
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND (last_used_at IS NULL OR last_used_at < datetime('now', '-1 minute'));
+`, tokenID); err != nil {
+		return User{}, "", fmt.Errorf("resolve api token: %w", err)
+	}
+	return out, tokenID, nil
+}
+
 func randomToken(n int) (string, error) {
 	b := make([]byte, n)
 	if _, err := rand.Read(b); err != nil {
@@ -7,7 +7,8 @@ CREATE TABLE IF NOT EXISTS users (
   display_name TEXT,
   avatar_url TEXT,
   created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  custom_instructions TEXT NOT NULL DEFAULT ''
 );
 
 CREATE TABLE IF NOT EXISTS sessions (
@@ -34,7 +35,8 @@ CREATE TABLE IF NOT EXISTS models (
   curated INTEGER NOT NULL DEFAULT 0,
   is_active INTEGER NOT NULL DEFAULT 1,
   created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  input_modalities_json TEXT
 );
 
 CREATE INDEX IF NOT EXISTS idx_models_curated ON models(curated);
@@ -69,16 +71,38 @@ CREATE TABLE IF NOT EXISTS user_model_reasoning_presets (
   FOREIGN KEY (model_id) REFERENCES models(id) ON DELETE CASCADE
 );
 
+CREATE TABLE IF NOT EXISTS user_model_sampling_presets (
+  user_id TEXT NOT NULL,
+  model_id TEXT NOT NULL,
+  mode TEXT NOT NULL CHECK (mode IN ('chat', 'deep_research')),
+  temperature REAL,
+  top_p REAL,
+  max_tokens INTEGER,
+  stop_json TEXT,
+  seed INTEGER,
+  presence_penalty REAL,
+  frequency_penalty REAL,
+  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, model_id, mode),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (model_id) REFERENCES models(id) ON DELETE CASCADE
+);
+
 CREATE TABLE IF NOT EXISTS conversations (
   id TEXT PRIMARY KEY,
   user_id TEXT NOT NULL,
   title TEXT NOT NULL DEFAULT 'New Chat',
   created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
   updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  active_leaf_message_id TEXT REFERENCES messages(id) ON DELETE SET NULL,
+  system_prompt TEXT NOT NULL DEFAULT '',
+  title_locked INTEGER NOT NULL DEFAULT 0,
+  search_rowid INTEGER,
   FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
 CREATE INDEX IF NOT EXISTS idx_conversations_user_updated ON conversations(user_id, updated_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_search_rowid ON conversations(search_rowid);
 
 CREATE TABLE IF NOT EXISTS messages (
   id TEXT PRIMARY KEY,
@@ -101,12 +125,29 @@ CREATE TABLE IF NOT EXISTS messages (
   grounding_enabled INTEGER NOT NULL DEFAULT 1,
   deep_research_enabled INTEGER NOT NULL DEFAULT 0,
   created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  parent_message_id TEXT REFERENCES messages(id) ON DELETE CASCADE,
+  tool_call_id TEXT,
+  tool_name TEXT,
+  tool_arguments_json TEXT,
+  structured_output_json TEXT,
+  search_rowid INTEGER,
+  path_position INTEGER,
   FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
   FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
   FOREIGN KEY (model_id) REFERENCES models(id) ON DELETE SET NULL
 );
 
 CREATE INDEX IF NOT EXISTS idx_messages_conversation_created ON messages(conversation_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_parent ON messages(conversation_id, parent_message_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_search_rowid ON messages(search_rowid);
+
+CREATE TRIGGER IF NOT EXISTS messages_path_position_after_insert AFTER INSERT ON messages
+WHEN new.path_position IS NULL
+BEGIN
+  UPDATE messages
+  SET path_position = COALESCE((SELECT parent.path_position FROM messages parent WHERE parent.id = new.parent_message_id), 0) + 1
+  WHERE rowid = new.rowid;
+END;
 
 CREATE TABLE IF NOT EXISTS citations (
   id TEXT PRIMARY KEY,
@@ -115,6 +156,7 @@ CREATE TABLE IF NOT EXISTS citations (
   title TEXT,
   snippet TEXT,
   source_provider TEXT,
+  source_providers_json TEXT,
   created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
   FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
 );
@@ -131,10 +173,12 @@ CREATE TABLE IF NOT EXISTS files (
   storage_path TEXT NOT NULL,
   extracted_text TEXT,
   created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  search_rowid INTEGER,
   FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
 CREATE INDEX IF NOT EXISTS idx_files_user_created ON files(user_id, created_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_files_search_rowid ON files(search_rowid);
 
 CREATE TABLE IF NOT EXISTS message_files (
   message_id TEXT NOT NULL,
@@ -146,3 +190,124 @@ CREATE TABLE IF NOT EXISTS message_files (
 );
 
 CREATE INDEX IF NOT EXISTS idx_message_files_file_id ON message_files(file_id);
+
+CREATE TABLE IF NOT EXISTS conversation_summaries (
+  conversation_id TEXT NOT NULL,
+  through_message_id TEXT NOT NULL,
+  content TEXT NOT NULL,
+  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  prompt_tokens INTEGER NOT NULL DEFAULT 0,
+  completion_tokens INTEGER NOT NULL DEFAULT 0,
+  cost_microusd INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (conversation_id, through_message_id),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+  FOREIGN KEY (through_message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS message_comparisons (
+  user_message_id TEXT PRIMARY KEY,
+  conversation_id TEXT NOT NULL,
+  model_ids_json TEXT NOT NULL,
+  winner_message_id TEXT,
+  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_message_id) REFERENCES messages(id) ON DELETE CASCADE,
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+  FOREIGN KEY (winner_message_id) REFERENCES messages(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id TEXT PRIMARY KEY,
+  user_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  conversation_id TEXT,
+  last_used_at TEXT,
+  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS research_cache (
+  cache_key TEXT PRIMARY KEY,
+  value TEXT NOT NULL,
+  size_bytes INTEGER NOT NULL,
+  created_at TEXT NOT NULL,
+  expires_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_research_cache_expires_at ON research_cache(expires_at);
+CREATE INDEX IF NOT EXISTS idx_research_cache_created_at ON research_cache(created_at);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+  content,
+  content = 'messages',
+  content_rowid = 'search_rowid',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_insert AFTER INSERT ON messages BEGIN
+  UPDATE messages
+  SET search_rowid = (SELECT COALESCE(MAX(search_rowid), 0) + 1 FROM messages)
+  WHERE rowid = new.rowid AND search_rowid IS NULL;
+  INSERT INTO messages_fts (rowid, content)
+  SELECT search_rowid, new.content FROM messages WHERE rowid = new.rowid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_delete AFTER DELETE ON messages BEGIN
+  INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.search_rowid, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_update AFTER UPDATE OF content ON messages BEGIN
+  INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.search_rowid, old.content);
+  INSERT INTO messages_fts (rowid, content) VALUES (new.search_rowid, new.content);
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS conversations_fts USING fts5(
+  title,
+  content = 'conversations',
+  content_rowid = 'search_rowid',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS conversations_fts_after_insert AFTER INSERT ON conversations BEGIN
+  UPDATE conversations
+  SET search_rowid = (SELECT COALESCE(MAX(search_rowid), 0) + 1 FROM conversations)
+  WHERE rowid = new.rowid AND search_rowid IS NULL;
+  INSERT INTO conversations_fts (rowid, title)
+  SELECT search_rowid, new.title FROM conversations WHERE rowid = new.rowid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS conversations_fts_after_delete AFTER DELETE ON conversations BEGIN
+  INSERT INTO conversations_fts (conversations_fts, rowid, title) VALUES ('delete', old.search_rowid, old.title);
+END;
+
+CREATE TRIGGER IF NOT EXISTS conversations_fts_after_update AFTER UPDATE OF title ON conversations BEGIN
+  INSERT INTO conversations_fts (conversations_fts, rowid, title) VALUES ('delete', old.search_rowid, old.title);
+  INSERT INTO conversations_fts (rowid, title) VALUES (new.search_rowid, new.title);
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(
+  extracted_text,
+  content = 'files',
+  content_rowid = 'search_rowid',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS files_fts_after_insert AFTER INSERT ON files BEGIN
+  UPDATE files
+  SET search_rowid = (SELECT COALESCE(MAX(search_rowid), 0) + 1 FROM files)
+  WHERE rowid = new.rowid AND search_rowid IS NULL;
+  INSERT INTO files_fts (rowid, extracted_text)
+  SELECT search_rowid, COALESCE(new.extracted_text, '') FROM files WHERE rowid = new.rowid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS files_fts_after_delete AFTER DELETE ON files BEGIN
+  INSERT INTO files_fts (files_fts, rowid, extracted_text) VALUES ('delete', old.search_rowid, COALESCE(old.extracted_text, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS files_fts_after_update AFTER UPDATE OF extracted_text ON files BEGIN
+  INSERT INTO files_fts (files_fts, rowid, extracted_text) VALUES ('delete', old.search_rowid, COALESCE(old.extracted_text, ''));
+  INSERT INTO files_fts (rowid, extracted_text) VALUES (new.search_rowid, COALESCE(new.extracted_text, ''));
+END;
@@ -15,7 +15,7 @@ fi
 
 SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
 REPO_ROOT="$(cd "${SCRIPT_DIR}/.." && pwd)"
-MIGRATIONS_DIR="${REPO_ROOT}/db/migrations"
+MIGRATIONS_DIR="${REPO_ROOT}/backend/internal/db/migrations"
 
 echo "Applying migrations to Turso database '${DB_NAME}'"
 for file in "${MIGRATIONS_DIR}"/*.sql; do